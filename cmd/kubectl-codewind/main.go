@@ -0,0 +1,241 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/eclipse/codewind-operator/pkg/apis"
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `kubectl-codewind lists Codewind instances, prints how to connect an IDE to them, and suspends or resumes them.
+
+Usage:
+  kubectl codewind list [-n namespace | -A]
+  kubectl codewind connection NAME [-n namespace] [-o json]
+  kubectl codewind suspend NAME [-n namespace]
+  kubectl codewind resume NAME [-n namespace]
+`
+
+// connectionDetails : What an IDE needs to connect to a Codewind instance
+type connectionDetails struct {
+	Name           string                         `json:"name"`
+	Namespace      string                         `json:"namespace"`
+	Phase          codewindv1alpha1.CodewindPhase `json:"phase,omitempty"`
+	Username       string                         `json:"username,omitempty"`
+	WorkspaceID    string                         `json:"workspaceID,omitempty"`
+	AccessURL      string                         `json:"accessURL"`
+	PerformanceURL string                         `json:"performanceURL,omitempty"`
+	AuthURL        string                         `json:"authURL,omitempty"`
+	Realm          string                         `json:"realm,omitempty"`
+	ClientID       string                         `json:"clientID,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run : Runs a command against the cluster of the current kubeconfig context. Returns the process exit code, 2 for
+// invalid arguments and 1 when the command failed
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	command := args[0]
+	var namespace, output string
+	var allNamespaces bool
+	flags := pflag.NewFlagSet("kubectl-codewind "+command, pflag.ContinueOnError)
+	flags.StringVarP(&namespace, "namespace", "n", "", "Namespace of the instances, defaults to the namespace of the kubeconfig context")
+	switch command {
+	case "list":
+		flags.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List the instances of every namespace")
+	case "connection":
+		flags.StringVarP(&output, "output", "o", "", "Output format, json for an IDE or a script")
+	case "suspend", "resume":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	names := flags.Args()
+	if (command == "list" && len(names) != 0) || (command != "list" && len(names) != 1) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if output != "" && output != "json" {
+		fmt.Fprintln(os.Stderr, "--output must be json")
+		return 2
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+	if namespace == "" {
+		contextNamespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		namespace = contextNamespace
+	}
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	scheme := runtime.NewScheme()
+	if err := apis.AddToScheme(scheme); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch command {
+	case "list":
+		if allNamespaces {
+			namespace = ""
+		}
+		err = listCodewinds(c, namespace)
+	case "connection":
+		err = printConnection(c, namespace, names[0], output)
+	case "suspend":
+		err = setSuspended(c, namespace, names[0], true)
+	case "resume":
+		err = setSuspended(c, namespace, names[0], false)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listCodewinds : Prints a table of the instances of the namespace, of every namespace when it is empty
+func listCodewinds(c client.Client, namespace string) error {
+	codewinds := &codewindv1alpha1.CodewindList{}
+	if err := c.List(context.TODO(), codewinds, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	if len(codewinds.Items) == 0 {
+		if namespace == "" {
+			fmt.Fprintln(os.Stderr, "No Codewind instances found")
+		} else {
+			fmt.Fprintf(os.Stderr, "No Codewind instances found in namespace %s\n", namespace)
+		}
+		return nil
+	}
+	sort.Slice(codewinds.Items, func(i, j int) bool {
+		if codewinds.Items[i].Namespace != codewinds.Items[j].Namespace {
+			return codewinds.Items[i].Namespace < codewinds.Items[j].Namespace
+		}
+		return codewinds.Items[i].Name < codewinds.Items[j].Name
+	})
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	if namespace == "" {
+		fmt.Fprint(table, "NAMESPACE\t")
+	}
+	fmt.Fprintln(table, "NAME\tUSERNAME\tPHASE\tVERSION\tACCESS URL")
+	for _, codewind := range codewinds.Items {
+		if namespace == "" {
+			fmt.Fprintf(table, "%s\t", codewind.Namespace)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", codewind.Name, codewind.Spec.Username, orNone(string(codewind.Status.Phase)),
+			orNone(codewind.Status.Version), orNone(codewind.Status.AccessURL))
+	}
+	return table.Flush()
+}
+
+// printConnection : Prints the gatekeeper URL, realm and client an IDE connects to the instance with
+func printConnection(c client.Client, namespace string, name string, output string) error {
+	codewind := &codewindv1alpha1.Codewind{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, codewind); err != nil {
+		return err
+	}
+	if codewind.Status.AccessURL == "" {
+		return fmt.Errorf("Codewind %s has not published its access URL yet, its phase is %s", name, orNone(string(codewind.Status.Phase)))
+	}
+	details := connectionDetails{
+		Name:           codewind.Name,
+		Namespace:      codewind.Namespace,
+		Phase:          codewind.Status.Phase,
+		Username:       codewind.Spec.Username,
+		WorkspaceID:    codewind.Annotations[codewindv1alpha1.WorkspaceIDAnnotation],
+		AccessURL:      codewind.Status.AccessURL,
+		PerformanceURL: codewind.Status.PerformanceURL,
+		AuthURL:        codewind.Status.AuthURL,
+		Realm:          codewind.Status.Realm,
+		ClientID:       codewind.Status.ClientID,
+	}
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(details)
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Name:\t%s/%s\n", details.Namespace, details.Name)
+	fmt.Fprintf(table, "Phase:\t%s\n", orNone(string(details.Phase)))
+	fmt.Fprintf(table, "Username:\t%s\n", orNone(details.Username))
+	fmt.Fprintf(table, "Access URL:\t%s\n", details.AccessURL)
+	fmt.Fprintf(table, "Performance URL:\t%s\n", orNone(details.PerformanceURL))
+	fmt.Fprintf(table, "Auth URL:\t%s\n", orNone(details.AuthURL))
+	fmt.Fprintf(table, "Realm:\t%s\n", orNone(details.Realm))
+	fmt.Fprintf(table, "Client ID:\t%s\n", orNone(details.ClientID))
+	return table.Flush()
+}
+
+// setSuspended : Suspends or resumes the instance through the suspended field of its spec, the operator scales the
+// deployments
+func setSuspended(c client.Client, namespace string, name string, suspended bool) error {
+	codewind := &codewindv1alpha1.Codewind{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, codewind); err != nil {
+		return err
+	}
+	action := "suspended"
+	if !suspended {
+		action = "resumed"
+	}
+	if codewind.Spec.Suspended == suspended {
+		fmt.Printf("codewind/%s is already %s\n", name, action)
+		return nil
+	}
+	original := codewind.DeepCopy()
+	codewind.Spec.Suspended = suspended
+	if err := c.Patch(context.TODO(), codewind, client.MergeFrom(original)); err != nil {
+		return err
+	}
+	fmt.Printf("codewind/%s %s\n", name, action)
+	return nil
+}
+
+// orNone : Shows empty values as <none>, as kubectl does
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
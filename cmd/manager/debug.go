@@ -0,0 +1,74 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// debugAddressEnvVar : Environment variable enabling the debug server when --debug-address is not set
+const debugAddressEnvVar = "CODEWIND_OPERATOR_DEBUG_ADDRESS"
+
+// debugServer : Serves pprof profiles and runtime statistics of the operator. It runs in every replica,
+// including those waiting for the leader election lock
+type debugServer struct {
+	address string
+}
+
+// NeedLeaderElection : The debug server also runs in replicas that are not the leader
+func (s *debugServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start : Serves the debug endpoints until the manager stops
+func (s *debugServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Addr: s.address, Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Info("Serving the debug endpoints", "address", s.address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errs <- err
+		}
+		close(errs)
+	}()
+	select {
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	case err := <-errs:
+		return err
+	}
+}
+
+func init() {
+	// Runtime statistics served on /debug/vars next to the memstats and cmdline published by expvar
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("gomaxprocs", expvar.Func(func() interface{} {
+		return runtime.GOMAXPROCS(0)
+	}))
+}
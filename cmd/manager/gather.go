@@ -0,0 +1,447 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/apis"
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/eclipse/codewind-operator/version"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// gatherer : Writes the resources, events and logs of the Codewind and Keycloak instances into a tar archive.
+// Failures to collect a resource are recorded in the archive instead of stopping the collection
+type gatherer struct {
+	client    client.Client
+	clientset kubernetes.Interface
+	archive   *tar.Writer
+	directory string
+	logsSince time.Duration
+	written   map[string]bool
+	failures  []string
+}
+
+// runGather : Bundles the Codewind and Keycloak CRs, the resources the operator creates for them, secret metadata,
+// recent events and the operator logs into a gzipped tar archive for support tickets. Secret values and config map
+// data, except the operator config map, are never collected. Returns the process exit code, 1 when some resources
+// could not be collected.
+func runGather(args []string) int {
+	var namespaces []string
+	var operatorNamespace, output string
+	var logsSince time.Duration
+	var podLogs bool
+	flags := pflag.NewFlagSet("gather", pflag.ContinueOnError)
+	flags.StringSliceVar(&namespaces, "namespace", nil, "Namespaces to collect, defaults to the namespaces holding Codewind or Keycloak CRs")
+	flags.StringVar(&operatorNamespace, "operator-namespace", util.GetOperatorNamespace(), "Namespace of the operator deployment")
+	flags.StringVar(&output, "output", "", "Archive to write, - for stdout. Defaults to codewind-gather-<time>.tar.gz")
+	flags.DurationVar(&logsSince, "logs-since", 24*time.Hour, "Only collect log lines newer than this, 0 for all")
+	flags.BoolVar(&podLogs, "pod-logs", false, "Also collect the logs of the Codewind and Keycloak pods")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, apis.AddToScheme, routev1.AddToScheme} {
+		if err := addToScheme(scheme); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	started := time.Now().UTC()
+	directory := "codewind-gather-" + started.Format("20060102-150405")
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		if output == "" {
+			output = directory + ".tar.gz"
+		}
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer file.Close()
+		out = file
+	}
+	compressed := gzip.NewWriter(out)
+	g := &gatherer{client: c, clientset: clientset, archive: tar.NewWriter(compressed), directory: directory, logsSince: logsSince, written: map[string]bool{}}
+
+	if len(namespaces) == 0 {
+		namespaces = g.instanceNamespaces()
+	}
+	namespaces = appendMissing(namespaces, operatorNamespace)
+	sort.Strings(namespaces)
+	var codewinds []codewindv1alpha1.Codewind
+	var keycloaks []codewindv1alpha1.Keycloak
+	for _, namespace := range namespaces {
+		namespaceCodewinds, namespaceKeycloaks := g.gatherNamespace(namespace, podLogs)
+		codewinds = append(codewinds, namespaceCodewinds...)
+		keycloaks = append(keycloaks, namespaceKeycloaks...)
+	}
+	g.gatherOperator(operatorNamespace)
+	g.add("summary.txt", []byte(gatherSummary(started, namespaces, codewinds, keycloaks, g.failures)))
+	if len(g.failures) > 0 {
+		g.add("failures.txt", []byte(strings.Join(g.failures, "\n")+"\n"))
+	}
+
+	if err := g.archive.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := compressed.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if output != "-" {
+		fmt.Fprintln(os.Stderr, "Wrote "+output)
+	}
+	if len(g.failures) > 0 {
+		fmt.Fprintf(os.Stderr, "%d resources could not be collected, see failures.txt in the archive\n", len(g.failures))
+		return 1
+	}
+	return 0
+}
+
+// instanceNamespaces : The namespaces holding Codewind or Keycloak CRs across the cluster
+func (g *gatherer) instanceNamespaces() []string {
+	namespaces := []string{}
+	codewinds := &codewindv1alpha1.CodewindList{}
+	if err := g.client.List(context.TODO(), codewinds); err != nil {
+		g.failed("listing Codewind CRs in all namespaces, use --namespace", err)
+	}
+	for _, codewind := range codewinds.Items {
+		namespaces = appendMissing(namespaces, codewind.Namespace)
+	}
+	keycloaks := &codewindv1alpha1.KeycloakList{}
+	if err := g.client.List(context.TODO(), keycloaks); err != nil {
+		g.failed("listing Keycloak CRs in all namespaces, use --namespace", err)
+	}
+	for _, keycloak := range keycloaks.Items {
+		namespaces = appendMissing(namespaces, keycloak.Namespace)
+	}
+	return namespaces
+}
+
+// gatherNamespace : Collects the CRs, workloads, networking, volumes, secret and config map metadata and events of
+// a namespace. Returns the Codewind and Keycloak CRs for the summary
+func (g *gatherer) gatherNamespace(namespace string, podLogs bool) ([]codewindv1alpha1.Codewind, []codewindv1alpha1.Keycloak) {
+	codewinds := &codewindv1alpha1.CodewindList{}
+	g.gatherList(namespace, "codewinds", codewinds)
+	keycloaks := &codewindv1alpha1.KeycloakList{}
+	g.gatherList(namespace, "keycloaks", keycloaks)
+	g.gatherList(namespace, "deployments", &appsv1.DeploymentList{})
+	g.gatherList(namespace, "replicasets", &appsv1.ReplicaSetList{})
+	pods := &v1.PodList{}
+	g.gatherList(namespace, "pods", pods)
+	g.gatherList(namespace, "services", &v1.ServiceList{})
+	g.gatherList(namespace, "ingresses", &extv1beta1.IngressList{})
+	g.gatherList(namespace, "routes", &routev1.RouteList{})
+	g.gatherList(namespace, "networkpolicies", &networkingv1.NetworkPolicyList{})
+	g.gatherList(namespace, "persistentvolumeclaims", &v1.PersistentVolumeClaimList{})
+	g.gatherSecrets(namespace)
+	g.gatherConfigMaps(namespace)
+	g.gatherEvents(namespace)
+	if podLogs {
+		g.gatherPodLogs(pods.Items)
+	}
+	return codewinds.Items, keycloaks.Items
+}
+
+// gatherOperator : Collects the current and previous logs of the operator pods
+func (g *gatherer) gatherOperator(namespace string) {
+	pods := &v1.PodList{}
+	err := g.client.List(context.TODO(), pods, client.InNamespace(namespace), client.MatchingLabels{"name": "codewind-operator"})
+	if err != nil {
+		g.failed("listing the operator pods in "+namespace, err)
+		return
+	}
+	g.gatherPodLogs(pods.Items)
+}
+
+// gatherList : Lists a resource in a namespace and writes it as JSON. Resources the cluster does not serve, such
+// as routes outside OpenShift, are skipped
+func (g *gatherer) gatherList(namespace string, resource string, list runtime.Object) {
+	err := g.client.List(context.TODO(), list, client.InNamespace(namespace))
+	if meta.IsNoMatchError(err) {
+		return
+	}
+	if err != nil {
+		g.failed("listing "+resource+" in "+namespace, err)
+		return
+	}
+	// The field ownership of every object is noise in a support bundle
+	meta.EachListItem(list, func(object runtime.Object) error {
+		if accessor, err := meta.Accessor(object); err == nil {
+			accessor.SetManagedFields(nil)
+		}
+		return nil
+	})
+	g.addJSON(namespace+"/"+resource+".json", list)
+}
+
+// objectSummary : The metadata of a secret or config map and the size of each of its keys, without the values
+type objectSummary struct {
+	Name            string            `json:"name"`
+	Type            string            `json:"type,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	OwnerReferences []string          `json:"ownerReferences,omitempty"`
+	Created         time.Time         `json:"created"`
+	KeySizes        map[string]int    `json:"keySizes"`
+}
+
+// summarizeObject : The metadata of an object without the annotations that may copy its data
+func summarizeObject(object metav1.Object, objectType string) objectSummary {
+	annotations := map[string]string{}
+	for key, value := range object.GetAnnotations() {
+		if key != "kubectl.kubernetes.io/last-applied-configuration" {
+			annotations[key] = value
+		}
+	}
+	owners := []string{}
+	for _, owner := range object.GetOwnerReferences() {
+		owners = append(owners, owner.Kind+"/"+owner.Name)
+	}
+	return objectSummary{
+		Name:            object.GetName(),
+		Type:            objectType,
+		Labels:          object.GetLabels(),
+		Annotations:     annotations,
+		OwnerReferences: owners,
+		Created:         object.GetCreationTimestamp().Time,
+		KeySizes:        map[string]int{},
+	}
+}
+
+// gatherSecrets : Writes the metadata and key sizes of the secrets of a namespace, never their values
+func (g *gatherer) gatherSecrets(namespace string) {
+	secrets := &v1.SecretList{}
+	err := g.client.List(context.TODO(), secrets, client.InNamespace(namespace))
+	if err != nil {
+		g.failed("listing secrets in "+namespace, err)
+		return
+	}
+	summaries := []objectSummary{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		summary := summarizeObject(secret, string(secret.Type))
+		for key, value := range secret.Data {
+			summary.KeySizes[key] = len(value)
+		}
+		summaries = append(summaries, summary)
+	}
+	g.addJSON(namespace+"/secrets.json", summaries)
+}
+
+// gatherConfigMaps : Writes the operator config map as it is, and the metadata and key sizes of the other config maps
+// of a namespace, which may hold realm exports
+func (g *gatherer) gatherConfigMaps(namespace string) {
+	configMaps := &v1.ConfigMapList{}
+	err := g.client.List(context.TODO(), configMaps, client.InNamespace(namespace))
+	if err != nil {
+		g.failed("listing config maps in "+namespace, err)
+		return
+	}
+	summaries := []objectSummary{}
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		if configMap.Name == defaults.OperatorConfigMapName {
+			configMap.ManagedFields = nil
+			g.addJSON(namespace+"/"+defaults.OperatorConfigMapName+".json", configMap)
+			continue
+		}
+		summary := summarizeObject(configMap, "")
+		for key, value := range configMap.Data {
+			summary.KeySizes[key] = len(value)
+		}
+		for key, value := range configMap.BinaryData {
+			summary.KeySizes[key] = len(value)
+		}
+		summaries = append(summaries, summary)
+	}
+	g.addJSON(namespace+"/configmaps.json", summaries)
+}
+
+// gatherEvents : Writes the events of a namespace, oldest first
+func (g *gatherer) gatherEvents(namespace string) {
+	events := &v1.EventList{}
+	err := g.client.List(context.TODO(), events, client.InNamespace(namespace))
+	if err != nil {
+		g.failed("listing events in "+namespace, err)
+		return
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+	})
+	lines := []string{}
+	for i := range events.Items {
+		event := &events.Items[i]
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s/%s\tx%d\t%s",
+			eventTime(event).UTC().Format(time.RFC3339), event.Type, event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Count, event.Message))
+	}
+	g.add(namespace+"/events.txt", []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// eventTime : The last time an event was seen
+func eventTime(event *v1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+// gatherPodLogs : Writes the logs of every container of the pods, and the logs of the previous run of containers
+// that restarted
+func (g *gatherer) gatherPodLogs(pods []v1.Pod) {
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			g.gatherContainerLog(pod, status.Name, false)
+			if status.RestartCount > 0 {
+				g.gatherContainerLog(pod, status.Name, true)
+			}
+		}
+	}
+}
+
+// gatherContainerLog : Writes the log of one container, limited to the lines newer than --logs-since
+func (g *gatherer) gatherContainerLog(pod v1.Pod, container string, previous bool) {
+	options := &v1.PodLogOptions{Container: container, Previous: previous, Timestamps: true}
+	if g.logsSince > 0 {
+		sinceSeconds := int64(g.logsSince.Seconds())
+		options.SinceSeconds = &sinceSeconds
+	}
+	name := pod.Namespace + "/logs/" + pod.Name + "-" + container + ".log"
+	if previous {
+		name = pod.Namespace + "/logs/" + pod.Name + "-" + container + ".previous.log"
+	}
+	if g.written[name] {
+		return
+	}
+	stream, err := g.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Stream()
+	if err != nil {
+		g.failed("reading the log of "+pod.Namespace+"/"+pod.Name+" container "+container, err)
+		return
+	}
+	defer stream.Close()
+	podLog, err := ioutil.ReadAll(stream)
+	if err != nil {
+		g.failed("reading the log of "+pod.Namespace+"/"+pod.Name+" container "+container, err)
+		return
+	}
+	g.add(name, podLog)
+}
+
+// gatherSummary : A readable overview of the instances, their phase and their conditions
+func gatherSummary(started time.Time, namespaces []string, codewinds []codewindv1alpha1.Codewind, keycloaks []codewindv1alpha1.Keycloak, failures []string) string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Collected %s by codewind-operator %s\n", started.Format(time.RFC3339), version.Version)
+	fmt.Fprintf(&summary, "Namespaces: %s\n", strings.Join(namespaces, ", "))
+	fmt.Fprintf(&summary, "Resources that could not be collected: %d\n", len(failures))
+	for _, keycloak := range keycloaks {
+		fmt.Fprintf(&summary, "\nKeycloak %s/%s\n  phase: %s\n  url: %s\n  realm: %s\n", keycloak.Namespace, keycloak.Name, keycloak.Status.Phase, keycloak.Status.AccessURL, keycloak.Status.DefaultRealm)
+		for _, condition := range keycloak.Status.Conditions {
+			fmt.Fprintf(&summary, "  %s=%s %s %s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+	for _, codewind := range codewinds {
+		fmt.Fprintf(&summary, "\nCodewind %s/%s\n  workspace: %s\n  phase: %s\n  url: %s\n  keycloak: %s %s\n", codewind.Namespace, codewind.Name,
+			codewind.GetAnnotations()[codewindv1alpha1.WorkspaceIDAnnotation], codewind.Status.Phase, codewind.Status.AccessURL, codewind.Status.KeycloakStatus, codewind.Status.AuthURL)
+		for _, condition := range codewind.Status.Conditions {
+			fmt.Fprintf(&summary, "  %s=%s %s %s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+	return summary.String()
+}
+
+// addJSON : Writes a value as indented JSON into the archive
+func (g *gatherer) addJSON(name string, value interface{}) {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		g.failed("encoding "+name, err)
+		return
+	}
+	g.add(name, append(content, '\n'))
+}
+
+// add : Writes a file into the directory of the archive
+func (g *gatherer) add(name string, content []byte) {
+	header := &tar.Header{Name: g.directory + "/" + name, Mode: 0644, Size: int64(len(content)), ModTime: time.Now()}
+	if err := g.archive.WriteHeader(header); err != nil {
+		g.failed("writing "+name, err)
+		return
+	}
+	if _, err := g.archive.Write(content); err != nil {
+		g.failed("writing "+name, err)
+		return
+	}
+	g.written[name] = true
+}
+
+// failed : Records a resource that could not be collected
+func (g *gatherer) failed(what string, err error) {
+	g.failures = append(g.failures, what+": "+err.Error())
+	fmt.Fprintln(os.Stderr, "Failed "+what+": "+err.Error())
+}
+
+// appendMissing : Appends a value to a list unless it is already in it
+func appendMissing(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
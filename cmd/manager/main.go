@@ -18,24 +18,37 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 
 	"github.com/eclipse/codewind-operator/pkg/apis"
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
 	"github.com/eclipse/codewind-operator/pkg/controller"
+	"github.com/eclipse/codewind-operator/pkg/controller/codewind"
+	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/controller/keycloak"
+	"github.com/eclipse/codewind-operator/pkg/logging"
+	operatormetrics "github.com/eclipse/codewind-operator/pkg/metrics"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	operatorwebhook "github.com/eclipse/codewind-operator/pkg/webhook"
 	"github.com/eclipse/codewind-operator/version"
 	routev1 "github.com/openshift/api/route/v1"
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	kubemetrics "github.com/operator-framework/operator-sdk/pkg/kube-metrics"
 	"github.com/operator-framework/operator-sdk/pkg/leader"
-	"github.com/operator-framework/operator-sdk/pkg/log/zap"
 	"github.com/operator-framework/operator-sdk/pkg/metrics"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -59,8 +72,41 @@ func printVersion() {
 
 func main() {
 
-	// Configure zap logger
-	pflag.CommandLine.AddFlagSet(zap.FlagSet())
+	// Diagnostic subcommands, run instead of the operator
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		os.Exit(runSelfTest(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "gather" {
+		os.Exit(runGather(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		os.Exit(runRender(os.Args[2:]))
+	}
+
+	var enableLeaderElection bool
+	var leaderElectionID string
+	var leaderElectionNamespace string
+	pflag.BoolVar(&enableLeaderElection, "enable-leader-election", false, "Enable leader election so that only one of several operator replicas is active")
+	pflag.StringVar(&leaderElectionID, "leader-election-id", "codewind-operator-lock", "Name of the lock used for leader election")
+	pflag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace of the leader election lock, defaults to the operator namespace")
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
+	pflag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second, "How long replicas waiting for the lock wait before taking over from a leader that stopped renewing it")
+	pflag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second, "How long the leader keeps retrying to renew the lock before it stops")
+	pflag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second, "How often replicas try to acquire or renew the lock")
+	pflag.IntVar(&codewind.MaxConcurrentReconciles, "max-concurrent-reconciles", codewind.MaxConcurrentReconciles, "Maximum number of Codewind resources reconciled in parallel")
+	pflag.IntVar(&keycloak.MaxConcurrentReconciles, "max-concurrent-keycloak-reconciles", keycloak.MaxConcurrentReconciles, "Maximum number of Keycloak resources reconciled in parallel")
+	var enableWebhooks bool
+	var webhookPort int
+	var webhookCertDir string
+	pflag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve the admission webhooks that default and validate Codewind and Keycloak resources")
+	pflag.IntVar(&webhookPort, "webhook-port", 9443, "Port of the admission webhook server")
+	pflag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs", "Directory holding tls.crt and tls.key of the admission webhook server")
+	var debugAddress string
+	pflag.StringVar(&debugAddress, "debug-address", os.Getenv(debugAddressEnvVar), "Address of the pprof and runtime statistics server, for example localhost:6060. Disabled when empty")
+	pflag.BoolVar(&util.FIPSMode, "fips-mode", false, "Generate FIPS compliant certificates, limit TLS to FIPS approved versions and cipher suites and always verify certificates")
+
+	// Configure zap logger, the operator config map can change the level while the operator runs
+	pflag.CommandLine.AddFlagSet(logging.FlagSet())
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
 
@@ -68,10 +114,20 @@ func main() {
 	// implementing the logr.Logger interface. This logger will
 	// be propagated through the whole operator, generating
 	// uniform and structured logs.
-	logf.SetLogger(zap.Logger())
+	logOptions, err := logging.OptionsFromFlags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := logging.NewLogger(logOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logf.SetLogger(logger)
 	printVersion()
 
-	namespace, err := k8sutil.GetWatchNamespace()
+	watchNamespaces, err := util.GetWatchNamespaces()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
 		os.Exit(1)
@@ -84,19 +140,70 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Settings of the operator config map read before the manager starts, flags given on the command line win
+	operatorConfig := readOperatorConfig(cfg, util.GetOperatorNamespace())
+	applyConcurrencyFromOperatorConfig(operatorConfig, "max-concurrent-reconciles", "maxConcurrentReconciles", &codewind.MaxConcurrentReconciles)
+	applyConcurrencyFromOperatorConfig(operatorConfig, "max-concurrent-keycloak-reconciles", "maxConcurrentKeycloakReconciles", &keycloak.MaxConcurrentReconciles)
+	log.Info("Concurrent reconciles", "codewind", codewind.MaxConcurrentReconciles, "keycloak", keycloak.MaxConcurrentReconciles)
+	applyFIPSModeFromOperatorConfig(operatorConfig)
+	if util.FIPSMode {
+		log.Info("FIPS mode enabled", "boringCrypto", util.BoringCrypto())
+		if !util.BoringCrypto() {
+			log.Info("The operator is not built with the BoringCrypto module, its crypto is not FIPS validated")
+		}
+	}
+
 	ctx := context.TODO()
-	// Become the leader before proceeding
-	err = leader.Become(ctx, "codewind-operator-lock")
-	if err != nil {
-		log.Error(err, "")
-		os.Exit(1)
+	if !enableLeaderElection {
+		// Become the leader before proceeding
+		err = leader.Become(ctx, leaderElectionID)
+		if err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
 	}
 
-	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          namespace,
+	// Restrict the cache and watches to the requested namespaces. An empty
+	// WATCH_NAMESPACE watches every namespace in the cluster.
+	options := manager.Options{
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
-	})
+	}
+
+	// With leader election enabled every replica starts, but controllers (and with them all
+	// Keycloak configuration) only run in the replica currently holding the lock.
+	if enableLeaderElection {
+		if leaderElectionNamespace == "" {
+			leaderElectionNamespace = util.GetOperatorNamespace()
+		}
+		if renewDeadline >= leaseDuration {
+			log.Error(errors.New("the renew deadline must be shorter than the lease duration"), "Invalid leader election settings", "leaseDuration", leaseDuration.String(), "renewDeadline", renewDeadline.String())
+			os.Exit(1)
+		}
+		log.Info("Leader election enabled", "id", leaderElectionID, "namespace", leaderElectionNamespace, "leaseDuration", leaseDuration.String())
+		options.LeaderElection = true
+		options.LeaderElectionID = leaderElectionID
+		options.LeaderElectionNamespace = leaderElectionNamespace
+		options.LeaseDuration = &leaseDuration
+		options.RenewDeadline = &renewDeadline
+		options.RetryPeriod = &retryPeriod
+	}
+	if enableWebhooks {
+		options.Port = webhookPort
+		options.CertDir = webhookCertDir
+	}
+	switch len(watchNamespaces) {
+	case 0:
+		log.Info("Watching all namespaces")
+	case 1:
+		log.Info("Watching namespace", "namespace", watchNamespaces[0])
+		options.Namespace = watchNamespaces[0]
+	default:
+		log.Info("Watching namespaces", "namespaces", strings.Join(watchNamespaces, ","))
+		options.NewCache = cache.MultiNamespacedCacheBuilder(watchNamespaces)
+	}
+
+	// Create a new Cmd to provide shared dependencies and start components
+	mgr, err := manager.New(cfg, options)
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
@@ -122,8 +229,40 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup the admission webhooks
+	if enableWebhooks {
+		// The webhook of each type also serves /convert, converting between v1alpha1 and v1beta1
+		log.Info("Registering admission webhooks", "port", webhookPort)
+		if err := (&codewindv1alpha1.Codewind{}).SetupWebhookWithManager(mgr); err != nil {
+			log.Error(err, "Unable to register the Codewind webhook")
+			os.Exit(1)
+		}
+		if err := (&codewindv1alpha1.Keycloak{}).SetupWebhookWithManager(mgr); err != nil {
+			log.Error(err, "Unable to register the Keycloak webhook")
+			os.Exit(1)
+		}
+		if err := operatorwebhook.AddDefaultersToManager(mgr); err != nil {
+			log.Error(err, "Unable to register the defaulting webhooks")
+			os.Exit(1)
+		}
+	}
+
+	// Serve pprof and runtime statistics when requested
+	if debugAddress != "" {
+		if err := mgr.Add(&debugServer{address: debugAddress}); err != nil {
+			log.Error(err, "Unable to register the debug server")
+			os.Exit(1)
+		}
+	}
+
+	// Count the managed instances by phase on every scrape of the operator metrics
+	if err := operatormetrics.RegisterInstanceCollector(mgr.GetClient()); err != nil {
+		log.Error(err, "Unable to register the instance metrics")
+		os.Exit(1)
+	}
+
 	// Add the Metrics Service
-	addMetrics(ctx, cfg, namespace)
+	addMetrics(ctx, cfg, util.GetOperatorNamespace(), operatorConfig)
 
 	log.Info("Starting the Cmd.")
 
@@ -136,7 +275,7 @@ func main() {
 
 // addMetrics will create the Services and Service Monitors to allow the operator to export the metrics by using
 // the Prometheus operator
-func addMetrics(ctx context.Context, cfg *rest.Config, namespace string) {
+func addMetrics(ctx context.Context, cfg *rest.Config, namespace string, operatorConfig map[string]string) {
 	if err := serveCRMetrics(cfg); err != nil {
 		if errors.Is(err, k8sutil.ErrRunLocal) {
 			log.Info("Skipping CR metrics server creation; not running in a cluster.")
@@ -157,6 +296,12 @@ func addMetrics(ctx context.Context, cfg *rest.Config, namespace string) {
 		log.Info("Could not create metrics Service", "error", err.Error())
 	}
 
+	// ServiceMonitors are only created when enabled in the operator config map
+	if !util.ServiceMonitorsEnabled(operatorConfig) {
+		log.Info("Skipping ServiceMonitor creation; enableServiceMonitors is not set in the operator config map.")
+		return
+	}
+
 	// CreateServiceMonitors will automatically create the prometheus-operator and ServiceMonitor resources
 	// necessary to configure Prometheus to scrape metrics from this operator.
 	services := []*v1.Service{service}
@@ -171,11 +316,60 @@ func addMetrics(ctx context.Context, cfg *rest.Config, namespace string) {
 	}
 }
 
+// readOperatorConfig reads the data of the operator config map. The manager cache is not started yet, so the
+// config map is read with a direct client. Returns nil when the config map is not available, for example on the
+// first start before the Keycloak controller created it.
+func readOperatorConfig(cfg *rest.Config, namespace string) map[string]string {
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		log.Info("Could not create a client to read the operator config map", "error", err.Error())
+		return nil
+	}
+	operatorConfigMap := &v1.ConfigMap{}
+	err = c.Get(context.TODO(), types.NamespacedName{Name: defaults.OperatorConfigMapName, Namespace: namespace}, operatorConfigMap)
+	if err != nil {
+		log.Info("Could not read the operator config map", "error", err.Error())
+		return nil
+	}
+	return operatorConfigMap.Data
+}
+
+// applyConcurrencyFromOperatorConfig sets the number of parallel reconciles from the operator config map key
+// unless the flag was given on the command line. Invalid values are logged and ignored.
+func applyConcurrencyFromOperatorConfig(operatorConfig map[string]string, flagName string, key string, maxConcurrentReconciles *int) {
+	value, ok := operatorConfig[key]
+	if !ok || pflag.CommandLine.Changed(flagName) {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		log.Info("Ignoring invalid value in the operator config map", "key", key, "value", value)
+		return
+	}
+	*maxConcurrentReconciles = parsed
+}
+
+// applyFIPSModeFromOperatorConfig turns on FIPS mode when the fipsMode key of the operator config map is true, unless
+// the flag was given on the command line. Invalid values are logged and ignored.
+func applyFIPSModeFromOperatorConfig(operatorConfig map[string]string) {
+	value, ok := operatorConfig[util.FIPSModeKey]
+	if !ok || pflag.CommandLine.Changed("fips-mode") {
+		return
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Info("Ignoring invalid value in the operator config map", "key", util.FIPSModeKey, "value", value)
+		return
+	}
+	util.FIPSMode = parsed
+}
+
 // serveCRMetrics gets the Operator/CustomResource GVKs and generates metrics based on those types.
 // It serves those metrics on "http://metricsHost:operatorMetricsPort".
 func serveCRMetrics(cfg *rest.Config) error {
 	// Below function returns filtered operator/CustomResource specific GVKs.
-	filteredGVK, err := k8sutil.GetGVKsFromAddToScheme(apis.AddToScheme)
+	// Only the storage version, listing the v1beta1 CRs would go through the conversion webhook.
+	filteredGVK, err := k8sutil.GetGVKsFromAddToScheme(codewindv1alpha1.SchemeBuilder.AddToScheme)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,125 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/eclipse/codewind-operator/pkg/apis"
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/codewind"
+	"github.com/eclipse/codewind-operator/pkg/logging"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// runRender : Prints the resources the operator would create for a Codewind CR as YAML documents on stdout, without
+// connecting to the cluster or Keycloak. Secret values are redacted. Invalid settings of the operator config map are
+// logged to stderr and ignored, as the operator does. Returns the process exit code.
+func runRender(args []string) int {
+	var filename, operatorConfigFile, namespace, workspaceID string
+	var options codewind.RenderOptions
+	flags := pflag.NewFlagSet("render", pflag.ContinueOnError)
+	flags.StringVarP(&filename, "filename", "f", "", "File of the Codewind CR, - for stdin")
+	flags.StringVar(&operatorConfigFile, "operator-config", "", "File of the operator config map, the codewind-operator config map of the operator namespace")
+	flags.StringVar(&namespace, "namespace", "", "Namespace of the CR when the file does not set one, defaults to default")
+	flags.StringVar(&workspaceID, "workspace-id", "", "Workspace ID when the CR has no "+codewindv1alpha1.WorkspaceIDAnnotation+" annotation")
+	flags.BoolVar(&options.OpenShift, "openshift", false, "Render for OpenShift, with a route instead of an ingress")
+	flags.StringVar(&options.KeycloakURL, "keycloak-url", "", "Keycloak the gatekeeper authenticates against, for example https://codewind-keycloak-k81235kj.codewind.10.98.117.7.nip.io")
+	flags.StringVar(&options.Realm, "realm", "", "Keycloak realm, defaults to the defaultRealm of the operator config map")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if filename == "" {
+		fmt.Fprintln(os.Stderr, "render requires --filename")
+		return 2
+	}
+	logger, err := logging.NewLogger(logging.Options{Encoder: "console", Level: "warn"})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	logf.SetLogger(logger)
+
+	cr := &codewindv1alpha1.Codewind{}
+	if err := readRenderInput(filename, cr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if cr.Namespace == "" {
+		cr.Namespace = namespace
+	}
+	if cr.Namespace == "" {
+		cr.Namespace = "default"
+	}
+	if workspaceID != "" && cr.Annotations[codewindv1alpha1.WorkspaceIDAnnotation] == "" {
+		if cr.Annotations == nil {
+			cr.Annotations = map[string]string{}
+		}
+		cr.Annotations[codewindv1alpha1.WorkspaceIDAnnotation] = workspaceID
+	}
+	if operatorConfigFile != "" {
+		operatorConfigMap := &v1.ConfigMap{}
+		if err := readRenderInput(operatorConfigFile, operatorConfigMap); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		options.OperatorConfig = operatorConfigMap.Data
+	}
+
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, apis.AddToScheme, routev1.AddToScheme} {
+		if err := addToScheme(scheme); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	objects, err := codewind.Render(scheme, cr, options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, object := range objects {
+		document, err := yaml.Marshal(object)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stdout, "---\n%s", document)
+	}
+	return 0
+}
+
+// readRenderInput : Decodes a YAML or JSON file into the object, - reads stdin
+func readRenderInput(filename string, object interface{}) error {
+	var content []byte
+	var err error
+	if filename == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, object); err != nil {
+		return fmt.Errorf("unable to decode %s: %v", filename, err)
+	}
+	return nil
+}
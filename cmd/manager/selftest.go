@@ -0,0 +1,85 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/spf13/pflag"
+)
+
+// runSelfTest : Runs the read-only Keycloak self test and prints the JSON report to stdout.
+// Admin credentials are read from KEYCLOAK_ADMIN_USER and KEYCLOAK_ADMIN_PASSWORD so they
+// do not appear in the process list. Returns the process exit code.
+func runSelfTest(args []string) int {
+	keycloakConfig := security.KeycloakConfiguration{
+		KeycloakAdminUsername: os.Getenv("KEYCLOAK_ADMIN_USER"),
+		KeycloakAdminPassword: os.Getenv("KEYCLOAK_ADMIN_PASSWORD"),
+	}
+	var caFile, distribution string
+	flags := pflag.NewFlagSet("selftest", pflag.ContinueOnError)
+	flags.StringVar(&keycloakConfig.AuthURL, "auth-url", "", "Keycloak URL, for example https://codewind-keycloak-k81235kj.codewind.10.98.117.7.nip.io")
+	flags.StringVar(&keycloakConfig.RealmName, "realm", "codewind", "Codewind realm")
+	flags.StringVar(&keycloakConfig.ClientName, "client", "", "Keycloak client of the Codewind deployment, for example codewind-kbc3b0x2qins")
+	flags.StringVar(&keycloakConfig.DevUsername, "username", "", "Developer user of the Codewind deployment")
+	flags.StringVar(&keycloakConfig.WorkspaceID, "workspace", "", "Workspace ID of the Codewind deployment")
+	flags.StringVar(&caFile, "ca-file", "", "PEM file of additional CA certificates to trust")
+	flags.StringVar(&distribution, "distribution", "", "Keycloak distribution, legacy or quarkus, detected when not set")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if keycloakConfig.AuthURL == "" || keycloakConfig.KeycloakAdminUsername == "" || keycloakConfig.KeycloakAdminPassword == "" {
+		fmt.Fprintln(os.Stderr, "selftest requires --auth-url and the KEYCLOAK_ADMIN_USER and KEYCLOAK_ADMIN_PASSWORD environment variables")
+		return 2
+	}
+	switch security.KeycloakDistribution(distribution) {
+	case "", security.KeycloakLegacy, security.KeycloakQuarkus:
+		keycloakConfig.Distribution = security.KeycloakDistribution(distribution)
+	default:
+		fmt.Fprintln(os.Stderr, "--distribution must be legacy or quarkus")
+		return 2
+	}
+
+	httpOptions := util.HTTPClientOptions{Timeout: time.Second * 30}
+	if caFile != "" {
+		pemCerts, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		rootCAs, err := util.ParseCABundle(pemCerts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "No certificates found in "+caFile)
+			return 2
+		}
+		keycloakConfig.RootCAs = rootCAs
+		httpOptions.RootCAs = rootCAs
+	}
+
+	result := security.SelfTest(util.NewHTTPClient(httpOptions), &keycloakConfig)
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Println(string(output))
+	if !result.Passed {
+		return 1
+	}
+	return 0
+}
@@ -100,17 +100,36 @@ function installOperator() {
 
     cd ..
 
+    if [[ $FLG_OC311 != true ]]
+    then
+    echo "Deploying the operator webhooks:"
+    kubectl apply -f webhook.yaml
+    if ! kubectl api-versions | grep -q "^route.openshift.io/"
+    then
+      ./webhook-certs.sh
+    fi
+    fi
+
     echo "Creating Codewind configmap:"
 
     head -n17 codewind-configmap.yaml > custom-codewind-configmap.yaml
     echo "  ingressDomain: "$FLG_INGRESS_DOMAIN >> custom-codewind-configmap.yaml
-    tail -n3 codewind-configmap.yaml >> custom-codewind-configmap.yaml
+    tail -n +19 codewind-configmap.yaml >> custom-codewind-configmap.yaml
 
     kubectl apply -f custom-codewind-configmap.yaml
     rm -f custom-codewind-configmap.yaml
 
     echo "Deploying Codewind operator:"
+    if [[ $FLG_OC311 == true ]]
+    then
+    kubectl apply -f operator-oc311.yaml
+    else
     kubectl apply -f operator.yaml
+    fi
+
+    # The webhooks reject requests until the operator serves them
+    echo "Waiting for the operator"
+    kubectl rollout status deployment/codewind-operator -n $FLG_NAMESPACE
 
     cd crds
 
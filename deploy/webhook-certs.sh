@@ -0,0 +1,52 @@
+#!/bin/bash
+
+# Issues the serving certificate of the codewind-operator-webhook service on clusters without
+# the OpenShift service CA. Creates a CA and a certificate signed by it, stores them in the
+# codewind-operator-webhook-cert secret mounted by operator.yaml and sets the CA bundle of the
+# conversion webhooks of the CRDs and of the webhooks of webhook.yaml.
+#
+# Apply the CRDs and webhook.yaml first. Running the script again keeps the secret and only
+# sets the CA bundles, delete the secret to issue a new certificate.
+
+NAMESPACE="codewind"
+SERVICE="codewind-operator-webhook"
+SECRET="codewind-operator-webhook-cert"
+
+set -e
+
+if ! kubectl get secret $SECRET -n $NAMESPACE > /dev/null 2>&1
+then
+  CERT_DIR=$(mktemp -d)
+  trap "rm -rf $CERT_DIR" EXIT
+
+  echo "Issuing the webhook certificate of $SERVICE.$NAMESPACE.svc:"
+  openssl req -x509 -newkey rsa:2048 -nodes -days 3650 -subj "/CN=$SERVICE-ca" \
+    -keyout $CERT_DIR/ca.key -out $CERT_DIR/ca.crt 2> /dev/null
+  openssl req -newkey rsa:2048 -nodes -subj "/CN=$SERVICE.$NAMESPACE.svc" \
+    -keyout $CERT_DIR/tls.key -out $CERT_DIR/tls.csr 2> /dev/null
+  printf "subjectAltName=DNS:$SERVICE,DNS:$SERVICE.$NAMESPACE,DNS:$SERVICE.$NAMESPACE.svc\nextendedKeyUsage=serverAuth\n" > $CERT_DIR/ext.cnf
+  openssl x509 -req -days 3650 -in $CERT_DIR/tls.csr -CA $CERT_DIR/ca.crt -CAkey $CERT_DIR/ca.key -CAcreateserial \
+    -extfile $CERT_DIR/ext.cnf -out $CERT_DIR/tls.crt 2> /dev/null
+
+  kubectl create secret generic $SECRET -n $NAMESPACE --type=kubernetes.io/tls \
+    --from-file=tls.crt=$CERT_DIR/tls.crt --from-file=tls.key=$CERT_DIR/tls.key --from-file=ca.crt=$CERT_DIR/ca.crt
+fi
+
+CA_BUNDLE=$(kubectl get secret $SECRET -n $NAMESPACE -o jsonpath='{.data.ca\.crt}')
+if [ -z "$CA_BUNDLE" ]
+then
+  echo "Secret $SECRET holds no ca.crt, delete it to issue a new certificate"
+  exit 1
+fi
+
+echo "Setting the CA bundle of the webhooks:"
+for crd in codewinds keycloaks
+do
+  kubectl patch crd $crd.codewind.eclipse.org --type=json \
+    -p "[{\"op\":\"add\",\"path\":\"/spec/conversion/webhookClientConfig/caBundle\",\"value\":\"$CA_BUNDLE\"}]"
+done
+for config in validatingwebhookconfiguration/codewind-operator-validating-webhook mutatingwebhookconfiguration/codewind-operator-mutating-webhook
+do
+  kubectl patch $config --type=json \
+    -p "[{\"op\":\"add\",\"path\":\"/webhooks/0/clientConfig/caBundle\",\"value\":\"$CA_BUNDLE\"},{\"op\":\"add\",\"path\":\"/webhooks/1/clientConfig/caBundle\",\"value\":\"$CA_BUNDLE\"}]"
+done
@@ -12,6 +12,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -19,20 +20,398 @@ import (
 type CodewindSpec struct {
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 
-	// KeycloakDeployment : name of the keycloak deployment used by this instance of codewind
+	// KeycloakDeployment : name of the keycloak deployment used by this instance of codewind.
+	// Required unless auth.externalOIDC is set
 	// +kubebuilder:validation:Pattern=^[A-Za-z0-9/-]*$
-	KeycloakDeployment string `json:"keycloakDeployment"`
+	KeycloakDeployment string `json:"keycloakDeployment,omitempty"`
+
+	// KeycloakRef : Keycloak CR used by this instance of codewind, which may be in another namespace.
+	// Replaces keycloakDeployment
+	KeycloakRef *KeycloakReference `json:"keycloakRef,omitempty"`
 
 	// Developer username assigned to this instance
 	// +kubebuilder:validation:Pattern=^[A-Za-z0-9/-]*$
 	Username string `json:"username"`
 
-	// Codewind Storage size
+	// AccessList : further users granted access to this instance along with the developer user. Users
+	// removed from the list lose their access
+	AccessList []string `json:"accessList,omitempty"`
+
+	// AccessGroups : Keycloak groups whose members are granted access to this instance, missing groups are
+	// created. Groups removed from the list lose their access
+	AccessGroups []string `json:"accessGroups,omitempty"`
+
+	// Codewind Storage size, storage.size takes precedence
 	// +kubebuilder:validation:Pattern=[0-9]*Gi$
-	StorageSize string `json:"storageSize"`
+	StorageSize string `json:"storageSize,omitempty"`
+
+	// Storage : size and storage class of the PFE volume, defaults to the operator config map
+	Storage *StorageSpec `json:"storage,omitempty"`
 
 	// LogLevel within pods
 	LogLevel string `json:"logLevel"`
+
+	// LogLevels : log level of each component, defaults to logLevel
+	LogLevels *CodewindLogLevelsSpec `json:"logLevels,omitempty"`
+
+	// InitialPasswordSecret : name of a secret in this namespace whose "password" key holds a temporary
+	// password used when the operator creates the developer user. Existing users are left unchanged.
+	InitialPasswordSecret string `json:"initialPasswordSecret,omitempty"`
+
+	// VerifyEmail : require a newly created developer user to verify their email address
+	VerifyEmail bool `json:"verifyEmail,omitempty"`
+
+	// Auth : authentication provider settings, defaults to the Keycloak deployment
+	Auth *CodewindAuthSpec `json:"auth,omitempty"`
+
+	// IngressDomain : ingress domain of the Codewind routes, defaults to the operator config map
+	IngressDomain string `json:"ingressDomain,omitempty"`
+
+	// Hostname : DNS name the gatekeeper is published at, replaces the generated codewind-gatekeeper-<workspaceID> host
+	// of the ingress domain. The name must resolve to the ingress controller or router
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$
+	Hostname string `json:"hostname,omitempty"`
+
+	// Routing : how the gatekeeper is published, host gives the instance a host of its own and path publishes it under
+	// /codewind/<workspaceID>/ of the codewind.<ingressDomain> host shared by the instances. Defaults to the operator
+	// config map, else host
+	// +kubebuilder:validation:Enum=host;path
+	Routing string `json:"routing,omitempty"`
+
+	// Ingress : ingress class and annotations of the gatekeeper Ingress, defaults to the operator config map
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// Route : TLS termination and certificate of the gatekeeper route on OpenShift
+	Route *RouteSpec `json:"route,omitempty"`
+
+	// ImageTag : tag of the Codewind PFE, performance and gatekeeper images
+	ImageTag string `json:"imageTag,omitempty"`
+
+	// Version : Codewind version of the operator version catalog, selects the tested PFE, performance and
+	// gatekeeper image tags and overrides imageTag
+	Version string `json:"version,omitempty"`
+
+	// Images : image of each component, overrides imageTag and the operator config map defaults
+	Images *CodewindImagesSpec `json:"images,omitempty"`
+
+	// ImagePullSecrets : secrets used to pull the Codewind images, defaults to the operator config map
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// TLS : issue the gatekeeper and PFE certificates with cert-manager, or serve the gatekeeper certificate of an
+	// existing secret, instead of self-signed certificates
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// TrustedCABundle : config map or secret in the namespace of the CR holding PEM CA certificates, such as an
+	// internal CA of Keycloak or git servers. Mounted into the PFE, performance and gatekeeper containers and trusted
+	// by Node.js through NODE_EXTRA_CA_CERTS, in addition to the public CAs
+	TrustedCABundle *CABundleSpec `json:"trustedCABundle,omitempty"`
+
+	// Proxy : outbound proxy of the PFE, performance and gatekeeper containers, defaults to the operator config map
+	Proxy *ProxySpec `json:"proxy,omitempty"`
+
+	// GitCredentialsSecret : secret in the namespace of the CR holding the credentials PFE clones private template and
+	// project repositories with, either a username and password or token, or an SSH private key and known_hosts
+	GitCredentialsSecret string `json:"gitCredentialsSecret,omitempty"`
+
+	// BuildRegistry : registry PFE pushes the project images it builds to
+	BuildRegistry *BuildRegistrySpec `json:"buildRegistry,omitempty"`
+
+	// Env : extra environment variables of each component. Variables set by the operator cannot be replaced
+	Env *CodewindEnvSpec `json:"env,omitempty"`
+
+	// Resources : compute resources of each component, defaults to the operator config map
+	Resources *CodewindResourcesSpec `json:"resources,omitempty"`
+
+	// Probes : timings of the startup, liveness and readiness probes of each component, for example longer delays
+	// for PFE on slow storage
+	Probes *CodewindProbesSpec `json:"probes,omitempty"`
+
+	// Components : optional components of the instance, which are all deployed by default
+	Components *CodewindComponentsSpec `json:"components,omitempty"`
+
+	// NodeSelector : node labels the Codewind pods must be scheduled on
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations : tolerations of the Codewind pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity : scheduling constraints of the Codewind pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Architecture : selects the images built for this node architecture, the pods are scheduled on nodes of the
+	// architecture of their images. Defaults to the architecture key of the operator config map, else amd64
+	// +kubebuilder:validation:Enum=amd64;ppc64le;s390x
+	Architecture string `json:"architecture,omitempty"`
+
+	// PriorityClassName : priority class of the Codewind pods, the default priority of the cluster when not set
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// NetworkPolicies : create NetworkPolicies admitting only the traffic between the Codewind components,
+	// defaults to enableNetworkPolicies of the operator config map
+	NetworkPolicies *bool `json:"networkPolicies,omitempty"`
+
+	// SecurityContext : security settings of the performance and gatekeeper pods, and of the PFE pod when it is not
+	// privileged. Defaults to the operator config map
+	SecurityContext *PodSecuritySpec `json:"securityContext,omitempty"`
+
+	// PFEPrivileged : run PFE in a privileged container so it can build project images, true by default.
+	// A privileged PFE is rejected by namespaces enforcing the restricted Pod Security Standard
+	PFEPrivileged *bool `json:"pfePrivileged,omitempty"`
+
+	// PFE : settings of the PFE deployment
+	PFE *PFESpec `json:"pfe,omitempty"`
+
+	// Suspended : scales the PFE, performance and gatekeeper deployments to zero while keeping the volumes, secrets
+	// and Keycloak client of the instance. Clearing it scales them back up
+	Suspended bool `json:"suspended,omitempty"`
+
+	// TTLAfterLastUse : how long the instance may be idle before the TTLAction is taken, such as 12h. Defaults to
+	// ttlAfterLastUse of the operator config map, an instance without one is never cleaned up
+	TTLAfterLastUse string `json:"ttlAfterLastUse,omitempty"`
+
+	// TTLAction : what happens to an instance idle for longer than TTLAfterLastUse, hibernate suspends it and delete
+	// removes the CR. Defaults to ttlAction of the operator config map, else hibernate
+	// +kubebuilder:validation:Enum=hibernate;delete
+	TTLAction string `json:"ttlAction,omitempty"`
+
+	// AdoptExisting : takes over the deployments, services, volume and secrets of a Codewind instance installed
+	// without the operator, named by the workspace ID in the codewindWorkspace annotation, instead of creating them
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+
+	// Backup : scheduled CSI VolumeSnapshots of the workspace volume, and the snapshot a new workspace volume is
+	// restored from
+	Backup *WorkspaceBackupSpec `json:"backup,omitempty"`
+}
+
+// WorkspaceBackupSpec : when the workspace volume is snapshotted and how many snapshots are kept
+type WorkspaceBackupSpec struct {
+	// Schedule : cron schedule of the snapshots in UTC, minute hour day-of-month month day-of-week, eg "0 2 * * *".
+	// No snapshots are taken when not set
+	Schedule string `json:"schedule,omitempty"`
+
+	// Retain : number of snapshots kept, the oldest ones are deleted. Defaults to 7
+	// +kubebuilder:validation:Minimum=1
+	Retain int32 `json:"retain,omitempty"`
+
+	// VolumeSnapshotClassName : snapshot class of the snapshots, defaults to the default class of the CSI driver
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+
+	// RestoreFrom : snapshot the workspace volume is provisioned from when it is created
+	RestoreFrom *WorkspaceRestoreSpec `json:"restoreFrom,omitempty"`
+}
+
+// WorkspaceRestoreSpec : snapshot a new workspace volume is provisioned from
+type WorkspaceRestoreSpec struct {
+	// VolumeSnapshotName : VolumeSnapshot in the namespace of the CR
+	VolumeSnapshotName string `json:"volumeSnapshotName"`
+}
+
+// BuildRegistrySpec : registry the project images of a Codewind instance are pushed to
+type BuildRegistrySpec struct {
+	// URL : host and optional port of the registry, such as registry.example.com:5000
+	URL string `json:"url"`
+
+	// SecretName : kubernetes.io/dockerconfigjson secret in the namespace of the CR holding the push credentials
+	SecretName string `json:"secretName,omitempty"`
+
+	// NamespacePrefix : registry namespace the project images are pushed under
+	NamespacePrefix string `json:"namespacePrefix,omitempty"`
+}
+
+// PFESpec : settings of the PFE deployment of a Codewind instance
+type PFESpec struct {
+	// ExtraVolumes : volumes added to the PFE pod, such as config maps or secrets holding Maven settings or
+	// registry credentials
+	ExtraVolumes []corev1.Volume `json:"extraVolumes,omitempty"`
+
+	// ExtraVolumeMounts : mounts of the extra volumes in the PFE container
+	ExtraVolumeMounts []corev1.VolumeMount `json:"extraVolumeMounts,omitempty"`
+}
+
+// CodewindResourcesSpec : compute resources of the containers of a Codewind instance
+type CodewindResourcesSpec struct {
+	// PFE : resources of the PFE container
+	PFE *corev1.ResourceRequirements `json:"pfe,omitempty"`
+
+	// Performance : resources of the performance dashboard container
+	Performance *corev1.ResourceRequirements `json:"performance,omitempty"`
+
+	// Gatekeeper : resources of the gatekeeper container
+	Gatekeeper *corev1.ResourceRequirements `json:"gatekeeper,omitempty"`
+}
+
+// CodewindLogLevelsSpec : log levels of the containers of a Codewind instance
+type CodewindLogLevelsSpec struct {
+	// PFE : log level of the PFE container
+	// +kubebuilder:validation:Enum=error;warn;info;debug;trace
+	PFE string `json:"pfe,omitempty"`
+
+	// Performance : log level of the performance dashboard container
+	// +kubebuilder:validation:Enum=error;warn;info;debug;trace
+	Performance string `json:"performance,omitempty"`
+
+	// Gatekeeper : log level of the gatekeeper container
+	// +kubebuilder:validation:Enum=error;warn;info;debug;trace
+	Gatekeeper string `json:"gatekeeper,omitempty"`
+}
+
+// CodewindProbesSpec : probe timings of the containers of a Codewind instance
+type CodewindProbesSpec struct {
+	// PFE : probes of the PFE container
+	PFE *ProbesSpec `json:"pfe,omitempty"`
+
+	// Performance : probes of the performance dashboard container
+	Performance *ProbesSpec `json:"performance,omitempty"`
+
+	// Gatekeeper : probes of the gatekeeper container
+	Gatekeeper *ProbesSpec `json:"gatekeeper,omitempty"`
+}
+
+// CodewindComponentsSpec : optional components of a Codewind instance
+type CodewindComponentsSpec struct {
+	// Performance : the performance dashboard deployment and service
+	Performance *ComponentSpec `json:"performance,omitempty"`
+}
+
+// ComponentSpec : whether an optional component is deployed
+type ComponentSpec struct {
+	// Enabled : deploy the component, true by default. Disabling it removes the resources of the component
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// CodewindEnvSpec : extra environment variables of the containers of a Codewind instance
+type CodewindEnvSpec struct {
+	// PFE : environment variables of the PFE container
+	PFE []corev1.EnvVar `json:"pfe,omitempty"`
+
+	// Performance : environment variables of the performance dashboard container
+	Performance []corev1.EnvVar `json:"performance,omitempty"`
+
+	// Gatekeeper : environment variables of the gatekeeper container
+	Gatekeeper []corev1.EnvVar `json:"gatekeeper,omitempty"`
+}
+
+// CodewindImagesSpec : container images of a Codewind instance
+type CodewindImagesSpec struct {
+	// PFE : image of the PFE container
+	PFE *ImageSpec `json:"pfe,omitempty"`
+
+	// Performance : image of the performance dashboard container
+	Performance *ImageSpec `json:"performance,omitempty"`
+
+	// Gatekeeper : image of the gatekeeper container
+	Gatekeeper *ImageSpec `json:"gatekeeper,omitempty"`
+}
+
+// KeycloakReference : a Keycloak CR, possibly in another namespace than the Codewind CR
+type KeycloakReference struct {
+	// Name : name of the Keycloak CR
+	// +kubebuilder:validation:Pattern=^[A-Za-z0-9/-]*$
+	Name string `json:"name"`
+
+	// Namespace : namespace of the Keycloak CR, defaults to the namespace of the Codewind CR
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// CodewindAuthSpec : authentication provider used by an instance of codewind
+type CodewindAuthSpec struct {
+	// ExternalOIDC : use an OIDC provider not managed by the operator instead of Keycloak
+	ExternalOIDC *ExternalOIDCSpec `json:"externalOIDC,omitempty"`
+
+	// SessionTimeout : longest time a login session lasts before the user must log in again, for example 10h.
+	// Defaults to the SSO session settings of the realm
+	// +kubebuilder:validation:Pattern=^([0-9]+[hms])+$
+	SessionTimeout string `json:"sessionTimeout,omitempty"`
+
+	// SessionIdleTimeout : time a login session lasts without activity, for example 30m. Defaults to the realm
+	// +kubebuilder:validation:Pattern=^([0-9]+[hms])+$
+	SessionIdleTimeout string `json:"sessionIdleTimeout,omitempty"`
+
+	// AccessTokenLifespan : time an access token is valid before the gatekeeper refreshes it, for example 5m.
+	// Defaults to the realm
+	// +kubebuilder:validation:Pattern=^([0-9]+[hms])+$
+	AccessTokenLifespan string `json:"accessTokenLifespan,omitempty"`
+
+	// ServiceAccount : lets CI pipelines call the PFE API with the client credentials of the workspace client
+	ServiceAccount *ServiceAccountSpec `json:"serviceAccount,omitempty"`
+
+	// TokenClaims : audiences and extra claims added to the tokens issued for the workspace client
+	TokenClaims *TokenClaimsSpec `json:"tokenClaims,omitempty"`
+
+	// RemoteAccess : publishes the URL, realm, client and an offline token of a machine user in a secret, for IDE
+	// plugins connecting to the instance from outside the cluster
+	RemoteAccess *RemoteAccessSpec `json:"remoteAccess,omitempty"`
+
+	// SessionSecretRef : secret in the namespace of the CR holding the key the gatekeeper encrypts its session
+	// cookies with, replaces the secret generated by the operator so that sessions survive a re-provision
+	SessionSecretRef *SessionSecretReference `json:"sessionSecretRef,omitempty"`
+}
+
+// SessionSecretReference : a key of a secret in the namespace of the Codewind CR
+type SessionSecretReference struct {
+	// Name : name of the secret
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$
+	Name string `json:"name"`
+
+	// Key : key of the session secret within the secret, defaults to session_secret
+	Key string `json:"key,omitempty"`
+}
+
+// TokenClaimsSpec : protocol mappers of the workspace client managed by the operator
+type TokenClaimsSpec struct {
+	// Audience : client IDs added to the aud claim of access tokens, for example an API gateway
+	Audience []string `json:"audience,omitempty"`
+
+	// Claims : claims with a fixed value added to access, ID and userinfo tokens
+	Claims []TokenClaim `json:"claims,omitempty"`
+
+	// GroupsClaim : name of a claim listing the groups of the user, no group claim when empty
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+
+	// FullGroupPath : list groups by their full path, for example /team/dev, rather than by name
+	FullGroupPath bool `json:"fullGroupPath,omitempty"`
+}
+
+// TokenClaim : a claim with a fixed value
+type TokenClaim struct {
+	// Name : name of the claim, nested claims use dots, for example gateway.tenant
+	Name string `json:"name"`
+
+	// Value : value of the claim
+	Value string `json:"value"`
+}
+
+// ServiceAccountSpec : service account of the workspace client and the secret its credentials are published in
+type ServiceAccountSpec struct {
+	// Enabled : enables the client credentials grant and grants the access role of the instance to the service account
+	Enabled bool `json:"enabled,omitempty"`
+
+	// SecretName : secret the credentials are published in, defaults to secret-codewind-ci-<workspaceID>
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// RemoteAccessSpec : machine user of the instance and the secret its connection details are published in
+type RemoteAccessSpec struct {
+	// Enabled : creates the machine user of the instance with its access role and keeps an offline token of it in the secret
+	Enabled bool `json:"enabled,omitempty"`
+
+	// SecretName : secret the connection details are published in, defaults to secret-codewind-remote-<workspaceID>
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// ExternalOIDCSpec : an existing OIDC provider, for example Azure AD or Okta
+type ExternalOIDCSpec struct {
+	// IssuerURL : OIDC issuer of the provider
+	IssuerURL string `json:"issuerURL"`
+
+	// ClientID : client registered with the provider for this instance
+	ClientID string `json:"clientID"`
+
+	// ClientSecretName : name of a secret in this namespace holding the client secret under the "client_secret" key,
+	// the secret itself is not part of the CR
+	ClientSecretName string `json:"clientSecretName"`
 }
 
 // CodewindStatus defines the observed state of Codewind
@@ -46,20 +425,201 @@ type CodewindStatus struct {
 
 	// Keycloak Configuration status
 	KeycloakStatus string `json:"keycloakStatus"`
+
+	// PerformanceURL : Performance dashboard, served through the gatekeeper
+	PerformanceURL string `json:"performanceURL,omitempty"`
+
+	// KeycloakURL : URL of the auth provider used to log in to this instance
+	KeycloakURL string `json:"keycloakURL,omitempty"`
+
+	// Realm : Keycloak realm of the client of this instance, empty for an external OIDC provider
+	Realm string `json:"realm,omitempty"`
+
+	// ClientID : client the IDE and the gatekeeper of this instance log in with
+	ClientID string `json:"clientID,omitempty"`
+
+	// ObservedGeneration : the most recent generation of the spec fully reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase : overall state of the deployment, one of Pending, Provisioning, Running, Hibernated or Failed
+	Phase CodewindPhase `json:"phase,omitempty"`
+
+	// PhaseTransitionTime : when the deployment entered its current phase
+	PhaseTransitionTime *metav1.Time `json:"phaseTransitionTime,omitempty"`
+
+	// Conditions : state of each provisioning step of the deployment
+	Conditions []CodewindCondition `json:"conditions,omitempty"`
+
+	// AccessList : users the operator has granted access to this instance
+	AccessList []string `json:"accessList,omitempty"`
+
+	// AccessGroups : groups the operator has granted access to this instance
+	AccessGroups []string `json:"accessGroups,omitempty"`
+
+	// SessionSettingsHash : hash of the session and token lifetimes last applied to the Keycloak client
+	SessionSettingsHash string `json:"sessionSettingsHash,omitempty"`
+
+	// ServiceAccountEnabled : the service account of the workspace client is enabled and granted access
+	ServiceAccountEnabled bool `json:"serviceAccountEnabled,omitempty"`
+
+	// ClientCredentialsSecret : secret holding the client credentials for CI pipelines
+	ClientCredentialsSecret string `json:"clientCredentialsSecret,omitempty"`
+
+	// RemoteAccessSecret : secret holding the connection details and offline token for IDE remote connections
+	RemoteAccessSecret string `json:"remoteAccessSecret,omitempty"`
+
+	// TokenClaimsHash : hash of the token claims last applied to the Keycloak client
+	TokenClaimsHash string `json:"tokenClaimsHash,omitempty"`
+
+	// Version : instance version every component was last rolled out with
+	Version string `json:"version,omitempty"`
+
+	// Upgrade : progress of a change of the instance version, empty once the last change completed
+	Upgrade *CodewindUpgradeStatus `json:"upgrade,omitempty"`
+
+	// LastActivityTime : last use of the instance, from its last-activity annotation, its creation or its last resume
+	LastActivityTime *metav1.Time `json:"lastActivityTime,omitempty"`
+
+	// IdleWarningTime : when the warning that the idle instance is about to be cleaned up was recorded
+	IdleWarningTime *metav1.Time `json:"idleWarningTime,omitempty"`
+
+	// KeycloakCheckTime : when the Keycloak realm, client and access role were last checked for changes made
+	// outside the operator
+	KeycloakCheckTime *metav1.Time `json:"keycloakCheckTime,omitempty"`
+
+	// LastSnapshotTime : when the last scheduled snapshot of the workspace volume was taken
+	LastSnapshotTime *metav1.Time `json:"lastSnapshotTime,omitempty"`
+
+	// LastSnapshotName : name of the VolumeSnapshot taken last
+	LastSnapshotName string `json:"lastSnapshotName,omitempty"`
+}
+
+// CodewindUpgradeStep : component being rolled out by an upgrade
+type CodewindUpgradeStep string
+
+// Steps of an upgrade, in the order they are rolled out
+const (
+	// CodewindUpgradeStepKeycloak : the client of the instance is configured again in Keycloak
+	CodewindUpgradeStepKeycloak CodewindUpgradeStep = "Keycloak"
+
+	// CodewindUpgradeStepPFE : the PFE deployment rolls out the new image
+	CodewindUpgradeStepPFE CodewindUpgradeStep = "PFE"
+
+	// CodewindUpgradeStepPerformance : the performance deployment rolls out the new image
+	CodewindUpgradeStepPerformance CodewindUpgradeStep = "Performance"
+
+	// CodewindUpgradeStepGatekeeper : the gatekeeper deployment rolls out the new image
+	CodewindUpgradeStepGatekeeper CodewindUpgradeStep = "Gatekeeper"
+)
+
+// CodewindUpgradeStatus : progress of a change of the instance version
+type CodewindUpgradeStatus struct {
+	// FromVersion : instance version before the upgrade
+	FromVersion string `json:"fromVersion,omitempty"`
+
+	// ToVersion : instance version being rolled out
+	ToVersion string `json:"toVersion"`
+
+	// Step : component being rolled out, components of later steps keep the images of FromVersion
+	Step CodewindUpgradeStep `json:"step,omitempty"`
+
+	// StepStartTime : when the current step started, the upgrade is rolled back when a step takes too long
+	StepStartTime metav1.Time `json:"stepStartTime,omitempty"`
+
+	// PreviousImages : images of FromVersion, restored when the upgrade is rolled back
+	PreviousImages *CodewindImagesSpec `json:"previousImages,omitempty"`
+
+	// RolledBack : the upgrade failed and the images of FromVersion were restored. ToVersion is not
+	// attempted again until the instance version changes
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// CodewindPhase : overall state of a Codewind deployment
+type CodewindPhase string
+
+// Phases of a Codewind deployment
+const (
+	// CodewindPhasePending : the deployment has not been provisioned yet
+	CodewindPhasePending CodewindPhase = "Pending"
+
+	// CodewindPhaseProvisioning : resources are being created or are not ready yet
+	CodewindPhaseProvisioning CodewindPhase = "Provisioning"
+
+	// CodewindPhaseRunning : every condition is true
+	CodewindPhaseRunning CodewindPhase = "Running"
+
+	// CodewindPhaseFailed : a provisioning step failed and will be retried
+	CodewindPhaseFailed CodewindPhase = "Failed"
+
+	// CodewindPhaseHibernated : the instance is suspended and its deployments are scaled to zero
+	CodewindPhaseHibernated CodewindPhase = "Hibernated"
+)
+
+// CodewindConditionType : a provisioning step reported in the Codewind status
+type CodewindConditionType string
+
+// Conditions reported in the Codewind status
+const (
+	// CodewindKeycloakConfigured : the realm, client and user have been configured in the auth provider
+	CodewindKeycloakConfigured CodewindConditionType = "KeycloakConfigured"
+
+	// CodewindCertificatesReady : the gatekeeper TLS secret exists
+	CodewindCertificatesReady CodewindConditionType = "CertificatesReady"
+
+	// CodewindPFEReady : the PFE deployment is available
+	CodewindPFEReady CodewindConditionType = "PFEReady"
+
+	// CodewindGatekeeperReady : the gatekeeper deployment is available
+	CodewindGatekeeperReady CodewindConditionType = "GatekeeperReady"
+
+	// CodewindPerformanceReady : the performance dashboard deployment is available
+	CodewindPerformanceReady CodewindConditionType = "PerformanceReady"
+
+	// CodewindUpgraded : every component runs the instance version
+	CodewindUpgraded CodewindConditionType = "Upgraded"
+
+	// CodewindQuotaExceeded : provisioning the instance would exceed the instance quota of the operator
+	CodewindQuotaExceeded CodewindConditionType = "QuotaExceeded"
+
+	// CodewindUnsupportedArchitecture : the version of the instance has no images for the architecture of its pods
+	CodewindUnsupportedArchitecture CodewindConditionType = "UnsupportedArchitecture"
+)
+
+// CodewindCondition : state of one provisioning step of a Codewind deployment
+type CodewindCondition struct {
+	// Type : the provisioning step
+	Type CodewindConditionType `json:"type"`
+
+	// Status : True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Reason : one word CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+
+	// Message : human readable details of the last transition
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime : when the status last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Codewind is the Schema for the codewinds API
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=codewinds,scope=Namespaced
 // +kubebuilder:printcolumn:name="Username",type="string",JSONPath=".spec.username",priority=0,description="Deployment reference name"
-// +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".metadata.namespace",priority=0,description="Deployment namespace"
 // +kubebuilder:printcolumn:name="Workspace",type="string",JSONPath=".metadata.annotations.codewindWorkspace",priority=0,description="WorkspaceID"
-// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",priority=0,description="Age of the resource"
-// +kubebuilder:printcolumn:name="Keycloak",type="string",JSONPath=".spec.keycloakDeployment",priority=0,description="Deployment reference name"
-// +kubebuilder:printcolumn:name="Registration",type="string",JSONPath=".status.keycloakStatus",priority=0,description="Keycloak configuration status"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",priority=0,description="Deployment phase"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",priority=0,description="Version every component was last rolled out with"
+// +kubebuilder:printcolumn:name="Realm",type="string",JSONPath=".status.realm",priority=0,description="Keycloak realm of the instance"
 // +kubebuilder:printcolumn:name="AccessURL",type="string",JSONPath=".status.accessURL",priority=0,description="Exposed route"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",priority=0,description="Age of the resource"
+// +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".metadata.namespace",priority=1,description="Deployment namespace"
+// +kubebuilder:printcolumn:name="Keycloak",type="string",JSONPath=".spec.keycloakDeployment",priority=1,description="Deployment reference name"
+// +kubebuilder:printcolumn:name="Registration",type="string",JSONPath=".status.keycloakStatus",priority=1,description="Keycloak configuration status"
+// +kubebuilder:printcolumn:name="InPhase",type="date",JSONPath=".status.phaseTransitionTime",priority=1,description="Time since the deployment entered its phase"
 type Codewind struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
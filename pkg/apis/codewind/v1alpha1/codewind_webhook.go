@@ -0,0 +1,644 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/cron"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// WorkspaceIDAnnotation : annotation holding the workspace ID generated for a Codewind instance
+const WorkspaceIDAnnotation = "codewindWorkspace"
+
+var (
+	namePattern        = regexp.MustCompile(`^[A-Za-z0-9/-]*$`)
+	storageSizePattern = regexp.MustCompile(`^[0-9]+Gi$`)
+	digestPattern      = regexp.MustCompile(`^[a-z0-9]+:[a-f0-9]+$`)
+	registryPattern    = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$`)
+	repositoryPattern  = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+	workspaceIDPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+	logLevels          = []string{"error", "warn", "info", "debug", "trace"}
+	architectures      = []string{"amd64", "ppc64le", "s390x"}
+	reservedClaims     = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "azp", "typ", "scope", "codewind_workspace"}
+	operatorEnvVars    = []string{
+		"ACCESS_ROLE", "ACCESS_TOKEN_LIFESPAN", "AUTH_URL", "CHE_INGRESS_HOST", "CHE_WORKSPACE_ID", "CLIENT_ID",
+		"CLIENT_SECRET", "CODEWIND_AUTH_HOST", "CODEWIND_AUTH_REALM", "CODEWIND_INGRESS", "CODEWIND_PERFORMANCE_SERVICE",
+		"CODEWIND_VERSION", "CONTAINER_WORKSPACE_DIRECTORY", "ENABLE_AUTH", "GATEKEEPER_BASE_PATH", "GATEKEEPER_HOST",
+		"HOST_WORKSPACE_DIRECTORY", "IMAGE_PUSH_REGISTRY", "IMAGE_PUSH_REGISTRY_NAMESPACE", "IN_K8", "INGRESS_PREFIX", "KUBE_NAMESPACE", "LOG_LEVEL", "NODE_EXTRA_CA_CERTS",
+		"OIDC_ISSUER_URL", "ON_OPENSHIFT", "OWNER_REF_NAME", "OWNER_REF_UID", "PORTAL_HTTPS", "PVC_NAME", "REALM",
+		"SERVICE_ACCOUNT_NAME", "SERVICE_NAME", "SESSION_IDLE_TIMEOUT", "SESSION_SECRET", "SESSION_TIMEOUT",
+		"TEKTON_PIPELINE", "TILLER_NAMESPACE", "WORKSPACE_ID", "WORKSPACE_SERVICE",
+	}
+	pfeVolumes    = []string{"shared-workspace", "buildah-volume", "tls-certs", "trusted-ca-bundle", "git-credentials", "build-registry"}
+	pfeMountPaths = []string{"/codewind-workspace", "/var/lib/containers", "/tlscerts", "/etc/codewind/trusted-ca", "/etc/codewind/git", "/etc/gitconfig", "/etc/codewind/registry"}
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-codewind-eclipse-org-v1alpha1-codewind,mutating=false,failurePolicy=fail,groups=codewind.eclipse.org,resources=codewinds,versions=v1alpha1,name=vcodewind.codewind.eclipse.org
+
+var _ webhook.Validator = &Codewind{}
+
+// SetupWebhookWithManager : registers the Codewind webhooks with the manager webhook server
+func (r *Codewind) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// ValidateCreate : rejects a new Codewind CR with an invalid spec
+func (r *Codewind) ValidateCreate() error {
+	allErrs := r.validateSpec()
+	if r.Spec.AdoptExisting {
+		workspacePath := field.NewPath("metadata", "annotations").Key(WorkspaceIDAnnotation)
+		workspaceID := r.GetAnnotations()[WorkspaceIDAnnotation]
+		if workspaceID == "" {
+			allErrs = append(allErrs, field.Required(workspacePath, "the workspace ID of the existing deployment is required to adopt it"))
+		} else if !workspaceIDPattern.MatchString(workspaceID) {
+			allErrs = append(allErrs, field.Invalid(workspacePath, workspaceID, "must contain only lowercase letters and numbers"))
+		}
+	}
+	return r.invalidError(allErrs)
+}
+
+// ValidateUpdate : rejects an invalid spec and changes to fields that cannot change once the instance is deployed
+func (r *Codewind) ValidateUpdate(old runtime.Object) error {
+	oldCodewind, ok := old.(*Codewind)
+	if !ok {
+		return fmt.Errorf("expected a Codewind but got a %T", old)
+	}
+	allErrs := r.validateSpec()
+	specPath := field.NewPath("spec")
+	if r.Spec.KeycloakDeployment != oldCodewind.Spec.KeycloakDeployment {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("keycloakDeployment"), "field is immutable"))
+	}
+	if (r.Spec.KeycloakRef == nil) != (oldCodewind.Spec.KeycloakRef == nil) || (r.Spec.KeycloakRef != nil && *r.Spec.KeycloakRef != *oldCodewind.Spec.KeycloakRef) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("keycloakRef"), "field is immutable"))
+	}
+	if r.Spec.Username != oldCodewind.Spec.Username {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("username"), "field is immutable"))
+	}
+	allErrs = append(allErrs, validateStorageUpdate(specPath.Child("storage"), r.Spec.Storage, oldCodewind.Spec.Storage)...)
+	if snapshot := restoreSnapshot(r.Spec.Backup); snapshot != "" && snapshot != restoreSnapshot(oldCodewind.Spec.Backup) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("backup", "restoreFrom"), "the workspace volume is only restored when it is created"))
+	}
+	oldWorkspaceID := oldCodewind.GetAnnotations()[WorkspaceIDAnnotation]
+	if oldWorkspaceID != "" && r.GetAnnotations()[WorkspaceIDAnnotation] != oldWorkspaceID {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("metadata", "annotations").Key(WorkspaceIDAnnotation), "workspace ID is immutable"))
+	}
+	return r.invalidError(allErrs)
+}
+
+// restoreSnapshot : the snapshot the workspace volume is restored from, empty when none
+func restoreSnapshot(backup *WorkspaceBackupSpec) string {
+	if backup == nil || backup.RestoreFrom == nil {
+		return ""
+	}
+	return backup.RestoreFrom.VolumeSnapshotName
+}
+
+// ValidateDelete : a Codewind CR can always be deleted
+func (r *Codewind) ValidateDelete() error {
+	return nil
+}
+
+// validateSpec : checks the spec for configurations the controller cannot deploy
+func (r *Codewind) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if r.Spec.Username == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("username"), "a developer username is required"))
+	} else if !namePattern.MatchString(r.Spec.Username) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("username"), r.Spec.Username, "must contain only letters, numbers, '/' and '-'"))
+	}
+	for i, username := range r.Spec.AccessList {
+		if username == "" || !namePattern.MatchString(username) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("accessList").Index(i), username, "must be a username of letters, numbers, '/' and '-'"))
+		}
+	}
+	for i, groupName := range r.Spec.AccessGroups {
+		if groupName == "" || strings.Contains(groupName, "/") {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("accessGroups").Index(i), groupName, "must be the name of a top level group"))
+		}
+	}
+
+	allErrs = append(allErrs, validateStorageSize(specPath.Child("storageSize"), r.Spec.StorageSize)...)
+	allErrs = append(allErrs, validateStorage(specPath.Child("storage"), r.Spec.Storage)...)
+
+	if r.Spec.LogLevel != "" && !contains(logLevels, r.Spec.LogLevel) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("logLevel"), r.Spec.LogLevel, logLevels))
+	}
+	if levels := r.Spec.LogLevels; levels != nil {
+		levelsPath := specPath.Child("logLevels")
+		for _, component := range []struct {
+			name  string
+			level string
+		}{{"pfe", levels.PFE}, {"performance", levels.Performance}, {"gatekeeper", levels.Gatekeeper}} {
+			if component.level != "" && !contains(logLevels, component.level) {
+				allErrs = append(allErrs, field.NotSupported(levelsPath.Child(component.name), component.level, logLevels))
+			}
+		}
+	}
+	if r.Spec.Architecture != "" && !contains(architectures, r.Spec.Architecture) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("architecture"), r.Spec.Architecture, architectures))
+	}
+
+	allErrs = append(allErrs, validateTLS(specPath.Child("tls"), r.Spec.TLS)...)
+	allErrs = append(allErrs, validateCABundle(specPath.Child("trustedCABundle"), r.Spec.TrustedCABundle)...)
+	if r.Spec.GitCredentialsSecret != "" {
+		for _, message := range validation.IsDNS1123Subdomain(r.Spec.GitCredentialsSecret) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("gitCredentialsSecret"), r.Spec.GitCredentialsSecret, message))
+		}
+	}
+	if r.Spec.TLS != nil && r.Spec.TLS.ExternalTermination && r.Spec.Route != nil && r.Spec.Route.Termination != "" && r.Spec.Route.Termination != "edge" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("route", "termination"), "external TLS termination forwards plain HTTP, routes must use edge termination"))
+	}
+	if r.Spec.Hostname != "" {
+		for _, message := range validation.IsDNS1123Subdomain(r.Spec.Hostname) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("hostname"), r.Spec.Hostname, message))
+		}
+	}
+	if resources := r.Spec.Resources; resources != nil {
+		resourcesPath := specPath.Child("resources")
+		allErrs = append(allErrs, validateResources(resourcesPath.Child("pfe"), resources.PFE)...)
+		allErrs = append(allErrs, validateResources(resourcesPath.Child("performance"), resources.Performance)...)
+		allErrs = append(allErrs, validateResources(resourcesPath.Child("gatekeeper"), resources.Gatekeeper)...)
+	}
+	if probes := r.Spec.Probes; probes != nil {
+		probesPath := specPath.Child("probes")
+		allErrs = append(allErrs, validateProbes(probesPath.Child("pfe"), probes.PFE)...)
+		allErrs = append(allErrs, validateProbes(probesPath.Child("performance"), probes.Performance)...)
+		allErrs = append(allErrs, validateProbes(probesPath.Child("gatekeeper"), probes.Gatekeeper)...)
+	}
+	if env := r.Spec.Env; env != nil {
+		envPath := specPath.Child("env")
+		allErrs = append(allErrs, validateEnv(envPath.Child("pfe"), env.PFE)...)
+		allErrs = append(allErrs, validateEnv(envPath.Child("performance"), env.Performance)...)
+		allErrs = append(allErrs, validateEnv(envPath.Child("gatekeeper"), env.Gatekeeper)...)
+	}
+	if r.Spec.TTLAfterLastUse != "" {
+		if ttl, err := time.ParseDuration(r.Spec.TTLAfterLastUse); err != nil || ttl < time.Minute {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("ttlAfterLastUse"), r.Spec.TTLAfterLastUse, "must be a duration of at least 1m, for example 12h"))
+		}
+	}
+	if ttlActions := []string{"hibernate", "delete"}; r.Spec.TTLAction != "" && !contains(ttlActions, r.Spec.TTLAction) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("ttlAction"), r.Spec.TTLAction, ttlActions))
+	}
+	if r.Spec.Backup != nil {
+		allErrs = append(allErrs, r.validateWorkspaceBackup(specPath.Child("backup"), r.Spec.Backup)...)
+	}
+	allErrs = append(allErrs, validateBuildRegistry(specPath.Child("buildRegistry"), r.Spec.BuildRegistry)...)
+	if r.Spec.PFE != nil {
+		allErrs = append(allErrs, validatePFEVolumes(specPath.Child("pfe"), r.Spec.PFE)...)
+	}
+	if images := r.Spec.Images; images != nil {
+		imagesPath := specPath.Child("images")
+		allErrs = append(allErrs, validateImage(imagesPath.Child("pfe"), images.PFE)...)
+		allErrs = append(allErrs, validateImage(imagesPath.Child("performance"), images.Performance)...)
+		allErrs = append(allErrs, validateImage(imagesPath.Child("gatekeeper"), images.Gatekeeper)...)
+	}
+
+	externalOIDC := (*ExternalOIDCSpec)(nil)
+	if r.Spec.Auth != nil {
+		externalOIDC = r.Spec.Auth.ExternalOIDC
+		allErrs = append(allErrs, validateSessionSettings(specPath.Child("auth"), r.Spec.Auth)...)
+		allErrs = append(allErrs, validateSessionSecretRef(specPath.Child("auth", "sessionSecretRef"), r.Spec.Auth.SessionSecretRef)...)
+		allErrs = append(allErrs, validateTokenClaims(specPath.Child("auth", "tokenClaims"), r.Spec.Auth.TokenClaims)...)
+		allErrs = append(allErrs, validateRemoteAccess(specPath.Child("auth", "remoteAccess"), r.Spec.Auth)...)
+	}
+	if externalOIDC == nil {
+		if keycloakRef := r.Spec.KeycloakRef; keycloakRef != nil {
+			keycloakRefPath := specPath.Child("keycloakRef")
+			if r.Spec.KeycloakDeployment != "" {
+				allErrs = append(allErrs, field.Forbidden(specPath.Child("keycloakDeployment"), "cannot be combined with keycloakRef"))
+			}
+			if keycloakRef.Name == "" {
+				allErrs = append(allErrs, field.Required(keycloakRefPath.Child("name"), "name of the Keycloak CR"))
+			} else if !namePattern.MatchString(keycloakRef.Name) {
+				allErrs = append(allErrs, field.Invalid(keycloakRefPath.Child("name"), keycloakRef.Name, "must contain only letters, numbers, '/' and '-'"))
+			}
+		} else if r.Spec.KeycloakDeployment == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("keycloakDeployment"), "a Keycloak deployment or keycloakRef is required unless auth.externalOIDC is set"))
+		} else if !namePattern.MatchString(r.Spec.KeycloakDeployment) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("keycloakDeployment"), r.Spec.KeycloakDeployment, "must contain only letters, numbers, '/' and '-'"))
+		}
+		return allErrs
+	}
+
+	oidcPath := specPath.Child("auth", "externalOIDC")
+	if r.Spec.KeycloakDeployment != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("keycloakDeployment"), "cannot be combined with auth.externalOIDC"))
+	}
+	if r.Spec.KeycloakRef != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("keycloakRef"), "cannot be combined with auth.externalOIDC"))
+	}
+	if r.Spec.InitialPasswordSecret != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("initialPasswordSecret"), "users cannot be created in an external OIDC provider"))
+	}
+	if r.Spec.Auth.TokenClaims != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("auth", "tokenClaims"), "claims of an external OIDC provider are configured with the provider"))
+	}
+	if r.Spec.Auth.ServiceAccount != nil && r.Spec.Auth.ServiceAccount.Enabled {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("auth", "serviceAccount"), "service accounts of an external OIDC provider are registered with the provider"))
+	}
+	if r.Spec.Auth.RemoteAccess != nil && r.Spec.Auth.RemoteAccess.Enabled {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("auth", "remoteAccess"), "machine users of an external OIDC provider are registered with the provider"))
+	}
+	if issuer, err := url.Parse(externalOIDC.IssuerURL); err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		allErrs = append(allErrs, field.Invalid(oidcPath.Child("issuerURL"), externalOIDC.IssuerURL, "must be an https URL"))
+	}
+	if externalOIDC.ClientID == "" {
+		allErrs = append(allErrs, field.Required(oidcPath.Child("clientID"), ""))
+	}
+	if externalOIDC.ClientSecretName == "" {
+		allErrs = append(allErrs, field.Required(oidcPath.Child("clientSecretName"), "name of the secret holding the client secret"))
+	}
+	return allErrs
+}
+
+// validateWorkspaceBackup : checks the snapshot schedule and that a restore names a snapshot the operator provisions
+// the volume from
+func (r *Codewind) validateWorkspaceBackup(backupPath *field.Path, backup *WorkspaceBackupSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if backup.Schedule != "" {
+		if _, err := cron.Parse(backup.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(backupPath.Child("schedule"), backup.Schedule, err.Error()))
+		}
+	}
+	if restore := backup.RestoreFrom; restore != nil {
+		restorePath := backupPath.Child("restoreFrom")
+		if restore.VolumeSnapshotName == "" {
+			allErrs = append(allErrs, field.Required(restorePath.Child("volumeSnapshotName"), "name of the VolumeSnapshot the workspace volume is provisioned from"))
+		}
+		if r.Spec.AdoptExisting {
+			allErrs = append(allErrs, field.Forbidden(restorePath, "the volume of an adopted deployment already exists and cannot be restored"))
+		}
+	}
+	return allErrs
+}
+
+// invalidError : converts a list of field errors into an Invalid API error, nil when the list is empty
+func (r *Codewind) invalidError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: SchemeGroupVersion.Group, Kind: "Codewind"}, r.Name, allErrs)
+}
+
+// validateSessionSecretRef : the referenced session secret must have a valid name, and a valid key when set
+func validateSessionSecretRef(fldPath *field.Path, sessionSecretRef *SessionSecretReference) field.ErrorList {
+	var allErrs field.ErrorList
+	if sessionSecretRef == nil {
+		return allErrs
+	}
+	if sessionSecretRef.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), "the name of the secret is required"))
+	} else {
+		for _, message := range validation.IsDNS1123Subdomain(sessionSecretRef.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), sessionSecretRef.Name, message))
+		}
+	}
+	if sessionSecretRef.Key != "" {
+		for _, message := range validation.IsConfigMapKey(sessionSecretRef.Key) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("key"), sessionSecretRef.Key, message))
+		}
+	}
+	return allErrs
+}
+
+// validateRemoteAccess : the connection details of IDE remote connections cannot be published in the secret of the
+// client credentials, the operator would overwrite one with the other
+func validateRemoteAccess(fldPath *field.Path, auth *CodewindAuthSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	remoteAccess, serviceAccount := auth.RemoteAccess, auth.ServiceAccount
+	if remoteAccess == nil || serviceAccount == nil || remoteAccess.SecretName == "" {
+		return allErrs
+	}
+	if remoteAccess.SecretName == serviceAccount.SecretName {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("secretName"), remoteAccess.SecretName, "must differ from auth.serviceAccount.secretName"))
+	}
+	return allErrs
+}
+
+// validateSessionSettings : lifetimes are positive durations, a session cannot idle longer than it lasts
+func validateSessionSettings(fldPath *field.Path, auth *CodewindAuthSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	durations := map[string]time.Duration{}
+	for _, setting := range []struct {
+		name  string
+		value string
+	}{
+		{"sessionTimeout", auth.SessionTimeout},
+		{"sessionIdleTimeout", auth.SessionIdleTimeout},
+		{"accessTokenLifespan", auth.AccessTokenLifespan},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(setting.value)
+		if err != nil || duration < time.Second {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(setting.name), setting.value, "must be a duration of at least 1s, for example 30m"))
+			continue
+		}
+		durations[setting.name] = duration
+	}
+	sessionTimeout, hasTimeout := durations["sessionTimeout"]
+	if idleTimeout, ok := durations["sessionIdleTimeout"]; ok && hasTimeout && idleTimeout > sessionTimeout {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("sessionIdleTimeout"), auth.SessionIdleTimeout, "cannot be longer than sessionTimeout"))
+	}
+	return allErrs
+}
+
+// validateTokenClaims : claims have unique names that do not replace the standard claims or the workspace claim
+func validateTokenClaims(fldPath *field.Path, tokenClaims *TokenClaimsSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if tokenClaims == nil {
+		return allErrs
+	}
+	var audiences []string
+	for i, audience := range tokenClaims.Audience {
+		if audience == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("audience").Index(i), audience, "must be a client ID"))
+		} else if contains(audiences, audience) {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("audience").Index(i), audience))
+		}
+		audiences = append(audiences, audience)
+	}
+	var claimNames []string
+	for i, claim := range tokenClaims.Claims {
+		namePath := fldPath.Child("claims").Index(i).Child("name")
+		switch {
+		case claim.Name == "":
+			allErrs = append(allErrs, field.Required(namePath, "name of the claim"))
+		case contains(reservedClaims, claim.Name):
+			allErrs = append(allErrs, field.Invalid(namePath, claim.Name, "is set by Keycloak or the operator"))
+		case contains(claimNames, claim.Name):
+			allErrs = append(allErrs, field.Duplicate(namePath, claim.Name))
+		}
+		claimNames = append(claimNames, claim.Name)
+	}
+	if groupsClaim := tokenClaims.GroupsClaim; groupsClaim != "" && (contains(reservedClaims, groupsClaim) || contains(claimNames, groupsClaim)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("groupsClaim"), groupsClaim, "is already set by Keycloak, the operator or claims"))
+	}
+	if tokenClaims.FullGroupPath && tokenClaims.GroupsClaim == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("groupsClaim"), "fullGroupPath requires a groups claim"))
+	}
+	return allErrs
+}
+
+// validateStorageSize : storage sizes are a whole, non zero number of Gi. Empty uses the operator config map size.
+func validateStorageSize(fldPath *field.Path, storageSize string) field.ErrorList {
+	var allErrs field.ErrorList
+	if storageSize == "" {
+		return allErrs
+	}
+	if !storageSizePattern.MatchString(storageSize) {
+		return append(allErrs, field.Invalid(fldPath, storageSize, "must be a number of Gi, for example 10Gi"))
+	}
+	quantity, err := resource.ParseQuantity(storageSize)
+	if err != nil || quantity.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, storageSize, "must be larger than 0Gi"))
+	}
+	return allErrs
+}
+
+// validateStorage : the size of a volume is a quantity larger than zero
+func validateStorage(fldPath *field.Path, storage *StorageSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if storage == nil || storage.Size == "" {
+		return allErrs
+	}
+	quantity, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("size"), storage.Size, "must be a quantity, for example 10Gi"))
+	} else if quantity.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("size"), storage.Size, "must be larger than 0"))
+	}
+	return allErrs
+}
+
+// validateStorageUpdate : volumes can grow but not shrink, and keep the storage class they were created with
+func validateStorageUpdate(fldPath *field.Path, storage *StorageSpec, oldStorage *StorageSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if storage == nil || oldStorage == nil {
+		return allErrs
+	}
+	if oldStorage.StorageClassName != "" && storage.StorageClassName != oldStorage.StorageClassName {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("storageClassName"), "field is immutable"))
+	}
+	size, err := resource.ParseQuantity(storage.Size)
+	oldSize, oldErr := resource.ParseQuantity(oldStorage.Size)
+	if err == nil && oldErr == nil && size.Cmp(oldSize) < 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("size"), "volumes cannot shrink below "+oldSize.String()))
+	}
+	return allErrs
+}
+
+// validateTLS : a cert-manager section must name an Issuer or ClusterIssuer, a provided secret replaces cert-manager
+func validateTLS(fldPath *field.Path, tls *TLSSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if tls == nil || tls.CertManager == nil {
+		return allErrs
+	}
+	if tls.SecretName != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("secretName"), "cannot be combined with certManager"))
+	}
+	issuerPath := fldPath.Child("certManager", "issuerRef")
+	issuerRef := tls.CertManager.IssuerRef
+	if issuerRef.Name == "" {
+		allErrs = append(allErrs, field.Required(issuerPath.Child("name"), "name of the cert-manager issuer"))
+	}
+	issuerKinds := []string{"Issuer", "ClusterIssuer"}
+	if issuerRef.Kind != "" && !contains(issuerKinds, issuerRef.Kind) {
+		allErrs = append(allErrs, field.NotSupported(issuerPath.Child("kind"), issuerRef.Kind, issuerKinds))
+	}
+	return allErrs
+}
+
+// validateCABundle : a CA bundle is read from either a config map or a secret
+func validateCABundle(fldPath *field.Path, caBundle *CABundleSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if caBundle == nil {
+		return allErrs
+	}
+	if caBundle.ConfigMap == "" && caBundle.Secret == "" {
+		allErrs = append(allErrs, field.Required(fldPath, "a configMap or secret holding the CA certificates is required"))
+	} else if caBundle.ConfigMap != "" && caBundle.Secret != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("secret"), "cannot be combined with configMap"))
+	}
+	return allErrs
+}
+
+// validateResources : a container cannot request more of a resource than its limit
+func validateResources(fldPath *field.Path, resources *corev1.ResourceRequirements) field.ErrorList {
+	var allErrs field.ErrorList
+	if resources == nil {
+		return allErrs
+	}
+	for name, request := range resources.Requests {
+		limit, ok := resources.Limits[name]
+		if ok && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("requests").Key(string(name)), request.String(), "must be less than or equal to the "+string(name)+" limit "+limit.String()))
+		}
+	}
+	return allErrs
+}
+
+// validateProbes : the startup and liveness probes succeed on the first successful run, as Kubernetes requires
+func validateProbes(fldPath *field.Path, probes *ProbesSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if probes == nil {
+		return allErrs
+	}
+	if probe := probes.Startup; probe != nil && probe.SuccessThreshold != nil && *probe.SuccessThreshold != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("startup", "successThreshold"), *probe.SuccessThreshold, "must be 1"))
+	}
+	if probe := probes.Liveness; probe != nil && probe.SuccessThreshold != nil && *probe.SuccessThreshold != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("liveness", "successThreshold"), *probe.SuccessThreshold, "must be 1"))
+	}
+	return allErrs
+}
+
+// validateEnv : variables have unique, valid names not set by the operator, and either a value or a valueFrom source
+func validateEnv(fldPath *field.Path, env []corev1.EnvVar) field.ErrorList {
+	var allErrs field.ErrorList
+	var names []string
+	for i, envVar := range env {
+		namePath := fldPath.Index(i).Child("name")
+		switch {
+		case envVar.Name == "":
+			allErrs = append(allErrs, field.Required(namePath, "name of the variable"))
+		case contains(operatorEnvVars, envVar.Name):
+			allErrs = append(allErrs, field.Invalid(namePath, envVar.Name, "is set by the operator"))
+		case contains(names, envVar.Name):
+			allErrs = append(allErrs, field.Duplicate(namePath, envVar.Name))
+		default:
+			for _, message := range validation.IsEnvVarName(envVar.Name) {
+				allErrs = append(allErrs, field.Invalid(namePath, envVar.Name, message))
+			}
+		}
+		names = append(names, envVar.Name)
+		if envVar.Value != "" && envVar.ValueFrom != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Index(i).Child("valueFrom"), "cannot be combined with value"))
+		}
+	}
+	return allErrs
+}
+
+// validateBuildRegistry : the registry is a host and optional port, images are pushed under a repository path
+func validateBuildRegistry(fldPath *field.Path, registry *BuildRegistrySpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if registry == nil {
+		return allErrs
+	}
+	if registry.URL == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("url"), "host of the registry"))
+	} else if !registryPattern.MatchString(registry.URL) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("url"), registry.URL, "must be a registry host and optional port without a scheme or path, for example registry.example.com:5000"))
+	}
+	if registry.SecretName != "" {
+		for _, message := range validation.IsDNS1123Subdomain(registry.SecretName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("secretName"), registry.SecretName, message))
+		}
+	}
+	if registry.NamespacePrefix != "" && !repositoryPattern.MatchString(registry.NamespacePrefix) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("namespacePrefix"), registry.NamespacePrefix, "must be lower case path components of letters, numbers and '.', '_' or '-' separators"))
+	}
+	return allErrs
+}
+
+// validatePFEVolumes : extra volumes have unique names not used by the operator, and are mounted outside the
+// directories of the operator volumes
+func validatePFEVolumes(fldPath *field.Path, pfe *PFESpec) field.ErrorList {
+	var allErrs field.ErrorList
+	var volumeNames []string
+	for i, volume := range pfe.ExtraVolumes {
+		namePath := fldPath.Child("extraVolumes").Index(i).Child("name")
+		switch {
+		case volume.Name == "":
+			allErrs = append(allErrs, field.Required(namePath, "name of the volume"))
+		case contains(pfeVolumes, volume.Name):
+			allErrs = append(allErrs, field.Invalid(namePath, volume.Name, "is a volume of the operator"))
+		case contains(volumeNames, volume.Name):
+			allErrs = append(allErrs, field.Duplicate(namePath, volume.Name))
+		default:
+			for _, message := range validation.IsDNS1123Label(volume.Name) {
+				allErrs = append(allErrs, field.Invalid(namePath, volume.Name, message))
+			}
+		}
+		volumeNames = append(volumeNames, volume.Name)
+	}
+	var mountPaths []string
+	for i, mount := range pfe.ExtraVolumeMounts {
+		mountPath := fldPath.Child("extraVolumeMounts").Index(i)
+		if !contains(volumeNames, mount.Name) {
+			allErrs = append(allErrs, field.NotFound(mountPath.Child("name"), mount.Name))
+		}
+		cleanPath := path.Clean(mount.MountPath)
+		switch {
+		case !path.IsAbs(mount.MountPath) || cleanPath == "/":
+			allErrs = append(allErrs, field.Invalid(mountPath.Child("mountPath"), mount.MountPath, "must be an absolute path below the root directory"))
+		case contains(mountPaths, cleanPath):
+			allErrs = append(allErrs, field.Duplicate(mountPath.Child("mountPath"), mount.MountPath))
+		default:
+			for _, operatorPath := range pfeMountPaths {
+				if cleanPath == operatorPath || strings.HasPrefix(cleanPath, operatorPath+"/") || strings.HasPrefix(operatorPath, cleanPath+"/") {
+					allErrs = append(allErrs, field.Invalid(mountPath.Child("mountPath"), mount.MountPath, "overlaps the operator volume at "+operatorPath))
+					break
+				}
+			}
+		}
+		mountPaths = append(mountPaths, cleanPath)
+	}
+	return allErrs
+}
+
+// validateImage : the repository holds no tag or digest, and an image is pinned by either a tag or a digest
+func validateImage(fldPath *field.Path, image *ImageSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if image == nil {
+		return allErrs
+	}
+	if strings.Contains(image.Repository, "@") || strings.LastIndex(image.Repository, ":") > strings.LastIndex(image.Repository, "/") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("repository"), image.Repository, "must not contain a tag or digest, use the tag and digest fields"))
+	}
+	if image.Digest != "" && !digestPattern.MatchString(image.Digest) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("digest"), image.Digest, "must be an algorithm and hex digest, for example sha256:..."))
+	}
+	if image.Digest != "" && image.Tag != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("tag"), "cannot be combined with digest"))
+	}
+	return allErrs
+}
+
+// contains : true when value is one of the list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1alpha1
+
+// v1alpha1 is the storage version of the API and the hub the other versions are converted through
+
+// Hub : marks Codewind as the conversion hub
+func (*Codewind) Hub() {}
+
+// Hub : marks Keycloak as the conversion hub
+func (*Keycloak) Hub() {}
@@ -0,0 +1,24 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+// ImageSpec : container image of a component, fields left empty are taken from the operator defaults
+type ImageSpec struct {
+	// Repository : image repository, for example registry.example.com/eclipse/codewind-pfe-amd64
+	Repository string `json:"repository,omitempty"`
+
+	// Tag : image tag, ignored when digest is set
+	Tag string `json:"tag,omitempty"`
+
+	// Digest : image digest, for example sha256:...
+	// +kubebuilder:validation:Pattern=^[a-z0-9]+:[a-f0-9]+$
+	Digest string `json:"digest,omitempty"`
+}
@@ -0,0 +1,35 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+// IngressSpec : ingress controller settings of the generated Ingress objects, fields left empty are taken from the
+// operator config map. Not used on OpenShift, where routes are created instead
+type IngressSpec struct {
+	// ClassName : ingress class of the controller serving the Ingress, such as traefik, contour or alb. Set with the
+	// kubernetes.io/ingress.class annotation, nginx by default. The nginx annotations are only added for nginx
+	ClassName string `json:"className,omitempty"`
+
+	// Annotations : annotations added to the Ingress, replacing the generated annotations of the same name. An
+	// empty value removes a generated annotation
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// RouteSpec : TLS settings of the gatekeeper route on OpenShift
+type RouteSpec struct {
+	// Termination : where TLS is terminated, passthrough by default. The router terminates edge and reencrypt routes,
+	// reencrypt routes then open a new TLS connection to the gatekeeper
+	// +kubebuilder:validation:Enum=edge;reencrypt;passthrough
+	Termination string `json:"termination,omitempty"`
+
+	// CertificateSecret : secret in the namespace of the CR holding the route certificate in tls.crt and tls.key,
+	// with an optional ca.crt. Edge and reencrypt routes only, the default certificate of the router when not set
+	CertificateSecret string `json:"certificateSecret,omitempty"`
+}
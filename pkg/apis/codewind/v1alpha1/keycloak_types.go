@@ -12,15 +12,373 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // KeycloakSpec defines the desired state of Keycloak
 type KeycloakSpec struct {
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
-	// StorageSize : Size of the Keycloak PVC
+	// Unmanaged : use the existing Keycloak server at url instead of deploying one. The operator still configures
+	// the realm and the clients of the Codewind deployments in it
+	Unmanaged bool `json:"unmanaged,omitempty"`
+
+	// URL : https URL of the existing Keycloak server, required when unmanaged
+	URL string `json:"url,omitempty"`
+
+	// AdminCredentialsSecret : secret holding the keycloak-admin-user and keycloak-admin-password of the existing
+	// Keycloak server, required when unmanaged
+	AdminCredentialsSecret string `json:"adminCredentialsSecret,omitempty"`
+
+	// StorageSize : Size of the Keycloak PVC, storage.size takes precedence
 	// +kubebuilder:validation:Pattern=[0-9]*Gi$
-	StorageSize string `json:"storageSize"`
+	StorageSize string `json:"storageSize,omitempty"`
+
+	// Storage : size and storage class of the Keycloak volume, defaults to the operator config map
+	Storage *StorageSpec `json:"storage,omitempty"`
+
+	// Database : external PostgreSQL database of Keycloak, replaces the embedded database and its volume
+	Database *KeycloakDatabaseSpec `json:"database,omitempty"`
+
+	// Replicas : number of Keycloak pods, defaults to 1. More than one replica requires an external database
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// IngressDomain : ingress domain of the Keycloak route, defaults to the operator config map
+	IngressDomain string `json:"ingressDomain,omitempty"`
+
+	// Ingress : ingress class and annotations of the Keycloak Ingress, defaults to the operator config map
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// ImageTag : tag of the Keycloak image
+	ImageTag string `json:"imageTag,omitempty"`
+
+	// Version : Codewind version of the operator version catalog, selects the tested Keycloak image tag and overrides imageTag
+	Version string `json:"version,omitempty"`
+
+	// Distribution : legacy for Keycloak serving its REST API under /auth, quarkus for Keycloak 17 or later serving
+	// it from the root. Detected from the running server when not set
+	// +kubebuilder:validation:Enum=legacy;quarkus
+	Distribution string `json:"distribution,omitempty"`
+
+	// Images : image of the Keycloak container, overrides imageTag and the operator config map default
+	Images *KeycloakImagesSpec `json:"images,omitempty"`
+
+	// ImagePullSecrets : secrets used to pull the Keycloak image, defaults to the operator config map
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// TLS : issue the Keycloak certificate with cert-manager, or use an existing secret, instead of a self-signed
+	// certificate
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// CABundle : CA certificates the operator trusts when calling this Keycloak, defaults to the bundle of the operator config map
+	CABundle *CABundleSpec `json:"caBundle,omitempty"`
+
+	// Resources : compute resources of the Keycloak container, defaults to the operator config map
+	Resources *KeycloakResourcesSpec `json:"resources,omitempty"`
+
+	// Probes : timings of the startup, liveness and readiness probes of the Keycloak container
+	Probes *KeycloakProbesSpec `json:"probes,omitempty"`
+
+	// NodeSelector : node labels the Keycloak pod must be scheduled on
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations : tolerations of the Keycloak pod
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity : scheduling constraints of the Keycloak pod
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Architecture : selects the Keycloak image built for this node architecture, the pod is scheduled on nodes of
+	// the architecture of its image. Defaults to the architecture key of the operator config map, else amd64
+	// +kubebuilder:validation:Enum=amd64;ppc64le;s390x
+	Architecture string `json:"architecture,omitempty"`
+
+	// PriorityClassName : priority class of the Keycloak pod, the default priority of the cluster when not set
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Realm : realm holding the clients and access roles of the Codewind deployments, defaults to the defaultRealm
+	// of the operator config map
+	Realm *KeycloakRealmSpec `json:"realm,omitempty"`
+
+	// UserFederation : external user directories the Codewind realm authenticates its users against
+	UserFederation *KeycloakUserFederationSpec `json:"userFederation,omitempty"`
+
+	// IdentityProviders : external identity providers the users of the Codewind realm can log in with
+	IdentityProviders []IdentityProviderSpec `json:"identityProviders,omitempty"`
+
+	// SMTP : mail server the Codewind realm sends password reset and email verification messages with
+	SMTP *KeycloakSMTPSpec `json:"smtp,omitempty"`
+
+	// PasswordPolicy : rules the passwords of the Codewind realm users must follow, the realm policy is left unchanged when not set
+	PasswordPolicy *PasswordPolicySpec `json:"passwordPolicy,omitempty"`
+
+	// BruteForceProtection : lock out accounts of the Codewind realm after repeated login failures, the realm settings
+	// are left unchanged when not set
+	BruteForceProtection *BruteForceProtectionSpec `json:"bruteForceProtection,omitempty"`
+
+	// Branding : login theme and branding of the Codewind realm login page
+	Branding *KeycloakBrandingSpec `json:"branding,omitempty"`
+
+	// NetworkPolicies : create a NetworkPolicy admitting only HTTP traffic and the traffic between Keycloak replicas,
+	// defaults to enableNetworkPolicies of the operator config map
+	NetworkPolicies *bool `json:"networkPolicies,omitempty"`
+
+	// SecurityContext : security settings of the Keycloak pods, defaults to the operator config map
+	SecurityContext *PodSecuritySpec `json:"securityContext,omitempty"`
+
+	// Backup : scheduled exports of the Codewind realm, and the export a new realm is restored from
+	Backup *KeycloakBackupSpec `json:"backup,omitempty"`
+}
+
+// KeycloakBackupSpec : when the Codewind realm is exported, where the exports are kept and the export the realm is
+// restored from when it does not exist yet
+type KeycloakBackupSpec struct {
+	// Interval : time between two exports of the realm, eg 24h. Without an interval the realm is only exported
+	// when the backup annotation is set
+	Interval string `json:"interval,omitempty"`
+
+	// SecretName : keep the exports in this secret instead of the realm export config map
+	SecretName string `json:"secretName,omitempty"`
+
+	// Retain : number of exports kept, defaults to 1. The latest export is always under realm.json
+	// +kubebuilder:validation:Minimum=1
+	Retain int32 `json:"retain,omitempty"`
+
+	// RestoreFrom : export the realm is created from when it does not exist in Keycloak, eg after the Keycloak
+	// volume was lost. Ignored for a shared realm
+	RestoreFrom *KeycloakRestoreSpec `json:"restoreFrom,omitempty"`
+}
+
+// KeycloakRestoreSpec : config map or secret holding a realm export
+type KeycloakRestoreSpec struct {
+	// ConfigMapName : config map in the Keycloak namespace holding the export
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// SecretName : secret in the Keycloak namespace holding the export
+	SecretName string `json:"secretName,omitempty"`
+
+	// Key : key of the export in the config map or secret, defaults to realm.json
+	Key string `json:"key,omitempty"`
+}
+
+// KeycloakDatabaseSpec : external PostgreSQL database holding the Keycloak data
+type KeycloakDatabaseSpec struct {
+	// Host : hostname of the database server
+	Host string `json:"host"`
+
+	// Port : port of the database server, defaults to 5432
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// Database : name of the database, defaults to keycloak
+	Database string `json:"database,omitempty"`
+
+	// CredentialsSecret : name of a secret in this namespace holding the "username" and "password" of the database user
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// KeycloakImagesSpec : container images of a Keycloak instance
+type KeycloakImagesSpec struct {
+	// Keycloak : image of the Keycloak container
+	Keycloak *ImageSpec `json:"keycloak,omitempty"`
+}
+
+// KeycloakResourcesSpec : compute resources of the containers of a Keycloak instance
+type KeycloakResourcesSpec struct {
+	// Keycloak : resources of the Keycloak container
+	Keycloak *corev1.ResourceRequirements `json:"keycloak,omitempty"`
+}
+
+// KeycloakProbesSpec : probe timings of the containers of a Keycloak instance
+type KeycloakProbesSpec struct {
+	// Keycloak : probes of the Keycloak container
+	Keycloak *ProbesSpec `json:"keycloak,omitempty"`
+}
+
+// KeycloakUserFederationSpec : external user directories of the Codewind realm
+type KeycloakUserFederationSpec struct {
+	// LDAP : LDAP or Active Directory server holding the users of the realm
+	LDAP *LDAPFederationSpec `json:"ldap,omitempty"`
+}
+
+// LDAPFederationSpec : LDAP user federation provider added to the Codewind realm
+type LDAPFederationSpec struct {
+	// ConnectionURL : URL of the LDAP server, for example ldaps://ldap.example.com:636
+	// +kubebuilder:validation:Pattern=^ldaps?://
+	ConnectionURL string `json:"connectionURL"`
+
+	// Vendor : type of the LDAP server, defaults to other
+	// +kubebuilder:validation:Enum=ad;rhds;tivoli;edirectory;other
+	Vendor string `json:"vendor,omitempty"`
+
+	// BindCredentialsSecret : name of a secret in this namespace holding the "bindDN" and "bindCredential" used to search
+	// the directory, the server is searched anonymously when not set
+	BindCredentialsSecret string `json:"bindCredentialsSecret,omitempty"`
+
+	// UsersDN : DN of the LDAP tree holding the users, for example ou=users,dc=example,dc=com
+	UsersDN string `json:"usersDN"`
+
+	// UsernameAttribute : LDAP attribute mapped to the Keycloak username, defaults to sAMAccountName for ad and uid otherwise
+	UsernameAttribute string `json:"usernameAttribute,omitempty"`
+
+	// UserObjectClasses : object classes of the LDAP users, defaults to the classes of the vendor
+	UserObjectClasses []string `json:"userObjectClasses,omitempty"`
+
+	// Sync : how users are synchronized from the LDAP server
+	Sync *LDAPSyncSpec `json:"sync,omitempty"`
+}
+
+// LDAPSyncSpec : synchronization of LDAP users into the Codewind realm
+type LDAPSyncSpec struct {
+	// ImportUsers : copy the LDAP users into the Keycloak database, defaults to true
+	ImportUsers *bool `json:"importUsers,omitempty"`
+
+	// FullSyncPeriod : seconds between two synchronizations of all users, periodic full synchronization is off when not set
+	// +kubebuilder:validation:Minimum=0
+	FullSyncPeriod int32 `json:"fullSyncPeriod,omitempty"`
+
+	// ChangedSyncPeriod : seconds between two synchronizations of changed users, off when not set
+	// +kubebuilder:validation:Minimum=0
+	ChangedSyncPeriod int32 `json:"changedSyncPeriod,omitempty"`
+}
+
+// IdentityProviderSpec : identity provider brokered by the Codewind realm
+type IdentityProviderSpec struct {
+	// Alias : name of the provider in the realm, part of its redirect URI
+	// +kubebuilder:validation:Pattern=^[a-z0-9-]+$
+	Alias string `json:"alias"`
+
+	// Type : kind of the provider
+	// +kubebuilder:validation:Enum=github;google;oidc;saml
+	Type string `json:"type"`
+
+	// DisplayName : name shown on the login page, defaults to the alias
+	DisplayName string `json:"displayName,omitempty"`
+
+	// ClientCredentialsSecret : name of a secret in this namespace holding the "clientID" and "clientSecret" the realm
+	// is registered with at the provider, required for all types except saml
+	ClientCredentialsSecret string `json:"clientCredentialsSecret,omitempty"`
+
+	// IssuerURL : issuer of an oidc provider, its discovery document supplies the endpoints of the provider
+	IssuerURL string `json:"issuerURL,omitempty"`
+
+	// MetadataURL : URL of the SAML metadata of a saml provider
+	MetadataURL string `json:"metadataURL,omitempty"`
+
+	// Config : further Keycloak settings of the provider, applied over the settings made by the operator
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// KeycloakSMTPSpec : mail server of the Codewind realm
+type KeycloakSMTPSpec struct {
+	// Host : hostname of the SMTP server
+	Host string `json:"host"`
+
+	// Port : port of the SMTP server, defaults to 25
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// From : email address the messages are sent from
+	From string `json:"from"`
+
+	// FromDisplayName : name shown as the sender of the messages
+	FromDisplayName string `json:"fromDisplayName,omitempty"`
+
+	// CredentialsSecret : name of a secret in this namespace holding the "username" and "password" of the SMTP server,
+	// messages are sent without authentication when not set
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+
+	// SSL : connect to the server over TLS
+	SSL bool `json:"ssl,omitempty"`
+
+	// StartTLS : upgrade the connection to TLS with STARTTLS
+	StartTLS bool `json:"startTLS,omitempty"`
+}
+
+// PasswordPolicySpec : password policy of the Codewind realm, rules that are not set do not apply
+type PasswordPolicySpec struct {
+	// MinLength : minimum number of characters
+	// +kubebuilder:validation:Minimum=1
+	MinLength int32 `json:"minLength,omitempty"`
+
+	// MinDigits : minimum number of digits
+	// +kubebuilder:validation:Minimum=0
+	MinDigits int32 `json:"minDigits,omitempty"`
+
+	// MinLowerCase : minimum number of lower case letters
+	// +kubebuilder:validation:Minimum=0
+	MinLowerCase int32 `json:"minLowerCase,omitempty"`
+
+	// MinUpperCase : minimum number of upper case letters
+	// +kubebuilder:validation:Minimum=0
+	MinUpperCase int32 `json:"minUpperCase,omitempty"`
+
+	// MinSpecialChars : minimum number of characters that are neither letters nor digits
+	// +kubebuilder:validation:Minimum=0
+	MinSpecialChars int32 `json:"minSpecialChars,omitempty"`
+
+	// NotUsername : the password may not be the username
+	NotUsername bool `json:"notUsername,omitempty"`
+
+	// PasswordHistory : number of previous passwords that may not be reused
+	// +kubebuilder:validation:Minimum=0
+	PasswordHistory int32 `json:"passwordHistory,omitempty"`
+
+	// ExpireDays : days after which users must change their password
+	// +kubebuilder:validation:Minimum=0
+	ExpireDays int32 `json:"expireDays,omitempty"`
+}
+
+// BruteForceProtectionSpec : brute force detection of the Codewind realm
+type BruteForceProtectionSpec struct {
+	// MaxLoginFailures : login failures after which the account is locked, defaults to 30
+	// +kubebuilder:validation:Minimum=1
+	MaxLoginFailures int32 `json:"maxLoginFailures,omitempty"`
+
+	// WaitIncrementSeconds : seconds the account is locked for after reaching the failures, defaults to 60
+	// +kubebuilder:validation:Minimum=1
+	WaitIncrementSeconds int32 `json:"waitIncrementSeconds,omitempty"`
+
+	// MaxWaitSeconds : longest temporary lockout in seconds, defaults to 900
+	// +kubebuilder:validation:Minimum=1
+	MaxWaitSeconds int32 `json:"maxWaitSeconds,omitempty"`
+
+	// FailureResetSeconds : seconds after which the count of login failures is reset, defaults to 43200
+	// +kubebuilder:validation:Minimum=1
+	FailureResetSeconds int32 `json:"failureResetSeconds,omitempty"`
+
+	// PermanentLockout : disable the account instead of locking it temporarily, an administrator has to enable it again
+	PermanentLockout bool `json:"permanentLockout,omitempty"`
+}
+
+// KeycloakRealmSpec : realm the Codewind deployments are configured in
+type KeycloakRealmSpec struct {
+	// Name : name of the realm, defaults to the defaultRealm of the operator config map
+	// +kubebuilder:validation:Pattern=^[A-Za-z0-9_-]*$
+	Name string `json:"name,omitempty"`
+
+	// Shared : the realm already exists and is shared with other applications. The operator checks that it exists
+	// instead of creating it and only adds the client and access role of each workspace. Settings of the spec that
+	// change the whole realm cannot be combined with a shared realm
+	Shared bool `json:"shared,omitempty"`
+}
+
+// KeycloakBrandingSpec : branding of the Codewind realm login page, settings that are not set are left unchanged
+type KeycloakBrandingSpec struct {
+	// LoginTheme : login theme of the realm, must be installed in the Keycloak image
+	LoginTheme string `json:"loginTheme,omitempty"`
+
+	// DisplayName : name of the realm shown in page titles
+	DisplayName string `json:"displayName,omitempty"`
+
+	// DisplayNameHTML : HTML shown above the login form in place of the display name
+	DisplayNameHTML string `json:"displayNameHTML,omitempty"`
+
+	// LogoURL : URL of a logo image shown above the login form, before the display name HTML
+	LogoURL string `json:"logoURL,omitempty"`
 }
 
 // KeycloakStatus defines the observed state of Keycloak
@@ -29,11 +387,82 @@ type KeycloakStatus struct {
 	Phase        string `json:"phase"`
 	AccessURL    string `json:"url"`
 	DefaultRealm string `json:"defaultRealm"`
+
+	// Distribution : distribution of the running Keycloak, deciding the paths of its REST API
+	Distribution string `json:"distribution,omitempty"`
+
+	// Conditions : state of the checks made against the Keycloak service
+	Conditions []KeycloakCondition `json:"conditions,omitempty"`
+
+	// UserFederationHash : hash of the user federation last pushed to the realm, including its bind credentials
+	UserFederationHash string `json:"userFederationHash,omitempty"`
+
+	// IdentityProviders : aliases of the identity providers the operator configured in the realm
+	IdentityProviders []string `json:"identityProviders,omitempty"`
+
+	// IdentityProvidersHash : hash of the identity providers last pushed to the realm, including their client credentials
+	IdentityProvidersHash string `json:"identityProvidersHash,omitempty"`
+
+	// SMTPHash : hash of the mail server settings last pushed to the realm, including its credentials
+	SMTPHash string `json:"smtpHash,omitempty"`
+
+	// LastBackupTime : when the realm was last exported
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+}
+
+// KeycloakConditionType : a check reported in the Keycloak status
+type KeycloakConditionType string
+
+// Conditions reported in the Keycloak status
+const (
+	// KeycloakAdminCredentialsValid : the operator can log in to Keycloak with the credentials of its admin secret
+	KeycloakAdminCredentialsValid KeycloakConditionType = "AdminCredentialsValid"
+
+	// KeycloakAdminAPIAvailable : requests are sent to the admin API of Keycloak, False while its circuit is open after
+	// repeated failures
+	KeycloakAdminAPIAvailable KeycloakConditionType = "AdminAPIAvailable"
+
+	// KeycloakUserFederationReady : the user federation of the spec is configured in the realm
+	KeycloakUserFederationReady KeycloakConditionType = "UserFederationReady"
+
+	// KeycloakIdentityProvidersReady : the identity providers of the spec are configured in the realm
+	KeycloakIdentityProvidersReady KeycloakConditionType = "IdentityProvidersReady"
+
+	// KeycloakSMTPReady : the mail server of the spec is configured in the realm
+	KeycloakSMTPReady KeycloakConditionType = "SMTPReady"
+
+	// KeycloakSecurityPolicyReady : the password policy and brute force protection of the spec are applied to the realm
+	KeycloakSecurityPolicyReady KeycloakConditionType = "SecurityPolicyReady"
+
+	// KeycloakBrandingReady : the branding of the spec is applied to the realm
+	KeycloakBrandingReady KeycloakConditionType = "BrandingReady"
+
+	// KeycloakUnsupportedArchitecture : the version of the spec has no Keycloak image for the architecture of the pod
+	KeycloakUnsupportedArchitecture KeycloakConditionType = "UnsupportedArchitecture"
+)
+
+// KeycloakCondition : state of one check made against a Keycloak service
+type KeycloakCondition struct {
+	// Type : the check
+	Type KeycloakConditionType `json:"type"`
+
+	// Status : True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Reason : one word CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+
+	// Message : human readable details of the last transition
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime : when the status last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Keycloak is the Schema for the keycloaks API
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=keycloaks,scope=Namespaced
 // +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".metadata.namespace",priority=0,description="Deployment namespace"
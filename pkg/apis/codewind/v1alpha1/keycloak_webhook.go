@@ -0,0 +1,219 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-codewind-eclipse-org-v1alpha1-keycloak,mutating=false,failurePolicy=fail,groups=codewind.eclipse.org,resources=keycloaks,versions=v1alpha1,name=vkeycloak.codewind.eclipse.org
+
+var _ webhook.Validator = &Keycloak{}
+
+// SetupWebhookWithManager : registers the Keycloak webhooks with the manager webhook server
+func (r *Keycloak) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// ValidateCreate : rejects a new Keycloak CR with an invalid spec
+func (r *Keycloak) ValidateCreate() error {
+	return r.invalidError(r.validateSpec())
+}
+
+// ValidateUpdate : rejects an invalid spec and a volume that would shrink
+func (r *Keycloak) ValidateUpdate(old runtime.Object) error {
+	oldKeycloak, ok := old.(*Keycloak)
+	if !ok {
+		return fmt.Errorf("expected a Keycloak but got a %T", old)
+	}
+	allErrs := r.validateSpec()
+	allErrs = append(allErrs, validateStorageUpdate(field.NewPath("spec", "storage"), r.Spec.Storage, oldKeycloak.Spec.Storage)...)
+	return r.invalidError(allErrs)
+}
+
+// ValidateDelete : a Keycloak CR can always be deleted
+func (r *Keycloak) ValidateDelete() error {
+	return nil
+}
+
+// validateSpec : checks the spec for configurations the controller cannot deploy
+func (r *Keycloak) validateSpec() field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := validateStorageSize(specPath.Child("storageSize"), r.Spec.StorageSize)
+	allErrs = append(allErrs, validateStorage(specPath.Child("storage"), r.Spec.Storage)...)
+	allErrs = append(allErrs, validateTLS(specPath.Child("tls"), r.Spec.TLS)...)
+	if r.Spec.TLS != nil && r.Spec.TLS.ExternalTermination {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("tls", "externalTermination"), "Keycloak always serves plain HTTP behind its ingress"))
+	}
+	if r.Spec.Unmanaged {
+		if keycloakURL, err := url.Parse(r.Spec.URL); err != nil || keycloakURL.Scheme != "https" || keycloakURL.Host == "" {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("url"), r.Spec.URL, "must be the https URL of the existing Keycloak server"))
+		}
+		if r.Spec.AdminCredentialsSecret == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("adminCredentialsSecret"), "name of the secret holding the Keycloak admin credentials"))
+		}
+	} else if r.Spec.URL != "" || r.Spec.AdminCredentialsSecret != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("url"), "url and adminCredentialsSecret are only used when unmanaged"))
+	}
+	if r.Spec.Resources != nil {
+		allErrs = append(allErrs, validateResources(specPath.Child("resources", "keycloak"), r.Spec.Resources.Keycloak)...)
+	}
+	if r.Spec.Probes != nil {
+		allErrs = append(allErrs, validateProbes(specPath.Child("probes", "keycloak"), r.Spec.Probes.Keycloak)...)
+	}
+	if r.Spec.Images != nil {
+		allErrs = append(allErrs, validateImage(specPath.Child("images", "keycloak"), r.Spec.Images.Keycloak)...)
+	}
+	if r.Spec.Architecture != "" && !contains(architectures, r.Spec.Architecture) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("architecture"), r.Spec.Architecture, architectures))
+	}
+	if r.Spec.Replicas != nil && *r.Spec.Replicas > 1 && r.Spec.Database == nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("replicas"), "more than one replica requires an external database"))
+	}
+	if database := r.Spec.Database; database != nil {
+		databasePath := specPath.Child("database")
+		if database.Host == "" {
+			allErrs = append(allErrs, field.Required(databasePath.Child("host"), "hostname of the PostgreSQL server"))
+		}
+		if database.CredentialsSecret == "" {
+			allErrs = append(allErrs, field.Required(databasePath.Child("credentialsSecret"), "name of the secret holding the database username and password"))
+		}
+	}
+	allErrs = append(allErrs, validateCABundle(specPath.Child("caBundle"), r.Spec.CABundle)...)
+	if federation := r.Spec.UserFederation; federation != nil && federation.LDAP != nil {
+		ldapPath := specPath.Child("userFederation", "ldap")
+		if !strings.HasPrefix(federation.LDAP.ConnectionURL, "ldap://") && !strings.HasPrefix(federation.LDAP.ConnectionURL, "ldaps://") {
+			allErrs = append(allErrs, field.Invalid(ldapPath.Child("connectionURL"), federation.LDAP.ConnectionURL, "must be an ldap:// or ldaps:// URL"))
+		}
+		if federation.LDAP.UsersDN == "" {
+			allErrs = append(allErrs, field.Required(ldapPath.Child("usersDN"), "DN of the LDAP tree holding the users"))
+		}
+	}
+	allErrs = append(allErrs, validateIdentityProviders(specPath.Child("identityProviders"), r.Spec.IdentityProviders)...)
+	if realm := r.Spec.Realm; realm != nil && realm.Shared {
+		realmPath := specPath.Child("realm")
+		if realm.Name == "" {
+			allErrs = append(allErrs, field.Required(realmPath.Child("name"), "name of the existing shared realm"))
+		}
+		realmWide := []struct {
+			name string
+			set  bool
+		}{
+			{"smtp", r.Spec.SMTP != nil},
+			{"passwordPolicy", r.Spec.PasswordPolicy != nil},
+			{"bruteForceProtection", r.Spec.BruteForceProtection != nil},
+			{"branding", r.Spec.Branding != nil},
+			{"userFederation", r.Spec.UserFederation != nil},
+			{"identityProviders", len(r.Spec.IdentityProviders) > 0},
+		}
+		for _, setting := range realmWide {
+			if setting.set {
+				allErrs = append(allErrs, field.Forbidden(specPath.Child(setting.name), "changes the whole realm and cannot be combined with a shared realm"))
+			}
+		}
+	}
+	if branding := r.Spec.Branding; branding != nil && branding.LogoURL != "" {
+		if logoURL, err := url.Parse(branding.LogoURL); err != nil || (logoURL.Scheme != "https" && logoURL.Scheme != "http") || logoURL.Host == "" {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("branding", "logoURL"), branding.LogoURL, "must be an http or https URL"))
+		}
+	}
+	if smtp := r.Spec.SMTP; smtp != nil {
+		smtpPath := specPath.Child("smtp")
+		if smtp.Host == "" {
+			allErrs = append(allErrs, field.Required(smtpPath.Child("host"), "hostname of the SMTP server"))
+		}
+		if smtp.From == "" {
+			allErrs = append(allErrs, field.Required(smtpPath.Child("from"), "email address the messages are sent from"))
+		}
+		if smtp.SSL && smtp.StartTLS {
+			allErrs = append(allErrs, field.Forbidden(smtpPath.Child("startTLS"), "cannot be combined with ssl"))
+		}
+	}
+	if backup := r.Spec.Backup; backup != nil {
+		allErrs = append(allErrs, r.validateBackup(specPath.Child("backup"), backup)...)
+	}
+	return allErrs
+}
+
+// validateBackup : checks the export interval and that a restore names a single config map or secret
+func (r *Keycloak) validateBackup(backupPath *field.Path, backup *KeycloakBackupSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if backup.Interval != "" {
+		if interval, err := time.ParseDuration(backup.Interval); err != nil || interval < time.Minute {
+			allErrs = append(allErrs, field.Invalid(backupPath.Child("interval"), backup.Interval, "must be a duration of at least 1m, for example 24h"))
+		}
+	}
+	restore := backup.RestoreFrom
+	if restore == nil {
+		return allErrs
+	}
+	restorePath := backupPath.Child("restoreFrom")
+	if restore.ConfigMapName == "" && restore.SecretName == "" {
+		allErrs = append(allErrs, field.Required(restorePath.Child("configMapName"), "name of the config map or secret holding the realm export"))
+	} else if restore.ConfigMapName != "" && restore.SecretName != "" {
+		allErrs = append(allErrs, field.Forbidden(restorePath.Child("secretName"), "cannot be combined with configMapName"))
+	}
+	if r.Spec.Realm != nil && r.Spec.Realm.Shared {
+		allErrs = append(allErrs, field.Forbidden(restorePath, "a shared realm is never created by the operator and cannot be restored"))
+	}
+	return allErrs
+}
+
+// validateIdentityProviders : checks that aliases are unique and each provider has the settings of its type
+func validateIdentityProviders(providersPath *field.Path, providers []IdentityProviderSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	aliases := map[string]bool{}
+	for i, provider := range providers {
+		providerPath := providersPath.Index(i)
+		if provider.Alias == "" {
+			allErrs = append(allErrs, field.Required(providerPath.Child("alias"), "name of the provider in the realm"))
+		} else if aliases[provider.Alias] {
+			allErrs = append(allErrs, field.Duplicate(providerPath.Child("alias"), provider.Alias))
+		}
+		aliases[provider.Alias] = true
+		switch provider.Type {
+		case "github", "google", "oidc":
+			if provider.ClientCredentialsSecret == "" {
+				allErrs = append(allErrs, field.Required(providerPath.Child("clientCredentialsSecret"), "name of the secret holding the clientID and clientSecret"))
+			}
+			if provider.Type == "oidc" && provider.IssuerURL == "" {
+				allErrs = append(allErrs, field.Required(providerPath.Child("issuerURL"), "issuer of the OIDC provider"))
+			}
+		case "saml":
+			if provider.MetadataURL == "" {
+				allErrs = append(allErrs, field.Required(providerPath.Child("metadataURL"), "URL of the SAML metadata of the provider"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(providerPath.Child("type"), provider.Type, []string{"github", "google", "oidc", "saml"}))
+		}
+	}
+	return allErrs
+}
+
+// invalidError : converts a list of field errors into an Invalid API error, nil when the list is empty
+func (r *Keycloak) invalidError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: SchemeGroupVersion.Group, Kind: "Keycloak"}, r.Name, allErrs)
+}
@@ -0,0 +1,55 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1alpha1
+
+// ProbesSpec : timings of the startup, liveness and readiness probes of a container, probes and fields left empty
+// keep the defaults of the operator
+type ProbesSpec struct {
+	// Startup : probe holding off the liveness and readiness probes until the container has started
+	Startup *ProbeSpec `json:"startup,omitempty"`
+
+	// Liveness : probe restarting the container once it stops responding
+	Liveness *ProbeSpec `json:"liveness,omitempty"`
+
+	// Readiness : probe removing the pod from its service while it does not respond
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+}
+
+// ProbeSpec : timings of a probe
+type ProbeSpec struct {
+	// Disabled : removes the probe from the container
+	Disabled bool `json:"disabled,omitempty"`
+
+	// InitialDelaySeconds : seconds after the container started before the probe is first run
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=3600
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds : seconds between two runs of the probe
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=3600
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds : seconds a run of the probe may take
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=3600
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// SuccessThreshold : successful runs in a row after a failure before the probe succeeds, must be 1 for the
+	// startup and liveness probes
+	// +kubebuilder:validation:Minimum=1
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+
+	// FailureThreshold : failed runs in a row before the probe fails
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
@@ -0,0 +1,24 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+// ProxySpec : outbound HTTP proxy of the deployed components, fields left empty are taken from the operator config map
+type ProxySpec struct {
+	// HTTPProxy : proxy URL of plain HTTP requests, set as HTTP_PROXY
+	HTTPProxy string `json:"httpProxy,omitempty"`
+
+	// HTTPSProxy : proxy URL of HTTPS requests, set as HTTPS_PROXY
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+
+	// NoProxy : comma separated hosts, domains and CIDRs reached without the proxy, set as NO_PROXY. The cluster
+	// service domains and localhost are always added
+	NoProxy string `json:"noProxy,omitempty"`
+}
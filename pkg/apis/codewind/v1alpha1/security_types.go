@@ -0,0 +1,37 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSecuritySpec : security settings of the pods of a component, fields left empty are taken from the operator
+// config map and then from defaults complying with the restricted Pod Security Standard
+type PodSecuritySpec struct {
+	// RunAsNonRoot : require the containers to run as a user other than root, true by default
+	RunAsNonRoot *bool `json:"runAsNonRoot,omitempty"`
+
+	// RunAsUser : user ID of the containers, assigned by the security context constraint on OpenShift and 1001 elsewhere by default
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// FSGroup : group owning the volumes of the pods, assigned by the security context constraint on OpenShift and 1001 elsewhere by default
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+
+	// SeccompProfile : seccomp profile of the pods, such as runtime/default or localhost/<profile>, runtime/default by default
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+
+	// AllowPrivilegeEscalation : let the container processes gain more privileges than their parent, false by default
+	AllowPrivilegeEscalation *bool `json:"allowPrivilegeEscalation,omitempty"`
+
+	// DropCapabilities : Linux capabilities removed from the containers, ALL by default
+	DropCapabilities []corev1.Capability `json:"dropCapabilities,omitempty"`
+}
@@ -0,0 +1,22 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+// StorageSpec : persistent volume of a deployment
+type StorageSpec struct {
+	// Size : requested size of the volume, for example 10Gi. Growing the size expands the existing
+	// volume when its storage class allows volume expansion, volumes cannot shrink
+	Size string `json:"size,omitempty"`
+
+	// StorageClassName : storage class of the volume, defaults to the cluster default. Only applies
+	// when the volume is created
+	StorageClassName string `json:"storageClassName,omitempty"`
+}
@@ -0,0 +1,58 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package v1alpha1
+
+// TLSSpec : how the TLS certificates of a deployment are issued or provided, self-signed by the operator when empty
+type TLSSpec struct {
+	// CertManager : request the certificates from cert-manager
+	CertManager *CertManagerSpec `json:"certManager,omitempty"`
+
+	// SecretName : existing TLS secret in the namespace of the CR, such as a wildcard certificate of the ingress domain,
+	// holding tls.crt and tls.key. Used by the Ingress or route instead of a generated certificate, cannot be combined
+	// with certManager
+	SecretName string `json:"secretName,omitempty"`
+
+	// ExternalTermination : the ingress controller or load balancer terminates TLS and forwards plain HTTP to the
+	// gatekeeper, the published URLs stay https. Routes use edge termination. Codewind CR only, Keycloak always serves
+	// HTTP behind its ingress
+	ExternalTermination bool `json:"externalTermination,omitempty"`
+}
+
+// CertManagerSpec : cert-manager settings used to issue the certificates of a deployment
+type CertManagerSpec struct {
+	// IssuerRef : the cert-manager Issuer or ClusterIssuer that signs the certificates
+	IssuerRef CertManagerIssuerRef `json:"issuerRef"`
+}
+
+// CertManagerIssuerRef : reference to a cert-manager issuer
+type CertManagerIssuerRef struct {
+	// Name : name of the issuer
+	Name string `json:"name"`
+
+	// Kind : Issuer or ClusterIssuer, defaults to Issuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+
+	// Group : API group of the issuer, defaults to cert-manager.io
+	Group string `json:"group,omitempty"`
+}
+
+// CABundleSpec : PEM bundle of CA certificates, read from a config map or a secret
+type CABundleSpec struct {
+	// ConfigMap : name of a config map holding the bundle
+	ConfigMap string `json:"configMap,omitempty"`
+
+	// Secret : name of a secret holding the bundle
+	Secret string `json:"secret,omitempty"`
+
+	// Key : key of the bundle in the config map or secret, defaults to ca.crt
+	Key string `json:"key,omitempty"`
+}
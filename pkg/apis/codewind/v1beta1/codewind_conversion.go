@@ -0,0 +1,188 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1beta1
+
+import (
+	"reflect"
+
+	"github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo : converts this Codewind to the v1alpha1 storage version
+func (src *Codewind) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Codewind)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	src.Status.DeepCopyInto(&dst.Status)
+
+	spec := src.Spec
+	dst.Spec = v1alpha1.CodewindSpec{
+		Username:             spec.Username,
+		LogLevel:             spec.LogLevel,
+		LogLevels:            spec.LogLevels,
+		TrustedCABundle:      spec.TrustedCABundle,
+		GitCredentialsSecret: spec.GitCredentialsSecret,
+		BuildRegistry:        spec.BuildRegistry,
+		Env:                  spec.Env,
+		Resources:            spec.Resources,
+		Probes:               spec.Probes,
+		Components:           spec.Components,
+		NodeSelector:         spec.NodeSelector,
+		Tolerations:          spec.Tolerations,
+		Affinity:             spec.Affinity,
+		PriorityClassName:    spec.PriorityClassName,
+		SecurityContext:      spec.SecurityContext,
+		PFEPrivileged:        spec.PFEPrivileged,
+		PFE:                  spec.PFE,
+		Suspended:            spec.Suspended,
+		TTLAfterLastUse:      spec.TTLAfterLastUse,
+		TTLAction:            spec.TTLAction,
+		AdoptExisting:        spec.AdoptExisting,
+	}
+	if auth := spec.Auth; auth != nil {
+		dst.Spec.KeycloakDeployment = auth.KeycloakDeployment
+		dst.Spec.KeycloakRef = auth.KeycloakRef
+		dst.Spec.AccessList = auth.AccessList
+		dst.Spec.AccessGroups = auth.AccessGroups
+		dst.Spec.InitialPasswordSecret = auth.InitialPasswordSecret
+		dst.Spec.VerifyEmail = auth.VerifyEmail
+		provider := v1alpha1.CodewindAuthSpec{
+			ExternalOIDC:        auth.ExternalOIDC,
+			SessionTimeout:      auth.SessionTimeout,
+			SessionIdleTimeout:  auth.SessionIdleTimeout,
+			AccessTokenLifespan: auth.AccessTokenLifespan,
+			ServiceAccount:      auth.ServiceAccount,
+			TokenClaims:         auth.TokenClaims,
+			RemoteAccess:        auth.RemoteAccess,
+			SessionSecretRef:    auth.SessionSecretRef,
+		}
+		if !reflect.DeepEqual(provider, v1alpha1.CodewindAuthSpec{}) {
+			dst.Spec.Auth = &provider
+		}
+	}
+	if images := spec.Images; images != nil {
+		dst.Spec.Version = images.Version
+		dst.Spec.ImageTag = images.Tag
+		dst.Spec.ImagePullSecrets = images.PullSecrets
+		dst.Spec.Architecture = images.Architecture
+		if images.PFE != nil || images.Performance != nil || images.Gatekeeper != nil {
+			dst.Spec.Images = &v1alpha1.CodewindImagesSpec{
+				PFE:         images.PFE,
+				Performance: images.Performance,
+				Gatekeeper:  images.Gatekeeper,
+			}
+		}
+	}
+	var size, className string
+	if storage := spec.Storage; storage != nil {
+		size, className = storage.Size, storage.StorageClassName
+		dst.Spec.Backup = storage.Backup
+	}
+	dst.Spec.StorageSize, dst.Spec.Storage = storageToV1alpha1(&dst.ObjectMeta, size, className)
+	if networking := spec.Networking; networking != nil {
+		dst.Spec.IngressDomain = networking.IngressDomain
+		dst.Spec.Hostname = networking.Hostname
+		dst.Spec.Routing = networking.Routing
+		dst.Spec.Ingress = networking.Ingress
+		dst.Spec.Route = networking.Route
+		dst.Spec.TLS = networking.TLS
+		dst.Spec.Proxy = networking.Proxy
+		dst.Spec.NetworkPolicies = networking.NetworkPolicies
+	}
+	return nil
+}
+
+// ConvertFrom : converts a v1alpha1 Codewind to this version, sections left empty are omitted
+func (dst *Codewind) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Codewind)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	src.Status.DeepCopyInto(&dst.Status)
+
+	spec := src.Spec
+	dst.Spec = CodewindSpec{
+		Username:             spec.Username,
+		LogLevel:             spec.LogLevel,
+		LogLevels:            spec.LogLevels,
+		TrustedCABundle:      spec.TrustedCABundle,
+		GitCredentialsSecret: spec.GitCredentialsSecret,
+		BuildRegistry:        spec.BuildRegistry,
+		Env:                  spec.Env,
+		Resources:            spec.Resources,
+		Probes:               spec.Probes,
+		Components:           spec.Components,
+		NodeSelector:         spec.NodeSelector,
+		Tolerations:          spec.Tolerations,
+		Affinity:             spec.Affinity,
+		PriorityClassName:    spec.PriorityClassName,
+		SecurityContext:      spec.SecurityContext,
+		PFEPrivileged:        spec.PFEPrivileged,
+		PFE:                  spec.PFE,
+		Suspended:            spec.Suspended,
+		TTLAfterLastUse:      spec.TTLAfterLastUse,
+		TTLAction:            spec.TTLAction,
+		AdoptExisting:        spec.AdoptExisting,
+	}
+	auth := CodewindAuthSpec{
+		KeycloakDeployment:    spec.KeycloakDeployment,
+		KeycloakRef:           spec.KeycloakRef,
+		AccessList:            spec.AccessList,
+		AccessGroups:          spec.AccessGroups,
+		InitialPasswordSecret: spec.InitialPasswordSecret,
+		VerifyEmail:           spec.VerifyEmail,
+	}
+	if provider := spec.Auth; provider != nil {
+		auth.ExternalOIDC = provider.ExternalOIDC
+		auth.SessionTimeout = provider.SessionTimeout
+		auth.SessionIdleTimeout = provider.SessionIdleTimeout
+		auth.AccessTokenLifespan = provider.AccessTokenLifespan
+		auth.ServiceAccount = provider.ServiceAccount
+		auth.TokenClaims = provider.TokenClaims
+		auth.RemoteAccess = provider.RemoteAccess
+		auth.SessionSecretRef = provider.SessionSecretRef
+	}
+	if !reflect.DeepEqual(auth, CodewindAuthSpec{}) {
+		dst.Spec.Auth = &auth
+	}
+	images := CodewindImagesSpec{
+		Version:      spec.Version,
+		Tag:          spec.ImageTag,
+		PullSecrets:  spec.ImagePullSecrets,
+		Architecture: spec.Architecture,
+	}
+	if spec.Images != nil {
+		images.PFE = spec.Images.PFE
+		images.Performance = spec.Images.Performance
+		images.Gatekeeper = spec.Images.Gatekeeper
+	}
+	if !reflect.DeepEqual(images, CodewindImagesSpec{}) {
+		dst.Spec.Images = &images
+	}
+	size, className := storageFromV1alpha1(&dst.ObjectMeta, spec.StorageSize, spec.Storage)
+	storage := CodewindStorageSpec{Size: size, StorageClassName: className, Backup: spec.Backup}
+	if storage != (CodewindStorageSpec{}) {
+		dst.Spec.Storage = &storage
+	}
+	networking := CodewindNetworkingSpec{
+		IngressDomain:   spec.IngressDomain,
+		Hostname:        spec.Hostname,
+		Routing:         spec.Routing,
+		Ingress:         spec.Ingress,
+		Route:           spec.Route,
+		TLS:             spec.TLS,
+		Proxy:           spec.Proxy,
+		NetworkPolicies: spec.NetworkPolicies,
+	}
+	if networking != (CodewindNetworkingSpec{}) {
+		dst.Spec.Networking = &networking
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1beta1
+
+import (
+	"github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CodewindSpec defines the desired state of Codewind. The settings of v1alpha1 are grouped into the auth, images,
+// storage and networking sections, the settings themselves are unchanged
+type CodewindSpec struct {
+	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
+
+	// Developer username assigned to this instance
+	// +kubebuilder:validation:Pattern=^[A-Za-z0-9/-]*$
+	Username string `json:"username"`
+
+	// Auth : Keycloak or OIDC provider of this instance and the users granted access to it
+	Auth *CodewindAuthSpec `json:"auth,omitempty"`
+
+	// Images : version, images and architecture of the Codewind containers
+	Images *CodewindImagesSpec `json:"images,omitempty"`
+
+	// Storage : PFE workspace volume and its snapshots
+	Storage *CodewindStorageSpec `json:"storage,omitempty"`
+
+	// Networking : how the gatekeeper is published and the traffic admitted between the Codewind components
+	Networking *CodewindNetworkingSpec `json:"networking,omitempty"`
+
+	// LogLevel within pods
+	LogLevel string `json:"logLevel"`
+
+	// LogLevels : log level of each component, defaults to logLevel
+	LogLevels *v1alpha1.CodewindLogLevelsSpec `json:"logLevels,omitempty"`
+
+	// TrustedCABundle : config map or secret in the namespace of the CR holding PEM CA certificates, such as an
+	// internal CA of Keycloak or git servers. Mounted into the PFE, performance and gatekeeper containers and trusted
+	// by Node.js through NODE_EXTRA_CA_CERTS, in addition to the public CAs
+	TrustedCABundle *v1alpha1.CABundleSpec `json:"trustedCABundle,omitempty"`
+
+	// GitCredentialsSecret : secret in the namespace of the CR holding the credentials PFE clones private template and
+	// project repositories with, either a username and password or token, or an SSH private key and known_hosts
+	GitCredentialsSecret string `json:"gitCredentialsSecret,omitempty"`
+
+	// BuildRegistry : registry PFE pushes the project images it builds to
+	BuildRegistry *v1alpha1.BuildRegistrySpec `json:"buildRegistry,omitempty"`
+
+	// Env : extra environment variables of each component. Variables set by the operator cannot be replaced
+	Env *v1alpha1.CodewindEnvSpec `json:"env,omitempty"`
+
+	// Resources : compute resources of each component, defaults to the operator config map
+	Resources *v1alpha1.CodewindResourcesSpec `json:"resources,omitempty"`
+
+	// Probes : timings of the startup, liveness and readiness probes of each component, for example longer delays
+	// for PFE on slow storage
+	Probes *v1alpha1.CodewindProbesSpec `json:"probes,omitempty"`
+
+	// Components : optional components of the instance, which are all deployed by default
+	Components *v1alpha1.CodewindComponentsSpec `json:"components,omitempty"`
+
+	// NodeSelector : node labels the Codewind pods must be scheduled on
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations : tolerations of the Codewind pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity : scheduling constraints of the Codewind pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// PriorityClassName : priority class of the Codewind pods, the default priority of the cluster when not set
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// SecurityContext : security settings of the performance and gatekeeper pods, and of the PFE pod when it is not
+	// privileged. Defaults to the operator config map
+	SecurityContext *v1alpha1.PodSecuritySpec `json:"securityContext,omitempty"`
+
+	// PFEPrivileged : run PFE in a privileged container so it can build project images, true by default.
+	// A privileged PFE is rejected by namespaces enforcing the restricted Pod Security Standard
+	PFEPrivileged *bool `json:"pfePrivileged,omitempty"`
+
+	// PFE : settings of the PFE deployment
+	PFE *v1alpha1.PFESpec `json:"pfe,omitempty"`
+
+	// Suspended : scales the PFE, performance and gatekeeper deployments to zero while keeping the volumes, secrets
+	// and Keycloak client of the instance. Clearing it scales them back up
+	Suspended bool `json:"suspended,omitempty"`
+
+	// TTLAfterLastUse : how long the instance may be idle before the TTLAction is taken, such as 12h. Defaults to
+	// ttlAfterLastUse of the operator config map, an instance without one is never cleaned up
+	TTLAfterLastUse string `json:"ttlAfterLastUse,omitempty"`
+
+	// TTLAction : what happens to an instance idle for longer than TTLAfterLastUse, hibernate suspends it and delete
+	// removes the CR. Defaults to ttlAction of the operator config map, else hibernate
+	// +kubebuilder:validation:Enum=hibernate;delete
+	TTLAction string `json:"ttlAction,omitempty"`
+
+	// AdoptExisting : takes over the deployments, services, volume and secrets of a Codewind instance installed
+	// without the operator, named by the workspace ID in the codewindWorkspace annotation, instead of creating them
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+}
+
+// CodewindAuthSpec : auth provider of an instance of codewind and the users granted access to it
+type CodewindAuthSpec struct {
+	// KeycloakDeployment : name of the keycloak deployment used by this instance of codewind.
+	// Required unless externalOIDC is set
+	// +kubebuilder:validation:Pattern=^[A-Za-z0-9/-]*$
+	KeycloakDeployment string `json:"keycloakDeployment,omitempty"`
+
+	// KeycloakRef : Keycloak CR used by this instance of codewind, which may be in another namespace.
+	// Replaces keycloakDeployment
+	KeycloakRef *v1alpha1.KeycloakReference `json:"keycloakRef,omitempty"`
+
+	// ExternalOIDC : use an OIDC provider not managed by the operator instead of Keycloak
+	ExternalOIDC *v1alpha1.ExternalOIDCSpec `json:"externalOIDC,omitempty"`
+
+	// AccessList : further users granted access to this instance along with the developer user. Users
+	// removed from the list lose their access
+	AccessList []string `json:"accessList,omitempty"`
+
+	// AccessGroups : Keycloak groups whose members are granted access to this instance, missing groups are
+	// created. Groups removed from the list lose their access
+	AccessGroups []string `json:"accessGroups,omitempty"`
+
+	// InitialPasswordSecret : name of a secret in this namespace whose "password" key holds a temporary
+	// password used when the operator creates the developer user. Existing users are left unchanged.
+	InitialPasswordSecret string `json:"initialPasswordSecret,omitempty"`
+
+	// VerifyEmail : require a newly created developer user to verify their email address
+	VerifyEmail bool `json:"verifyEmail,omitempty"`
+
+	// SessionTimeout : longest time a login session lasts before the user must log in again, for example 10h.
+	// Defaults to the SSO session settings of the realm
+	// +kubebuilder:validation:Pattern=^([0-9]+[hms])+$
+	SessionTimeout string `json:"sessionTimeout,omitempty"`
+
+	// SessionIdleTimeout : time a login session lasts without activity, for example 30m. Defaults to the realm
+	// +kubebuilder:validation:Pattern=^([0-9]+[hms])+$
+	SessionIdleTimeout string `json:"sessionIdleTimeout,omitempty"`
+
+	// AccessTokenLifespan : time an access token is valid before the gatekeeper refreshes it, for example 5m.
+	// Defaults to the realm
+	// +kubebuilder:validation:Pattern=^([0-9]+[hms])+$
+	AccessTokenLifespan string `json:"accessTokenLifespan,omitempty"`
+
+	// ServiceAccount : lets CI pipelines call the PFE API with the client credentials of the workspace client
+	ServiceAccount *v1alpha1.ServiceAccountSpec `json:"serviceAccount,omitempty"`
+
+	// TokenClaims : audiences and extra claims added to the tokens issued for the workspace client
+	TokenClaims *v1alpha1.TokenClaimsSpec `json:"tokenClaims,omitempty"`
+
+	// RemoteAccess : publishes the URL, realm, client and an offline token of a machine user in a secret, for IDE
+	// plugins connecting to the instance from outside the cluster
+	RemoteAccess *v1alpha1.RemoteAccessSpec `json:"remoteAccess,omitempty"`
+
+	// SessionSecretRef : secret in the namespace of the CR holding the key the gatekeeper encrypts its session
+	// cookies with, replaces the secret generated by the operator so that sessions survive a re-provision
+	SessionSecretRef *v1alpha1.SessionSecretReference `json:"sessionSecretRef,omitempty"`
+}
+
+// CodewindImagesSpec : version, images and architecture of the containers of a Codewind instance
+type CodewindImagesSpec struct {
+	// Version : Codewind version of the operator version catalog, selects the tested PFE, performance and
+	// gatekeeper image tags and overrides tag
+	Version string `json:"version,omitempty"`
+
+	// Tag : tag of the Codewind PFE, performance and gatekeeper images
+	Tag string `json:"tag,omitempty"`
+
+	// PFE : image of the PFE container, overrides tag and the operator config map default
+	PFE *v1alpha1.ImageSpec `json:"pfe,omitempty"`
+
+	// Performance : image of the performance dashboard container, overrides tag and the operator config map default
+	Performance *v1alpha1.ImageSpec `json:"performance,omitempty"`
+
+	// Gatekeeper : image of the gatekeeper container, overrides tag and the operator config map default
+	Gatekeeper *v1alpha1.ImageSpec `json:"gatekeeper,omitempty"`
+
+	// PullSecrets : secrets used to pull the Codewind images, defaults to the operator config map
+	PullSecrets []corev1.LocalObjectReference `json:"pullSecrets,omitempty"`
+
+	// Architecture : selects the images built for this node architecture, the pods are scheduled on nodes of the
+	// architecture of their images. Defaults to the architecture key of the operator config map, else amd64
+	// +kubebuilder:validation:Enum=amd64;ppc64le;s390x
+	Architecture string `json:"architecture,omitempty"`
+}
+
+// CodewindStorageSpec : workspace volume of a Codewind instance
+type CodewindStorageSpec struct {
+	// Size : requested size of the PFE volume, for example 10Gi. Defaults to the operator config map. Growing the
+	// size expands the existing volume when its storage class allows volume expansion, volumes cannot shrink
+	Size string `json:"size,omitempty"`
+
+	// StorageClassName : storage class of the PFE volume, defaults to the operator config map, else the cluster
+	// default. Only applies when the volume is created
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// Backup : scheduled CSI VolumeSnapshots of the workspace volume, and the snapshot a new workspace volume is
+	// restored from
+	Backup *v1alpha1.WorkspaceBackupSpec `json:"backup,omitempty"`
+}
+
+// CodewindNetworkingSpec : how the gatekeeper of a Codewind instance is published
+type CodewindNetworkingSpec struct {
+	// IngressDomain : ingress domain of the Codewind routes, defaults to the operator config map
+	IngressDomain string `json:"ingressDomain,omitempty"`
+
+	// Hostname : DNS name the gatekeeper is published at, replaces the generated codewind-gatekeeper-<workspaceID> host
+	// of the ingress domain. The name must resolve to the ingress controller or router
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$
+	Hostname string `json:"hostname,omitempty"`
+
+	// Routing : how the gatekeeper is published, host gives the instance a host of its own and path publishes it under
+	// /codewind/<workspaceID>/ of the codewind.<ingressDomain> host shared by the instances. Defaults to the operator
+	// config map, else host
+	// +kubebuilder:validation:Enum=host;path
+	Routing string `json:"routing,omitempty"`
+
+	// Ingress : ingress class and annotations of the gatekeeper Ingress, defaults to the operator config map
+	Ingress *v1alpha1.IngressSpec `json:"ingress,omitempty"`
+
+	// Route : TLS termination and certificate of the gatekeeper route on OpenShift
+	Route *v1alpha1.RouteSpec `json:"route,omitempty"`
+
+	// TLS : issue the gatekeeper and PFE certificates with cert-manager, or serve the gatekeeper certificate of an
+	// existing secret, instead of self-signed certificates
+	TLS *v1alpha1.TLSSpec `json:"tls,omitempty"`
+
+	// Proxy : outbound proxy of the PFE, performance and gatekeeper containers, defaults to the operator config map
+	Proxy *v1alpha1.ProxySpec `json:"proxy,omitempty"`
+
+	// NetworkPolicies : create NetworkPolicies admitting only the traffic between the Codewind components,
+	// defaults to enableNetworkPolicies of the operator config map
+	NetworkPolicies *bool `json:"networkPolicies,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Codewind is the Schema for the codewinds API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=codewinds,scope=Namespaced
+// +kubebuilder:printcolumn:name="Username",type="string",JSONPath=".spec.username",priority=0,description="Deployment reference name"
+// +kubebuilder:printcolumn:name="Workspace",type="string",JSONPath=".metadata.annotations.codewindWorkspace",priority=0,description="WorkspaceID"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",priority=0,description="Deployment phase"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",priority=0,description="Version every component was last rolled out with"
+// +kubebuilder:printcolumn:name="Realm",type="string",JSONPath=".status.realm",priority=0,description="Keycloak realm of the instance"
+// +kubebuilder:printcolumn:name="AccessURL",type="string",JSONPath=".status.accessURL",priority=0,description="Exposed route"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",priority=0,description="Age of the resource"
+// +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".metadata.namespace",priority=1,description="Deployment namespace"
+// +kubebuilder:printcolumn:name="Keycloak",type="string",JSONPath=".spec.auth.keycloakDeployment",priority=1,description="Deployment reference name"
+// +kubebuilder:printcolumn:name="Registration",type="string",JSONPath=".status.keycloakStatus",priority=1,description="Keycloak configuration status"
+// +kubebuilder:printcolumn:name="InPhase",type="date",JSONPath=".status.phaseTransitionTime",priority=1,description="Time since the deployment entered its phase"
+type Codewind struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CodewindSpec            `json:"spec,omitempty"`
+	Status v1alpha1.CodewindStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CodewindList contains a list of Codewind
+type CodewindList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Codewind `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Codewind{}, &CodewindList{})
+}
@@ -0,0 +1,505 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fill : sets every exported field reachable from v to a non-zero value, so that a conversion dropping a field of
+// the spec or status fails the round trip
+func fill(v reflect.Value, depth int) {
+	if depth > 12 {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				fill(v.Field(i), depth+1)
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0), depth+1)
+	case reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+		fill(key, depth+1)
+		value := reflect.New(v.Type().Elem()).Elem()
+		fill(value, depth+1)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, value)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	}
+}
+
+func enabled(value bool) *bool {
+	return &value
+}
+
+// filledV1alpha1Codewind : a v1alpha1 Codewind with every field set, storage.size differing from storageSize
+func filledV1alpha1Codewind() *v1alpha1.Codewind {
+	codewind := &v1alpha1.Codewind{}
+	fill(reflect.ValueOf(&codewind.Spec).Elem(), 0)
+	fill(reflect.ValueOf(&codewind.Status).Elem(), 0)
+	codewind.Spec.StorageSize = "10Gi"
+	codewind.Spec.Storage.Size = "20Gi"
+	return codewind
+}
+
+// filledV1beta1Codewind : a v1beta1 Codewind with every field set
+func filledV1beta1Codewind() *Codewind {
+	codewind := &Codewind{}
+	fill(reflect.ValueOf(&codewind.Spec).Elem(), 0)
+	fill(reflect.ValueOf(&codewind.Status).Elem(), 0)
+	return codewind
+}
+
+// filledV1alpha1Keycloak : a v1alpha1 Keycloak with every field set, storage.size differing from storageSize
+func filledV1alpha1Keycloak() *v1alpha1.Keycloak {
+	keycloak := &v1alpha1.Keycloak{}
+	fill(reflect.ValueOf(&keycloak.Spec).Elem(), 0)
+	fill(reflect.ValueOf(&keycloak.Status).Elem(), 0)
+	keycloak.Spec.StorageSize = "1Gi"
+	keycloak.Spec.Storage.Size = "2Gi"
+	return keycloak
+}
+
+// filledV1beta1Keycloak : a v1beta1 Keycloak with every field set
+func filledV1beta1Keycloak() *Keycloak {
+	keycloak := &Keycloak{}
+	fill(reflect.ValueOf(&keycloak.Spec).Elem(), 0)
+	fill(reflect.ValueOf(&keycloak.Status).Elem(), 0)
+	return keycloak
+}
+
+func TestCodewindConversionFromV1alpha1(t *testing.T) {
+	tests := []struct {
+		name     string
+		codewind *v1alpha1.Codewind
+		check    func(t *testing.T, converted *Codewind)
+	}{
+		{
+			name: "minimal",
+			codewind: &v1alpha1.Codewind{
+				ObjectMeta: metav1.ObjectMeta{Name: "jane1", Namespace: "codewind"},
+				Spec:       v1alpha1.CodewindSpec{Username: "jane", LogLevel: "info", KeycloakDeployment: "devex001"},
+			},
+			check: func(t *testing.T, converted *Codewind) {
+				if converted.Spec.Auth == nil || converted.Spec.Auth.KeycloakDeployment != "devex001" {
+					t.Errorf("auth.keycloakDeployment not set: %+v", converted.Spec.Auth)
+				}
+				if converted.Spec.Images != nil || converted.Spec.Storage != nil || converted.Spec.Networking != nil {
+					t.Errorf("empty sections not omitted: %+v", converted.Spec)
+				}
+			},
+		},
+		{
+			name: "storageSize",
+			codewind: &v1alpha1.Codewind{
+				Spec: v1alpha1.CodewindSpec{Username: "jane", StorageSize: "10Gi"},
+			},
+			check: func(t *testing.T, converted *Codewind) {
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Size != "10Gi" {
+					t.Errorf("storage.size not set from storageSize: %+v", converted.Spec.Storage)
+				}
+				if got := converted.Annotations[StorageSizeAnnotation]; got != "10Gi" {
+					t.Errorf("annotation %s is %q, want 10Gi", StorageSizeAnnotation, got)
+				}
+			},
+		},
+		{
+			name: "storageSize and storage class",
+			codewind: &v1alpha1.Codewind{
+				Spec: v1alpha1.CodewindSpec{Username: "jane", StorageSize: "10Gi", Storage: &v1alpha1.StorageSpec{StorageClassName: "fast"}},
+			},
+			check: func(t *testing.T, converted *Codewind) {
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Size != "10Gi" || converted.Spec.Storage.StorageClassName != "fast" {
+					t.Errorf("storage not converted: %+v", converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "storage.size wins over storageSize",
+			codewind: &v1alpha1.Codewind{
+				Spec: v1alpha1.CodewindSpec{Username: "jane", StorageSize: "10Gi", Storage: &v1alpha1.StorageSpec{Size: "20Gi"}},
+			},
+			check: func(t *testing.T, converted *Codewind) {
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Size != "20Gi" {
+					t.Errorf("storage.size is not storage.size of v1alpha1: %+v", converted.Spec.Storage)
+				}
+				if got := converted.Annotations[StorageSizeAnnotation]; got != "10Gi" {
+					t.Errorf("annotation %s is %q, want 10Gi", StorageSizeAnnotation, got)
+				}
+			},
+		},
+		{
+			name: "other annotations",
+			codewind: &v1alpha1.Codewind{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"codewindWorkspace": "k4a3dtkp"}},
+				Spec:       v1alpha1.CodewindSpec{Username: "jane", StorageSize: "10Gi"},
+			},
+		},
+		{
+			name: "auth, images, storage and lifecycle fields",
+			codewind: &v1alpha1.Codewind{
+				Spec: v1alpha1.CodewindSpec{
+					Username:     "jane",
+					KeycloakRef:  &v1alpha1.KeycloakReference{Name: "devex001", Namespace: "auth"},
+					AccessGroups: []string{"developers"},
+					Auth: &v1alpha1.CodewindAuthSpec{
+						SessionTimeout:   "8h",
+						ServiceAccount:   &v1alpha1.ServiceAccountSpec{Enabled: true, SecretName: "ci"},
+						TokenClaims:      &v1alpha1.TokenClaimsSpec{Audience: []string{"pipelines"}, GroupsClaim: "groups"},
+						RemoteAccess:     &v1alpha1.RemoteAccessSpec{Enabled: true, SecretName: "remote"},
+						SessionSecretRef: &v1alpha1.SessionSecretReference{Name: "session", Key: "secret"},
+					},
+					Version:         "0.14.0",
+					Architecture:    "s390x",
+					Images:          &v1alpha1.CodewindImagesSpec{Gatekeeper: &v1alpha1.ImageSpec{Repository: "registry.example.com/gatekeeper"}},
+					Components:      &v1alpha1.CodewindComponentsSpec{Performance: &v1alpha1.ComponentSpec{Enabled: enabled(false)}},
+					Backup:          &v1alpha1.WorkspaceBackupSpec{Schedule: "0 2 * * *", Retain: 3},
+					Suspended:       true,
+					TTLAfterLastUse: "72h",
+					TTLAction:       "suspend",
+					Tolerations:     []corev1.Toleration{{Key: "dedicated", Value: "codewind"}},
+				},
+			},
+			check: func(t *testing.T, converted *Codewind) {
+				auth := converted.Spec.Auth
+				if auth == nil || auth.RemoteAccess == nil || auth.SessionSecretRef == nil || auth.ServiceAccount == nil || auth.TokenClaims == nil {
+					t.Errorf("auth fields not converted: %+v", auth)
+				}
+				if converted.Spec.Images == nil || converted.Spec.Images.Architecture != "s390x" || converted.Spec.Images.Version != "0.14.0" {
+					t.Errorf("images not converted: %+v", converted.Spec.Images)
+				}
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Backup == nil {
+					t.Errorf("storage.backup not converted: %+v", converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name:     "every field",
+			codewind: filledV1alpha1Codewind(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.codewind.DeepCopy()
+			converted := &Codewind{}
+			if err := converted.ConvertFrom(test.codewind); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if !reflect.DeepEqual(test.codewind, original) {
+				t.Errorf("ConvertFrom changed its source")
+			}
+			if test.check != nil {
+				test.check(t, converted)
+			}
+			back := &v1alpha1.Codewind{}
+			if err := converted.ConvertTo(back); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if !reflect.DeepEqual(back, original) {
+				t.Errorf("round trip changed the CR\n got: %+v\nwant: %+v", back, original)
+			}
+		})
+	}
+}
+
+func TestCodewindConversionFromV1beta1(t *testing.T) {
+	tests := []struct {
+		name     string
+		codewind *Codewind
+		// want : the CR after the round trip when it differs from codewind
+		want  *Codewind
+		check func(t *testing.T, converted *v1alpha1.Codewind)
+	}{
+		{
+			name: "minimal",
+			codewind: &Codewind{
+				ObjectMeta: metav1.ObjectMeta{Name: "jane1", Namespace: "codewind"},
+				Spec:       CodewindSpec{Username: "jane", LogLevel: "info", Auth: &CodewindAuthSpec{KeycloakDeployment: "devex001"}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Codewind) {
+				if converted.Spec.KeycloakDeployment != "devex001" || converted.Spec.Auth != nil {
+					t.Errorf("auth not converted: %q %+v", converted.Spec.KeycloakDeployment, converted.Spec.Auth)
+				}
+			},
+		},
+		{
+			name: "storage.size",
+			codewind: &Codewind{
+				Spec: CodewindSpec{Username: "jane", Storage: &CodewindStorageSpec{Size: "10Gi"}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Codewind) {
+				if converted.Spec.StorageSize != "" || converted.Spec.Storage == nil || converted.Spec.Storage.Size != "10Gi" {
+					t.Errorf("storage not converted: %q %+v", converted.Spec.StorageSize, converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "storageSize of a v1alpha1 CR",
+			codewind: &Codewind{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{StorageSizeAnnotation: "10Gi"}},
+				Spec:       CodewindSpec{Username: "jane", Storage: &CodewindStorageSpec{Size: "10Gi"}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Codewind) {
+				if converted.Spec.StorageSize != "10Gi" || converted.Spec.Storage != nil {
+					t.Errorf("storageSize not restored: %q %+v", converted.Spec.StorageSize, converted.Spec.Storage)
+				}
+				if _, found := converted.Annotations[StorageSizeAnnotation]; found || converted.Annotations != nil {
+					t.Errorf("annotation %s kept in v1alpha1: %v", StorageSizeAnnotation, converted.Annotations)
+				}
+			},
+		},
+		{
+			name: "storage.size changed in v1beta1",
+			codewind: &Codewind{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{StorageSizeAnnotation: "10Gi"}},
+				Spec:       CodewindSpec{Username: "jane", Storage: &CodewindStorageSpec{Size: "20Gi"}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Codewind) {
+				if converted.Spec.StorageSize != "10Gi" || converted.Spec.Storage == nil || converted.Spec.Storage.Size != "20Gi" {
+					t.Errorf("storage not converted: %q %+v", converted.Spec.StorageSize, converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "storage.size removed in v1beta1",
+			codewind: &Codewind{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{StorageSizeAnnotation: "10Gi"}},
+				Spec:       CodewindSpec{Username: "jane"},
+			},
+			want: &Codewind{
+				Spec: CodewindSpec{Username: "jane"},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Codewind) {
+				if converted.Spec.StorageSize != "" || converted.Spec.Storage != nil {
+					t.Errorf("storageSize restored: %q %+v", converted.Spec.StorageSize, converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "auth of the provider only",
+			codewind: &Codewind{
+				Spec: CodewindSpec{Username: "jane", Auth: &CodewindAuthSpec{
+					RemoteAccess:     &v1alpha1.RemoteAccessSpec{Enabled: true},
+					SessionSecretRef: &v1alpha1.SessionSecretReference{Name: "session"},
+				}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Codewind) {
+				if converted.Spec.Auth == nil || converted.Spec.Auth.RemoteAccess == nil || converted.Spec.Auth.SessionSecretRef == nil {
+					t.Errorf("auth not converted: %+v", converted.Spec.Auth)
+				}
+			},
+		},
+		{
+			name:     "every field",
+			codewind: filledV1beta1Codewind(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := test.want
+			if want == nil {
+				want = test.codewind.DeepCopy()
+			}
+			converted := &v1alpha1.Codewind{}
+			if err := test.codewind.ConvertTo(converted); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if test.check != nil {
+				test.check(t, converted)
+			}
+			back := &Codewind{}
+			if err := back.ConvertFrom(converted); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if !reflect.DeepEqual(back, want) {
+				t.Errorf("round trip changed the CR\n got: %+v\nwant: %+v", back, want)
+			}
+		})
+	}
+}
+
+func TestKeycloakConversionFromV1alpha1(t *testing.T) {
+	tests := []struct {
+		name     string
+		keycloak *v1alpha1.Keycloak
+		check    func(t *testing.T, converted *Keycloak)
+	}{
+		{
+			name: "minimal",
+			keycloak: &v1alpha1.Keycloak{
+				ObjectMeta: metav1.ObjectMeta{Name: "devex001", Namespace: "codewind"},
+			},
+			check: func(t *testing.T, converted *Keycloak) {
+				if converted.Spec.Images != nil || converted.Spec.Storage != nil || converted.Spec.Networking != nil {
+					t.Errorf("empty sections not omitted: %+v", converted.Spec)
+				}
+			},
+		},
+		{
+			name: "storageSize",
+			keycloak: &v1alpha1.Keycloak{
+				Spec: v1alpha1.KeycloakSpec{StorageSize: "1Gi"},
+			},
+			check: func(t *testing.T, converted *Keycloak) {
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Size != "1Gi" {
+					t.Errorf("storage.size not set from storageSize: %+v", converted.Spec.Storage)
+				}
+				if got := converted.Annotations[StorageSizeAnnotation]; got != "1Gi" {
+					t.Errorf("annotation %s is %q, want 1Gi", StorageSizeAnnotation, got)
+				}
+			},
+		},
+		{
+			name: "storage.size wins over storageSize",
+			keycloak: &v1alpha1.Keycloak{
+				Spec: v1alpha1.KeycloakSpec{StorageSize: "1Gi", Storage: &v1alpha1.StorageSpec{Size: "2Gi", StorageClassName: "fast"}},
+			},
+			check: func(t *testing.T, converted *Keycloak) {
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Size != "2Gi" || converted.Spec.Storage.StorageClassName != "fast" {
+					t.Errorf("storage not converted: %+v", converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "database, images and backup",
+			keycloak: &v1alpha1.Keycloak{
+				Spec: v1alpha1.KeycloakSpec{
+					Database:     &v1alpha1.KeycloakDatabaseSpec{Host: "postgres", CredentialsSecret: "keycloak-db"},
+					Version:      "0.14.0",
+					Architecture: "ppc64le",
+					Backup:       &v1alpha1.KeycloakBackupSpec{Interval: "24h"},
+					Realm:        &v1alpha1.KeycloakRealmSpec{Name: "codewind", Shared: true},
+				},
+			},
+			check: func(t *testing.T, converted *Keycloak) {
+				if converted.Spec.Storage == nil || converted.Spec.Storage.Database == nil {
+					t.Errorf("storage.database not converted: %+v", converted.Spec.Storage)
+				}
+				if converted.Spec.Images == nil || converted.Spec.Images.Architecture != "ppc64le" {
+					t.Errorf("images not converted: %+v", converted.Spec.Images)
+				}
+			},
+		},
+		{
+			name:     "every field",
+			keycloak: filledV1alpha1Keycloak(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.keycloak.DeepCopy()
+			converted := &Keycloak{}
+			if err := converted.ConvertFrom(test.keycloak); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if test.check != nil {
+				test.check(t, converted)
+			}
+			back := &v1alpha1.Keycloak{}
+			if err := converted.ConvertTo(back); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if !reflect.DeepEqual(back, original) {
+				t.Errorf("round trip changed the CR\n got: %+v\nwant: %+v", back, original)
+			}
+		})
+	}
+}
+
+func TestKeycloakConversionFromV1beta1(t *testing.T) {
+	tests := []struct {
+		name     string
+		keycloak *Keycloak
+		check    func(t *testing.T, converted *v1alpha1.Keycloak)
+	}{
+		{
+			name: "storageSize of a v1alpha1 CR",
+			keycloak: &Keycloak{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{StorageSizeAnnotation: "1Gi"}},
+				Spec:       KeycloakSpec{Storage: &KeycloakStorageSpec{Size: "1Gi"}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Keycloak) {
+				if converted.Spec.StorageSize != "1Gi" || converted.Spec.Storage != nil {
+					t.Errorf("storageSize not restored: %q %+v", converted.Spec.StorageSize, converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "storage.size changed in v1beta1",
+			keycloak: &Keycloak{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{StorageSizeAnnotation: "1Gi"}},
+				Spec:       KeycloakSpec{Storage: &KeycloakStorageSpec{Size: "2Gi"}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Keycloak) {
+				if converted.Spec.StorageSize != "1Gi" || converted.Spec.Storage == nil || converted.Spec.Storage.Size != "2Gi" {
+					t.Errorf("storage not converted: %q %+v", converted.Spec.StorageSize, converted.Spec.Storage)
+				}
+			},
+		},
+		{
+			name: "networking",
+			keycloak: &Keycloak{
+				Spec: KeycloakSpec{Networking: &KeycloakNetworkingSpec{IngressDomain: "10.98.117.7.nip.io", NetworkPolicies: enabled(true)}},
+			},
+			check: func(t *testing.T, converted *v1alpha1.Keycloak) {
+				if converted.Spec.IngressDomain != "10.98.117.7.nip.io" || converted.Spec.NetworkPolicies == nil {
+					t.Errorf("networking not converted: %+v", converted.Spec)
+				}
+			},
+		},
+		{
+			name:     "every field",
+			keycloak: filledV1beta1Keycloak(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.keycloak.DeepCopy()
+			converted := &v1alpha1.Keycloak{}
+			if err := test.keycloak.ConvertTo(converted); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if test.check != nil {
+				test.check(t, converted)
+			}
+			back := &Keycloak{}
+			if err := back.ConvertFrom(converted); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if !reflect.DeepEqual(back, original) {
+				t.Errorf("round trip changed the CR\n got: %+v\nwant: %+v", back, original)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1beta1
+
+import (
+	"reflect"
+
+	"github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo : converts this Keycloak to the v1alpha1 storage version
+func (src *Keycloak) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Keycloak)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	src.Status.DeepCopyInto(&dst.Status)
+
+	spec := src.Spec
+	dst.Spec = v1alpha1.KeycloakSpec{
+		Unmanaged:              spec.Unmanaged,
+		URL:                    spec.URL,
+		AdminCredentialsSecret: spec.AdminCredentialsSecret,
+		Replicas:               spec.Replicas,
+		Distribution:           spec.Distribution,
+		CABundle:               spec.CABundle,
+		Resources:              spec.Resources,
+		Probes:                 spec.Probes,
+		NodeSelector:           spec.NodeSelector,
+		Tolerations:            spec.Tolerations,
+		Affinity:               spec.Affinity,
+		PriorityClassName:      spec.PriorityClassName,
+		Realm:                  spec.Realm,
+		UserFederation:         spec.UserFederation,
+		IdentityProviders:      spec.IdentityProviders,
+		SMTP:                   spec.SMTP,
+		PasswordPolicy:         spec.PasswordPolicy,
+		BruteForceProtection:   spec.BruteForceProtection,
+		Branding:               spec.Branding,
+		SecurityContext:        spec.SecurityContext,
+		Backup:                 spec.Backup,
+	}
+	if images := spec.Images; images != nil {
+		dst.Spec.Version = images.Version
+		dst.Spec.ImageTag = images.Tag
+		dst.Spec.ImagePullSecrets = images.PullSecrets
+		dst.Spec.Architecture = images.Architecture
+		if images.Keycloak != nil {
+			dst.Spec.Images = &v1alpha1.KeycloakImagesSpec{Keycloak: images.Keycloak}
+		}
+	}
+	var size, className string
+	if storage := spec.Storage; storage != nil {
+		size, className = storage.Size, storage.StorageClassName
+		dst.Spec.Database = storage.Database
+	}
+	dst.Spec.StorageSize, dst.Spec.Storage = storageToV1alpha1(&dst.ObjectMeta, size, className)
+	if networking := spec.Networking; networking != nil {
+		dst.Spec.IngressDomain = networking.IngressDomain
+		dst.Spec.Ingress = networking.Ingress
+		dst.Spec.TLS = networking.TLS
+		dst.Spec.NetworkPolicies = networking.NetworkPolicies
+	}
+	return nil
+}
+
+// ConvertFrom : converts a v1alpha1 Keycloak to this version, sections left empty are omitted
+func (dst *Keycloak) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Keycloak)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	src.Status.DeepCopyInto(&dst.Status)
+
+	spec := src.Spec
+	dst.Spec = KeycloakSpec{
+		Unmanaged:              spec.Unmanaged,
+		URL:                    spec.URL,
+		AdminCredentialsSecret: spec.AdminCredentialsSecret,
+		Replicas:               spec.Replicas,
+		Distribution:           spec.Distribution,
+		CABundle:               spec.CABundle,
+		Resources:              spec.Resources,
+		Probes:                 spec.Probes,
+		NodeSelector:           spec.NodeSelector,
+		Tolerations:            spec.Tolerations,
+		Affinity:               spec.Affinity,
+		PriorityClassName:      spec.PriorityClassName,
+		Realm:                  spec.Realm,
+		UserFederation:         spec.UserFederation,
+		IdentityProviders:      spec.IdentityProviders,
+		SMTP:                   spec.SMTP,
+		PasswordPolicy:         spec.PasswordPolicy,
+		BruteForceProtection:   spec.BruteForceProtection,
+		Branding:               spec.Branding,
+		SecurityContext:        spec.SecurityContext,
+		Backup:                 spec.Backup,
+	}
+	images := KeycloakImagesSpec{
+		Version:      spec.Version,
+		Tag:          spec.ImageTag,
+		PullSecrets:  spec.ImagePullSecrets,
+		Architecture: spec.Architecture,
+	}
+	if spec.Images != nil {
+		images.Keycloak = spec.Images.Keycloak
+	}
+	if !reflect.DeepEqual(images, KeycloakImagesSpec{}) {
+		dst.Spec.Images = &images
+	}
+	size, className := storageFromV1alpha1(&dst.ObjectMeta, spec.StorageSize, spec.Storage)
+	storage := KeycloakStorageSpec{Size: size, StorageClassName: className, Database: spec.Database}
+	if storage != (KeycloakStorageSpec{}) {
+		dst.Spec.Storage = &storage
+	}
+	networking := KeycloakNetworkingSpec{
+		IngressDomain:   spec.IngressDomain,
+		Ingress:         spec.Ingress,
+		TLS:             spec.TLS,
+		NetworkPolicies: spec.NetworkPolicies,
+	}
+	if networking != (KeycloakNetworkingSpec{}) {
+		dst.Spec.Networking = &networking
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1beta1
+
+import (
+	"github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KeycloakSpec defines the desired state of Keycloak. The image, storage and networking settings of v1alpha1 are
+// grouped into sections, the settings themselves are unchanged
+type KeycloakSpec struct {
+	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
+	// Unmanaged : use the existing Keycloak server at url instead of deploying one. The operator still configures
+	// the realm and the clients of the Codewind deployments in it
+	Unmanaged bool `json:"unmanaged,omitempty"`
+
+	// URL : https URL of the existing Keycloak server, required when unmanaged
+	URL string `json:"url,omitempty"`
+
+	// AdminCredentialsSecret : secret holding the keycloak-admin-user and keycloak-admin-password of the existing
+	// Keycloak server, required when unmanaged
+	AdminCredentialsSecret string `json:"adminCredentialsSecret,omitempty"`
+
+	// Replicas : number of Keycloak pods, defaults to 1. More than one replica requires an external database
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Distribution : legacy for Keycloak serving its REST API under /auth, quarkus for Keycloak 17 or later serving
+	// it from the root. Detected from the running server when not set
+	// +kubebuilder:validation:Enum=legacy;quarkus
+	Distribution string `json:"distribution,omitempty"`
+
+	// Images : version, image and architecture of the Keycloak container
+	Images *KeycloakImagesSpec `json:"images,omitempty"`
+
+	// Storage : Keycloak volume or external database
+	Storage *KeycloakStorageSpec `json:"storage,omitempty"`
+
+	// Networking : how Keycloak is published and the traffic admitted to it
+	Networking *KeycloakNetworkingSpec `json:"networking,omitempty"`
+
+	// CABundle : CA certificates the operator trusts when calling this Keycloak, defaults to the bundle of the operator config map
+	CABundle *v1alpha1.CABundleSpec `json:"caBundle,omitempty"`
+
+	// Resources : compute resources of the Keycloak container, defaults to the operator config map
+	Resources *v1alpha1.KeycloakResourcesSpec `json:"resources,omitempty"`
+
+	// Probes : timings of the startup, liveness and readiness probes of the Keycloak container
+	Probes *v1alpha1.KeycloakProbesSpec `json:"probes,omitempty"`
+
+	// NodeSelector : node labels the Keycloak pod must be scheduled on
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations : tolerations of the Keycloak pod
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity : scheduling constraints of the Keycloak pod
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// PriorityClassName : priority class of the Keycloak pod, the default priority of the cluster when not set
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Realm : realm holding the clients and access roles of the Codewind deployments, defaults to the defaultRealm
+	// of the operator config map
+	Realm *v1alpha1.KeycloakRealmSpec `json:"realm,omitempty"`
+
+	// UserFederation : external user directories the Codewind realm authenticates its users against
+	UserFederation *v1alpha1.KeycloakUserFederationSpec `json:"userFederation,omitempty"`
+
+	// IdentityProviders : external identity providers the users of the Codewind realm can log in with
+	IdentityProviders []v1alpha1.IdentityProviderSpec `json:"identityProviders,omitempty"`
+
+	// SMTP : mail server the Codewind realm sends password reset and email verification messages with
+	SMTP *v1alpha1.KeycloakSMTPSpec `json:"smtp,omitempty"`
+
+	// PasswordPolicy : rules the passwords of the Codewind realm users must follow, the realm policy is left unchanged when not set
+	PasswordPolicy *v1alpha1.PasswordPolicySpec `json:"passwordPolicy,omitempty"`
+
+	// BruteForceProtection : lock out accounts of the Codewind realm after repeated login failures, the realm settings
+	// are left unchanged when not set
+	BruteForceProtection *v1alpha1.BruteForceProtectionSpec `json:"bruteForceProtection,omitempty"`
+
+	// Branding : login theme and branding of the Codewind realm login page
+	Branding *v1alpha1.KeycloakBrandingSpec `json:"branding,omitempty"`
+
+	// SecurityContext : security settings of the Keycloak pods, defaults to the operator config map
+	SecurityContext *v1alpha1.PodSecuritySpec `json:"securityContext,omitempty"`
+
+	// Backup : scheduled exports of the Codewind realm, and the export a new realm is restored from
+	Backup *v1alpha1.KeycloakBackupSpec `json:"backup,omitempty"`
+}
+
+// KeycloakImagesSpec : version, image and architecture of the Keycloak container
+type KeycloakImagesSpec struct {
+	// Version : Codewind version of the operator version catalog, selects the tested Keycloak image tag and overrides tag
+	Version string `json:"version,omitempty"`
+
+	// Tag : tag of the Keycloak image
+	Tag string `json:"tag,omitempty"`
+
+	// Keycloak : image of the Keycloak container, overrides tag and the operator config map default
+	Keycloak *v1alpha1.ImageSpec `json:"keycloak,omitempty"`
+
+	// PullSecrets : secrets used to pull the Keycloak image, defaults to the operator config map
+	PullSecrets []corev1.LocalObjectReference `json:"pullSecrets,omitempty"`
+
+	// Architecture : selects the Keycloak image built for this node architecture, the pod is scheduled on nodes of
+	// the architecture of its image. Defaults to the architecture key of the operator config map, else amd64
+	// +kubebuilder:validation:Enum=amd64;ppc64le;s390x
+	Architecture string `json:"architecture,omitempty"`
+}
+
+// KeycloakStorageSpec : where a Keycloak instance keeps its data
+type KeycloakStorageSpec struct {
+	// Size : requested size of the Keycloak volume, for example 1Gi. Defaults to the operator config map. Growing the
+	// size expands the existing volume when its storage class allows volume expansion, volumes cannot shrink
+	Size string `json:"size,omitempty"`
+
+	// StorageClassName : storage class of the Keycloak volume, defaults to the operator config map, else the cluster
+	// default. Only applies when the volume is created
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// Database : external PostgreSQL database of Keycloak, replaces the embedded database and its volume
+	Database *v1alpha1.KeycloakDatabaseSpec `json:"database,omitempty"`
+}
+
+// KeycloakNetworkingSpec : how a Keycloak instance is published
+type KeycloakNetworkingSpec struct {
+	// IngressDomain : ingress domain of the Keycloak route, defaults to the operator config map
+	IngressDomain string `json:"ingressDomain,omitempty"`
+
+	// Ingress : ingress class and annotations of the Keycloak Ingress, defaults to the operator config map
+	Ingress *v1alpha1.IngressSpec `json:"ingress,omitempty"`
+
+	// TLS : issue the Keycloak certificate with cert-manager, or use an existing secret, instead of a self-signed
+	// certificate
+	TLS *v1alpha1.TLSSpec `json:"tls,omitempty"`
+
+	// NetworkPolicies : create a NetworkPolicy admitting only HTTP traffic and the traffic between Keycloak replicas,
+	// defaults to enableNetworkPolicies of the operator config map
+	NetworkPolicies *bool `json:"networkPolicies,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Keycloak is the Schema for the keycloaks API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=keycloaks,scope=Namespaced
+// +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".metadata.namespace",priority=0,description="Deployment namespace"
+// +kubebuilder:printcolumn:name="AuthID",type="string",JSONPath=".metadata.annotations.authID",priority=0,description="Deployment AuthID"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",priority=0,description="Age of the resource"
+// +kubebuilder:printcolumn:name="Access",type="string",JSONPath=".status.url",priority=0,description="Exposed route"
+type Keycloak struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KeycloakSpec            `json:"spec,omitempty"`
+	Status v1alpha1.KeycloakStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KeycloakList contains a list of Keycloak
+type KeycloakList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Keycloak `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Keycloak{}, &KeycloakList{})
+}
@@ -0,0 +1,65 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package v1beta1
+
+import (
+	"github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StorageSizeAnnotation : keeps the storageSize field of a v1alpha1 CR, which v1beta1 folds into storage.size, so
+// that converting the CR back to v1alpha1 restores it
+const StorageSizeAnnotation = "codewind.eclipse.org/v1alpha1-storage-size"
+
+// storageFromV1alpha1 : size and storage class of the volume of a v1alpha1 spec. storage.size wins over storageSize
+// as it does in the controllers
+func storageFromV1alpha1(meta *metav1.ObjectMeta, storageSize string, storage *v1alpha1.StorageSpec) (size string, className string) {
+	delete(meta.Annotations, StorageSizeAnnotation)
+	if storageSize != "" {
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[StorageSizeAnnotation] = storageSize
+		size = storageSize
+	}
+	if storage != nil {
+		if storage.Size != "" {
+			size = storage.Size
+		}
+		className = storage.StorageClassName
+	}
+	return size, className
+}
+
+// storageToV1alpha1 : storageSize and storage fields of a v1alpha1 spec for the size and storage class of a
+// v1beta1 spec. A size that still matches the storageSize of the annotation goes back into storageSize only
+func storageToV1alpha1(meta *metav1.ObjectMeta, size string, className string) (storageSize string, storage *v1alpha1.StorageSpec) {
+	storageSize = meta.Annotations[StorageSizeAnnotation]
+	delete(meta.Annotations, StorageSizeAnnotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	if storageSize != "" && size == "" {
+		// storage.size was removed from the v1beta1 CR
+		storageSize = ""
+	}
+	if size != storageSize {
+		storage = &v1alpha1.StorageSpec{Size: size}
+	}
+	if className != "" {
+		if storage == nil {
+			storage = &v1alpha1.StorageSpec{}
+		}
+		storage.StorageClassName = className
+	}
+	return storageSize, storage
+}
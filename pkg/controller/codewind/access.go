@@ -0,0 +1,98 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+)
+
+// codewindAccessList : the developer user followed by the users of the access list, without duplicates
+func codewindAccessList(codewind *codewindv1alpha1.Codewind) []string {
+	users := []string{codewind.Spec.Username}
+	for _, username := range codewind.Spec.AccessList {
+		if !contains(users, username) {
+			users = append(users, username)
+		}
+	}
+	return users
+}
+
+// codewindAccessGroups : the access groups without duplicates
+func codewindAccessGroups(codewind *codewindv1alpha1.Codewind) []string {
+	var groups []string
+	for _, groupName := range codewind.Spec.AccessGroups {
+		if !contains(groups, groupName) {
+			groups = append(groups, groupName)
+		}
+	}
+	return groups
+}
+
+// serviceAccountEnabled : true when CI pipelines may use the client credentials of the instance
+func serviceAccountEnabled(codewind *codewindv1alpha1.Codewind) bool {
+	return codewind.Spec.Auth != nil && codewind.Spec.Auth.ServiceAccount != nil && codewind.Spec.Auth.ServiceAccount.Enabled
+}
+
+// clientCredentialsSecretName : secret the client credentials are published in
+func clientCredentialsSecretName(codewind *codewindv1alpha1.Codewind, workspaceID string) string {
+	if codewind.Spec.Auth != nil && codewind.Spec.Auth.ServiceAccount != nil && codewind.Spec.Auth.ServiceAccount.SecretName != "" {
+		return codewind.Spec.Auth.ServiceAccount.SecretName
+	}
+	return "secret-codewind-ci-" + workspaceID
+}
+
+// remoteAccessEnabled : true when IDE plugins may connect with an offline token of the machine user of the instance
+func remoteAccessEnabled(codewind *codewindv1alpha1.Codewind) bool {
+	return codewind.Spec.Auth != nil && codewind.Spec.Auth.RemoteAccess != nil && codewind.Spec.Auth.RemoteAccess.Enabled
+}
+
+// remoteAccessSecretName : secret the connection details of IDE remote connections are published in
+func remoteAccessSecretName(codewind *codewindv1alpha1.Codewind, workspaceID string) string {
+	if codewind.Spec.Auth != nil && codewind.Spec.Auth.RemoteAccess != nil && codewind.Spec.Auth.RemoteAccess.SecretName != "" {
+		return codewind.Spec.Auth.RemoteAccess.SecretName
+	}
+	return "secret-codewind-remote-" + workspaceID
+}
+
+// revokedUsers : users or groups granted access by an earlier reconcile that are no longer listed
+func revokedUsers(granted []string, desired []string) []string {
+	var revoked []string
+	for _, username := range granted {
+		if !contains(desired, username) {
+			revoked = append(revoked, username)
+		}
+	}
+	return revoked
+}
+
+// accessListChanged : true when the users or groups granted access differ from the desired ones
+func accessListChanged(granted []string, desired []string) bool {
+	if len(granted) != len(desired) {
+		return true
+	}
+	for _, username := range desired {
+		if !contains(granted, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains : true when the list holds the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
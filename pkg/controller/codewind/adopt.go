@@ -0,0 +1,183 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// adoptable : a resource of an existing deployment the Codewind CR can take ownership of
+type adoptable interface {
+	metav1.Object
+	runtime.Object
+}
+
+// adoptedResource : a resource of an existing deployment, the labels the operator gives it and the spec the
+// operator expects of it
+type adoptedResource struct {
+	kind   string
+	name   string
+	object adoptable
+	labels map[string]string
+	sync   func()
+}
+
+// adoptResources : Takes ownership of the service account, volume, secrets, services and ingress or route of an
+// existing deployment when the CR adopts it. Resources that do not exist are created by the reconcile as usual, the
+// deployments are adopted by adoptDeployment once their desired spec is known
+func (r *ReconcileCodewind) adoptResources(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, isOpenshift bool) error {
+	if !codewind.Spec.AdoptExisting {
+		return nil
+	}
+	pfeService := &corev1.Service{}
+	gatekeeperService := &corev1.Service{}
+	resources := []adoptedResource{
+		{"service account", deploymentOptions.CodewindServiceAccountName, &corev1.ServiceAccount{}, labelsForCodewindPFE(deploymentOptions), nil},
+		{"PVC", deploymentOptions.CodewindPFEPVCName, &corev1.PersistentVolumeClaim{}, labelsForCodewindPFE(deploymentOptions), nil},
+		{"secret", deploymentOptions.CodewindGatekeeperSecretSessionName, &corev1.Secret{}, labelsForCodewindGatekeeper(deploymentOptions), nil},
+		{"secret", deploymentOptions.CodewindGatekeeperSecretAuthName, &corev1.Secret{}, labelsForCodewindGatekeeper(deploymentOptions), nil},
+		{"service", deploymentOptions.CodewindPFEServiceName, pfeService, labelsForCodewindPFE(deploymentOptions), func() {
+			syncServicePorts(pfeService, r.serviceForCodewindPFE(codewind, deploymentOptions))
+		}},
+		{"service", deploymentOptions.CodewindGatekeeperServiceName, gatekeeperService, labelsForCodewindGatekeeper(deploymentOptions), func() {
+			syncServicePorts(gatekeeperService, r.serviceForCodewindGatekeeper(codewind, deploymentOptions))
+		}},
+	}
+	// A disabled performance dashboard is removed rather than adopted
+	if performanceEnabled(codewind) {
+		performanceService := &corev1.Service{}
+		resources = append(resources, adoptedResource{"service", deploymentOptions.CodewindPerformanceServiceName, performanceService, labelsForCodewindPerformance(deploymentOptions), func() {
+			syncServicePorts(performanceService, r.serviceForCodewindPerformance(codewind, deploymentOptions))
+		}})
+	}
+	// A TLS secret named by the CR or issued by cert-manager belongs to its creator
+	if util.TLSSecretName(codewind.Spec.TLS) == "" && !util.CertManagerEnabled(codewind.Spec.TLS) {
+		resources = append(resources, adoptedResource{"secret", deploymentOptions.CodewindGatekeeperSecretTLSName, &corev1.Secret{}, labelsForCodewindGatekeeper(deploymentOptions), nil})
+	}
+	// The reconcile corrects the host and TLS settings of the ingress or route
+	if isOpenshift {
+		resources = append(resources, adoptedResource{"route", deploymentOptions.CodewindGatekeeperIngressName, &routev1.Route{}, labelsForCodewindGatekeeper(deploymentOptions), nil})
+	} else {
+		resources = append(resources, adoptedResource{"ingress", deploymentOptions.CodewindGatekeeperIngressName, &extv1beta1.Ingress{}, labelsForCodewindGatekeeper(deploymentOptions), nil})
+	}
+	for _, resource := range resources {
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: resource.name, Namespace: codewind.Namespace}, resource.object)
+		if k8serr.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get the resource to adopt", "Namespace", codewind.Namespace, "Name", resource.name)
+			return err
+		}
+		if metav1.IsControlledBy(resource.object, codewind) {
+			continue
+		}
+		if resource.sync != nil {
+			resource.sync()
+		}
+		err = r.adoptObject(reqLogger, codewind, resource.kind, resource.object, resource.labels)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptDeployment : Takes ownership of an existing deployment when the CR adopts it and replaces its pod template
+// with the one of the operator. A deployment whose selector does not select the pods of the operator cannot be
+// changed and is deleted instead, so the reconcile recreates it on the adopted volume. Returns true when the
+// deployment was deleted
+func (r *ReconcileCodewind) adoptDeployment(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deployment *appsv1.Deployment, desired *appsv1.Deployment) (bool, error) {
+	if !codewind.Spec.AdoptExisting || metav1.IsControlledBy(deployment, codewind) {
+		return false, nil
+	}
+	if owner := metav1.GetControllerOf(deployment); owner != nil {
+		return false, &controllerutil.AlreadyOwnedError{Object: deployment, Owner: *owner}
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil || !selector.Matches(labels.Set(desired.Spec.Template.Labels)) {
+		reqLogger.Info("Replacing the adopted deployment, its selector does not match the operator labels", "Namespace", deployment.Namespace, "Name", deployment.Name)
+		err = r.client.Delete(context.TODO(), deployment, client.PropagationPolicy(metav1.DeletePropagationForeground))
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to delete the adopted deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+			return false, err
+		}
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonAdopted, "Replacing deployment %s, its selector does not match the pods of the operator", deployment.Name)
+		return true, nil
+	}
+	deployment.Spec.Template = desired.Spec.Template
+	deployment.Spec.Strategy = desired.Spec.Strategy
+	deployment.Spec.Replicas = desired.Spec.Replicas
+	return false, r.adoptObject(reqLogger, codewind, "deployment", deployment, desired.Labels)
+}
+
+// adoptObject : Makes the CR the controller of a resource and adds the labels of the operator. A resource controlled
+// by something else is left alone and returned as an AlreadyOwnedError
+func (r *ReconcileCodewind) adoptObject(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, kind string, object adoptable, objectLabels map[string]string) error {
+	if err := controllerutil.SetControllerReference(codewind, object, r.scheme); err != nil {
+		return err
+	}
+	merged := object.GetLabels()
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for key, value := range objectLabels {
+		merged[key] = value
+	}
+	object.SetLabels(merged)
+	reqLogger.Info("Adopting an existing resource", "Namespace", object.GetNamespace(), "Name", object.GetName(), "Kind", kind)
+	if err := r.client.Update(context.TODO(), object); err != nil {
+		reqLogger.Error(err, "Failed to adopt the existing resource", "Namespace", object.GetNamespace(), "Name", object.GetName(), "Kind", kind)
+		return err
+	}
+	r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonAdopted, "Adopted %s %s", kind, object.GetName())
+	return nil
+}
+
+// syncServicePorts : Points an adopted service at the pods of the operator. The cluster IP is kept
+func syncServicePorts(service *corev1.Service, desired *corev1.Service) {
+	service.Spec.Selector = desired.Spec.Selector
+	service.Spec.Ports = desired.Spec.Ports
+}
+
+// adoptionResult : Result of a reconcile stopped by the adoption. A resource controlled by something else is
+// reported and checked again later, other errors are retried
+func (r *ReconcileCodewind) adoptionResult(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, err error) (reconcile.Result, error) {
+	if err == nil {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	if ownedErr, ok := err.(*controllerutil.AlreadyOwnedError); ok {
+		reqLogger.Error(err, "Unable to adopt a resource controlled by another owner", "Namespace", codewind.Namespace, "Name", ownedErr.Object.GetName())
+		r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonAdoptionFailed,
+			fmt.Sprintf("%s is controlled by %s %s and cannot be adopted", ownedErr.Object.GetName(), ownedErr.Owner.Kind, ownedErr.Owner.Name))
+		return reconcile.Result{RequeueAfter: time.Second * 30}, nil
+	}
+	return reconcile.Result{}, err
+}
@@ -17,13 +17,16 @@ import (
 
 	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
 	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/security"
 	"github.com/eclipse/codewind-operator/pkg/util"
 	routev1 "github.com/openshift/api/route/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -49,11 +52,8 @@ func (r *ReconcileCodewind) serviceAccountForCodewind(codewind *codewindv1alpha1
 }
 
 // pvcForCodewind function takes in a Codewind object and returns a PVC for that object.
-func (r *ReconcileCodewind) pvcForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, storageClassName string, storageSize string) *corev1.PersistentVolumeClaim {
+func (r *ReconcileCodewind) pvcForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, storageClassName string, storageSize resource.Quantity) *corev1.PersistentVolumeClaim {
 	labels := labelsForCodewindPFE(deploymentOptions)
-	if codewind.Spec.StorageSize != "" {
-		storageSize = codewind.Spec.StorageSize
-	}
 	pvc := &corev1.PersistentVolumeClaim{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
@@ -70,7 +70,7 @@ func (r *ReconcileCodewind) pvcForCodewind(codewind *codewindv1alpha1.Codewind,
 			},
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(storageSize),
+					corev1.ResourceStorage: storageSize,
 				},
 			},
 		},
@@ -80,6 +80,7 @@ func (r *ReconcileCodewind) pvcForCodewind(codewind *codewindv1alpha1.Codewind,
 	if storageClassName != "" {
 		pvc.Spec.StorageClassName = &storageClassName
 	}
+	restoreVolumeFromSnapshot(codewind, pvc)
 
 	// Set Codewind instance as the owner of the persistent volume claim.
 	controllerutil.SetControllerReference(codewind, pvc, r.scheme)
@@ -88,7 +89,7 @@ func (r *ReconcileCodewind) pvcForCodewind(codewind *codewindv1alpha1.Codewind,
 
 func (r *ReconcileCodewind) deploymentForCodewindPerformance(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, ingressDomain string) *appsv1.Deployment {
 	ls := labelsForCodewindPerformance(deploymentOptions)
-	replicas := int32(1)
+	replicas := deploymentReplicas(codewind)
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      defaults.PrefixCodewindPerformance + "-" + deploymentOptions.WorkspaceID,
@@ -102,14 +103,23 @@ func (r *ReconcileCodewind) deploymentForCodewindPerformance(codewind *codewindv
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
+					Labels:      ls,
+					Annotations: util.PodSecurityAnnotations(deploymentOptions.PodSecurity),
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: deploymentOptions.CodewindServiceAccountName,
+					NodeSelector:       codewind.Spec.NodeSelector,
+					Tolerations:        codewind.Spec.Tolerations,
+					Affinity:           architectureAffinity(codewind, deploymentOptions, deploymentOptions.PerformanceImage),
+					PriorityClassName:  codewind.Spec.PriorityClassName,
+					ImagePullSecrets:   deploymentOptions.ImagePullSecrets,
+					SecurityContext:    util.PodSecurityContext(deploymentOptions.PodSecurity),
 					Containers: []corev1.Container{{
 						Name:            defaults.PrefixCodewindPerformance,
-						Image:           defaults.CodewindPerformanceImage + ":" + defaults.CodewindPerformanceImageTag,
+						Image:           util.ImageReference(deploymentOptions.PerformanceImage),
 						ImagePullPolicy: corev1.PullAlways,
+						Resources:       deploymentOptions.PerformanceResources,
+						SecurityContext: util.ContainerSecurityContext(deploymentOptions.PodSecurity),
 						Env: []corev1.EnvVar{
 							{
 								Name:  "IN_K8",
@@ -132,6 +142,13 @@ func (r *ReconcileCodewind) deploymentForCodewindPerformance(codewind *codewindv
 			},
 		},
 	}
+	addTrustedCABundle(codewind, &dep.Spec.Template.Spec)
+	addProxyEnv(deploymentOptions, &dep.Spec.Template.Spec)
+	addLogLevelEnv(&dep.Spec.Template.Spec.Containers[0], componentLogLevels(codewind).Performance)
+	addFIPSEnv(&dep.Spec.Template.Spec.Containers[0])
+	addExtraEnv(&dep.Spec.Template.Spec.Containers[0], extraEnv(codewind).Performance)
+	util.SetContainerProbes(&dep.Spec.Template.Spec.Containers[0], defaults.PerformanceContainerPort, sidecarProbeTimings, componentProbes(codewind).Performance)
+	util.SetDeploymentProbesHash(dep)
 	// Set Codewind instance as the owner of this deployment
 	controllerutil.SetControllerReference(codewind, dep, r.scheme)
 	return dep
@@ -140,12 +157,8 @@ func (r *ReconcileCodewind) deploymentForCodewindPerformance(codewind *codewindv
 // deploymentForCodewindPFE returns a Codewind dployment object
 func (r *ReconcileCodewind) deploymentForCodewindPFE(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, isOnOpenshift bool, keycloakRealm string, authHost string, logLevel string, ingressDomain string) *appsv1.Deployment {
 	ls := labelsForCodewindPFE(deploymentOptions)
-	replicas := int32(1)
+	replicas := deploymentReplicas(codewind)
 	runAsPrivileged := true
-	loglevel := "info"
-	if codewind.Spec.LogLevel != "" {
-		loglevel = codewind.Spec.LogLevel
-	}
 	volumes := []corev1.Volume{
 		{
 			Name: "shared-workspace",
@@ -170,6 +183,32 @@ func (r *ReconcileCodewind) deploymentForCodewindPFE(codewind *codewindv1alpha1.
 			MountPath: "/var/lib/containers",
 		},
 	}
+	if util.CertManagerEnabled(codewind.Spec.TLS) {
+		volumes = append(volumes, corev1.Volume{
+			Name: "tls-certs",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: deploymentOptions.CodewindPFESecretTLSName,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "tls-certs",
+			MountPath: "/tlscerts",
+			ReadOnly:  true,
+		})
+	}
+	// PFE builds images with buildah and needs a privileged container unless that has been turned off
+	podSecurityContext := util.PodSecurityContext(deploymentOptions.PodSecurity)
+	containerSecurityContext := util.ContainerSecurityContext(deploymentOptions.PodSecurity)
+	podAnnotations := util.PodSecurityAnnotations(deploymentOptions.PodSecurity)
+	if deploymentOptions.PFEPrivileged {
+		podSecurityContext = nil
+		containerSecurityContext = &corev1.SecurityContext{
+			Privileged: &runAsPrivileged,
+		}
+		podAnnotations = nil
+	}
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentOptions.CodewindPFEDeploymentName,
@@ -183,19 +222,25 @@ func (r *ReconcileCodewind) deploymentForCodewindPFE(codewind *codewindv1alpha1.
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
+					Labels:      ls,
+					Annotations: podAnnotations,
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: deploymentOptions.CodewindServiceAccountName,
+					NodeSelector:       codewind.Spec.NodeSelector,
+					Tolerations:        codewind.Spec.Tolerations,
+					Affinity:           architectureAffinity(codewind, deploymentOptions, deploymentOptions.PFEImage),
+					PriorityClassName:  codewind.Spec.PriorityClassName,
+					ImagePullSecrets:   deploymentOptions.ImagePullSecrets,
+					SecurityContext:    podSecurityContext,
 					Volumes:            volumes,
 					Containers: []corev1.Container{{
 						Name:            defaults.PrefixCodewindPFE,
-						Image:           defaults.CodewindImage + ":" + defaults.CodewindImageTag,
+						Image:           util.ImageReference(deploymentOptions.PFEImage),
 						ImagePullPolicy: corev1.PullAlways,
-						SecurityContext: &corev1.SecurityContext{
-							Privileged: &runAsPrivileged,
-						},
-						VolumeMounts: volumeMounts,
+						Resources:       deploymentOptions.PFEResources,
+						SecurityContext: containerSecurityContext,
+						VolumeMounts:    volumeMounts,
 						Env: []corev1.EnvVar{
 							{
 								Name:  "TEKTON_PIPELINE",
@@ -243,7 +288,7 @@ func (r *ReconcileCodewind) deploymentForCodewindPFE(codewind *codewindv1alpha1.
 							},
 							{
 								Name:  "CODEWIND_VERSION",
-								Value: defaults.CodewindImageTag,
+								Value: codewindVersion(deploymentOptions),
 							},
 							{
 								Name:  "OWNER_REF_NAME",
@@ -277,10 +322,6 @@ func (r *ReconcileCodewind) deploymentForCodewindPFE(codewind *codewindv1alpha1.
 								Name:  "CODEWIND_AUTH_HOST",
 								Value: authHost,
 							},
-							{
-								Name:  "LOG_LEVEL",
-								Value: loglevel,
-							},
 						},
 						Ports: []corev1.ContainerPort{
 							{ContainerPort: int32(defaults.PFEContainerPort)},
@@ -290,6 +331,16 @@ func (r *ReconcileCodewind) deploymentForCodewindPFE(codewind *codewindv1alpha1.
 			},
 		},
 	}
+	addTrustedCABundle(codewind, &dep.Spec.Template.Spec)
+	addProxyEnv(deploymentOptions, &dep.Spec.Template.Spec)
+	addBuildRegistry(codewind, &dep.Spec.Template.Spec)
+	addLogLevelEnv(&dep.Spec.Template.Spec.Containers[0], componentLogLevels(codewind).PFE)
+	addFIPSEnv(&dep.Spec.Template.Spec.Containers[0])
+	addExtraEnv(&dep.Spec.Template.Spec.Containers[0], extraEnv(codewind).PFE)
+	addGitCredentials(codewind, deploymentOptions, &dep.Spec.Template.Spec)
+	addPFEExtraVolumes(codewind, &dep.Spec.Template.Spec)
+	util.SetContainerProbes(&dep.Spec.Template.Spec.Containers[0], defaults.PFEContainerPort, pfeProbeTimings, componentProbes(codewind).PFE)
+	util.SetDeploymentProbesHash(dep)
 	// Set Codewind instance as the owner of the Deployment.
 	controllerutil.SetControllerReference(codewind, dep, r.scheme)
 	return dep
@@ -343,6 +394,53 @@ func (r *ReconcileCodewind) serviceForCodewindPerformance(codewind *codewindv1al
 	return service
 }
 
+// serviceMonitorsForCodewind returns the ServiceMonitors scraping the PFE and Performance services of a Codewind
+// object, the Performance one only while the performance dashboard is enabled
+func (r *ReconcileCodewind) serviceMonitorsForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) []*unstructured.Unstructured {
+	pfeLabels := labelsForCodewindPFE(deploymentOptions)
+	performanceLabels := labelsForCodewindPerformance(deploymentOptions)
+	serviceMonitors := []*unstructured.Unstructured{
+		util.NewServiceMonitor(deploymentOptions.CodewindPFEServiceName, codewind.Namespace, pfeLabels, pfeLabels, "codewind-http", "https"),
+	}
+	if performanceEnabled(codewind) {
+		serviceMonitors = append(serviceMonitors, util.NewServiceMonitor(deploymentOptions.CodewindPerformanceServiceName, codewind.Namespace, performanceLabels, performanceLabels, defaults.PrefixCodewindPerformance+"-http", "http"))
+	}
+	// Set Codewind instance as the owner of the ServiceMonitors.
+	for _, serviceMonitor := range serviceMonitors {
+		controllerutil.SetControllerReference(codewind, serviceMonitor, r.scheme)
+	}
+	return serviceMonitors
+}
+
+// networkPoliciesForCodewind returns the NetworkPolicies admitting the ingress controller to the gatekeeper, the
+// gatekeeper to PFE and PFE to the performance dashboard while it is enabled
+func (r *ReconcileCodewind) networkPoliciesForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) []*networkingv1.NetworkPolicy {
+	pfeLabels := labelsForCodewindPFE(deploymentOptions)
+	performanceLabels := labelsForCodewindPerformance(deploymentOptions)
+	gatekeeperLabels := labelsForCodewindGatekeeper(deploymentOptions)
+	networkPolicies := []*networkingv1.NetworkPolicy{
+		// The ingress controller or router runs in another namespace, so any source may reach the gatekeeper port
+		util.NewIngressNetworkPolicy(deploymentOptions.CodewindGatekeeperDeploymentName, codewind.Namespace, gatekeeperLabels, gatekeeperLabels, []networkingv1.NetworkPolicyIngressRule{{
+			Ports: util.NetworkPolicyPorts(defaults.GatekeeperContainerPort),
+		}}),
+		util.NewIngressNetworkPolicy(deploymentOptions.CodewindPFEDeploymentName, codewind.Namespace, pfeLabels, pfeLabels, []networkingv1.NetworkPolicyIngressRule{{
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: gatekeeperLabels}}},
+			Ports: util.NetworkPolicyPorts(defaults.PFEContainerPort),
+		}}),
+	}
+	if performanceEnabled(codewind) {
+		networkPolicies = append(networkPolicies, util.NewIngressNetworkPolicy(deploymentOptions.CodewindPerformanceDeploymentName, codewind.Namespace, performanceLabels, performanceLabels, []networkingv1.NetworkPolicyIngressRule{{
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: pfeLabels}}},
+			Ports: util.NetworkPolicyPorts(defaults.PerformanceContainerPort),
+		}}))
+	}
+	// Set Codewind instance as the owner of the NetworkPolicies.
+	for _, networkPolicy := range networkPolicies {
+		controllerutil.SetControllerReference(codewind, networkPolicy, r.scheme)
+	}
+	return networkPolicies
+}
+
 // serviceForCodewindGatekeeper function takes in a Codewind object and returns a Gatekeeper Service for that object.
 func (r *ReconcileCodewind) serviceForCodewindGatekeeper(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *corev1.Service {
 	ls := labelsForCodewindGatekeeper(deploymentOptions)
@@ -368,9 +466,9 @@ func (r *ReconcileCodewind) serviceForCodewindGatekeeper(codewind *codewindv1alp
 }
 
 // deploymentForCodewindGatekeeper returns a Codewind deployment object
-func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, isOnOpenshift bool, keycloakRealm string, keycloakClientID string, keycloakAuthURL string, ingressDomain string) *appsv1.Deployment {
+func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, isOnOpenshift bool, gatekeeperAuth security.GatekeeperAuth, ingressDomain string) *appsv1.Deployment {
 	ls := labelsForCodewindGatekeeper(deploymentOptions)
-	replicas := int32(1)
+	replicas := deploymentReplicas(codewind)
 
 	// Replace any dash characters in the WorkspaceID to understore characters to match variable formats created by Kubernetes
 	workspaceServiceSuffix := strings.ReplaceAll(strings.ToUpper(deploymentOptions.WorkspaceID), "-", "_")
@@ -388,10 +486,17 @@ func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
+					Labels:      ls,
+					Annotations: util.PodSecurityAnnotations(deploymentOptions.PodSecurity),
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: deploymentOptions.CodewindServiceAccountName,
+					NodeSelector:       codewind.Spec.NodeSelector,
+					Tolerations:        codewind.Spec.Tolerations,
+					Affinity:           architectureAffinity(codewind, deploymentOptions, deploymentOptions.GatekeeperImage),
+					PriorityClassName:  codewind.Spec.PriorityClassName,
+					ImagePullSecrets:   deploymentOptions.ImagePullSecrets,
+					SecurityContext:    util.PodSecurityContext(deploymentOptions.PodSecurity),
 					Volumes: []corev1.Volume{{
 						Name: "tls-certs",
 						VolumeSource: corev1.VolumeSource{
@@ -402,8 +507,10 @@ func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1
 					}},
 					Containers: []corev1.Container{{
 						Name:            defaults.PrefixCodewindGatekeeper,
-						Image:           defaults.CodewindGatekeeperImage + ":" + defaults.CodewindGatekeeperImageTag,
+						Image:           util.ImageReference(deploymentOptions.GatekeeperImage),
 						ImagePullPolicy: corev1.PullAlways,
+						Resources:       deploymentOptions.GatekeeperResources,
+						SecurityContext: util.ContainerSecurityContext(deploymentOptions.PodSecurity),
 						VolumeMounts: []corev1.VolumeMount{{
 							MountPath: "/tlscerts",
 							Name:      "tls-certs",
@@ -412,15 +519,19 @@ func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1
 						Env: []corev1.EnvVar{
 							{
 								Name:  "AUTH_URL",
-								Value: keycloakAuthURL,
+								Value: gatekeeperAuth.AuthURL,
 							},
 							{
 								Name:  "CLIENT_ID",
-								Value: keycloakClientID,
+								Value: gatekeeperAuth.ClientID,
 							},
 							{
 								Name:  "REALM",
-								Value: keycloakRealm,
+								Value: gatekeeperAuth.Realm,
+							},
+							{
+								Name:  "OIDC_ISSUER_URL",
+								Value: gatekeeperAuth.IssuerURL,
 							},
 							{
 								Name:  "ENABLE_AUTH",
@@ -448,13 +559,13 @@ func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1
 									SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: deploymentOptions.CodewindGatekeeperSecretAuthName}, Key: "client_secret"}},
 							},
 							{
-								Name: "SESSION_SECRET",
-								ValueFrom: &corev1.EnvVarSource{
-									SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: deploymentOptions.CodewindGatekeeperSecretSessionName}, Key: "session_secret"}},
+								Name:      sessionSecretEnvName,
+								ValueFrom: &corev1.EnvVarSource{SecretKeyRef: gatekeeperSessionSecret(codewind, deploymentOptions)},
 							},
 							{
+								// The router of an edge route or an external TLS terminator forwards plain HTTP to the gatekeeper
 								Name:  "PORTAL_HTTPS",
-								Value: "true",
+								Value: strconv.FormatBool(!gatekeeperPlainHTTP(codewind, isOnOpenshift)),
 							},
 						},
 						Ports: []corev1.ContainerPort{
@@ -465,13 +576,28 @@ func (r *ReconcileCodewind) deploymentForCodewindGatekeeper(codewind *codewindv1
 			},
 		},
 	}
+	container := &dep.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, gatekeeperSessionEnv(clientSessionSettings(codewind))...)
+	if deploymentOptions.CodewindGatekeeperBasePath != "" {
+		// Path routing, the gatekeeper serves its pages and redirects under the path of the shared host
+		container.Env = append(container.Env, corev1.EnvVar{Name: "GATEKEEPER_BASE_PATH", Value: deploymentOptions.CodewindGatekeeperBasePath})
+	}
+	addTrustedCABundle(codewind, &dep.Spec.Template.Spec)
+	addProxyEnv(deploymentOptions, &dep.Spec.Template.Spec)
+	addLogLevelEnv(&dep.Spec.Template.Spec.Containers[0], componentLogLevels(codewind).Gatekeeper)
+	addFIPSEnv(&dep.Spec.Template.Spec.Containers[0])
+	addExtraEnv(&dep.Spec.Template.Spec.Containers[0], extraEnv(codewind).Gatekeeper)
+	// The gatekeeper listens on the port of its service
+	util.SetContainerProbes(&dep.Spec.Template.Spec.Containers[0], defaults.GatekeeperContainerPort, sidecarProbeTimings, componentProbes(codewind).Gatekeeper)
+	util.SetDeploymentProbesHash(dep)
 	// Set Codewind instance as the owner of the Deployment.
 	controllerutil.SetControllerReference(codewind, dep, r.scheme)
 	return dep
 }
 
 // ingressForCodewindGatekeeper function takes in a Codewind object and returns an Openshift Route for the gatekeeper
-func (r *ReconcileCodewind) routeForCodewindGatekeeper(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, ingressDomain string) *routev1.Route {
+// terminating TLS as set by tls
+func (r *ReconcileCodewind) routeForCodewindGatekeeper(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, ingressDomain string, tls *routev1.TLSConfig) *routev1.Route {
 	ls := labelsForCodewindGatekeeper(deploymentOptions)
 	weight := int32(100)
 	route := &routev1.Route{
@@ -486,13 +612,11 @@ func (r *ReconcileCodewind) routeForCodewindGatekeeper(codewind *codewindv1alpha
 		},
 		Spec: routev1.RouteSpec{
 			Host: deploymentOptions.CodewindGatekeeperIngressHost,
+			Path: deploymentOptions.CodewindGatekeeperBasePath,
 			Port: &routev1.RoutePort{
 				TargetPort: intstr.FromInt(defaults.GatekeeperContainerPort),
 			},
-			TLS: &routev1.TLSConfig{
-				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
-				Termination:                   routev1.TLSTerminationPassthrough,
-			},
+			TLS: tls,
 			To: routev1.RouteTargetReference{
 				Kind:   "Service",
 				Name:   deploymentOptions.CodewindGatekeeperServiceName,
@@ -516,6 +640,16 @@ func (r *ReconcileCodewind) ingressForCodewindGatekeeper(codewind *codewindv1alp
 		"kubernetes.io/ingress.class":                    "nginx",
 		"nginx.ingress.kubernetes.io/force-ssl-redirect": "true",
 	}
+	if externalTLSTermination(codewind) {
+		// The ingress terminates TLS and forwards plain HTTP to the gatekeeper
+		annotations["nginx.ingress.kubernetes.io/backend-protocol"] = "HTTP"
+		delete(annotations, "ingress.bluemix.net/ssl-services")
+	}
+	if deploymentOptions.CodewindGatekeeperBasePath != "" {
+		// The gatekeeper serves the requests under its base path, rewriting them would drop the path
+		delete(annotations, "nginx.ingress.kubernetes.io/rewrite-target")
+	}
+	annotations = util.IngressAnnotations(annotations, deploymentOptions.Ingress)
 	ingress := &extv1beta1.Ingress{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "extensions/v1beta1",
@@ -541,7 +675,7 @@ func (r *ReconcileCodewind) ingressForCodewindGatekeeper(codewind *codewindv1alp
 						HTTP: &extv1beta1.HTTPIngressRuleValue{
 							Paths: []extv1beta1.HTTPIngressPath{
 								{
-									Path: "/",
+									Path: deploymentOptions.CodewindGatekeeperBasePath + "/",
 									Backend: extv1beta1.IngressBackend{
 										ServiceName: deploymentOptions.CodewindGatekeeperServiceName,
 										ServicePort: intstr.FromInt(defaults.GatekeeperContainerPort),
@@ -573,7 +707,7 @@ func (r *ReconcileCodewind) buildGatekeeperSecretSession(codewind *codewindv1alp
 			Labels:    metaLabels,
 		},
 		StringData: map[string]string{
-			"session_secret": sessionSecretValue,
+			sessionSecretKey: sessionSecretValue,
 		},
 	}
 	// Set Codewind instance as the owner of this Secret.
@@ -584,7 +718,7 @@ func (r *ReconcileCodewind) buildGatekeeperSecretSession(codewind *codewindv1alp
 // buildGatekeeperSecretTLS :  builds a TLS secret for gatekeeper
 func (r *ReconcileCodewind) buildGatekeeperSecretTLS(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, ingressDomain string) *corev1.Secret {
 	metaLabels := labelsForCodewindGatekeeper(deploymentOptions)
-	pemPrivateKey, pemPublicCert, _ := util.GenerateCertificate(deploymentOptions.CodewindGatekeeperIngressHost, deploymentOptions.CodewindGatekeeperTLSCertTitle)
+	pemPrivateKey, pemPublicCert, _ := util.GenerateCertificate(deploymentOptions.CodewindGatekeeperIngressHost, deploymentOptions.CodewindGatekeeperTLSCertTitle, gatekeeperServiceDNSNames(codewind, deploymentOptions)...)
 	secret := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Secret",
@@ -605,6 +739,25 @@ func (r *ReconcileCodewind) buildGatekeeperSecretTLS(codewind *codewindv1alpha1.
 	return secret
 }
 
+// certificateForCodewindGatekeeper : builds a cert-manager Certificate for the gatekeeper ingress host, stored in the gatekeeper TLS secret
+func (r *ReconcileCodewind) certificateForCodewindGatekeeper(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *unstructured.Unstructured {
+	certificate := util.NewCertManagerCertificate(deploymentOptions.CodewindGatekeeperCertificateName, codewind.Namespace, labelsForCodewindGatekeeper(deploymentOptions),
+		deploymentOptions.CodewindGatekeeperSecretTLSName, append([]string{deploymentOptions.CodewindGatekeeperIngressHost}, gatekeeperServiceDNSNames(codewind, deploymentOptions)...), codewind.Spec.TLS.CertManager.IssuerRef)
+	// Set Codewind instance as the owner of this Certificate.
+	controllerutil.SetControllerReference(codewind, certificate, r.scheme)
+	return certificate
+}
+
+// certificateForCodewindPFE : builds a cert-manager Certificate for the PFE service
+func (r *ReconcileCodewind) certificateForCodewindPFE(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *unstructured.Unstructured {
+	serviceHost := deploymentOptions.CodewindPFEServiceName + "." + codewind.Namespace + ".svc"
+	certificate := util.NewCertManagerCertificate(deploymentOptions.CodewindPFECertificateName, codewind.Namespace, labelsForCodewindPFE(deploymentOptions),
+		deploymentOptions.CodewindPFESecretTLSName, []string{serviceHost, deploymentOptions.CodewindPFEServiceName, serviceHost + ".cluster.local"}, codewind.Spec.TLS.CertManager.IssuerRef)
+	// Set Codewind instance as the owner of this Certificate.
+	controllerutil.SetControllerReference(codewind, certificate, r.scheme)
+	return certificate
+}
+
 // buildGatekeeperSecretAuth :  builds an authentication detail secret for gatekeeper
 func (r *ReconcileCodewind) buildGatekeeperSecretAuth(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, keycloakClientKey string) *corev1.Secret {
 	metaLabels := labelsForCodewindGatekeeper(deploymentOptions)
@@ -627,6 +780,150 @@ func (r *ReconcileCodewind) buildGatekeeperSecretAuth(codewind *codewindv1alpha1
 	return secret
 }
 
+// buildClientCredentialsSecret : builds the secret CI pipelines mount to request tokens with the client credentials grant
+func (r *ReconcileCodewind) buildClientCredentialsSecret(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, gatekeeperAuth security.GatekeeperAuth, clientSecret string) *corev1.Secret {
+	metaLabels := labelsForCodewindGatekeeper(deploymentOptions)
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentOptions.CodewindClientCredentialsSecretName,
+			Namespace: codewind.Namespace,
+			Labels:    metaLabels,
+		},
+		StringData: map[string]string{
+			"client_id":     gatekeeperAuth.ClientID,
+			"client_secret": clientSecret,
+			"token_url":     gatekeeperAuth.IssuerURL + "/protocol/openid-connect/token",
+			"access_url":    gatekeeperURL(deploymentOptions),
+		},
+	}
+	// Set Codewind instance as the owner of this secret.
+	controllerutil.SetControllerReference(codewind, secret, r.scheme)
+	return secret
+}
+
+// addTrustedCABundle mounts the trusted CA bundle of the CR into every container of the pod and points
+// NODE_EXTRA_CA_CERTS at it
+func addTrustedCABundle(codewind *codewindv1alpha1.Codewind, podSpec *corev1.PodSpec) {
+	caBundle := codewind.Spec.TrustedCABundle
+	if caBundle == nil || (caBundle.ConfigMap == "" && caBundle.Secret == "") {
+		return
+	}
+	key := caBundle.Key
+	if key == "" {
+		key = "ca.crt"
+	}
+	items := []corev1.KeyToPath{{Key: key, Path: defaults.TrustedCABundleFile}}
+	volume := corev1.Volume{Name: "trusted-ca-bundle"}
+	if caBundle.ConfigMap != "" {
+		volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: caBundle.ConfigMap},
+			Items:                items,
+		}
+	} else {
+		volume.Secret = &corev1.SecretVolumeSource{SecretName: caBundle.Secret, Items: items}
+	}
+	podSpec.Volumes = append(podSpec.Volumes, volume)
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: defaults.TrustedCABundlePath,
+			ReadOnly:  true,
+		})
+		container.Env = append(container.Env, corev1.EnvVar{Name: "NODE_EXTRA_CA_CERTS", Value: defaults.TrustedCABundlePath + "/" + defaults.TrustedCABundleFile})
+	}
+}
+
+// addProxyEnv sets the proxy environment variables of the resolved proxy settings in every container of the pod
+func addProxyEnv(deploymentOptions DeploymentOptionsCodewind, podSpec *corev1.PodSpec) {
+	proxyEnv := util.ProxyEnv(deploymentOptions.Proxy)
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, proxyEnv...)
+	}
+}
+
+// deploymentReplicas returns the replicas of the PFE, performance and gatekeeper deployments, none while the
+// instance is suspended
+func deploymentReplicas(codewind *codewindv1alpha1.Codewind) int32 {
+	if codewind.Spec.Suspended {
+		return 0
+	}
+	return 1
+}
+
+// extraEnv returns the extra environment variables of the Codewind CR, empty when none are set
+func extraEnv(codewind *codewindv1alpha1.Codewind) codewindv1alpha1.CodewindEnvSpec {
+	if codewind.Spec.Env == nil {
+		return codewindv1alpha1.CodewindEnvSpec{}
+	}
+	return *codewind.Spec.Env
+}
+
+// addFIPSEnv limits the TLS connections of the Node.js servers of a container to FIPS approved settings in FIPS mode
+func addFIPSEnv(container *corev1.Container) {
+	if !util.FIPSMode {
+		return
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: "NODE_OPTIONS", Value: util.FIPSNodeOptions()})
+}
+
+// addExtraEnv appends the extra environment variables of the CR to the container, skipping variables the operator
+// already set so they keep the operator value
+func addExtraEnv(container *corev1.Container, env []corev1.EnvVar) {
+	managed := map[string]bool{}
+	for _, envVar := range container.Env {
+		managed[envVar.Name] = true
+	}
+	for _, envVar := range env {
+		if managed[envVar.Name] {
+			continue
+		}
+		managed[envVar.Name] = true
+		container.Env = append(container.Env, envVar)
+	}
+}
+
+// addPFEExtraVolumes adds the extra volumes of the CR to the PFE pod and mounts them in the PFE container
+func addPFEExtraVolumes(codewind *codewindv1alpha1.Codewind, podSpec *corev1.PodSpec) {
+	pfe := codewind.Spec.PFE
+	if pfe == nil {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, pfe.ExtraVolumes...)
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, pfe.ExtraVolumeMounts...)
+}
+
+// defaultImageForCodewind returns the operator default image with the tag of the catalog version, else the
+// image tag set on the Codewind CR
+func defaultImageForCodewind(codewind *codewindv1alpha1.Codewind, image codewindv1alpha1.ImageSpec, versionTag string) codewindv1alpha1.ImageSpec {
+	switch {
+	case versionTag != "":
+		image.Tag = versionTag
+		image.Digest = ""
+	case codewind.Spec.ImageTag != "":
+		image.Tag = codewind.Spec.ImageTag
+		image.Digest = ""
+	}
+	return image
+}
+
+// architectureAffinity returns the affinity of the CR limited to the nodes of the architectures the image is published for
+func architectureAffinity(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, image codewindv1alpha1.ImageSpec) *corev1.Affinity {
+	return util.ArchitectureAffinity(codewind.Spec.Affinity, util.ImageArchitectures(image, deploymentOptions.VersionImages))
+}
+
+// codewindVersion returns the tag of the PFE image, an image pinned by digest reports the default tag
+func codewindVersion(deploymentOptions DeploymentOptionsCodewind) string {
+	if deploymentOptions.PFEImage.Tag != "" {
+		return deploymentOptions.PFEImage.Tag
+	}
+	return defaults.CodewindImageTag
+}
+
 // labelsForCodewindPFE returns the labels for selecting the resources
 // belonging to the given codewind CR name.
 func labelsForCodewindPFE(deploymentOptions DeploymentOptionsCodewind) map[string]string {
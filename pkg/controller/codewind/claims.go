@@ -0,0 +1,79 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+)
+
+// protocolMappersKey : Operator config map key of the protocol mappers added to the client of every instance
+const protocolMappersKey = "protocolMappers"
+
+// protocolMappersFromOperatorConfig : Mappers of the JSON list of the protocolMappers key of the operator config map.
+// Nil when not set, on error nil is returned with the error
+func protocolMappersFromOperatorConfig(data map[string]string) ([]security.ProtocolMapper, error) {
+	value := data[protocolMappersKey]
+	if value == "" {
+		return nil, nil
+	}
+	mappers := []security.ProtocolMapper{}
+	if err := json.Unmarshal([]byte(value), &mappers); err != nil {
+		return nil, fmt.Errorf("operator config map key %s is not a valid JSON list of protocol mappers: %v", protocolMappersKey, err)
+	}
+	for i := range mappers {
+		switch {
+		case mappers[i].Name == "" || mappers[i].ProtocolMapper == "":
+			return nil, fmt.Errorf("operator config map key %s: every protocol mapper needs a name and a protocolMapper", protocolMappersKey)
+		case strings.HasPrefix(mappers[i].Name, security.TokenClaimMapperPrefix):
+			return nil, fmt.Errorf("operator config map key %s: protocol mapper names starting with %s are reserved for the token claims of a CR", protocolMappersKey, security.TokenClaimMapperPrefix)
+		}
+		if mappers[i].Protocol == "" {
+			mappers[i].Protocol = "openid-connect"
+		}
+	}
+	return mappers, nil
+}
+
+// tokenClaimMappers : protocol mappers of the workspace client for the token claims of the CR
+func tokenClaimMappers(codewind *codewindv1alpha1.Codewind) []security.ProtocolMapper {
+	if codewind.Spec.Auth == nil || codewind.Spec.Auth.TokenClaims == nil {
+		return nil
+	}
+	tokenClaims := codewind.Spec.Auth.TokenClaims
+	var mappers []security.ProtocolMapper
+	for _, audience := range tokenClaims.Audience {
+		mappers = append(mappers, security.NewAudienceMapper(security.TokenClaimMapperPrefix+"audience-"+audience, audience))
+	}
+	for _, claim := range tokenClaims.Claims {
+		mappers = append(mappers, security.NewHardcodedClaimMapper(security.TokenClaimMapperPrefix+"claim-"+claim.Name, claim.Name, claim.Value))
+	}
+	if tokenClaims.GroupsClaim != "" {
+		mappers = append(mappers, security.NewGroupMembershipMapper(security.TokenClaimMapperPrefix+"groups", tokenClaims.GroupsClaim, tokenClaims.FullGroupPath))
+	}
+	return mappers
+}
+
+// tokenClaimsHash : identifies the token claims applied to the client, empty when the CR declares none
+func tokenClaimsHash(codewind *codewindv1alpha1.Codewind) string {
+	mappers := tokenClaimMappers(codewind)
+	if len(mappers) == 0 {
+		return ""
+	}
+	jsonMappers, _ := json.Marshal(mappers)
+	return fmt.Sprintf("%x", sha256.Sum256(jsonMappers))
+}
@@ -13,15 +13,22 @@ package codewind
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
 	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/logging"
+	"github.com/eclipse/codewind-operator/pkg/metrics"
+	"github.com/eclipse/codewind-operator/pkg/notification"
 	"github.com/eclipse/codewind-operator/pkg/security"
 	util "github.com/eclipse/codewind-operator/pkg/util"
 	"github.com/go-logr/logr"
@@ -33,8 +40,10 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -46,6 +55,9 @@ import (
 
 var log = logf.Log.WithName("controller_codewind")
 
+// MaxConcurrentReconciles : number of Codewind resources that may be reconciled in parallel
+var MaxConcurrentReconciles = 1
+
 // DeploymentOptionsCodewind : Configuration settings of a Codewind deployment
 type DeploymentOptionsCodewind struct {
 	Name                                string
@@ -53,6 +65,7 @@ type DeploymentOptionsCodewind struct {
 	WorkspaceID                         string
 	CodewindRolesName                   string
 	CodewindRoleBindingName             string
+	CodewindInstanceRoleName            string
 	CodewindTektonClusterRolesName      string
 	CodewindTektonRoleBindingName       string
 	CodewindODOClusterRolesName         string
@@ -71,13 +84,61 @@ type DeploymentOptionsCodewind struct {
 	CodewindGatekeeperDeploymentName    string
 	CodewindGatekeeperIngressName       string
 	CodewindGatekeeperIngressHost       string
+	CodewindGatekeeperBasePath          string
+	CodewindGatekeeperCertificateName   string
+	CodewindPFESecretTLSName            string
+	CodewindPFECertificateName          string
+	CodewindClientCredentialsSecretName string
+	CodewindRemoteAccessSecretName      string
+	CodewindGitCredentialsSecretName    string
+	PFEResources                        corev1.ResourceRequirements
+	PerformanceResources                corev1.ResourceRequirements
+	GatekeeperResources                 corev1.ResourceRequirements
+	PFEImage                            codewindv1alpha1.ImageSpec
+	PerformanceImage                    codewindv1alpha1.ImageSpec
+	GatekeeperImage                     codewindv1alpha1.ImageSpec
+	VersionImages                       util.VersionImages
+	ImagePullSecrets                    []corev1.LocalObjectReference
+	PodSecurity                         codewindv1alpha1.PodSecuritySpec
+	Ingress                             codewindv1alpha1.IngressSpec
+	Proxy                               codewindv1alpha1.ProxySpec
+	PFEPrivileged                       bool
 }
 
 // OperatorConfigMapCodewind : Configuration fields saved in the config map
 type OperatorConfigMapCodewind struct {
-	IngressDomain string
-	StorageSize   string
-	DefaultRealm  string
+	IngressDomain    string
+	StorageSize      string
+	StorageClassName string
+	DefaultRealm     string
+	ClientScopes     []string
+	ProtocolMappers  []security.ProtocolMapper
+	CABundle         codewindv1alpha1.CABundleSpec
+	RetryPolicy      util.RetryPolicy
+	ServiceMonitors  bool
+
+	// LegacyRBAC : bind every instance to the shared cluster role instead of a role of its own
+	LegacyRBAC bool
+
+	// InstanceRoleRules : rules of the operator config map replacing the built in template of the instance role
+	InstanceRoleRules []rbacv1.PolicyRule
+
+	// UpgradeStepTimeout : how long a step of an upgrade may take before the upgrade is rolled back
+	UpgradeStepTimeout time.Duration
+
+	// KeycloakDriftCheckInterval : how often the Keycloak configuration of an instance is checked, zero when never
+	KeycloakDriftCheckInterval time.Duration
+
+	// Data : the operator config map as read, for the defaults of namespaces other than the one of the CR
+	Data map[string]string
+
+	PFEResources         *corev1.ResourceRequirements
+	PerformanceResources *corev1.ResourceRequirements
+	GatekeeperResources  *corev1.ResourceRequirements
+
+	PFEImage         codewindv1alpha1.ImageSpec
+	PerformanceImage codewindv1alpha1.ImageSpec
+	GatekeeperImage  codewindv1alpha1.ImageSpec
 }
 
 // Add creates a new Codewind Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -88,7 +149,7 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	reconciler := &ReconcileCodewind{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	reconciler := &ReconcileCodewind{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("codewind-controller")}
 	operatorNamespace, _ := k8sutil.GetOperatorNamespace()
 	if operatorNamespace == "" {
 		operatorNamespace = "codewind"
@@ -99,11 +160,19 @@ func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 
-	// Disable certificate validation checking
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	// Disable certificate validation checking of the default client. Calls to Keycloak and OIDC providers
+	// verify certificates when a CA bundle is configured in the operator config map or the Keycloak CR. FIPS mode
+	// never skips the validation, certificates are then verified against the system CAs without a bundle
+	if util.FIPSMode {
+		http.DefaultTransport.(*http.Transport).TLSClientConfig = util.TLSConfig(nil)
+	} else {
+		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	// Requests of the default client use the proxy of the operator config map
+	http.DefaultTransport.(*http.Transport).Proxy = util.Proxy
 
 	// Create a new controller
-	c, err := controller.New("codewind-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("codewind-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: MaxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
@@ -123,6 +192,31 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch the owned deployments so the status conditions follow their availability
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &codewindv1alpha1.Codewind{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the Keycloak CRs, which may live in other namespaces than the Codewind CRs using them
+	err = c.Watch(&source.Kind{Type: &codewindv1alpha1.Keycloak{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: codewindsForKeycloak(mgr.GetClient()),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the operator config map so that changed defaults reach every Codewind CR without restarting the operator
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: allCodewinds(mgr.GetClient()),
+	}, util.OperatorConfigMapPredicate(defaults.OperatorConfigMapName))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -131,8 +225,9 @@ var _ reconcile.Reconciler = &ReconcileCodewind{}
 
 // ReconcileCodewind reconciles a Codewind object
 type ReconcileCodewind struct {
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for a Codewind object and makes changes based on the state read
@@ -141,9 +236,10 @@ type ReconcileCodewind struct {
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	defer metrics.ObserveReconcile("Codewind", request, time.Now())
 
 	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
-	isOpenshift, _, err := util.DetectOpenShift()
+	isOpenshift, isOpenshift4, err := util.DetectOpenShift()
 	if err != nil {
 		reqLogger.Error(err, "An error occurred when detecting current infrastructure", "")
 	}
@@ -157,12 +253,50 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{}, err
 	}
 
-	codewindConfigMap := OperatorConfigMapCodewind{
-		IngressDomain: operatorConfigMap.Data["ingressDomain"],
-		StorageSize:   operatorConfigMap.Data["storageCodewindSize"],
-		DefaultRealm:  operatorConfigMap.Data["defaultRealm"],
+	// Apply a log level changed in the operator config map
+	if changed, err := logging.ApplyOperatorConfig(operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid log level in the operator config map", "key", logging.OperatorConfigLogLevelKey)
+	} else if changed {
+		reqLogger.Info("Changed the operator log level", "level", logging.Level())
+	}
+	if util.ApplyProxyConfig(operatorConfigMap.Data) {
+		reqLogger.Info("Changed the outbound proxy of the operator", "httpProxy", operatorConfigMap.Data[util.HTTPProxyKey], "httpsProxy", operatorConfigMap.Data[util.HTTPSProxyKey])
+	}
+	if changed, err := util.ApplyHTTPClientConfig(operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid HTTP client settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the HTTP client settings of the operator")
+	}
+	if changed, err := security.ApplyAuditConfig(r.client, operatorNamespace, operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid audit settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the audit sinks of the operator", "configMap", operatorConfigMap.Data[security.AuditConfigMapKey], "webhook", operatorConfigMap.Data[security.AuditWebhookURLKey] != "")
+	}
+	if changed, err := security.ApplyKeycloakGuardConfig(operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid Keycloak rate limit settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the rate limit and circuit breaker of the requests to Keycloak")
+	}
+	if changed, err := notification.ApplyConfig(r.client, operatorNamespace, operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Not posting notifications, invalid notification settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the notification webhook of the operator", "webhook", operatorConfigMap.Data[notification.WebhookURLKey] != "", "events", operatorConfigMap.Data[notification.EventsKey])
 	}
 
+	// The apps domain of an OpenShift 4 cluster replaces the ingressDomain of the cluster, not those of the namespaces
+	clusterIngressDomain, domainErr := util.OperatorIngressDomain(operatorConfigMap.Data, isOpenshift4)
+	if domainErr != nil {
+		reqLogger.Error(domainErr, "Unable to detect the apps domain of the cluster, using the ingressDomain of the operator config map")
+	}
+	if clusterIngressDomain != operatorConfigMap.Data["ingressDomain"] {
+		if operatorConfigMap.Data == nil {
+			operatorConfigMap.Data = map[string]string{}
+		}
+		operatorConfigMap.Data["ingressDomain"] = clusterIngressDomain
+	}
+
+	codewindConfigMap := codewindOperatorConfig(reqLogger, operatorConfigMap.Data, request.Namespace)
+
 	// get the operator config map
 	configMap := &corev1.ConfigMap{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: "codewind-config", Namespace: ""}, configMap)
@@ -179,6 +313,10 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 		reqLogger.Info("Using storageclass", "name", defaults.ROKSStorageClass)
 		storageClassName = defaults.ROKSStorageClass
 	}
+	// A storage class set in the operator config map wins over the detected class
+	if codewindConfigMap.StorageClassName != "" {
+		storageClassName = codewindConfigMap.StorageClassName
+	}
 
 	// Fetch the Codewind instance
 	codewind := &codewindv1alpha1.Codewind{}
@@ -193,6 +331,12 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{}, err
 	}
 
+	// Settings on the CR, usually filled in by the defaulting webhook, override the operator config map
+	ingressDomain := codewindConfigMap.IngressDomain
+	if codewind.Spec.IngressDomain != "" {
+		ingressDomain = codewind.Spec.IngressDomain
+	}
+
 	// Get the workspaceID from the CR else generate and store a new workspaceID
 	workspaceID := r.getCodewindWorkspaceID(codewind)
 	if workspaceID == "" {
@@ -203,78 +347,74 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{Requeue: true}, nil
 	}
 
-	deploymentOptions := DeploymentOptionsCodewind{
-		Name:                                codewind.Name,
-		WorkspaceID:                         workspaceID,
-		CodewindRolesName:                   defaults.CodewindRolesName,
-		CodewindServiceAccountName:          "codewind-" + workspaceID,
-		TektonRoleBindingName:               defaults.CodewindTektonClusterRoleBindingName + "-" + workspaceID,
-		CodewindRoleBindingName:             defaults.CodewindRoleBindingNamePrefix + "-" + workspaceID,
-		CodewindTektonClusterRolesName:      defaults.CodewindTektonClusterRolesName,
-		CodewindTektonRoleBindingName:       defaults.CodewindTektonClusterRoleBindingName + "-" + workspaceID,
-		CodewindODOClusterRolesName:         defaults.CodewindODOClusterRolesName,
-		CodewindODORoleBindingName:          defaults.CodewindODOClusterRoleBindingName + "-" + workspaceID,
-		CodewindPFEPVCName:                  defaults.PrefixCodewindPFE + "-pvc-" + workspaceID,
-		CodewindPFEDeploymentName:           defaults.PrefixCodewindPFE + "-" + workspaceID,
-		CodewindPFEServiceName:              defaults.PrefixCodewindPFE + "-" + workspaceID,
-		CodewindPerformanceDeploymentName:   defaults.PrefixCodewindPerformance + "-" + workspaceID,
-		CodewindPerformanceServiceName:      defaults.PrefixCodewindPerformance + "-" + workspaceID,
-		CodewindGatekeeperDeploymentName:    defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
-		CodewindGatekeeperIngressName:       defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
-		CodewindGatekeeperIngressHost:       defaults.PrefixCodewindGatekeeper + "-" + workspaceID + "." + codewind.Namespace + "." + codewindConfigMap.IngressDomain,
-		CodewindGatekeeperSecretSessionName: "secret-codewind-session-" + workspaceID,
-		CodewindGatekeeperSecretTLSName:     "secret-codewind-tls-" + workspaceID,
-		CodewindGatekeeperTLSCertTitle:      "Codewind" + "-" + workspaceID,
-		CodewindGatekeeperSecretAuthName:    "secret-codewind-client-" + workspaceID,
-		CodewindGatekeeperServiceName:       defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
-	}
+	// The finalizers only need the names of the resources, so a version missing from the catalog or without images
+	// for the architecture does not block the deletion of the CR
+	deploymentOptions, optionsErr := deploymentOptionsForCodewind(reqLogger, codewind, codewindConfigMap, workspaceID, ingressDomain, isOpenshift)
 
 	// Check if Codewind is being deleted
 	if !codewind.GetDeletionTimestamp().IsZero() {
 
 		// Perform finalizer clean up, then clear the finalizer, then allow this Codewind CR to be deleted
+		if err := r.handleCodewindKeycloakFinalizer(codewind, deploymentOptions, codewindConfigMap, reqLogger, request); err != nil {
+			return reconcile.Result{}, err
+		}
 		if err := r.handleCodewindCRBFinalizer(codewind, deploymentOptions, reqLogger, request); err != nil {
 			return reconcile.Result{}, err
 		}
+		notification.Notify(codewindNotification(codewind, notification.EventDeleted))
 
 		//Stop the reconcile
 		return reconcile.Result{}, nil
 	}
 
+	var architectureErr *util.UnsupportedArchitectureError
+	if errors.As(optionsErr, &architectureErr) {
+		return r.unsupportedArchitecture(reqLogger, codewind, optionsErr)
+	}
+	if optionsErr != nil {
+		return r.unknownVersion(reqLogger, codewind, optionsErr)
+	}
+	if condition := getCodewindCondition(codewind, codewindv1alpha1.CodewindUnsupportedArchitecture); condition != nil && condition.Status == corev1.ConditionTrue {
+		setCodewindCondition(codewind, codewindv1alpha1.CodewindUnsupportedArchitecture, corev1.ConditionFalse, "ImagesAvailable", "The version has images for the architecture of the pods")
+	}
+
 	// Add finalizer to this Codewind CR
 	if err := r.addCodewindFinalizer(reqLogger, codewind, request); err != nil {
 		return reconcile.Result{}, err
 	}
 
-	// Check if the Codewind Cluster roles already exist, if not create new ones
-	clusterRoles := &rbacv1.ClusterRole{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindRolesName, Namespace: ""}, clusterRoles)
-	if err != nil && k8serr.IsNotFound(err) {
-		newClusterRoles := r.clusterRolesForCodewind(codewind, deploymentOptions)
-		reqLogger.Info("Creating a new Codewind cluster roles", "Namespace", "", "Name", newClusterRoles.Name)
-		err = r.client.Create(context.TODO(), newClusterRoles)
-		if err != nil {
-			reqLogger.Error(err, "Failed to create new Codewind cluster roles.", "Namespace", "", "Name", newClusterRoles.Name)
-			return reconcile.Result{}, err
-		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Codewind cluster roles.")
-		return reconcile.Result{}, err
+	// Hibernate or delete the instance once it was idle for longer than its TTL
+	ttl, ttlAction, err := idleSettings(codewind, operatorConfigMap.Data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid idle cleanup settings in the operator config map")
+	}
+	idleResult, stop := r.reconcileIdle(reqLogger, codewind, ttl, ttlAction)
+	if stop {
+		return idleResult, nil
 	}
 
-	// Check if the Codewind instance Role Bindings already exist, if not create new ones
-	roleBinding := &rbacv1.RoleBinding{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindRoleBindingName, Namespace: codewind.Namespace}, roleBinding)
-	if err != nil && k8serr.IsNotFound(err) {
-		newRoleBinding := r.roleBindingForCodewind(codewind, deploymentOptions)
-		reqLogger.Info("Creating a new Codewind role binding", "Namespace", newRoleBinding.Namespace, "Name", newRoleBinding.Name)
-		err = r.client.Create(context.TODO(), newRoleBinding)
-		if err != nil {
-			reqLogger.Error(err, "Failed to create new Codewind role binding.", "Namespace", newRoleBinding.Namespace, "Name", newRoleBinding.Name)
-			return reconcile.Result{}, err
-		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Codewind role binding.")
+	// Refuse to provision instances beyond the instance quota of the operator config map
+	quota, err := quotaFromOperatorConfig(operatorConfigMap.Data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid instance quota in the operator config map")
+	}
+	if result, stop, err := r.reconcileQuota(reqLogger, codewind, quota); stop {
+		return result, err
+	}
+
+	// A changed instance version rolls out one component at a time
+	if result, stop := r.planUpgrade(reqLogger, codewind, &deploymentOptions, codewindConfigMap.UpgradeStepTimeout); stop {
+		return result, nil
+	}
+
+	// Take over the resources of an existing deployment named by the workspace ID
+	if err := r.adoptResources(reqLogger, codewind, deploymentOptions, isOpenshift); err != nil {
+		return r.adoptionResult(reqLogger, codewind, err)
+	}
+
+	// Bind the Codewind service account to the role of the instance, or to the shared cluster role
+	err = r.reconcileCodewindRBAC(reqLogger, codewind, deploymentOptions, codewindConfigMap, isOpenshift)
+	if err != nil {
 		return reconcile.Result{}, err
 	}
 
@@ -360,11 +500,19 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{}, err
 	}
 
+	// Size and storage class of the PFE volume, the CR wins over the operator config map and the detected class
+	storageSize, storageSizeOnCR, err := util.SelectStorageSize(codewind.Spec.Storage, codewind.Spec.StorageSize, codewindConfigMap.StorageSize)
+	if err != nil {
+		reqLogger.Error(err, "Invalid PFE storage size", "Namespace", codewind.Namespace, "Name", codewind.Name)
+		return reconcile.Result{}, err
+	}
+	storageClassName = util.SelectStorageClassName(codewind.Spec.Storage, storageClassName)
+
 	// Check if the Codewind PVC already exist, if not create a new one
 	codewindPVC := &corev1.PersistentVolumeClaim{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindPFEPVCName, Namespace: codewind.Namespace}, codewindPVC)
 	if err != nil && k8serr.IsNotFound(err) {
-		newCodewindPVC := r.pvcForCodewind(codewind, deploymentOptions, storageClassName, codewindConfigMap.StorageSize)
+		newCodewindPVC := r.pvcForCodewind(codewind, deploymentOptions, storageClassName, storageSize)
 		reqLogger.Info("Creating a new Codewind PFE PVC", "Namespace", newCodewindPVC.Namespace, "Name", newCodewindPVC.Name)
 		err = r.client.Create(context.TODO(), newCodewindPVC)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
@@ -374,44 +522,143 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get PFE PVC.")
 		return reconcile.Result{}, err
+	} else if storageSizeOnCR && util.ExpandPVC(codewindPVC, storageSize) {
+		// The size on the CR grew, the storage class must allow volume expansion
+		reqLogger.Info("Expanding the Codewind PFE PVC", "Namespace", codewindPVC.Namespace, "Name", codewindPVC.Name, "Size", storageSize.String())
+		err = r.client.Update(context.TODO(), codewindPVC)
+		if err != nil {
+			reqLogger.Error(err, "Failed to expand PFE PVC.", "Namespace", codewindPVC.Namespace, "Name", codewindPVC.Name)
+			return reconcile.Result{}, err
+		}
 	}
 
-	keycloakPod, err := r.getKeycloakPod(reqLogger, request, codewind.Spec.KeycloakDeployment)
-	if err != nil || keycloakPod == nil {
-		reqLogger.Error(err, "Unable to find the requested Keycloak pod")
-		return reconcile.Result{RequeueAfter: time.Second * 10}, err
+	// Request the PFE certificate from cert-manager when configured, the PFE deployment mounts its secret
+	useCertManager := util.CertManagerEnabled(codewind.Spec.TLS)
+	certificatesReady := true
+	certificatesMessage := ""
+	if useCertManager {
+		ready, message, err := util.EnsureCertManagerCertificate(r.client, r.certificateForCodewindPFE(codewind, deploymentOptions))
+		if err != nil {
+			reqLogger.Error(err, "Failed to request the PFE certificate.", "Namespace", codewind.Namespace, "Name", deploymentOptions.CodewindPFECertificateName)
+			return reconcile.Result{}, err
+		}
+		certificatesReady = ready
+		certificatesMessage = message
 	}
-	reqLogger.Info("Found the running Keycloak Pod", "Labels:", keycloakPod.GetLabels())
 
-	// Get the keycloak admin credentials
-	authID := keycloakPod.GetLabels()["authID"]
-	if authID == "" {
-		reqLogger.Error(err, "Unable to find AuthID in keycloak pod.", "Namespace", keycloakPod.Namespace, "Name", keycloakPod.Name)
-		return reconcile.Result{}, err
-	}
+	gatekeeperPublicURL := gatekeeperURL(deploymentOptions)
+	clientKey := ""
 
-	keycloakAdminUser, keycloakAdminPass, err := r.getKeycloakAdminCredentials(authID, keycloakPod.Namespace)
+	// Choose the identity provider of this instance
+	authProvider, err := r.authProviderForCodewind(reqLogger, request, codewind, codewindConfigMap, deploymentOptions)
 	if err != nil {
-		reqLogger.Error(err, "Unable to retrieve the Keycloak credentials")
 		return reconcile.Result{RequeueAfter: time.Second * 10}, err
 	}
+	gatekeeperAuth := authProvider.GatekeeperAuth()
 
-	keycloakRealm := codewindConfigMap.DefaultRealm
-	keycloakAuthHostName := defaults.PrefixCodewindKeycloak + "-" + authID + "." + keycloakPod.Namespace + "." + codewindConfigMap.IngressDomain
-	keycloakAuthURL := "https://" + keycloakAuthHostName
-	keycloakClientID := "codewind-" + deploymentOptions.WorkspaceID
-	gatekeeperPublicURL := "https://" + deploymentOptions.CodewindGatekeeperIngressHost
-	clientKey := ""
+	// Update the identity provider for user if needed
+	accessList := codewindAccessList(codewind)
+	accessGroups := codewindAccessGroups(codewind)
+	sessionHash := sessionSettingsHash(clientSessionSettings(codewind))
+	clientServiceAccount := serviceAccountEnabled(codewind)
+	claimsHash := tokenClaimsHash(codewind)
 
-	// Update Keycloak for user if needed
-	if codewind.Status.KeycloakStatus == "" {
+	// Restore the realm, client and access role of a configured deployment when an administrator changed them
+	if codewind.Status.KeycloakStatus == defaults.ConstKeycloakConfigReady && keycloakDriftCheckDue(codewind, codewindConfigMap.KeycloakDriftCheckInterval) {
+		err = r.repairKeycloakDrift(reqLogger, codewind, authProvider, gatekeeperAuth)
+		if err != nil {
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+	}
+	if codewind.Status.KeycloakStatus != defaults.ConstKeycloakConfigReady {
 		codewind.Status.KeycloakStatus = defaults.ConstKeycloakConfigStarted
-		clientKey, err = security.AddCodewindToKeycloak(deploymentOptions.WorkspaceID, keycloakAuthURL, keycloakRealm, keycloakAdminUser, keycloakAdminPass, gatekeeperPublicURL, codewind.Spec.Username, keycloakClientID)
+		clientKey, err = authProvider.ConfigureDeployment()
 		if err != nil {
-			reqLogger.Error(err, "Failed to update Keycloak for deployment.", "Namespace", codewind.Namespace, "ClientID", keycloakClientID)
-			return reconcile.Result{}, err
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonKeycloakConfigured, "Client %s is configured in realm %s", gatekeeperAuth.ClientID, gatekeeperAuth.Realm)
+		if clientKey != "" {
+			r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonClientSecretFetched, "Fetched the secret of client %s", gatekeeperAuth.ClientID)
 		}
 		codewind.Status.KeycloakStatus = defaults.ConstKeycloakConfigReady
+		codewind.Status.SessionSettingsHash = sessionHash
+		codewind.Status.ServiceAccountEnabled = clientServiceAccount
+		codewind.Status.TokenClaimsHash = claimsHash
+		checked := metav1.Now()
+		codewind.Status.KeycloakCheckTime = &checked
+	} else if accessListChanged(codewind.Status.AccessList, accessList) || accessListChanged(codewind.Status.AccessGroups, accessGroups) {
+		// Users or groups were added to or removed from the access lists of a configured deployment
+		reqLogger.Info("Updating the users granted access to the deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		err = authProvider.UpdateAccess()
+		if err != nil {
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+	}
+	codewind.Status.AccessList = accessList
+	codewind.Status.AccessGroups = accessGroups
+
+	// Apply changed token and session lifetimes, a newly configured client already has them
+	if codewind.Status.SessionSettingsHash != sessionHash {
+		reqLogger.Info("Updating the session settings of the deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		err = authProvider.UpdateSessionSettings()
+		if err != nil {
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+		codewind.Status.SessionSettingsHash = sessionHash
+	}
+
+	// Enable or disable the service account used by CI pipelines
+	if codewind.Status.ServiceAccountEnabled != clientServiceAccount {
+		reqLogger.Info("Updating the service account of the deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID, "Enabled", clientServiceAccount)
+		err = authProvider.UpdateServiceAccount()
+		if err != nil {
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+		codewind.Status.ServiceAccountEnabled = clientServiceAccount
+	}
+
+	// Sync the protocol mappers when the token claims of the CR changed
+	if codewind.Status.TokenClaimsHash != claimsHash {
+		reqLogger.Info("Updating the token claims of the deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		err = authProvider.UpdateTokenClaims()
+		if err != nil {
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+		codewind.Status.TokenClaimsHash = claimsHash
+	}
+
+	// Point the redirect URIs of the client at the new gatekeeper URL when the hostname changed
+	if codewind.Status.AccessURL != "" && codewind.Status.AccessURL != gatekeeperPublicURL {
+		reqLogger.Info("Updating the redirect URL of the deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID, "Previous", codewind.Status.AccessURL, "URL", gatekeeperPublicURL)
+		err = authProvider.UpdateRedirectURL(codewind.Status.AccessURL)
+		if err != nil {
+			return r.keycloakConfigFailed(reqLogger, codewind, gatekeeperAuth, err)
+		}
+	}
+	setCodewindCondition(codewind, codewindv1alpha1.CodewindKeycloakConfigured, corev1.ConditionTrue, "Configured", "Client "+gatekeeperAuth.ClientID+" is configured in realm "+gatekeeperAuth.Realm)
+	if result, wait := r.waitForUpgradeStep(reqLogger, codewind, codewindv1alpha1.CodewindUpgradeStepKeycloak, nil); wait {
+		return result, nil
+	}
+
+	// Write the git credentials of the CR into the secret mounted by PFE
+	var gitFiles map[string]string
+	if codewind.Spec.GitCredentialsSecret != "" {
+		gitFiles, err = r.gitCredentials(codewind)
+		if err != nil {
+			reqLogger.Error(err, "Invalid git credentials secret of the Codewind instance", "Namespace", codewind.Namespace, "Name", codewind.Spec.GitCredentialsSecret)
+			r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonGitCredentialsInvalid, err.Error())
+			return reconcile.Result{RequeueAfter: time.Second * 30}, nil
+		}
+	}
+	err = r.syncGitCredentialsSecret(reqLogger, codewind, deploymentOptions, gitFiles)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.checkBuildRegistrySecret(codewind)
+	if err != nil {
+		reqLogger.Error(err, "Invalid build registry secret of the Codewind instance", "Namespace", codewind.Namespace, "Name", codewind.Spec.BuildRegistry.SecretName)
+		r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonBuildRegistryInvalid, err.Error())
+		return reconcile.Result{RequeueAfter: time.Second * 30}, nil
 	}
 
 	// Check if the Codewind PFE Deployment already exists, if not create a new one
@@ -419,20 +666,35 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindPFEDeploymentName, Namespace: codewind.Namespace}, deployment)
 	if err != nil && k8serr.IsNotFound(err) {
 		// Define a new Deployment
-		dep := r.deploymentForCodewindPFE(codewind, deploymentOptions, isOpenshift, keycloakRealm, keycloakAuthHostName, codewind.Spec.LogLevel, codewindConfigMap.IngressDomain)
+		dep := r.deploymentForCodewindPFE(codewind, deploymentOptions, isOpenshift, gatekeeperAuth.Realm, gatekeeperAuth.AuthHost, codewind.Spec.LogLevel, ingressDomain)
 		reqLogger.Info("The workspace ID of this is:", "WorkspaceID", deploymentOptions.WorkspaceID)
 		reqLogger.Info("Creating a new PFE Deployment.", "Namespace", dep.Namespace, "Name", dep.Name)
 		err = r.client.Create(context.TODO(), dep)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
 			reqLogger.Error(err, "Failed to create new PFE deployment.", "Namespace", dep.Namespace, "Name", dep.Name)
+			r.recorder.Eventf(codewind, corev1.EventTypeWarning, defaults.EventReasonCreateFailed, "Failed to create PFE deployment %s: %v", dep.Name, err)
 			return reconcile.Result{}, err
 		}
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonCreated, "Created PFE deployment %s", dep.Name)
 		// Deployment created successfully - return and requeue
 		return reconcile.Result{Requeue: true}, nil
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get PFE Deployment.")
 		return reconcile.Result{}, err
 	}
+	desiredPFE := r.deploymentForCodewindPFE(codewind, deploymentOptions, isOpenshift, gatekeeperAuth.Realm, gatekeeperAuth.AuthHost, codewind.Spec.LogLevel, ingressDomain)
+	if replaced, err := r.adoptDeployment(reqLogger, codewind, deployment, desiredPFE); err != nil || replaced {
+		return r.adoptionResult(reqLogger, codewind, err)
+	}
+	// Roll the deployment when its image changed
+	err = r.updateDeployment(reqLogger, deployment, desiredPFE)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	setDeploymentCondition(codewind, codewindv1alpha1.CodewindPFEReady, deployment)
+	if result, wait := r.waitForUpgradeStep(reqLogger, codewind, codewindv1alpha1.CodewindUpgradeStepPFE, deployment); wait {
+		return result, nil
+	}
 
 	// Check if the Codewind PFE Service already exists, if not create a new one
 	service := &corev1.Service{}
@@ -450,73 +712,167 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{}, err
 	}
 
-	// Check if the Codewind Performance Deployment already exists, if not create a new one
-	deploymentPerformance := &appsv1.Deployment{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindPerformanceDeploymentName, Namespace: codewind.Namespace}, deploymentPerformance)
-	if err != nil && k8serr.IsNotFound(err) {
-		// Define a new Performance Deployment
-		newDeployment := r.deploymentForCodewindPerformance(codewind, deploymentOptions, codewindConfigMap.IngressDomain)
-		reqLogger.Info("Creating a new Performance deployment.", "Namespace", codewind.Namespace, "Name", newDeployment.Name)
-		err = r.client.Create(context.TODO(), newDeployment)
-		if err != nil && !k8serr.IsAlreadyExists(err) {
-			reqLogger.Error(err, "Failed to create new Performance deployment.", "Namespace", codewind.Namespace, "Name", newDeployment.Name)
+	// The performance dashboard is optional, a disabled one is removed and its upgrade step has nothing to roll out
+	if !performanceEnabled(codewind) {
+		err = r.removePerformance(reqLogger, codewind, deploymentOptions)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if result, wait := r.waitForUpgradeStep(reqLogger, codewind, codewindv1alpha1.CodewindUpgradeStepPerformance, nil); wait {
+			return result, nil
+		}
+	} else {
+		// Check if the Codewind Performance Deployment already exists, if not create a new one
+		deploymentPerformance := &appsv1.Deployment{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindPerformanceDeploymentName, Namespace: codewind.Namespace}, deploymentPerformance)
+		if err != nil && k8serr.IsNotFound(err) {
+			// Define a new Performance Deployment
+			newDeployment := r.deploymentForCodewindPerformance(codewind, deploymentOptions, ingressDomain)
+			reqLogger.Info("Creating a new Performance deployment.", "Namespace", codewind.Namespace, "Name", newDeployment.Name)
+			err = r.client.Create(context.TODO(), newDeployment)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new Performance deployment.", "Namespace", codewind.Namespace, "Name", newDeployment.Name)
+				r.recorder.Eventf(codewind, corev1.EventTypeWarning, defaults.EventReasonCreateFailed, "Failed to create Performance deployment %s: %v", newDeployment.Name, err)
+				return reconcile.Result{}, err
+			}
+			r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonCreated, "Created Performance deployment %s", newDeployment.Name)
+			return reconcile.Result{Requeue: true}, nil
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get Codewind Performance deployment")
+			return reconcile.Result{}, err
+		}
+		desiredPerformance := r.deploymentForCodewindPerformance(codewind, deploymentOptions, ingressDomain)
+		if replaced, err := r.adoptDeployment(reqLogger, codewind, deploymentPerformance, desiredPerformance); err != nil || replaced {
+			return r.adoptionResult(reqLogger, codewind, err)
+		}
+		err = r.updateDeployment(reqLogger, deploymentPerformance, desiredPerformance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		setDeploymentCondition(codewind, codewindv1alpha1.CodewindPerformanceReady, deploymentPerformance)
+		if result, wait := r.waitForUpgradeStep(reqLogger, codewind, codewindv1alpha1.CodewindUpgradeStepPerformance, deploymentPerformance); wait {
+			return result, nil
+		}
+
+		// Check if the Codewind Performance Service already exists, if not create a new one
+		servicePerformance := &corev1.Service{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindPerformanceServiceName, Namespace: codewind.Namespace}, servicePerformance)
+		if err != nil && k8serr.IsNotFound(err) {
+			newService := r.serviceForCodewindPerformance(codewind, deploymentOptions)
+			reqLogger.Info("Creating a new Codewind performance service", "Namespace", newService.Namespace, "Name", newService.Name)
+			err = r.client.Create(context.TODO(), newService)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new Service.", "Namespace", newService.Namespace, "Name", newService.Name)
+				return reconcile.Result{}, err
+			}
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get Codewind Performance service")
 			return reconcile.Result{}, err
 		}
-		return reconcile.Result{Requeue: true}, nil
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Codewind Performance deployment")
-		return reconcile.Result{}, err
 	}
 
-	// Check if the Codewind Performance Service already exists, if not create a new one
-	servicePerformance := &corev1.Service{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindPerformanceServiceName, Namespace: codewind.Namespace}, servicePerformance)
-	if err != nil && k8serr.IsNotFound(err) {
-		newService := r.serviceForCodewindPerformance(codewind, deploymentOptions)
-		reqLogger.Info("Creating a new Codewind performance service", "Namespace", newService.Namespace, "Name", newService.Name)
-		err = r.client.Create(context.TODO(), newService)
-		if err != nil && !k8serr.IsAlreadyExists(err) {
-			reqLogger.Error(err, "Failed to create new Service.", "Namespace", newService.Namespace, "Name", newService.Name)
+	// Let the Prometheus operator scrape the PFE and Performance services when enabled in the operator config map
+	if codewindConfigMap.ServiceMonitors {
+		err = r.reconcileServiceMonitors(reqLogger, codewind, deploymentOptions)
+		if err != nil {
 			return reconcile.Result{}, err
 		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Codewind Performance service")
+	}
+
+	// Admit only the traffic between the components when NetworkPolicies are enabled
+	err = r.reconcileNetworkPolicies(reqLogger, codewind, deploymentOptions, util.NetworkPoliciesEnabled(codewind.Spec.NetworkPolicies, operatorConfigMap.Data))
+	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	// Check if the Codewind Gatekeeper session secrets already exist, if not create new ones
+	// The gatekeeper reads the session secret referenced by the CR, which the operator only checks. Otherwise check if
+	// the Codewind Gatekeeper session secrets already exist, if not create new ones. An existing session secret is never
+	// rewritten, a new one logs out every user
 	secret := &corev1.Secret{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretSessionName, Namespace: codewind.Namespace}, secret)
-	if err != nil && k8serr.IsNotFound(err) {
-		// Define a new Secrets object
-		session := strings.ToUpper(strconv.FormatInt(util.CreateTimestamp(), 36))
-		newSecret := r.buildGatekeeperSecretSession(codewind, deploymentOptions, session)
-		reqLogger.Info("Creating a new Secret", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
-		err = r.client.Create(context.TODO(), newSecret)
-		if err != nil && !k8serr.IsAlreadyExists(err) {
-			reqLogger.Error(err, "Failed to create new Gatekeeper session secret.", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
+	if sessionSecretRef := gatekeeperSessionSecretRef(codewind); sessionSecretRef != nil {
+		err = r.checkSessionSecret(codewind.Namespace, sessionSecretRef)
+		if err != nil {
+			reqLogger.Error(err, "Invalid session secret of the Codewind instance", "Namespace", codewind.Namespace, "Name", sessionSecretRef.Name)
+			r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonSessionSecretInvalid, err.Error())
+			return reconcile.Result{RequeueAfter: time.Second * 30}, nil
+		}
+	} else {
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretSessionName, Namespace: codewind.Namespace}, secret)
+		if err != nil && k8serr.IsNotFound(err) {
+			// Define a new Secrets object
+			session := strings.ToUpper(strconv.FormatInt(util.CreateTimestamp(), 36))
+			newSecret := r.buildGatekeeperSecretSession(codewind, deploymentOptions, session)
+			reqLogger.Info("Creating a new Secret", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
+			err = r.client.Create(context.TODO(), newSecret)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new Gatekeeper session secret.", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
+				return reconcile.Result{}, err
+			}
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get Gatekeeper session secret.")
 			return reconcile.Result{}, err
 		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Gatekeeper session secret.")
-		return reconcile.Result{}, err
 	}
 
-	// Check if the Codewind Gatekeeper TLS secrets already exist, if not create new ones
-	secret = &corev1.Secret{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretTLSName, Namespace: codewind.Namespace}, secret)
-	if err != nil && k8serr.IsNotFound(err) {
-		// Define a new Secrets object
-		newSecret := r.buildGatekeeperSecretTLS(codewind, deploymentOptions, codewindConfigMap.IngressDomain)
-		reqLogger.Info("Creating a new Secret", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
-		err = r.client.Create(context.TODO(), newSecret)
-		if err != nil && !k8serr.IsAlreadyExists(err) {
-			reqLogger.Error(err, "Failed to create new Gatekeeper TLS secret.", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
+	if tlsSecretName := util.TLSSecretName(codewind.Spec.TLS); tlsSecretName != "" {
+		// The gatekeeper serves the certificate of the existing secret, no certificate is generated or requested
+		err = util.CheckTLSSecret(r.client, codewind.Namespace, tlsSecretName)
+		if err != nil {
+			reqLogger.Error(err, "Invalid TLS secret of the Codewind instance", "Namespace", codewind.Namespace, "Name", tlsSecretName)
+			r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonTLSSecretInvalid, err.Error())
+			setCodewindCondition(codewind, codewindv1alpha1.CodewindCertificatesReady, corev1.ConditionFalse, "SecretInvalid", err.Error())
+			if statusErr := r.client.Status().Update(context.TODO(), codewind); statusErr != nil {
+				return reconcile.Result{}, statusErr
+			}
+			return reconcile.Result{RequeueAfter: time.Second * 30}, nil
+		}
+		setCodewindCondition(codewind, codewindv1alpha1.CodewindCertificatesReady, corev1.ConditionTrue, "SecretProvided", "TLS secret "+tlsSecretName+" is provided")
+	} else if useCertManager {
+		// Request the Codewind Gatekeeper certificate from cert-manager, which writes the TLS secret
+		ready, message, err := util.EnsureCertManagerCertificate(r.client, r.certificateForCodewindGatekeeper(codewind, deploymentOptions))
+		if err != nil {
+			reqLogger.Error(err, "Failed to request the Gatekeeper certificate.", "Namespace", codewind.Namespace, "Name", deploymentOptions.CodewindGatekeeperCertificateName)
 			return reconcile.Result{}, err
 		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get TLS secret.")
-		return reconcile.Result{}, err
+		if certificatesReady && !ready {
+			certificatesMessage = message
+		}
+		certificatesReady = certificatesReady && ready
+		if certificatesReady {
+			setCodewindCondition(codewind, codewindv1alpha1.CodewindCertificatesReady, corev1.ConditionTrue, "CertificatesIssued", "cert-manager issued the PFE and gatekeeper certificates")
+		} else {
+			setCodewindCondition(codewind, codewindv1alpha1.CodewindCertificatesReady, corev1.ConditionFalse, "CertificatesPending", certificatesMessage)
+		}
+	} else {
+		// Check if the Codewind Gatekeeper TLS secrets already exist, if not create new ones
+		secret = &corev1.Secret{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretTLSName, Namespace: codewind.Namespace}, secret)
+		if err != nil && k8serr.IsNotFound(err) {
+			// Define a new Secrets object
+			newSecret := r.buildGatekeeperSecretTLS(codewind, deploymentOptions, ingressDomain)
+			reqLogger.Info("Creating a new Secret", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
+			err = r.client.Create(context.TODO(), newSecret)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new Gatekeeper TLS secret.", "Namespace", newSecret.Namespace, "Name", newSecret.Name)
+				r.recorder.Eventf(codewind, corev1.EventTypeWarning, defaults.EventReasonCreateFailed, "Failed to create TLS secret %s: %v", newSecret.Name, err)
+				return reconcile.Result{}, err
+			}
+			r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonCertificateGenerated, "Generated a self-signed certificate in TLS secret %s", newSecret.Name)
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get TLS secret.")
+			return reconcile.Result{}, err
+		} else if hosts := append([]string{deploymentOptions.CodewindGatekeeperIngressHost}, gatekeeperServiceDNSNames(codewind, deploymentOptions)...); !util.CertificateCoversHosts(secret.Data["tls.crt"], hosts) {
+			// The hostname changed, generate a certificate for the new host
+			reqLogger.Info("Replacing the self-signed certificate of the TLS secret", "Namespace", secret.Namespace, "Name", secret.Name, "Hosts", hosts)
+			secret.StringData = r.buildGatekeeperSecretTLS(codewind, deploymentOptions, ingressDomain).StringData
+			err = r.client.Update(context.TODO(), secret)
+			if err != nil {
+				reqLogger.Error(err, "Failed to update Gatekeeper TLS secret.", "Namespace", secret.Namespace, "Name", secret.Name)
+				return reconcile.Result{}, err
+			}
+			r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonCertificateGenerated, "Generated a self-signed certificate in TLS secret %s", secret.Name)
+		}
+		setCodewindCondition(codewind, codewindv1alpha1.CodewindCertificatesReady, corev1.ConditionTrue, "SecretReady", "TLS secret "+deploymentOptions.CodewindGatekeeperSecretTLSName+" is available")
 	}
 
 	// Check if the Codewind Gatekeeper Auth secrets already exist, if not create new ones
@@ -541,18 +897,68 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperDeploymentName, Namespace: codewind.Namespace}, deploymentGatekeeper)
 	if err != nil && k8serr.IsNotFound(err) {
 		// Define a new Gatekeeper Deployment
-		newDeployment := r.deploymentForCodewindGatekeeper(codewind, deploymentOptions, isOpenshift, keycloakRealm, keycloakClientID, keycloakAuthURL, codewindConfigMap.IngressDomain)
+		newDeployment := r.deploymentForCodewindGatekeeper(codewind, deploymentOptions, isOpenshift, gatekeeperAuth, ingressDomain)
 		reqLogger.Info("Creating a new Gatekeeper deployment.", "Namespace", codewind.Namespace, "Name", newDeployment.Name)
 		err = r.client.Create(context.TODO(), newDeployment)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
 			reqLogger.Error(err, "Failed to create new Gatekeeper deployment.", "Namespace", codewind.Namespace, "Name", newDeployment.Name)
+			r.recorder.Eventf(codewind, corev1.EventTypeWarning, defaults.EventReasonCreateFailed, "Failed to create Gatekeeper deployment %s: %v", newDeployment.Name, err)
 			return reconcile.Result{}, err
 		}
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonCreated, "Created Gatekeeper deployment %s", newDeployment.Name)
 		return reconcile.Result{Requeue: true}, nil
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get Codewind Gatekeeper deployment")
 		return reconcile.Result{}, err
 	}
+	desiredGatekeeper := r.deploymentForCodewindGatekeeper(codewind, deploymentOptions, isOpenshift, gatekeeperAuth, ingressDomain)
+	if replaced, err := r.adoptDeployment(reqLogger, codewind, deploymentGatekeeper, desiredGatekeeper); err != nil || replaced {
+		return r.adoptionResult(reqLogger, codewind, err)
+	}
+	err = r.updateDeployment(reqLogger, deploymentGatekeeper, desiredGatekeeper)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.updateGatekeeperSessionEnv(reqLogger, deploymentGatekeeper, desiredGatekeeper)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Replace the client secret when a rotation has been requested, the repair below stores it and rolls the gatekeeper
+	rotationRequested := rotateClientSecretRequested(codewind)
+	if rotationRequested {
+		reqLogger.Info("Rotating the gatekeeper client secret", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		clientKey, err = authProvider.RotateClientSecret()
+		if errors.Is(err, security.ErrRotationUnsupported) {
+			reqLogger.Error(err, "Ignoring the client secret rotation request", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to rotate the gatekeeper client secret", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+			return keycloakConfigResult(err)
+		}
+	}
+	err = r.repairGatekeeperClientSecret(reqLogger, authProvider, deploymentOptions, deploymentGatekeeper, clientKey)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.syncClientCredentialsSecret(reqLogger, codewind, deploymentOptions, gatekeeperAuth)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.syncRemoteAccessSecret(reqLogger, codewind, deploymentOptions, authProvider, gatekeeperAuth)
+	if err != nil {
+		return keycloakConfigResult(err)
+	}
+	if rotationRequested {
+		err = r.clearClientSecretRotation(codewind)
+		if err != nil {
+			reqLogger.Error(err, "Failed to clear the client secret rotation request", "Namespace", codewind.Namespace, "Name", codewind.Name)
+			return reconcile.Result{}, err
+		}
+	}
+	setDeploymentCondition(codewind, codewindv1alpha1.CodewindGatekeeperReady, deploymentGatekeeper)
+	if result, wait := r.waitForUpgradeStep(reqLogger, codewind, codewindv1alpha1.CodewindUpgradeStepGatekeeper, deploymentGatekeeper); wait {
+		return result, nil
+	}
 
 	// Check if the Codewind Gatekeeper Service already exists, if not create a new one
 	serviceGatekeeper := &corev1.Service{}
@@ -572,57 +978,708 @@ func (r *ReconcileCodewind) Reconcile(request reconcile.Request) (reconcile.Resu
 
 	if isOpenshift {
 		// Check if the Codewind Gatekeeper Route already exists, if not create a new one
+		var routeTLS *routev1.TLSConfig
+		routeTLS, err = r.routeTLSForCodewind(codewind, deploymentOptions)
+		if err != nil {
+			reqLogger.Error(err, "Invalid TLS settings of the Codewind gatekeeper route", "Namespace", codewind.Namespace, "Name", codewind.Name)
+			r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonRouteTLSInvalid, err.Error())
+			return reconcile.Result{}, err
+		}
 		routeGatekeeper := &routev1.Route{}
 		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperIngressName, Namespace: codewind.Namespace}, routeGatekeeper)
 		if err != nil && k8serr.IsNotFound(err) {
-			newRoute := r.routeForCodewindGatekeeper(codewind, deploymentOptions, codewindConfigMap.IngressDomain)
+			newRoute := r.routeForCodewindGatekeeper(codewind, deploymentOptions, ingressDomain, routeTLS)
 			reqLogger.Info("Creating a new Codewind gatekeeper route", "Namespace", newRoute.Namespace, "Name", newRoute.Name)
 			err = r.client.Create(context.TODO(), newRoute)
 			if err != nil && !k8serr.IsAlreadyExists(err) {
 				reqLogger.Error(err, "Failed to create new Codewind gatekeeper route.", "Namespace", newRoute.Namespace, "Name", newRoute.Name)
 				return reconcile.Result{}, err
 			}
-			// Success, update the accessURL
-			codewind.Status.AccessURL = gatekeeperPublicURL
 		} else if err != nil {
 			reqLogger.Error(err, "Failed to get Codewind gatekeeper route")
 			return reconcile.Result{}, err
+		} else if routeGatekeeper.Spec.Host != deploymentOptions.CodewindGatekeeperIngressHost || routeGatekeeper.Spec.Path != deploymentOptions.CodewindGatekeeperBasePath || !reflect.DeepEqual(routeGatekeeper.Spec.TLS, routeTLS) {
+			// The hostname, the routing, the termination or the route certificate changed
+			reqLogger.Info("Updating the host and TLS settings of the Codewind gatekeeper route", "Namespace", routeGatekeeper.Namespace, "Name", routeGatekeeper.Name, "Host", deploymentOptions.CodewindGatekeeperIngressHost, "Path", deploymentOptions.CodewindGatekeeperBasePath, "Termination", routeTLS.Termination)
+			routeGatekeeper.Spec.Host = deploymentOptions.CodewindGatekeeperIngressHost
+			routeGatekeeper.Spec.Path = deploymentOptions.CodewindGatekeeperBasePath
+			routeGatekeeper.Spec.TLS = routeTLS
+			err = r.client.Update(context.TODO(), routeGatekeeper)
+			if err != nil {
+				reqLogger.Error(err, "Failed to update Codewind gatekeeper route.", "Namespace", routeGatekeeper.Namespace, "Name", routeGatekeeper.Name)
+				return reconcile.Result{}, err
+			}
 		}
+		setCodewindEndpoints(codewind, gatekeeperPublicURL, gatekeeperAuth)
+		phaseChange := updateCodewindPhase(codewind)
 		err = r.client.Status().Update(context.TODO(), codewind)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
+		notifyCodewindPhase(phaseChange)
 	} else {
 		// Check if the Codewind Gatekeeper Ingress already exists, if not create a new one
 		ingressGatekeeper := &extv1beta1.Ingress{}
 		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperIngressName, Namespace: codewind.Namespace}, ingressGatekeeper)
 		if err != nil && k8serr.IsNotFound(err) {
-			newIngress := r.ingressForCodewindGatekeeper(codewind, deploymentOptions, codewindConfigMap.IngressDomain)
+			newIngress := r.ingressForCodewindGatekeeper(codewind, deploymentOptions, ingressDomain)
 			reqLogger.Info("Creating a new Codewind gatekeeper ingress", "Namespace", newIngress.Namespace, "Name", newIngress.Name)
 			err = r.client.Create(context.TODO(), newIngress)
 			if err != nil && !k8serr.IsAlreadyExists(err) {
 				reqLogger.Error(err, "Failed to create new Codewind gatekeeper ingress.", "Namespace", newIngress.Namespace, "Name", newIngress.Name)
 				return reconcile.Result{}, err
 			}
-			// Success, update the accessURL
-			codewind.Status.AccessURL = gatekeeperPublicURL
 		} else if err != nil {
 			reqLogger.Error(err, "Failed to get Codewind gatekeeper ingress")
 			return reconcile.Result{}, err
+		} else if newIngress := r.ingressForCodewindGatekeeper(codewind, deploymentOptions, ingressDomain); !reflect.DeepEqual(ingressGatekeeper.Annotations, newIngress.Annotations) || !reflect.DeepEqual(ingressGatekeeper.Spec, newIngress.Spec) {
+			// The hostname, the routing, the ingress class or the annotations changed
+			reqLogger.Info("Updating the Codewind gatekeeper ingress", "Namespace", ingressGatekeeper.Namespace, "Name", ingressGatekeeper.Name, "Host", deploymentOptions.CodewindGatekeeperIngressHost)
+			ingressGatekeeper.Annotations = newIngress.Annotations
+			ingressGatekeeper.Spec = newIngress.Spec
+			err = r.client.Update(context.TODO(), ingressGatekeeper)
+			if err != nil {
+				reqLogger.Error(err, "Failed to update Codewind gatekeeper ingress.", "Namespace", ingressGatekeeper.Namespace, "Name", ingressGatekeeper.Name)
+				return reconcile.Result{}, err
+			}
 		}
 
+		setCodewindEndpoints(codewind, gatekeeperPublicURL, gatekeeperAuth)
+		phaseChange := updateCodewindPhase(codewind)
 		err = r.client.Status().Update(context.TODO(), codewind)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
+		notifyCodewindPhase(phaseChange)
 	}
 
-	return reconcile.Result{}, nil
+	// Snapshot the workspace volume on the schedule of the CR
+	snapshotResult, err := r.reconcileSnapshots(reqLogger, codewind, deploymentOptions)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Certificates are not watched, check again until cert-manager has issued them
+	if !certificatesReady {
+		return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+	}
+	// Check the idle time again when the TTL warning or cleanup is due, Keycloak for drift, and take the next snapshot
+	result := soonerResult(idleResult, reconcile.Result{RequeueAfter: codewindConfigMap.KeycloakDriftCheckInterval})
+	return soonerResult(result, snapshotResult), nil
+}
+
+// codewindOperatorConfig : Settings of the operator config map for the instances of a namespace. Invalid settings
+// are logged and ignored so the instances can still be deployed
+func codewindOperatorConfig(reqLogger logr.Logger, data map[string]string, namespace string) OperatorConfigMapCodewind {
+	// Defaults of the namespace of the CR replace those of the cluster
+	namespaceConfig, err := util.OperatorConfigForNamespace(data, namespace)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid namespace defaults in the operator config map", "key", util.NamespaceDefaultsKey)
+	}
+
+	codewindConfigMap := OperatorConfigMapCodewind{
+		IngressDomain:    namespaceConfig["ingressDomain"],
+		StorageSize:      namespaceConfig["storageCodewindSize"],
+		StorageClassName: namespaceConfig["storageClassName"],
+		DefaultRealm:     data["defaultRealm"],
+		ClientScopes:     util.SplitList(data["clientScopes"]),
+		CABundle:         util.CABundleFromOperatorConfig(data),
+		ServiceMonitors:  util.ServiceMonitorsEnabled(data),
+		LegacyRBAC:       legacyRBACFromOperatorConfig(data),
+		Data:             data,
+	}
+	codewindConfigMap.ProtocolMappers, err = protocolMappersFromOperatorConfig(data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid protocol mappers in the operator config map", "key", protocolMappersKey)
+	}
+	codewindConfigMap.RetryPolicy, err = util.RetryPolicyFromOperatorConfig(data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid Keycloak retry settings in the operator config map")
+	}
+	if _, err := util.VersionCatalog(data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid versions in the operator config map", "key", util.VersionCatalogKey)
+	}
+	codewindConfigMap.UpgradeStepTimeout, err = upgradeStepTimeoutFromOperatorConfig(data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid upgrade step timeout in the operator config map")
+	}
+	codewindConfigMap.KeycloakDriftCheckInterval, err = keycloakDriftCheckIntervalFromOperatorConfig(data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid Keycloak drift check interval in the operator config map")
+	}
+	codewindConfigMap.InstanceRoleRules, err = instanceRoleRulesFromOperatorConfig(data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid instance role rules in the operator config map", "key", instanceRoleRulesKey)
+	}
+
+	// Default resources of each component
+	codewindConfigMap.PFEResources = operatorConfigResources(reqLogger, data, "resourcesPFE")
+	codewindConfigMap.PerformanceResources = operatorConfigResources(reqLogger, data, "resourcesPerformance")
+	codewindConfigMap.GatekeeperResources = operatorConfigResources(reqLogger, data, "resourcesGatekeeper")
+
+	// Default images of each component, the operator config map may replace the built in images
+	codewindConfigMap.PFEImage = util.ImageFromOperatorConfig(data, "imagePFE", codewindv1alpha1.ImageSpec{Repository: defaults.CodewindImage, Tag: defaults.CodewindImageTag})
+	codewindConfigMap.PerformanceImage = util.ImageFromOperatorConfig(data, "imagePerformance", codewindv1alpha1.ImageSpec{Repository: defaults.CodewindPerformanceImage, Tag: defaults.CodewindPerformanceImageTag})
+	codewindConfigMap.GatekeeperImage = util.ImageFromOperatorConfig(data, "imageGatekeeper", codewindv1alpha1.ImageSpec{Repository: defaults.CodewindGatekeeperImage, Tag: defaults.CodewindGatekeeperImageTag})
+	return codewindConfigMap
+}
+
+// deploymentOptionsForCodewind : Names and settings of the resources of an instance, the fields of the CR override
+// the defaults of the operator config map. Fails when the CR names a version missing from the version catalog or
+// without images for the architecture, the names of the resources are set even then
+func deploymentOptionsForCodewind(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, codewindConfigMap OperatorConfigMapCodewind, workspaceID string, ingressDomain string, isOpenshift bool) (DeploymentOptionsCodewind, error) {
+	// The hostname of the CR replaces the generated gatekeeper host, path routing publishes the instance under a
+	// path of the shared host
+	gatekeeperHost := defaults.PrefixCodewindGatekeeper + "-" + workspaceID + "." + codewind.Namespace + "." + ingressDomain
+	gatekeeperBasePath := ""
+	if util.SelectRouting(codewind.Spec.Routing, codewindConfigMap.Data) == util.RoutingPath {
+		gatekeeperHost = defaults.CodewindSharedHostPrefix + "." + ingressDomain
+		gatekeeperBasePath = defaults.CodewindPathPrefix + "/" + workspaceID
+	}
+	if codewind.Spec.Hostname != "" {
+		gatekeeperHost = codewind.Spec.Hostname
+	}
+
+	deploymentOptions := DeploymentOptionsCodewind{
+		Name:                                codewind.Name,
+		WorkspaceID:                         workspaceID,
+		CodewindRolesName:                   defaults.CodewindRolesName,
+		CodewindServiceAccountName:          "codewind-" + workspaceID,
+		TektonRoleBindingName:               defaults.CodewindTektonClusterRoleBindingName + "-" + workspaceID,
+		CodewindRoleBindingName:             defaults.CodewindRoleBindingNamePrefix + "-" + workspaceID,
+		CodewindInstanceRoleName:            defaults.CodewindInstanceRoleNamePrefix + "-" + workspaceID,
+		CodewindTektonClusterRolesName:      defaults.CodewindTektonClusterRolesName,
+		CodewindTektonRoleBindingName:       defaults.CodewindTektonClusterRoleBindingName + "-" + workspaceID,
+		CodewindODOClusterRolesName:         defaults.CodewindODOClusterRolesName,
+		CodewindODORoleBindingName:          defaults.CodewindODOClusterRoleBindingName + "-" + workspaceID,
+		CodewindPFEPVCName:                  defaults.PrefixCodewindPFE + "-pvc-" + workspaceID,
+		CodewindPFEDeploymentName:           defaults.PrefixCodewindPFE + "-" + workspaceID,
+		CodewindPFEServiceName:              defaults.PrefixCodewindPFE + "-" + workspaceID,
+		CodewindPerformanceDeploymentName:   defaults.PrefixCodewindPerformance + "-" + workspaceID,
+		CodewindPerformanceServiceName:      defaults.PrefixCodewindPerformance + "-" + workspaceID,
+		CodewindGatekeeperDeploymentName:    defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
+		CodewindGatekeeperIngressName:       defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
+		CodewindGatekeeperIngressHost:       gatekeeperHost,
+		CodewindGatekeeperBasePath:          gatekeeperBasePath,
+		CodewindGatekeeperSecretSessionName: "secret-codewind-session-" + workspaceID,
+		CodewindGatekeeperSecretTLSName:     gatekeeperTLSSecretName(codewind, workspaceID),
+		CodewindGatekeeperTLSCertTitle:      "Codewind" + "-" + workspaceID,
+		CodewindGatekeeperSecretAuthName:    "secret-codewind-client-" + workspaceID,
+		CodewindGatekeeperServiceName:       defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
+		CodewindGatekeeperCertificateName:   defaults.PrefixCodewindGatekeeper + "-" + workspaceID,
+		CodewindPFESecretTLSName:            "secret-codewind-pfe-tls-" + workspaceID,
+		CodewindPFECertificateName:          defaults.PrefixCodewindPFE + "-" + workspaceID,
+		CodewindClientCredentialsSecretName: clientCredentialsSecretName(codewind, workspaceID),
+		CodewindRemoteAccessSecretName:      remoteAccessSecretName(codewind, workspaceID),
+		CodewindGitCredentialsSecretName:    "secret-codewind-git-" + workspaceID,
+	}
+
+	// Resources of the CR override the operator config map defaults
+	componentResources := codewind.Spec.Resources
+	if componentResources == nil {
+		componentResources = &codewindv1alpha1.CodewindResourcesSpec{}
+	}
+	deploymentOptions.PFEResources = util.SelectResources(componentResources.PFE, codewindConfigMap.PFEResources)
+	deploymentOptions.PerformanceResources = util.SelectResources(componentResources.Performance, codewindConfigMap.PerformanceResources)
+	deploymentOptions.GatekeeperResources = util.SelectResources(componentResources.Gatekeeper, codewindConfigMap.GatekeeperResources)
+
+	// A version of the catalog selects the tested tags of the components
+	versionImages := util.VersionImages{}
+	if codewind.Spec.Version != "" {
+		var err error
+		versionImages, err = util.LookupVersion(codewindConfigMap.Data, codewind.Spec.Version)
+		if err != nil {
+			return deploymentOptions, err
+		}
+	}
+	deploymentOptions.VersionImages = versionImages
+
+	// The version must have images for the architecture of the pods
+	architecture := util.SelectArchitecture(codewind.Spec.Architecture, codewindConfigMap.Data)
+	if err := util.CheckArchitecture(codewind.Spec.Version, versionImages, architecture); err != nil {
+		return deploymentOptions, err
+	}
+
+	// Images of the CR override its version, imageTag and the operator config map defaults, whose repositories are
+	// swapped for those of the architecture
+	componentImages := codewind.Spec.Images
+	if componentImages == nil {
+		componentImages = &codewindv1alpha1.CodewindImagesSpec{}
+	}
+	deploymentOptions.PFEImage = util.SelectImage(componentImages.PFE, defaultImageForCodewind(codewind, util.ArchitectureImage(codewindConfigMap.PFEImage, architecture), versionImages.PFE))
+	deploymentOptions.PerformanceImage = util.SelectImage(componentImages.Performance, defaultImageForCodewind(codewind, util.ArchitectureImage(codewindConfigMap.PerformanceImage, architecture), versionImages.Performance))
+	deploymentOptions.GatekeeperImage = util.SelectImage(componentImages.Gatekeeper, defaultImageForCodewind(codewind, util.ArchitectureImage(codewindConfigMap.GatekeeperImage, architecture), versionImages.Gatekeeper))
+	deploymentOptions.ImagePullSecrets = util.SelectImagePullSecrets(codewind.Spec.ImagePullSecrets, codewindConfigMap.Data, "imagePullSecrets")
+
+	// Security settings of the CR override the operator config map default, an invalid default is ignored
+	defaultPodSecurity, podSecurityErr := util.PodSecurityFromOperatorConfig(codewindConfigMap.Data)
+	if podSecurityErr != nil {
+		reqLogger.Error(podSecurityErr, "Ignoring invalid security context in the operator config map", "key", util.PodSecurityContextKey)
+	}
+	deploymentOptions.PodSecurity = util.SelectPodSecurity(codewind.Spec.SecurityContext, defaultPodSecurity, isOpenshift)
+	deploymentOptions.PFEPrivileged = codewind.Spec.PFEPrivileged == nil || *codewind.Spec.PFEPrivileged
+
+	// Ingress class and annotations of the CR override the operator config map defaults
+	defaultIngress, ingressErr := util.IngressFromOperatorConfig(codewindConfigMap.Data)
+	if ingressErr != nil {
+		reqLogger.Error(ingressErr, "Ignoring invalid ingress annotations in the operator config map", "key", util.IngressAnnotationsKey)
+	}
+	deploymentOptions.Ingress = util.SelectIngress(codewind.Spec.Ingress, defaultIngress)
+
+	// Proxy settings of the CR override the operator config map defaults
+	deploymentOptions.Proxy = util.SelectProxy(codewind.Spec.Proxy, util.ProxyFromOperatorConfig(codewindConfigMap.Data))
+	return deploymentOptions, nil
+}
+
+// operatorConfigResources : Default resources of a component from the operator config map. An invalid value
+// is logged and ignored so the deployments can still be created
+func operatorConfigResources(reqLogger logr.Logger, data map[string]string, key string) *corev1.ResourceRequirements {
+	resources, err := util.ResourcesFromOperatorConfig(data, key)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid resources in the operator config map", "key", key)
+	}
+	return resources
+}
+
+// updateDeployment : Updates the container images of an existing deployment to those of the desired one, which rolls
+// its pods, updates its probes and log levels once they changed, and scales it to the desired replicas when the
+// instance is suspended or resumed. Other changes to the desired deployment are not applied
+func (r *ReconcileCodewind) updateDeployment(reqLogger logr.Logger, deployment *appsv1.Deployment, desired *appsv1.Deployment) error {
+	imagesChanged := util.SyncDeploymentImages(deployment, desired)
+	replicasChanged := util.SyncDeploymentReplicas(deployment, desired)
+	probesChanged := util.SyncDeploymentProbes(deployment, desired)
+	logLevelChanged := syncLogLevelEnv(deployment, desired)
+	if !imagesChanged && !replicasChanged && !probesChanged && !logLevelChanged {
+		return nil
+	}
+	if imagesChanged {
+		reqLogger.Info("Updating the images of deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	}
+	if replicasChanged {
+		reqLogger.Info("Scaling deployment", "Namespace", deployment.Namespace, "Name", deployment.Name, "Replicas", *deployment.Spec.Replicas)
+	}
+	if probesChanged {
+		reqLogger.Info("Updating the probes of deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	}
+	if logLevelChanged {
+		reqLogger.Info("Updating the log level of deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	}
+	err := r.client.Update(context.TODO(), deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to update deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	}
+	return err
+}
+
+// syncClientCredentialsSecret : Publishes the client credentials of the deployment for CI pipelines while the service
+// account is enabled, copying the client secret from the gatekeeper auth secret. The secret is removed once the
+// service account is disabled or published under another name
+func (r *ReconcileCodewind) syncClientCredentialsSecret(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, gatekeeperAuth security.GatekeeperAuth) error {
+	secretName := ""
+	if codewind.Status.ServiceAccountEnabled {
+		secretName = deploymentOptions.CodewindClientCredentialsSecretName
+	}
+	if published := codewind.Status.ClientCredentialsSecret; published != "" && published != secretName {
+		reqLogger.Info("Removing the client credentials secret", "Namespace", codewind.Namespace, "Name", published)
+		err := r.client.Delete(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: published, Namespace: codewind.Namespace}})
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to remove the client credentials secret", "Namespace", codewind.Namespace, "Name", published)
+			return err
+		}
+		codewind.Status.ClientCredentialsSecret = ""
+	}
+	if secretName == "" {
+		return nil
+	}
+
+	authSecret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretAuthName, Namespace: codewind.Namespace}, authSecret)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get Gatekeeper auth secret.")
+		return err
+	}
+	desired := r.buildClientCredentialsSecret(codewind, deploymentOptions, gatekeeperAuth, string(authSecret.Data["client_secret"]))
+	secret := &corev1.Secret{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: codewind.Namespace}, secret)
+	if err != nil && k8serr.IsNotFound(err) {
+		reqLogger.Info("Publishing the client credentials secret", "Namespace", desired.Namespace, "Name", desired.Name)
+		err = r.client.Create(context.TODO(), desired)
+		if err != nil && !k8serr.IsAlreadyExists(err) {
+			reqLogger.Error(err, "Failed to create the client credentials secret", "Namespace", desired.Namespace, "Name", desired.Name)
+			return err
+		}
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get the client credentials secret", "Namespace", codewind.Namespace, "Name", secretName)
+		return err
+	} else if !stringDataMatches(secret.Data, desired.StringData) {
+		reqLogger.Info("Updating the client credentials secret", "Namespace", secret.Namespace, "Name", secret.Name)
+		secret.Data = nil
+		secret.StringData = desired.StringData
+		err = r.client.Update(context.TODO(), secret)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update the client credentials secret", "Namespace", secret.Namespace, "Name", secret.Name)
+			return err
+		}
+	}
+	codewind.Status.ClientCredentialsSecret = secretName
+	return nil
+}
+
+// stringDataMatches : true when the data of a secret holds exactly the given values
+func stringDataMatches(data map[string][]byte, stringData map[string]string) bool {
+	if len(data) != len(stringData) {
+		return false
+	}
+	for key, value := range stringData {
+		if string(data[key]) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileServiceMonitors : Creates the ServiceMonitors of the PFE and Performance services, nothing is created when
+// the Prometheus operator is not installed
+func (r *ReconcileCodewind) reconcileServiceMonitors(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) error {
+	available, err := util.DetectPrometheusOperator()
+	if err != nil {
+		reqLogger.Error(err, "Unable to detect the Prometheus operator")
+		return err
+	}
+	if !available {
+		reqLogger.Info("ServiceMonitors are enabled but the Prometheus operator is not installed, skipping them")
+		return nil
+	}
+	for _, serviceMonitor := range r.serviceMonitorsForCodewind(codewind, deploymentOptions) {
+		created, err := util.EnsureServiceMonitor(r.client, serviceMonitor)
+		if err != nil {
+			reqLogger.Error(err, "Failed to create the ServiceMonitor", "Namespace", serviceMonitor.GetNamespace(), "Name", serviceMonitor.GetName())
+			return err
+		}
+		if created {
+			reqLogger.Info("Created a new ServiceMonitor", "Namespace", serviceMonitor.GetNamespace(), "Name", serviceMonitor.GetName())
+		}
+	}
+	return nil
+}
+
+// reconcileNetworkPolicies : Creates or updates the NetworkPolicies of the components when enabled, and removes them
+// once they are disabled
+func (r *ReconcileCodewind) reconcileNetworkPolicies(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, enabled bool) error {
+	for _, networkPolicy := range r.networkPoliciesForCodewind(codewind, deploymentOptions) {
+		if !enabled {
+			deleted, err := util.DeleteNetworkPolicy(r.client, networkPolicy.Name, networkPolicy.Namespace)
+			if err != nil {
+				reqLogger.Error(err, "Failed to delete the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+				return err
+			}
+			if deleted {
+				reqLogger.Info("Deleted the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+			}
+			continue
+		}
+		changed, err := util.EnsureNetworkPolicy(r.client, networkPolicy)
+		if err != nil {
+			reqLogger.Error(err, "Failed to apply the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+			return err
+		}
+		if changed {
+			reqLogger.Info("Applied the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+		}
+	}
+	return nil
+}
+
+// updateGatekeeperSessionEnv : Rolls the gatekeeper when its session settings or the secret of its session key changed
+func (r *ReconcileCodewind) updateGatekeeperSessionEnv(reqLogger logr.Logger, deployment *appsv1.Deployment, desired *appsv1.Deployment) error {
+	changed := false
+	for _, want := range desired.Spec.Template.Spec.Containers {
+		for i := range deployment.Spec.Template.Spec.Containers {
+			container := &deployment.Spec.Template.Spec.Containers[i]
+			if container.Name == want.Name && syncGatekeeperSessionEnv(container, want.Env) {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	reqLogger.Info("Updating the session settings of deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	err := r.client.Update(context.TODO(), deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to update the session settings of deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	}
+	return err
+}
+
+// repairGatekeeperClientSecret : Updates the gatekeeper auth secret when it no longer matches the client secret held
+// by the identity provider, for example after an administrator regenerated it in the Keycloak admin console, and
+// rolls the gatekeeper pods when they were started with another secret. A provider that cannot be reached is
+// checked again on the next reconcile
+func (r *ReconcileCodewind) repairGatekeeperClientSecret(reqLogger logr.Logger, authProvider security.AuthProvider, deploymentOptions DeploymentOptionsCodewind, deployment *appsv1.Deployment, clientKey string) error {
+	currentSecret := clientKey
+	if currentSecret == "" {
+		var err error
+		currentSecret, err = authProvider.CurrentClientSecret()
+		if err != nil {
+			reqLogger.Info("Unable to check the gatekeeper client secret, checking again later", "Namespace", deployment.Namespace, "reason", err.Error())
+			return nil
+		}
+		if currentSecret == "" {
+			return nil
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretAuthName, Namespace: deployment.Namespace}, secret)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get Gatekeeper auth secret.")
+		return err
+	}
+	secretChanged := string(secret.Data["client_secret"]) != currentSecret
+	if secretChanged {
+		reqLogger.Info("The gatekeeper client secret does not match the identity provider, updating it", "Namespace", secret.Namespace, "Name", secret.Name)
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data["client_secret"] = []byte(currentSecret)
+		err = r.client.Update(context.TODO(), secret)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update Gatekeeper auth secret.", "Namespace", secret.Namespace, "Name", secret.Name)
+			return err
+		}
+	}
+
+	// Deployments that never recorded a digest are assumed to run with the stored secret
+	secretHash := fmt.Sprintf("%x", sha256.Sum256([]byte(currentSecret)))
+	annotations := deployment.Spec.Template.GetAnnotations()
+	startedHash, recorded := annotations[defaults.GatekeeperClientSecretHashAnnotation]
+	if startedHash == secretHash || (!recorded && !secretChanged) {
+		return nil
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[defaults.GatekeeperClientSecretHashAnnotation] = secretHash
+	deployment.Spec.Template.SetAnnotations(annotations)
+	reqLogger.Info("Restarting the gatekeeper to load the new client secret", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	err = r.client.Update(context.TODO(), deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to restart the gatekeeper deployment", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	}
+	return err
+}
+
+// rotateClientSecretRequested : true when the Codewind CR carries the client secret rotation annotation
+func rotateClientSecretRequested(codewind *codewindv1alpha1.Codewind) bool {
+	return codewind.GetAnnotations()[defaults.RotateClientSecretAnnotation] == "true"
+}
+
+// clearClientSecretRotation : Removes the rotation annotation so that setting it again rotates the secret again.
+// The status computed by this reconcile is kept, the update returns the stored status
+func (r *ReconcileCodewind) clearClientSecretRotation(codewind *codewindv1alpha1.Codewind) error {
+	status := codewind.Status.DeepCopy()
+	annotations := codewind.GetAnnotations()
+	delete(annotations, defaults.RotateClientSecretAnnotation)
+	codewind.SetAnnotations(annotations)
+	err := r.client.Update(context.TODO(), codewind)
+	codewind.Status = *status
+	return err
+}
+
+// keycloakConfigFailed : Records a failed identity provider configuration in the status and chooses how to requeue.
+// Waiting for Keycloak to start is not a failure, anything else configures the deployment again on the next attempt
+func (r *ReconcileCodewind) keycloakConfigFailed(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, gatekeeperAuth security.GatekeeperAuth, err error) (reconcile.Result, error) {
+	if errors.Is(err, security.ErrKeycloakNotReady) {
+		reqLogger.Info("Waiting for Keycloak to start before configuring the deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		r.recorder.Event(codewind, corev1.EventTypeNormal, security.ReasonWaitingForKeycloak, "Waiting for Keycloak to start before configuring client "+gatekeeperAuth.ClientID)
+	} else {
+		reqLogger.Error(err, "Failed to update the identity provider for deployment.", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		r.recorder.Event(codewind, corev1.EventTypeWarning, security.ConditionReason(err), err.Error())
+		codewind.Status.KeycloakStatus = defaults.ConstKeycloakConfigFailed
+	}
+	setCodewindCondition(codewind, codewindv1alpha1.CodewindKeycloakConfigured, corev1.ConditionFalse, security.ConditionReason(err), err.Error())
+	phaseChange := updateCodewindPhase(codewind)
+	if statusErr := r.client.Status().Update(context.TODO(), codewind); statusErr != nil {
+		reqLogger.Error(statusErr, "Failed to update Codewind status", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	} else {
+		notifyCodewindPhase(phaseChange)
+	}
+	return keycloakConfigResult(err)
+}
+
+// unknownVersion : Reports a version missing from the version catalog. The CR is not reconciled again until it or
+// the operator config map changes
+func (r *ReconcileCodewind) unknownVersion(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, err error) (reconcile.Result, error) {
+	reqLogger.Error(err, "Unable to select the images of the deployment", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonUnknownVersion, err.Error())
+	var phaseChange *notification.Notification
+	if setCodewindPhase(codewind, codewindv1alpha1.CodewindPhaseFailed) {
+		failed := codewindNotification(codewind, notification.EventFailed)
+		failed.Reason, failed.Message = defaults.EventReasonUnknownVersion, err.Error()
+		phaseChange = &failed
+	}
+	if statusErr := r.client.Status().Update(context.TODO(), codewind); statusErr != nil {
+		reqLogger.Error(statusErr, "Failed to update Codewind status", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	} else {
+		notifyCodewindPhase(phaseChange)
+	}
+	return reconcile.Result{}, nil
+}
+
+// unsupportedArchitecture : Reports a version without images for the architecture of the instance. The CR is not
+// reconciled again until it or the operator config map changes
+func (r *ReconcileCodewind) unsupportedArchitecture(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, err error) (reconcile.Result, error) {
+	reqLogger.Error(err, "Unable to select the images of the deployment", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonUnsupportedArchitecture, err.Error())
+	setCodewindCondition(codewind, codewindv1alpha1.CodewindUnsupportedArchitecture, corev1.ConditionTrue, defaults.EventReasonUnsupportedArchitecture, err.Error())
+	phaseChange := updateCodewindPhase(codewind)
+	if statusErr := r.client.Status().Update(context.TODO(), codewind); statusErr != nil {
+		reqLogger.Error(statusErr, "Failed to update Codewind status", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	} else {
+		notifyCodewindPhase(phaseChange)
+	}
+	return reconcile.Result{}, nil
+}
+
+// keycloakConfigResult : Chooses how to requeue after a failed Keycloak configuration
+func keycloakConfigResult(err error) (reconcile.Result, error) {
+	switch {
+	case security.RetryAfter(err) > 0:
+		// The operator refused to call Keycloak, its circuit is open or the rate limit is exceeded
+		return reconcile.Result{RequeueAfter: security.RetryAfter(err)}, nil
+	case errors.Is(err, security.ErrKeycloakNotReady):
+		// Keycloak is starting, check again soon without holding the worker
+		return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+	case errors.Is(err, security.ErrKeycloakUnreachable), errors.Is(err, security.ErrOIDCDiscovery):
+		// The provider may still be starting, retry at a steady pace
+		return reconcile.Result{RequeueAfter: time.Second * 30}, nil
+	case errors.Is(err, security.ErrAuthFailed):
+		// Credentials need to be corrected by an administrator
+		return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+	case errors.Is(err, security.ErrUserConfig):
+		// The developer user must be registered in the realm first
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
+	}
+	return reconcile.Result{}, err
+}
+
+// authProviderForCodewind : Returns the identity provider of a Codewind instance, either the external
+// OIDC provider of its spec or its Keycloak deployment
+func (r *ReconcileCodewind) authProviderForCodewind(reqLogger logr.Logger, request reconcile.Request, codewind *codewindv1alpha1.Codewind, codewindConfigMap OperatorConfigMapCodewind, deploymentOptions DeploymentOptionsCodewind) (security.AuthProvider, error) {
+	if codewind.Spec.Auth != nil && codewind.Spec.Auth.ExternalOIDC != nil {
+		externalOIDC := codewind.Spec.Auth.ExternalOIDC
+		oidcClientSecret, err := r.getExternalOIDCClientSecret(externalOIDC.ClientSecretName, codewind.Namespace)
+		if err != nil {
+			reqLogger.Error(err, "Unable to retrieve the OIDC client secret", "Namespace", codewind.Namespace, "Secret", externalOIDC.ClientSecretName)
+			return nil, err
+		}
+		rootCAs, err := util.LoadCABundle(r.client, util.GetOperatorNamespace(), codewindConfigMap.CABundle)
+		if err != nil {
+			reqLogger.Error(err, "Unable to load the CA bundle of the operator config map")
+			return nil, err
+		}
+		return &security.ExternalOIDCAuthProvider{
+			IssuerURL:    externalOIDC.IssuerURL,
+			ClientID:     externalOIDC.ClientID,
+			ClientSecret: oidcClientSecret,
+			RootCAs:      rootCAs,
+		}, nil
+	}
+
+	// An unmanaged Keycloak has no pod, its CR names the server and the admin secret
+	keycloakName, keycloakRefNamespace := keycloakReference(codewind)
+	var keycloakNamespace, keycloakAuthURL, keycloakAdminSecret string
+	unmanagedKeycloak, err := r.getUnmanagedKeycloak(keycloakName, keycloakRefNamespace)
+	if err != nil {
+		reqLogger.Error(err, "Unable to read the Keycloak CRs")
+		return nil, err
+	}
+	if unmanagedKeycloak != nil {
+		reqLogger.Info("Using the unmanaged Keycloak", "Namespace", unmanagedKeycloak.Namespace, "Name", unmanagedKeycloak.Name, "URL", unmanagedKeycloak.Spec.URL)
+		keycloakNamespace = unmanagedKeycloak.Namespace
+		keycloakAuthURL = strings.TrimSuffix(unmanagedKeycloak.Spec.URL, "/")
+		keycloakAdminSecret = unmanagedKeycloak.Spec.AdminCredentialsSecret
+	} else {
+		keycloakPod, err := r.getKeycloakPod(reqLogger, request, keycloakName, keycloakRefNamespace)
+		if err != nil || keycloakPod == nil {
+			reqLogger.Error(err, "Unable to find the requested Keycloak pod")
+			return nil, err
+		}
+		reqLogger.Info("Found the running Keycloak Pod", "Labels:", keycloakPod.GetLabels())
+
+		// Get the keycloak admin credentials
+		authID := keycloakPod.GetLabels()["authID"]
+		if authID == "" {
+			err = fmt.Errorf("Unable to find AuthID in keycloak pod %s", keycloakPod.Name)
+			reqLogger.Error(err, "Unable to find AuthID in keycloak pod.", "Namespace", keycloakPod.Namespace, "Name", keycloakPod.Name)
+			return nil, err
+		}
+		keycloakNamespace = keycloakPod.Namespace
+		keycloakNamespaceConfig, _ := util.OperatorConfigForNamespace(codewindConfigMap.Data, keycloakPod.Namespace)
+		keycloakIngressDomain := r.getKeycloakIngressDomain(keycloakPod.Namespace, keycloakName, keycloakNamespaceConfig["ingressDomain"])
+		keycloakAuthURL = "https://" + defaults.PrefixCodewindKeycloak + "-" + authID + "." + keycloakPod.Namespace + "." + keycloakIngressDomain
+		keycloakAdminSecret = "secret-keycloak-user-" + authID
+	}
+
+	keycloakAdminUser, keycloakAdminPass, err := r.getKeycloakAdminCredentials(keycloakAdminSecret, keycloakNamespace)
+	if err != nil {
+		reqLogger.Error(err, "Unable to retrieve the Keycloak credentials")
+		return nil, err
+	}
+
+	rootCAs, err := r.getKeycloakRootCAs(keycloakNamespace, keycloakName, codewindConfigMap.CABundle)
+	if err != nil {
+		reqLogger.Error(err, "Unable to load the Keycloak CA bundle", "Namespace", keycloakNamespace, "Keycloak", keycloakName)
+		return nil, err
+	}
+	realmName, sharedRealm := r.getKeycloakRealm(keycloakNamespace, keycloakName, codewindConfigMap.DefaultRealm)
+	keycloakConfig := security.KeycloakConfiguration{
+		RealmName:             realmName,
+		SharedRealm:           sharedRealm,
+		AuthURL:               keycloakAuthURL,
+		WorkspaceID:           deploymentOptions.WorkspaceID,
+		KeycloakAdminUsername: keycloakAdminUser,
+		KeycloakAdminPassword: keycloakAdminPass,
+		DevUsername:           codewind.Spec.Username,
+		AccessList:            codewind.Spec.AccessList,
+		RevokedUsers:          revokedUsers(codewind.Status.AccessList, codewindAccessList(codewind)),
+		AccessGroups:          codewindAccessGroups(codewind),
+		RevokedGroups:         revokedUsers(codewind.Status.AccessGroups, codewindAccessGroups(codewind)),
+		GatekeeperPublicURL:   gatekeeperURL(deploymentOptions),
+		ClientName:            "codewind-" + deploymentOptions.WorkspaceID,
+		ClientScopes:          codewindConfigMap.ClientScopes,
+		ProtocolMappers:       codewindConfigMap.ProtocolMappers,
+		SessionSettings:       clientSessionSettings(codewind),
+		ServiceAccountEnabled: serviceAccountEnabled(codewind),
+		TokenClaimMappers:     tokenClaimMappers(codewind),
+		RootCAs:               rootCAs,
+		Distribution:          r.getKeycloakDistribution(keycloakNamespace, keycloakName),
+		RetryPolicy:           codewindConfigMap.RetryPolicy,
+	}
+
+	// The initial password is only needed while the user may still have to be created
+	if codewind.Status.KeycloakStatus != defaults.ConstKeycloakConfigReady && codewind.GetDeletionTimestamp().IsZero() {
+		if codewind.Spec.InitialPasswordSecret != "" {
+			keycloakConfig.DevUserInitialPassword, err = r.getDevUserInitialPassword(codewind.Spec.InitialPasswordSecret, codewind.Namespace)
+			if err != nil {
+				reqLogger.Error(err, "Unable to retrieve the initial user password", "Namespace", codewind.Namespace, "Secret", codewind.Spec.InitialPasswordSecret)
+				return nil, err
+			}
+		}
+		if codewind.Spec.VerifyEmail {
+			keycloakConfig.DevUserRequiredActions = append(keycloakConfig.DevUserRequiredActions, "VERIFY_EMAIL")
+		}
+	}
+	return security.NewKeycloakAuthProvider(keycloakConfig), nil
 }
 
-func (r *ReconcileCodewind) getKeycloakPod(reqLogger logr.Logger, request reconcile.Request, authName string) (*corev1.Pod, error) {
+// getKeycloakPod : Pod of the Keycloak deployment of the given name, looked up in every watched namespace when the
+// namespace is empty
+func (r *ReconcileCodewind) getKeycloakPod(reqLogger logr.Logger, request reconcile.Request, authName string, namespace string) (*corev1.Pod, error) {
 	keycloaks := &corev1.PodList{}
 	opts := []client.ListOption{
+		client.InNamespace(namespace),
 		client.MatchingLabels{"app": defaults.PrefixCodewindKeycloak, "authName": authName},
 	}
 	err := r.client.List(context.TODO(), keycloaks, opts...)
@@ -634,18 +1691,160 @@ func (r *ReconcileCodewind) getKeycloakPod(reqLogger logr.Logger, request reconc
 	return &keycloakPod, nil
 }
 
+// getUnmanagedKeycloak : The unmanaged Keycloak CR of the given name, nil when the Keycloak is deployed by the operator.
+// Looked up in every watched namespace when the namespace is empty
+func (r *ReconcileCodewind) getUnmanagedKeycloak(name string, namespace string) (*codewindv1alpha1.Keycloak, error) {
+	keycloaks := &codewindv1alpha1.KeycloakList{}
+	err := r.client.List(context.TODO(), keycloaks, client.InNamespace(namespace))
+	if err != nil {
+		return nil, err
+	}
+	for i := range keycloaks.Items {
+		if keycloaks.Items[i].Name == name && keycloaks.Items[i].Spec.Unmanaged {
+			return &keycloaks.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// keycloakReference : Name and namespace of the Keycloak CR of a Codewind deployment. keycloakRef defaults to the
+// namespace of the Codewind CR, the namespace is empty for keycloakDeployment, which is looked up in every namespace
+func keycloakReference(codewind *codewindv1alpha1.Codewind) (name string, namespace string) {
+	if keycloakRef := codewind.Spec.KeycloakRef; keycloakRef != nil {
+		if keycloakRef.Namespace == "" {
+			return keycloakRef.Name, codewind.Namespace
+		}
+		return keycloakRef.Name, keycloakRef.Namespace
+	}
+	return codewind.Spec.KeycloakDeployment, ""
+}
+
+// codewindsForKeycloak : Requests for the Codewind CRs using a Keycloak CR, so that they are configured again once
+// the Keycloak is ready or its settings changed
+func codewindsForKeycloak(c client.Client) handler.ToRequestsFunc {
+	return func(keycloak handler.MapObject) []reconcile.Request {
+		codewinds := &codewindv1alpha1.CodewindList{}
+		err := c.List(context.TODO(), codewinds)
+		if err != nil {
+			log.Error(err, "Unable to list the Codewind CRs using a Keycloak", "Namespace", keycloak.Meta.GetNamespace(), "Name", keycloak.Meta.GetName())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range codewinds.Items {
+			name, namespace := keycloakReference(&codewinds.Items[i])
+			if name == keycloak.Meta.GetName() && (namespace == "" || namespace == keycloak.Meta.GetNamespace()) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: codewinds.Items[i].Name, Namespace: codewinds.Items[i].Namespace}})
+			}
+		}
+		return requests
+	}
+}
+
+// allCodewinds : Requests a reconcile of every Codewind CR, for example after the operator defaults changed
+func allCodewinds(c client.Client) handler.ToRequestsFunc {
+	return func(object handler.MapObject) []reconcile.Request {
+		codewinds := &codewindv1alpha1.CodewindList{}
+		err := c.List(context.TODO(), codewinds)
+		if err != nil {
+			log.Error(err, "Unable to list the Codewind CRs to apply the operator defaults", "Namespace", object.Meta.GetNamespace(), "Name", object.Meta.GetName())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range codewinds.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: codewinds.Items[i].Name, Namespace: codewinds.Items[i].Namespace}})
+		}
+		return requests
+	}
+}
+
+// getKeycloakIngressDomain : Ingress domain of a Keycloak deployment, its CR may override the operator config map
+func (r *ReconcileCodewind) getKeycloakIngressDomain(namespace string, name string, defaultDomain string) string {
+	keycloak := &codewindv1alpha1.Keycloak{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, keycloak)
+	if err == nil && keycloak.Spec.IngressDomain != "" {
+		return keycloak.Spec.IngressDomain
+	}
+	return defaultDomain
+}
+
+// getKeycloakDistribution : Distribution of a Keycloak deployment named in its CR or detected by the Keycloak
+// controller, empty until it is known so that it is detected on first use
+func (r *ReconcileCodewind) getKeycloakDistribution(namespace string, name string) security.KeycloakDistribution {
+	keycloak := &codewindv1alpha1.Keycloak{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, keycloak)
+	if err != nil {
+		return ""
+	}
+	if keycloak.Spec.Distribution != "" {
+		return security.KeycloakDistribution(keycloak.Spec.Distribution)
+	}
+	return security.KeycloakDistribution(keycloak.Status.Distribution)
+}
+
+// getKeycloakRealm : Realm of a Keycloak deployment, its CR may override the operator config map and share the realm
+// with other applications
+func (r *ReconcileCodewind) getKeycloakRealm(namespace string, name string, defaultRealm string) (string, bool) {
+	keycloak := &codewindv1alpha1.Keycloak{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, keycloak)
+	if err != nil || keycloak.Spec.Realm == nil {
+		return defaultRealm, false
+	}
+	if keycloak.Spec.Realm.Name != "" {
+		return keycloak.Spec.Realm.Name, keycloak.Spec.Realm.Shared
+	}
+	return defaultRealm, keycloak.Spec.Realm.Shared
+}
+
+// getKeycloakRootCAs : CA certificates trusted when calling a Keycloak deployment, its CR may override the operator config map
+func (r *ReconcileCodewind) getKeycloakRootCAs(namespace string, name string, operatorBundle codewindv1alpha1.CABundleSpec) (*x509.CertPool, error) {
+	keycloak := &codewindv1alpha1.Keycloak{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, keycloak)
+	if err != nil {
+		keycloak = nil
+	}
+	return util.LoadKeycloakCABundle(r.client, keycloak, util.GetOperatorNamespace(), operatorBundle)
+}
+
 // getKeycloakAdminCredentials from the keycloak secret
-func (r *ReconcileCodewind) getKeycloakAdminCredentials(authID string, keycloakNamespace string) (username string, password string, err error) {
+func (r *ReconcileCodewind) getKeycloakAdminCredentials(secretName string, keycloakNamespace string) (username string, password string, err error) {
 	secretUser := &corev1.Secret{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: "secret-keycloak-user-" + authID, Namespace: keycloakNamespace}, secretUser)
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: keycloakNamespace}, secretUser)
 	if err != nil {
 		return "", "", err
 	}
 	return string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), nil
 }
 
+// getDevUserInitialPassword : Reads the temporary password of a new developer user from a secret
+func (r *ReconcileCodewind) getDevUserInitialPassword(secretName string, namespace string) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: namespace}, secret)
+	if err != nil {
+		return "", err
+	}
+	password := string(secret.Data["password"])
+	if password == "" {
+		return "", fmt.Errorf("secret %s has no password key", secretName)
+	}
+	return password, nil
+}
+
+// getExternalOIDCClientSecret : Reads the client secret of an external OIDC provider from a secret
+func (r *ReconcileCodewind) getExternalOIDCClientSecret(secretName string, namespace string) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: namespace}, secret)
+	if err != nil {
+		return "", err
+	}
+	clientSecret := string(secret.Data["client_secret"])
+	if clientSecret == "" {
+		return "", fmt.Errorf("secret %s has no client_secret key", secretName)
+	}
+	return clientSecret, nil
+}
+
 func (r *ReconcileCodewind) getCodewindWorkspaceID(codewind *codewindv1alpha1.Codewind) string {
-	workspaceID := codewind.GetAnnotations()["codewindWorkspace"]
+	workspaceID := codewind.GetAnnotations()[codewindv1alpha1.WorkspaceIDAnnotation]
 	return workspaceID
 }
 
@@ -655,7 +1854,7 @@ func (r *ReconcileCodewind) setCodewindWorkspaceID(codewind *codewindv1alpha1.Co
 	if annotations == nil {
 		annotations = make(map[string]string)
 	}
-	annotations["codewindWorkspace"] = newWorkspaceID
+	annotations[codewindv1alpha1.WorkspaceIDAnnotation] = newWorkspaceID
 	codewind.SetAnnotations(annotations)
 	err := r.client.Update(context.TODO(), codewind)
 	if err != nil {
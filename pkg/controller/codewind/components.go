@@ -0,0 +1,83 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// performanceEnabled : Whether the performance dashboard of the instance is deployed, true unless the CR disables it
+func performanceEnabled(codewind *codewindv1alpha1.Codewind) bool {
+	components := codewind.Spec.Components
+	if components == nil || components.Performance == nil || components.Performance.Enabled == nil {
+		return true
+	}
+	return *components.Performance.Enabled
+}
+
+// removePerformance : Deletes the deployment, service, ServiceMonitor and NetworkPolicy of a disabled performance
+// dashboard and drops its condition. Resources that do not exist are skipped
+func (r *ReconcileCodewind) removePerformance(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) error {
+	deployment := &appsv1.Deployment{}
+	deployment.Name = deploymentOptions.CodewindPerformanceDeploymentName
+	deployment.Namespace = codewind.Namespace
+	service := &corev1.Service{}
+	service.Name = deploymentOptions.CodewindPerformanceServiceName
+	service.Namespace = codewind.Namespace
+	serviceMonitor := &unstructured.Unstructured{}
+	serviceMonitor.SetGroupVersionKind(util.ServiceMonitorGVK)
+	serviceMonitor.SetName(deploymentOptions.CodewindPerformanceServiceName)
+	serviceMonitor.SetNamespace(codewind.Namespace)
+	resources := []struct {
+		kind   string
+		object runtime.Object
+		name   string
+	}{
+		{"deployment", deployment, deployment.Name},
+		{"service", service, service.Name},
+		{"ServiceMonitor", serviceMonitor, serviceMonitor.GetName()},
+	}
+	for _, resource := range resources {
+		err := r.client.Delete(context.TODO(), resource.object)
+		// The ServiceMonitor kind is missing when the Prometheus operator is not installed
+		if k8serr.IsNotFound(err) || meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed to delete the performance "+resource.kind, "Namespace", codewind.Namespace, "Name", resource.name)
+			return err
+		}
+		reqLogger.Info("Deleted the performance "+resource.kind+" of the disabled performance dashboard", "Namespace", codewind.Namespace, "Name", resource.name)
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonDeleted, "Deleted performance %s %s, the performance dashboard is disabled", resource.kind, resource.name)
+	}
+	deleted, err := util.DeleteNetworkPolicy(r.client, deploymentOptions.CodewindPerformanceDeploymentName, codewind.Namespace)
+	if err != nil {
+		reqLogger.Error(err, "Failed to delete the NetworkPolicy", "Namespace", codewind.Namespace, "Name", deploymentOptions.CodewindPerformanceDeploymentName)
+		return err
+	}
+	if deleted {
+		reqLogger.Info("Deleted the NetworkPolicy", "Namespace", codewind.Namespace, "Name", deploymentOptions.CodewindPerformanceDeploymentName)
+	}
+	removeCodewindCondition(codewind, codewindv1alpha1.CodewindPerformanceReady)
+	return nil
+}
@@ -0,0 +1,82 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"fmt"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// defaultKeycloakDriftCheckInterval : how often the Keycloak configuration of an instance is compared with the
+// configuration the operator created
+const defaultKeycloakDriftCheckInterval = 5 * time.Minute
+
+// keycloakDriftCheckIntervalFromOperatorConfig : Interval of the keycloakDriftCheckInterval key of the operator config
+// map, zero disables the checks. On error the default is returned with the error
+func keycloakDriftCheckIntervalFromOperatorConfig(data map[string]string) (time.Duration, error) {
+	value := data["keycloakDriftCheckInterval"]
+	if value == "" {
+		return defaultKeycloakDriftCheckInterval, nil
+	}
+	if value == "0" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return defaultKeycloakDriftCheckInterval, fmt.Errorf("operator config map key keycloakDriftCheckInterval must be a duration such as 5m, got %q", value)
+	}
+	return interval, nil
+}
+
+// keycloakDriftCheckDue : Reports whether the interval passed since the Keycloak configuration was last checked
+func keycloakDriftCheckDue(codewind *codewindv1alpha1.Codewind, interval time.Duration) bool {
+	if interval == 0 {
+		return false
+	}
+	checked := codewind.Status.KeycloakCheckTime
+	return checked == nil || time.Since(checked.Time) >= interval
+}
+
+// repairKeycloakDrift : Restores the realm, client and access role of a configured instance when they were changed
+// outside the operator, recording an event for each repair
+func (r *ReconcileCodewind) repairKeycloakDrift(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, authProvider security.AuthProvider, gatekeeperAuth security.GatekeeperAuth) error {
+	repaired, err := authProvider.RepairDrift()
+	for _, repair := range repaired {
+		reqLogger.Info("Repaired the Keycloak configuration of the deployment", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID, "Repair", repair)
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonKeycloakDriftRepaired, "Keycloak was changed outside the operator, %s", repair)
+	}
+	if err != nil {
+		return err
+	}
+	checked := metav1.Now()
+	codewind.Status.KeycloakCheckTime = &checked
+	return nil
+}
+
+// soonerResult : The result requeueing first of two reconcile results
+func soonerResult(result reconcile.Result, other reconcile.Result) reconcile.Result {
+	if result.Requeue || other.RequeueAfter == 0 {
+		return result
+	}
+	if other.Requeue || result.RequeueAfter == 0 || other.RequeueAfter < result.RequeueAfter {
+		return other
+	}
+	return result
+}
@@ -16,27 +16,101 @@ import (
 
 	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
 	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/security"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-// addCodewindFinalizer : Adds the finalizer to the metadata of the Codewind CR
+// addCodewindFinalizer : Adds the finalizers to the metadata of the Codewind CR
 func (r *ReconcileCodewind) addCodewindFinalizer(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, request reconcile.Request) error {
-	if len(codewind.GetFinalizers()) < 1 && codewind.GetDeletionTimestamp() == nil {
-		reqLogger.Info("Adding Finalizer to Codewind", "namespace", codewind.Namespace, "name", codewind.Name, "finalizer", defaults.CodewindFinalizerName)
-		codewind.SetFinalizers([]string{defaults.CodewindFinalizerName})
+	if codewind.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	finalizers := codewind.GetFinalizers()
+	updated := false
+	for _, finalizer := range []string{defaults.CodewindFinalizerName, defaults.CodewindKeycloakFinalizerName} {
+		if !hasFinalizer(finalizers, finalizer) {
+			reqLogger.Info("Adding Finalizer to Codewind", "namespace", codewind.Namespace, "name", codewind.Name, "finalizer", finalizer)
+			finalizers = append(finalizers, finalizer)
+			updated = true
+		}
+	}
+	if updated {
+		codewind.SetFinalizers(finalizers)
 		err := r.client.Update(context.TODO(), codewind)
 		if err != nil {
-			reqLogger.Error(err, "Failed to update Codewind with the CRB finalizer", "namespace", codewind.Namespace, "name", codewind.Name, "finalizer", defaults.CodewindFinalizerName)
+			reqLogger.Error(err, "Failed to update Codewind with the finalizers", "namespace", codewind.Namespace, "name", codewind.Name)
 			return err
 		}
 	}
 	return nil
 }
 
+// hasFinalizer : true when the finalizer is in the list
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, name := range finalizers {
+		if name == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCodewindKeycloakFinalizer : Removes the client, access role and user role mapping of this deployment
+// from its identity provider, reporting a failure in the CR status and retrying until cleanup succeeds
+func (r *ReconcileCodewind) handleCodewindKeycloakFinalizer(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, codewindConfigMap OperatorConfigMapCodewind, reqLogger logr.Logger, request reconcile.Request) error {
+	if !hasFinalizer(codewind.GetFinalizers(), defaults.CodewindKeycloakFinalizerName) {
+		return nil
+	}
+	reqLogger.Info("Processing Finalizer", "namespace", codewind.Namespace, "name", codewind.Name, "finalizer", defaults.CodewindKeycloakFinalizerName)
+
+	// Nothing can be cleaned up once the Keycloak deployment itself has been removed
+	keycloakMissing := false
+	if codewind.Spec.Auth == nil || codewind.Spec.Auth.ExternalOIDC == nil {
+		keycloakName, keycloakNamespace := keycloakReference(codewind)
+		keycloakPod, _ := r.getKeycloakPod(reqLogger, request, keycloakName, keycloakNamespace)
+		unmanagedKeycloak, _ := r.getUnmanagedKeycloak(keycloakName, keycloakNamespace)
+		keycloakMissing = keycloakPod == nil && unmanagedKeycloak == nil
+	}
+	if keycloakMissing {
+		reqLogger.Info("Keycloak not found, skipping Keycloak cleanup", "namespace", codewind.Namespace, "name", codewind.Name, "keycloak", codewind.Spec.KeycloakDeployment)
+	} else {
+		authProvider, err := r.authProviderForCodewind(reqLogger, request, codewind, codewindConfigMap, deploymentOptions)
+		if err == nil {
+			err = authProvider.RemoveDeployment()
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed to remove the deployment from Keycloak", "namespace", codewind.Namespace, "name", codewind.Name)
+			r.recorder.Event(codewind, corev1.EventTypeWarning, security.ConditionReason(err), "Failed to remove the deployment from Keycloak: "+err.Error())
+			codewind.Status.KeycloakStatus = defaults.ConstKeycloakCleanupFailed
+			if statusErr := r.client.Status().Update(context.TODO(), codewind); statusErr != nil {
+				reqLogger.Error(statusErr, "Failed to update Codewind status", "namespace", codewind.Namespace, "name", codewind.Name)
+			}
+			return err
+		}
+		reqLogger.Info("Successfully removed the deployment from Keycloak", "namespace", codewind.Namespace, "name", codewind.Name, "finalizer", defaults.CodewindKeycloakFinalizerName)
+	}
+
+	// Clear only this finalizer, the cluster role binding finalizer runs next
+	remaining := []string{}
+	for _, finalizer := range codewind.GetFinalizers() {
+		if finalizer != defaults.CodewindKeycloakFinalizerName {
+			remaining = append(remaining, finalizer)
+		}
+	}
+	codewind.SetFinalizers(remaining)
+	err := r.client.Update(context.TODO(), codewind)
+	if err != nil {
+		reqLogger.Error(err, "Failed to remove the Keycloak finalizer", "namespace", codewind.Namespace, "name", codewind.Name)
+		return err
+	}
+	return nil
+}
+
 // removeFinalizers  : Removes all the finalizers from the Codewind CR
 func (r *ReconcileCodewind) removeFinalizers(codewind *codewindv1alpha1.Codewind) error {
 	codewind.SetFinalizers(nil)
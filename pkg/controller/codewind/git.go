@@ -0,0 +1,154 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// gitCredentials : the files of the git credentials secret mounted into PFE, built from the secret named by the CR.
+// A basic-auth secret holds a username and a password or token, and optionally the URL they are used for. An
+// ssh-auth secret holds a private key and the known_hosts of the git servers. The git config points git at them
+func (r *ReconcileCodewind) gitCredentials(codewind *codewindv1alpha1.Codewind) (map[string]string, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: codewind.Spec.GitCredentialsSecret, Namespace: codewind.Namespace}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("git credentials secret %s cannot be read: %v", codewind.Spec.GitCredentialsSecret, err)
+	}
+	files := map[string]string{}
+	if privateKey := secret.Data[corev1.SSHAuthPrivateKey]; len(privateKey) > 0 {
+		knownHosts := secret.Data["known_hosts"]
+		if len(knownHosts) == 0 {
+			return nil, fmt.Errorf("git credentials secret %s holds an SSH key but no known_hosts", secret.Name)
+		}
+		files[corev1.SSHAuthPrivateKey] = string(privateKey)
+		files["known_hosts"] = string(knownHosts)
+		files["config"] = fmt.Sprintf("[core]\n\tsshCommand = ssh -i %[1]s/%[2]s -o IdentitiesOnly=yes -o UserKnownHostsFile=%[1]s/known_hosts -o StrictHostKeyChecking=yes\n",
+			defaults.GitCredentialsPath, corev1.SSHAuthPrivateKey)
+		return files, nil
+	}
+	username := secret.Data[corev1.BasicAuthUsernameKey]
+	password := secret.Data[corev1.BasicAuthPasswordKey]
+	if len(username) == 0 || len(password) == 0 {
+		return nil, fmt.Errorf("git credentials secret %s needs a %s and %s, or an %s", secret.Name, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey, corev1.SSHAuthPrivateKey)
+	}
+	section := "[credential]"
+	if url := strings.TrimSpace(string(secret.Data["url"])); url != "" {
+		section = fmt.Sprintf("[credential %q]", url)
+	}
+	files[corev1.BasicAuthUsernameKey] = string(username)
+	files[corev1.BasicAuthPasswordKey] = string(password)
+	files["config"] = fmt.Sprintf("%s\n\thelper = \"!f() { test \\\"$1\\\" = get && echo username=$(cat %[2]s/username) && echo password=$(cat %[2]s/password); }; f\"\n",
+		section, defaults.GitCredentialsPath)
+	return files, nil
+}
+
+// syncGitCredentialsSecret : Writes the git credentials files into the secret mounted by PFE while the CR names a git
+// credentials secret, and removes it once the field is cleared
+func (r *ReconcileCodewind) syncGitCredentialsSecret(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, files map[string]string) error {
+	secretName := deploymentOptions.CodewindGitCredentialsSecretName
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: codewind.Namespace}, secret)
+	if err != nil && !k8serr.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to get the git credentials secret", "Namespace", codewind.Namespace, "Name", secretName)
+		return err
+	}
+	found := err == nil
+	if files == nil {
+		if !found {
+			return nil
+		}
+		reqLogger.Info("Removing the git credentials secret", "Namespace", secret.Namespace, "Name", secret.Name)
+		err = r.client.Delete(context.TODO(), secret)
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to remove the git credentials secret", "Namespace", secret.Namespace, "Name", secret.Name)
+			return err
+		}
+		return nil
+	}
+	desired := r.buildGitCredentialsSecret(codewind, deploymentOptions, files)
+	if !found {
+		reqLogger.Info("Creating the git credentials secret", "Namespace", desired.Namespace, "Name", desired.Name)
+		err = r.client.Create(context.TODO(), desired)
+		if err != nil && !k8serr.IsAlreadyExists(err) {
+			reqLogger.Error(err, "Failed to create the git credentials secret", "Namespace", desired.Namespace, "Name", desired.Name)
+			return err
+		}
+	} else if !stringDataMatches(secret.Data, desired.StringData) {
+		reqLogger.Info("Updating the git credentials secret", "Namespace", secret.Namespace, "Name", secret.Name)
+		secret.Data = nil
+		secret.StringData = desired.StringData
+		err = r.client.Update(context.TODO(), secret)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update the git credentials secret", "Namespace", secret.Namespace, "Name", secret.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// buildGitCredentialsSecret : builds the secret holding the git config and credentials of PFE
+func (r *ReconcileCodewind) buildGitCredentialsSecret(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, files map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentOptions.CodewindGitCredentialsSecretName,
+			Namespace: codewind.Namespace,
+			Labels:    labelsForCodewindPFE(deploymentOptions),
+		},
+		StringData: files,
+	}
+	// Set Codewind instance as the owner of this secret.
+	controllerutil.SetControllerReference(codewind, secret, r.scheme)
+	return secret
+}
+
+// addGitCredentials mounts the git credentials secret into the PFE container, with its git config as the system
+// config of git so the global config of the container stays writable. The config only refers to files of the
+// mounted directory, which follow updates of the secret
+func addGitCredentials(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, podSpec *corev1.PodSpec) {
+	if codewind.Spec.GitCredentialsSecret == "" {
+		return
+	}
+	mode := int32(0400)
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "git-credentials",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: deploymentOptions.CodewindGitCredentialsSecretName, DefaultMode: &mode},
+		},
+	})
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "git-credentials",
+		MountPath: defaults.GitCredentialsPath,
+		ReadOnly:  true,
+	}, corev1.VolumeMount{
+		Name:      "git-credentials",
+		MountPath: defaults.GitSystemConfigPath,
+		SubPath:   "config",
+		ReadOnly:  true,
+	})
+}
@@ -0,0 +1,131 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ttlActionHibernate : an idle instance is suspended
+	ttlActionHibernate = "hibernate"
+
+	// ttlActionDelete : an idle instance is deleted
+	ttlActionDelete = "delete"
+
+	// maxIdleWarning : how long before the TTL expires the idle warning is recorded at most
+	maxIdleWarning = time.Hour
+)
+
+// ttlActionResults : what happens to the instance for each action, in events
+var ttlActionResults = map[string]string{ttlActionHibernate: "hibernated", ttlActionDelete: "deleted"}
+
+// idleSettings : TTL and action of the CR, else of the ttlAfterLastUse and ttlAction keys of the operator config map.
+// A zero TTL disables the cleanup, an invalid operator config map value is returned as an error and ignored
+func idleSettings(codewind *codewindv1alpha1.Codewind, data map[string]string) (time.Duration, string, error) {
+	var err error
+	action := codewind.Spec.TTLAction
+	if action == "" {
+		action = data["ttlAction"]
+	}
+	if action != ttlActionHibernate && action != ttlActionDelete {
+		if action != "" {
+			err = fmt.Errorf("operator config map key ttlAction must be hibernate or delete, got %q", action)
+		}
+		action = ttlActionHibernate
+	}
+	value := codewind.Spec.TTLAfterLastUse
+	if value == "" {
+		value = data["ttlAfterLastUse"]
+	}
+	if value == "" {
+		return 0, action, err
+	}
+	ttl, parseErr := time.ParseDuration(value)
+	if parseErr != nil || ttl <= 0 {
+		return 0, action, fmt.Errorf("ttlAfterLastUse must be a positive duration such as 12h, got %q", value)
+	}
+	return ttl, action, err
+}
+
+// lastActivity : Latest of the last-activity annotation, the creation of the CR and the last recorded activity
+func lastActivity(codewind *codewindv1alpha1.Codewind) time.Time {
+	last := codewind.CreationTimestamp.Time
+	if codewind.Status.LastActivityTime != nil && codewind.Status.LastActivityTime.After(last) {
+		last = codewind.Status.LastActivityTime.Time
+	}
+	if annotation := codewind.GetAnnotations()[defaults.LastActivityAnnotation]; annotation != "" {
+		if heartbeat, err := time.Parse(time.RFC3339, annotation); err == nil && heartbeat.After(last) {
+			last = heartbeat
+		}
+	}
+	return last
+}
+
+// reconcileIdle : Hibernates or deletes an instance that was idle for longer than its TTL, recording a warning event
+// shortly before. Resuming a hibernated instance counts as activity. Returns true when the reconcile must stop, else
+// the result requeues the next check
+func (r *ReconcileCodewind) reconcileIdle(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, ttl time.Duration, action string) (reconcile.Result, bool) {
+	now := time.Now()
+	last := lastActivity(codewind)
+	if !codewind.Spec.Suspended && codewind.Status.Phase == codewindv1alpha1.CodewindPhaseHibernated {
+		last = now
+	}
+	if codewind.Status.LastActivityTime == nil || !codewind.Status.LastActivityTime.Time.Equal(last) {
+		lastTime := metav1.NewTime(last)
+		codewind.Status.LastActivityTime = &lastTime
+		codewind.Status.IdleWarningTime = nil
+	}
+	if ttl == 0 || (codewind.Spec.Suspended && action == ttlActionHibernate) {
+		return reconcile.Result{}, false
+	}
+	idle := now.Sub(last)
+	if idle >= ttl {
+		reqLogger.Info("Cleaning up the idle Codewind instance", "Namespace", codewind.Namespace, "Name", codewind.Name, "LastActivity", last, "Action", action)
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonIdleTimeout, "Idle since %s, longer than the TTL of %s, the instance is %s", last.Format(time.RFC3339), ttl, ttlActionResults[action])
+		var err error
+		if action == ttlActionDelete {
+			err = r.client.Delete(context.TODO(), codewind)
+		} else {
+			codewind.Spec.Suspended = true
+			err = r.client.Update(context.TODO(), codewind)
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed to clean up the idle Codewind instance", "Namespace", codewind.Namespace, "Name", codewind.Name)
+			return reconcile.Result{Requeue: true}, true
+		}
+		return reconcile.Result{Requeue: action == ttlActionHibernate}, true
+	}
+	warning := ttl / 4
+	if warning > maxIdleWarning {
+		warning = maxIdleWarning
+	}
+	if idle < ttl-warning {
+		return reconcile.Result{RequeueAfter: ttl - warning - idle}, false
+	}
+	if codewind.Status.IdleWarningTime == nil {
+		warningTime := metav1.NewTime(now)
+		codewind.Status.IdleWarningTime = &warningTime
+		r.recorder.Eventf(codewind, corev1.EventTypeWarning, defaults.EventReasonIdleWarning, "Idle since %s, the instance will be %s at %s unless it is used",
+			last.Format(time.RFC3339), ttlActionResults[action], last.Add(ttl).Format(time.RFC3339))
+	}
+	return reconcile.Result{RequeueAfter: ttl - idle}, false
+}
@@ -0,0 +1,99 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// logLevelEnv : variable the PFE, performance and gatekeeper containers read their log level from
+const logLevelEnv = "LOG_LEVEL"
+
+// componentLogLevels : Log level of each component, the level of the component on the CR wins over the logLevel of
+// the CR and then the default
+func componentLogLevels(codewind *codewindv1alpha1.Codewind) codewindv1alpha1.CodewindLogLevelsSpec {
+	level := defaults.CodewindLogLevel
+	if codewind.Spec.LogLevel != "" {
+		level = codewind.Spec.LogLevel
+	}
+	levels := codewindv1alpha1.CodewindLogLevelsSpec{PFE: level, Performance: level, Gatekeeper: level}
+	if overrides := codewind.Spec.LogLevels; overrides != nil {
+		if overrides.PFE != "" {
+			levels.PFE = overrides.PFE
+		}
+		if overrides.Performance != "" {
+			levels.Performance = overrides.Performance
+		}
+		if overrides.Gatekeeper != "" {
+			levels.Gatekeeper = overrides.Gatekeeper
+		}
+	}
+	return levels
+}
+
+// addLogLevelEnv : sets the log level of the container
+func addLogLevelEnv(container *corev1.Container, level string) {
+	container.Env = append(container.Env, corev1.EnvVar{Name: logLevelEnv, Value: level})
+}
+
+// syncLogLevelEnv : Sets the log level of the containers of the existing deployment to that of the desired one.
+// Containers deployed before their log level was set log at the default level. Returns true when the existing
+// deployment changed and must be updated
+func syncLogLevelEnv(existing *appsv1.Deployment, desired *appsv1.Deployment) bool {
+	changed := false
+	for _, want := range desired.Spec.Template.Spec.Containers {
+		level, ok := envValue(want.Env, logLevelEnv)
+		if !ok {
+			continue
+		}
+		for i := range existing.Spec.Template.Spec.Containers {
+			container := &existing.Spec.Template.Spec.Containers[i]
+			if container.Name != want.Name {
+				continue
+			}
+			current, ok := envValue(container.Env, logLevelEnv)
+			if !ok {
+				current = defaults.CodewindLogLevel
+			}
+			if current == level {
+				continue
+			}
+			container.Env = setEnv(container.Env, logLevelEnv, level)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// envValue : value of a variable of the environment and whether it is set
+func envValue(env []corev1.EnvVar, name string) (string, bool) {
+	for _, envVar := range env {
+		if envVar.Name == name {
+			return envVar.Value, true
+		}
+	}
+	return "", false
+}
+
+// setEnv : environment with the variable set to the value, replacing an existing definition
+func setEnv(env []corev1.EnvVar, name string, value string) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			env[i] = corev1.EnvVar{Name: name, Value: value}
+			return env
+		}
+	}
+	return append(env, corev1.EnvVar{Name: name, Value: value})
+}
@@ -0,0 +1,41 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// pfeProbeTimings : PFE prepares the workspace volume before it listens, which takes minutes on slow storage. The
+// liveness probe waits long enough on clusters that drop startup probes
+var pfeProbeTimings = util.ProbeTimings{
+	Startup:   corev1.Probe{PeriodSeconds: 10, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 60},
+	Liveness:  corev1.Probe{InitialDelaySeconds: 120, PeriodSeconds: 30, TimeoutSeconds: 10, SuccessThreshold: 1, FailureThreshold: 5},
+	Readiness: corev1.Probe{InitialDelaySeconds: 10, PeriodSeconds: 10, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3},
+}
+
+// sidecarProbeTimings : the performance dashboard and the gatekeeper listen within seconds
+var sidecarProbeTimings = util.ProbeTimings{
+	Startup:   corev1.Probe{PeriodSeconds: 5, TimeoutSeconds: 3, SuccessThreshold: 1, FailureThreshold: 24},
+	Liveness:  corev1.Probe{InitialDelaySeconds: 30, PeriodSeconds: 20, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3},
+	Readiness: corev1.Probe{InitialDelaySeconds: 5, PeriodSeconds: 10, TimeoutSeconds: 3, SuccessThreshold: 1, FailureThreshold: 3},
+}
+
+// componentProbes : probe timings of each component set on the CR, none when the CR sets no probes
+func componentProbes(codewind *codewindv1alpha1.Codewind) codewindv1alpha1.CodewindProbesSpec {
+	if codewind.Spec.Probes == nil {
+		return codewindv1alpha1.CodewindProbesSpec{}
+	}
+	return *codewind.Spec.Probes
+}
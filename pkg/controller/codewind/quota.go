@@ -0,0 +1,144 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// instanceQuota : Limits on the number of Codewind instances, zero when unlimited
+type instanceQuota struct {
+	PerNamespace int
+	PerUser      int
+}
+
+// quotaFromOperatorConfig : Reads the maxInstancesPerNamespace and maxInstancesPerUser keys of the operator config
+// map. An invalid value leaves that limit unset and is returned as an error
+func quotaFromOperatorConfig(data map[string]string) (instanceQuota, error) {
+	quota := instanceQuota{}
+	var firstErr error
+	limits := []struct {
+		key   string
+		limit *int
+	}{
+		{"maxInstancesPerNamespace", &quota.PerNamespace},
+		{"maxInstancesPerUser", &quota.PerUser},
+	}
+	for _, l := range limits {
+		value := data[l.key]
+		if value == "" {
+			continue
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("operator config map key %s must be a number of instances, got %q", l.key, value)
+			}
+			continue
+		}
+		*l.limit = limit
+	}
+	return quota, firstErr
+}
+
+// holdsQuota : Reports whether an instance counts against the quota of the instance being admitted. Admitted
+// instances count, as do older instances the operator has not decided on yet, refused and deleted instances do not
+func holdsQuota(instance *codewindv1alpha1.Codewind, codewind *codewindv1alpha1.Codewind) bool {
+	if instance.UID == codewind.UID || instance.DeletionTimestamp != nil {
+		return false
+	}
+	condition := getCodewindCondition(instance, codewindv1alpha1.CodewindQuotaExceeded)
+	if condition != nil {
+		return condition.Status == corev1.ConditionFalse
+	}
+	if instance.CreationTimestamp.Equal(&codewind.CreationTimestamp) {
+		return instance.Namespace+"/"+instance.Name < codewind.Namespace+"/"+codewind.Name
+	}
+	return instance.CreationTimestamp.Before(&codewind.CreationTimestamp)
+}
+
+// quotaViolation : Describes the limit that provisioning the instance would exceed, empty when it fits
+func (r *ReconcileCodewind) quotaViolation(codewind *codewindv1alpha1.Codewind, quota instanceQuota) (string, error) {
+	if quota.PerNamespace == 0 && quota.PerUser == 0 {
+		return "", nil
+	}
+	instances := &codewindv1alpha1.CodewindList{}
+	if err := r.client.List(context.TODO(), instances); err != nil {
+		return "", err
+	}
+	inNamespace, ofUser := 0, 0
+	for i := range instances.Items {
+		instance := &instances.Items[i]
+		if !holdsQuota(instance, codewind) {
+			continue
+		}
+		if instance.Namespace == codewind.Namespace {
+			inNamespace++
+		}
+		if instance.Spec.Username == codewind.Spec.Username {
+			ofUser++
+		}
+	}
+	if quota.PerNamespace > 0 && inNamespace >= quota.PerNamespace {
+		return fmt.Sprintf("Namespace %s already has %d of at most %d Codewind instances", codewind.Namespace, inNamespace, quota.PerNamespace), nil
+	}
+	if quota.PerUser > 0 && ofUser >= quota.PerUser {
+		return fmt.Sprintf("User %s already has %d of at most %d Codewind instances", codewind.Spec.Username, ofUser, quota.PerUser), nil
+	}
+	return "", nil
+}
+
+// reconcileQuota : Admits the instance when it fits the instance quota, else sets the QuotaExceeded condition and
+// checks again later without provisioning anything. An admitted instance keeps running when the limits are lowered.
+// Returns true when the reconcile must stop
+func (r *ReconcileCodewind) reconcileQuota(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, quota instanceQuota) (reconcile.Result, bool, error) {
+	condition := getCodewindCondition(codewind, codewindv1alpha1.CodewindQuotaExceeded)
+	if condition != nil && condition.Status == corev1.ConditionFalse {
+		return reconcile.Result{}, false, nil
+	}
+	violation, err := r.quotaViolation(codewind, quota)
+	if err != nil {
+		reqLogger.Error(err, "Failed to count the Codewind instances of the quota")
+		return reconcile.Result{}, true, err
+	}
+	if violation == "" {
+		// Record the admission straight away, it counts against the quota of the instances reconciled next
+		setCodewindCondition(codewind, codewindv1alpha1.CodewindQuotaExceeded, corev1.ConditionFalse, "WithinQuota", "The instance fits the instance quota")
+		if err := r.client.Status().Update(context.TODO(), codewind); err != nil {
+			reqLogger.Error(err, "Failed to update Codewind status", "Namespace", codewind.Namespace, "Name", codewind.Name)
+			return reconcile.Result{}, true, err
+		}
+		return reconcile.Result{}, false, nil
+	}
+	if condition == nil || condition.Status != corev1.ConditionTrue {
+		reqLogger.Info("Refusing to provision the Codewind instance", "Namespace", codewind.Namespace, "Name", codewind.Name, "Reason", violation)
+		r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonQuotaExceeded, violation)
+	}
+	setCodewindCondition(codewind, codewindv1alpha1.CodewindQuotaExceeded, corev1.ConditionTrue, "QuotaExceeded", violation)
+	phaseChange := updateCodewindPhase(codewind)
+	if err := r.client.Status().Update(context.TODO(), codewind); err != nil {
+		reqLogger.Error(err, "Failed to update Codewind status", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	} else {
+		notifyCodewindPhase(phaseChange)
+	}
+	// Other instances are not watched, check again in case one was deleted or the limits were raised
+	return reconcile.Result{RequeueAfter: time.Minute}, true, nil
+}
@@ -12,13 +12,228 @@
 package codewind
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
 	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/go-logr/logr"
 	rbacv1 "k8s.io/api/rbac/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+const (
+	// legacyRBACKey : Operator config map key binding every instance to the shared cluster role of earlier releases
+	legacyRBACKey = "legacyRBAC"
+
+	// instanceRoleRulesKey : Operator config map key replacing the rules of the built in instance role template
+	instanceRoleRulesKey = "instanceRoleRules"
+)
+
+// legacyRBACFromOperatorConfig : Reports whether the operator config map asks for the shared cluster role, instances
+// get their own role by default
+func legacyRBACFromOperatorConfig(data map[string]string) bool {
+	legacy, _ := strconv.ParseBool(data[legacyRBACKey])
+	return legacy
+}
+
+// instanceRoleRulesFromOperatorConfig : Rules of the JSON list of the instanceRoleRules key of the operator config
+// map. Nil when not set, on error nil is returned with the error
+func instanceRoleRulesFromOperatorConfig(data map[string]string) ([]rbacv1.PolicyRule, error) {
+	value := data[instanceRoleRulesKey]
+	if value == "" {
+		return nil, nil
+	}
+	rules := []rbacv1.PolicyRule{}
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("operator config map key %s is not a valid JSON list of policy rules: %v", instanceRoleRulesKey, err)
+	}
+	return rules, nil
+}
+
+// instanceRoleRules : Rules of the role of an instance, limited to what PFE needs to build and run projects in the
+// namespace of the instance. The privileged security context constraint is only granted to a privileged PFE
+func instanceRoleRules(deploymentOptions DeploymentOptionsCodewind, isOpenshift bool) []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods", "pods/log"},
+			Verbs:     []string{"get", "list", "watch", "create", "delete"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods/exec", "pods/portforward"},
+			Verbs:     []string{"get", "create"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"secrets", "configmaps"},
+			Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"services"},
+			Verbs:     []string{"get", "list", "create", "update", "patch", "delete"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"serviceaccounts"},
+			Verbs:     []string{"get", "patch"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"persistentvolumeclaims"},
+			Verbs:     []string{"get", "list", "watch", "create", "delete"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch", "update"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{"apps", "extensions"},
+			Resources: []string{"deployments"},
+			Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{"apps", "extensions"},
+			Resources: []string{"replicasets"},
+			Verbs:     []string{"get", "list", "delete"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{"extensions"},
+			Resources: []string{"ingresses"},
+			Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+		},
+	}
+	if isOpenshift {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"route.openshift.io"},
+			Resources: []string{"routes", "routes/custom-host"},
+			Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+		})
+		if deploymentOptions.PFEPrivileged {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups:     []string{"security.openshift.io"},
+				Resources:     []string{"securitycontextconstraints"},
+				Verbs:         []string{"use"},
+				ResourceNames: []string{"privileged"},
+			})
+		}
+	}
+	return rules
+}
+
+// roleForCodewind : Role of an instance in its namespace, owned by the Codewind CR
+func (r *ReconcileCodewind) roleForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, rules []rbacv1.PolicyRule) *rbacv1.Role {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentOptions.CodewindInstanceRoleName,
+			Labels:    labelsForCodewindPFE(deploymentOptions),
+			Namespace: codewind.Namespace,
+		},
+		Rules: rules,
+	}
+	controllerutil.SetControllerReference(codewind, role, r.scheme)
+	return role
+}
+
+// reconcileCodewindRBAC : Binds the service account of an instance to its own role, generated from the built in
+// template or the rules of the operator config map. With legacyRBAC the shared cluster role of earlier releases is
+// bound instead. The role binding is recreated when it refers to the other role, its roleRef cannot be changed
+func (r *ReconcileCodewind) reconcileCodewindRBAC(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, codewindConfigMap OperatorConfigMapCodewind, isOpenshift bool) error {
+	if codewindConfigMap.LegacyRBAC {
+		// Check if the Codewind Cluster roles already exist, if not create new ones
+		clusterRoles := &rbacv1.ClusterRole{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindRolesName, Namespace: ""}, clusterRoles)
+		if err != nil && k8serr.IsNotFound(err) {
+			newClusterRoles := r.clusterRolesForCodewind(codewind, deploymentOptions)
+			reqLogger.Info("Creating a new Codewind cluster roles", "Namespace", "", "Name", newClusterRoles.Name)
+			err = r.client.Create(context.TODO(), newClusterRoles)
+			if err != nil {
+				reqLogger.Error(err, "Failed to create new Codewind cluster roles.", "Namespace", "", "Name", newClusterRoles.Name)
+				return err
+			}
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get Codewind cluster roles.")
+			return err
+		}
+	} else {
+		rules := codewindConfigMap.InstanceRoleRules
+		if rules == nil {
+			rules = instanceRoleRules(deploymentOptions, isOpenshift)
+		}
+		role := &rbacv1.Role{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindInstanceRoleName, Namespace: codewind.Namespace}, role)
+		if err != nil && k8serr.IsNotFound(err) {
+			newRole := r.roleForCodewind(codewind, deploymentOptions, rules)
+			reqLogger.Info("Creating a new Codewind role", "Namespace", newRole.Namespace, "Name", newRole.Name)
+			err = r.client.Create(context.TODO(), newRole)
+			if err != nil {
+				reqLogger.Error(err, "Failed to create new Codewind role.", "Namespace", newRole.Namespace, "Name", newRole.Name)
+				return err
+			}
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get Codewind role.")
+			return err
+		} else if !reflect.DeepEqual(role.Rules, rules) {
+			reqLogger.Info("Updating the rules of the Codewind role", "Namespace", role.Namespace, "Name", role.Name)
+			role.Rules = rules
+			err = r.client.Update(context.TODO(), role)
+			if err != nil {
+				reqLogger.Error(err, "Failed to update Codewind role.", "Namespace", role.Namespace, "Name", role.Name)
+				return err
+			}
+		}
+	}
+
+	// Check if the Codewind instance Role Bindings already exist and refer to the selected role, if not create new ones
+	newRoleBinding := r.roleBindingForCodewind(codewind, deploymentOptions, codewindConfigMap.LegacyRBAC)
+	roleBinding := &rbacv1.RoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindRoleBindingName, Namespace: codewind.Namespace}, roleBinding)
+	if err == nil && roleBinding.RoleRef != newRoleBinding.RoleRef {
+		reqLogger.Info("Replacing the Codewind role binding of the other role", "Namespace", roleBinding.Namespace, "Name", roleBinding.Name, "Role", newRoleBinding.RoleRef.Name)
+		err = r.client.Delete(context.TODO(), roleBinding)
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to delete Codewind role binding.", "Namespace", roleBinding.Namespace, "Name", roleBinding.Name)
+			return err
+		}
+		err = k8serr.NewNotFound(rbacv1.Resource("rolebindings"), roleBinding.Name)
+	}
+	if err != nil && k8serr.IsNotFound(err) {
+		reqLogger.Info("Creating a new Codewind role binding", "Namespace", newRoleBinding.Namespace, "Name", newRoleBinding.Name)
+		err = r.client.Create(context.TODO(), newRoleBinding)
+		if err != nil {
+			reqLogger.Error(err, "Failed to create new Codewind role binding.", "Namespace", newRoleBinding.Namespace, "Name", newRoleBinding.Name)
+			return err
+		}
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get Codewind role binding.")
+		return err
+	}
+
+	// The role of the instance is no longer needed once the shared cluster role is bound
+	if codewindConfigMap.LegacyRBAC {
+		role := &rbacv1.Role{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindInstanceRoleName, Namespace: codewind.Namespace}, role)
+		if err == nil {
+			reqLogger.Info("Deleting the Codewind role", "Namespace", role.Namespace, "Name", role.Name)
+			err = r.client.Delete(context.TODO(), role)
+		}
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to delete Codewind role.", "Namespace", codewind.Namespace, "Name", deploymentOptions.CodewindInstanceRoleName)
+			return err
+		}
+	}
+	return nil
+}
+
 // clusterRolesForCodewind : takes in a Codewind object and returns Cluster roles for that object.
 func (r *ReconcileCodewind) clusterRolesForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *rbacv1.ClusterRole {
 	ourRoles := []rbacv1.PolicyRule{
@@ -219,9 +434,22 @@ func (r *ReconcileCodewind) clusterRolesForCodewindODO(codewind *codewindv1alpha
 	}
 }
 
-//roleBindingForCodewind : create Codewind role bindings in the deployment namespace
-func (r *ReconcileCodewind) roleBindingForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *rbacv1.RoleBinding {
+// roleBindingForCodewind : create Codewind role bindings in the deployment namespace, referring to the role of
+// the instance or with legacy set to the shared cluster role
+func (r *ReconcileCodewind) roleBindingForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, legacy bool) *rbacv1.RoleBinding {
 	labels := labelsForCodewindPFE(deploymentOptions)
+	roleRef := rbacv1.RoleRef{
+		Kind:     "Role",
+		Name:     deploymentOptions.CodewindInstanceRoleName,
+		APIGroup: "rbac.authorization.k8s.io",
+	}
+	if legacy {
+		roleRef = rbacv1.RoleRef{
+			Kind:     "ClusterRole",
+			Name:     deploymentOptions.CodewindRolesName,
+			APIGroup: "rbac.authorization.k8s.io",
+		}
+	}
 	rolebinding := &rbacv1.RoleBinding{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "rbac.authorization.k8s.io/v1beta1",
@@ -239,18 +467,14 @@ func (r *ReconcileCodewind) roleBindingForCodewind(codewind *codewindv1alpha1.Co
 				Namespace: codewind.Namespace,
 			},
 		},
-		RoleRef: rbacv1.RoleRef{
-			Kind:     "ClusterRole",
-			Name:     deploymentOptions.CodewindRolesName,
-			APIGroup: "rbac.authorization.k8s.io",
-		},
+		RoleRef: roleRef,
 	}
 	// Set Codewind instance as the owner of these role bindings.
 	controllerutil.SetControllerReference(codewind, rolebinding, r.scheme)
 	return rolebinding
 }
 
-//roleBindingForCodewindTekton : create Codewind Tekton cluster role bindings
+// roleBindingForCodewindTekton : create Codewind Tekton cluster role bindings
 func (r *ReconcileCodewind) roleBindingForCodewindTekton(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *rbacv1.ClusterRoleBinding {
 	labels := labelsForCodewindPFE(deploymentOptions)
 	rolebinding := &rbacv1.ClusterRoleBinding{
@@ -280,7 +504,7 @@ func (r *ReconcileCodewind) roleBindingForCodewindTekton(codewind *codewindv1alp
 	return rolebinding
 }
 
-//roleBindingForCodewindODO : create Codewind ODO cluster role bindings
+// roleBindingForCodewindODO : create Codewind ODO cluster role bindings
 func (r *ReconcileCodewind) roleBindingForCodewindODO(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *rbacv1.ClusterRoleBinding {
 	labels := labelsForCodewindPFE(deploymentOptions)
 	rolebinding := &rbacv1.ClusterRoleBinding{
@@ -0,0 +1,74 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// checkBuildRegistrySecret : the push secret of the build registry exists and holds a docker config
+func (r *ReconcileCodewind) checkBuildRegistrySecret(codewind *codewindv1alpha1.Codewind) error {
+	registry := codewind.Spec.BuildRegistry
+	if registry == nil || registry.SecretName == "" {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: registry.SecretName, Namespace: codewind.Namespace}, secret)
+	if err != nil {
+		return fmt.Errorf("build registry secret %s cannot be read: %v", registry.SecretName, err)
+	}
+	if len(secret.Data[corev1.DockerConfigJsonKey]) == 0 {
+		return fmt.Errorf("build registry secret %s has no %s, create it with kubectl create secret docker-registry", registry.SecretName, corev1.DockerConfigJsonKey)
+	}
+	return nil
+}
+
+// addBuildRegistry points PFE at the build registry of the CR and mounts its push secret as the docker config read by
+// buildah and docker
+func addBuildRegistry(codewind *codewindv1alpha1.Codewind, podSpec *corev1.PodSpec) {
+	registry := codewind.Spec.BuildRegistry
+	if registry == nil || registry.URL == "" {
+		return
+	}
+	container := &podSpec.Containers[0]
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "IMAGE_PUSH_REGISTRY", Value: registry.URL},
+		corev1.EnvVar{Name: "IMAGE_PUSH_REGISTRY_NAMESPACE", Value: registry.NamespacePrefix},
+	)
+	if registry.SecretName == "" {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "build-registry",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: registry.SecretName,
+				Items:      []corev1.KeyToPath{{Key: corev1.DockerConfigJsonKey, Path: "config.json"}},
+			},
+		},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "build-registry",
+		MountPath: defaults.BuildRegistryConfigPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "DOCKER_CONFIG", Value: defaults.BuildRegistryConfigPath},
+		corev1.EnvVar{Name: "REGISTRY_AUTH_FILE", Value: defaults.BuildRegistryConfigPath + "/config.json"},
+	)
+}
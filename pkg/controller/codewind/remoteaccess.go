@@ -0,0 +1,183 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// remoteAccessRefreshTokenKey : key of the remote access secret holding the offline token of the machine user
+	remoteAccessRefreshTokenKey = "refresh_token"
+
+	// remoteAccessBundleKey : key of the remote access secret holding every connection detail as one JSON document
+	remoteAccessBundleKey = "connection.json"
+)
+
+// remoteAccessBundle : the connection details an IDE plugin imports to connect to the instance
+type remoteAccessBundle struct {
+	URL          string `json:"url"`
+	AuthURL      string `json:"authURL"`
+	Realm        string `json:"realm"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	TokenURL     string `json:"tokenURL"`
+	Username     string `json:"username"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// syncRemoteAccessSecret : Publishes the connection details of the deployment and an offline token of its machine
+// user while remote access is enabled. A token is only requested when the secret holds none, so that the token IDE
+// plugins use stays valid across reconciles. Once remote access is disabled the machine user is deleted, which
+// revokes its tokens, and the secret is removed
+func (r *ReconcileCodewind) syncRemoteAccessSecret(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, authProvider security.AuthProvider, gatekeeperAuth security.GatekeeperAuth) error {
+	secretName := ""
+	if remoteAccessEnabled(codewind) {
+		secretName = deploymentOptions.CodewindRemoteAccessSecretName
+	}
+	if published := codewind.Status.RemoteAccessSecret; published != "" && published != secretName {
+		if secretName == "" {
+			reqLogger.Info("Removing the machine user of the deployment", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+			err := authProvider.RemoveRemoteAccess()
+			if err != nil {
+				reqLogger.Error(err, "Failed to remove the machine user of the deployment", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+				return err
+			}
+		}
+		reqLogger.Info("Removing the remote access secret", "Namespace", codewind.Namespace, "Name", published)
+		err := r.client.Delete(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: published, Namespace: codewind.Namespace}})
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to remove the remote access secret", "Namespace", codewind.Namespace, "Name", published)
+			return err
+		}
+		codewind.Status.RemoteAccessSecret = ""
+	}
+	if secretName == "" {
+		return nil
+	}
+
+	authSecret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.CodewindGatekeeperSecretAuthName, Namespace: codewind.Namespace}, authSecret)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get Gatekeeper auth secret.")
+		return err
+	}
+	clientSecret := string(authSecret.Data["client_secret"])
+	secret := &corev1.Secret{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: codewind.Namespace}, secret)
+	if err != nil && !k8serr.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to get the remote access secret", "Namespace", codewind.Namespace, "Name", secretName)
+		return err
+	}
+	found := err == nil
+	token := &security.RemoteAccessToken{Username: security.RemoteAccessUsername(deploymentOptions.WorkspaceID)}
+	if found {
+		token.RefreshToken = string(secret.Data[remoteAccessRefreshTokenKey])
+	}
+	if token.RefreshToken == "" {
+		reqLogger.Info("Issuing an offline token for IDE remote connections", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+		token, err = authProvider.IssueRemoteAccessToken(clientSecret)
+		if errors.Is(err, security.ErrRemoteAccessUnsupported) {
+			reqLogger.Error(err, "Ignoring the remote access of the deployment", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+			return nil
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed to issue an offline token for IDE remote connections", "Namespace", codewind.Namespace, "ClientID", gatekeeperAuth.ClientID)
+			r.recorder.Event(codewind, corev1.EventTypeWarning, security.ConditionReason(err), "Failed to issue an offline token for IDE remote connections: "+err.Error())
+			return err
+		}
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonRemoteAccessTokenIssued, "Published an offline token of machine user %s in secret %s", token.Username, secretName)
+	}
+
+	desired, err := r.buildRemoteAccessSecret(codewind, deploymentOptions, gatekeeperAuth, clientSecret, token)
+	if err != nil {
+		return err
+	}
+	if !found {
+		reqLogger.Info("Publishing the remote access secret", "Namespace", desired.Namespace, "Name", desired.Name)
+		err = r.client.Create(context.TODO(), desired)
+		if err != nil && !k8serr.IsAlreadyExists(err) {
+			reqLogger.Error(err, "Failed to create the remote access secret", "Namespace", desired.Namespace, "Name", desired.Name)
+			return err
+		}
+	} else if !stringDataMatches(secret.Data, desired.StringData) {
+		reqLogger.Info("Updating the remote access secret", "Namespace", secret.Namespace, "Name", secret.Name)
+		secret.Data = nil
+		secret.StringData = desired.StringData
+		err = r.client.Update(context.TODO(), secret)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update the remote access secret", "Namespace", secret.Namespace, "Name", secret.Name)
+			return err
+		}
+	}
+	codewind.Status.RemoteAccessSecret = secretName
+	return nil
+}
+
+// buildRemoteAccessSecret : builds the secret a user downloads to connect an IDE plugin to the deployment, holding
+// each connection detail under its own key and all of them in connection.json
+func (r *ReconcileCodewind) buildRemoteAccessSecret(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind, gatekeeperAuth security.GatekeeperAuth, clientSecret string, token *security.RemoteAccessToken) (*corev1.Secret, error) {
+	bundle := remoteAccessBundle{
+		URL:          gatekeeperURL(deploymentOptions),
+		AuthURL:      gatekeeperAuth.AuthURL,
+		Realm:        gatekeeperAuth.Realm,
+		ClientID:     gatekeeperAuth.ClientID,
+		ClientSecret: clientSecret,
+		TokenURL:     gatekeeperAuth.IssuerURL + "/protocol/openid-connect/token",
+		Username:     token.Username,
+		RefreshToken: token.RefreshToken,
+	}
+	bundleJSON, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	stringData := map[string]string{
+		"access_url":                bundle.URL,
+		"auth_url":                  bundle.AuthURL,
+		"realm":                     bundle.Realm,
+		"client_id":                 bundle.ClientID,
+		"token_url":                 bundle.TokenURL,
+		"username":                  bundle.Username,
+		remoteAccessRefreshTokenKey: bundle.RefreshToken,
+		remoteAccessBundleKey:       string(bundleJSON),
+	}
+	if clientSecret != "" {
+		stringData["client_secret"] = clientSecret
+	}
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentOptions.CodewindRemoteAccessSecretName,
+			Namespace: codewind.Namespace,
+			Labels:    labelsForCodewindGatekeeper(deploymentOptions),
+		},
+		StringData: stringData,
+	}
+	// Set Codewind instance as the owner of this secret.
+	controllerutil.SetControllerReference(codewind, secret, r.scheme)
+	return secret, nil
+}
@@ -0,0 +1,223 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	util "github.com/eclipse/codewind-operator/pkg/util"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// RedactedValue : Replaces the values of the rendered secrets
+const RedactedValue = "REDACTED"
+
+// RenderOptions : The environment a Codewind CR is rendered for
+type RenderOptions struct {
+	// OperatorConfig : data of the operator config map
+	OperatorConfig map[string]string
+
+	// OpenShift : render a route instead of an ingress, and the ODO roles
+	OpenShift bool
+
+	// KeycloakURL : Keycloak the gatekeeper authenticates against, not needed when the CR names an external OIDC provider
+	KeycloakURL string
+
+	// Realm : realm of the Keycloak client, the defaultRealm of the operator config map when not set
+	Realm string
+}
+
+// Render : Builds the resources the operator creates for a Codewind CR without reading from or writing to the cluster
+// or Keycloak. The names of the resources derive from the workspace ID annotation of the CR. Secret values are
+// redacted, and owner references are left out as the CR has no UID before it is created. The git credentials secret
+// is not rendered, its content is copied from a secret of the cluster
+func Render(scheme *runtime.Scheme, codewind *codewindv1alpha1.Codewind, options RenderOptions) ([]runtime.Object, error) {
+	if codewind.Namespace == "" {
+		return nil, fmt.Errorf("Codewind %s has no namespace", codewind.Name)
+	}
+	r := &ReconcileCodewind{scheme: scheme}
+	reqLogger := log.WithValues("Request.Namespace", codewind.Namespace, "Request.Name", codewind.Name)
+	workspaceID := r.getCodewindWorkspaceID(codewind)
+	if workspaceID == "" {
+		return nil, fmt.Errorf("Codewind %s has no %s annotation, the names of its resources derive from the workspace ID", codewind.Name, codewindv1alpha1.WorkspaceIDAnnotation)
+	}
+
+	codewindConfigMap := codewindOperatorConfig(reqLogger, options.OperatorConfig, codewind.Namespace)
+	ingressDomain := codewindConfigMap.IngressDomain
+	if codewind.Spec.IngressDomain != "" {
+		ingressDomain = codewind.Spec.IngressDomain
+	}
+	deploymentOptions, err := deploymentOptionsForCodewind(reqLogger, codewind, codewindConfigMap, workspaceID, ingressDomain, options.OpenShift)
+	if err != nil {
+		return nil, err
+	}
+	gatekeeperAuth, err := renderGatekeeperAuth(codewind, codewindConfigMap, deploymentOptions, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Service account and roles
+	objects := []runtime.Object{}
+	if codewindConfigMap.LegacyRBAC {
+		objects = append(objects, r.clusterRolesForCodewind(codewind, deploymentOptions))
+	} else {
+		rules := codewindConfigMap.InstanceRoleRules
+		if rules == nil {
+			rules = instanceRoleRules(deploymentOptions, options.OpenShift)
+		}
+		objects = append(objects, r.roleForCodewind(codewind, deploymentOptions, rules))
+	}
+	objects = append(objects,
+		r.roleBindingForCodewind(codewind, deploymentOptions, codewindConfigMap.LegacyRBAC),
+		r.clusterRolesForCodewindTekton(codewind, deploymentOptions),
+		r.roleBindingForCodewindTekton(codewind, deploymentOptions),
+	)
+	if options.OpenShift {
+		objects = append(objects, r.clusterRolesForCodewindODO(codewind, deploymentOptions), r.roleBindingForCodewindODO(codewind, deploymentOptions))
+	}
+	objects = append(objects, r.serviceAccountForCodewind(codewind, deploymentOptions))
+
+	// The ROKS storage class is not detected, only the classes of the CR and the operator config map are used
+	storageSize, _, err := util.SelectStorageSize(codewind.Spec.Storage, codewind.Spec.StorageSize, codewindConfigMap.StorageSize)
+	if err != nil {
+		return nil, err
+	}
+	storageClassName := util.SelectStorageClassName(codewind.Spec.Storage, codewindConfigMap.StorageClassName)
+	objects = append(objects, r.pvcForCodewind(codewind, deploymentOptions, storageClassName, storageSize))
+
+	// PFE and Performance
+	useCertManager := util.CertManagerEnabled(codewind.Spec.TLS)
+	if useCertManager {
+		objects = append(objects, r.certificateForCodewindPFE(codewind, deploymentOptions))
+	}
+	objects = append(objects,
+		r.deploymentForCodewindPFE(codewind, deploymentOptions, options.OpenShift, gatekeeperAuth.Realm, gatekeeperAuth.AuthHost, codewind.Spec.LogLevel, ingressDomain),
+		r.serviceForCodewindPFE(codewind, deploymentOptions),
+	)
+	if performanceEnabled(codewind) {
+		objects = append(objects,
+			r.deploymentForCodewindPerformance(codewind, deploymentOptions, ingressDomain),
+			r.serviceForCodewindPerformance(codewind, deploymentOptions),
+		)
+	}
+	if codewindConfigMap.ServiceMonitors {
+		for _, serviceMonitor := range r.serviceMonitorsForCodewind(codewind, deploymentOptions) {
+			objects = append(objects, serviceMonitor)
+		}
+	}
+	if util.NetworkPoliciesEnabled(codewind.Spec.NetworkPolicies, codewindConfigMap.Data) {
+		for _, networkPolicy := range r.networkPoliciesForCodewind(codewind, deploymentOptions) {
+			objects = append(objects, networkPolicy)
+		}
+	}
+
+	// Gatekeeper, its secrets and the route or ingress
+	if gatekeeperSessionSecretRef(codewind) == nil {
+		objects = append(objects, r.buildGatekeeperSecretSession(codewind, deploymentOptions, RedactedValue))
+	}
+	if util.TLSSecretName(codewind.Spec.TLS) == "" {
+		if useCertManager {
+			objects = append(objects, r.certificateForCodewindGatekeeper(codewind, deploymentOptions))
+		} else {
+			objects = append(objects, r.buildGatekeeperSecretTLS(codewind, deploymentOptions, ingressDomain))
+		}
+	}
+	objects = append(objects, r.buildGatekeeperSecretAuth(codewind, deploymentOptions, RedactedValue))
+	if serviceAccountEnabled(codewind) {
+		objects = append(objects, r.buildClientCredentialsSecret(codewind, deploymentOptions, gatekeeperAuth, RedactedValue))
+	}
+	objects = append(objects,
+		r.deploymentForCodewindGatekeeper(codewind, deploymentOptions, options.OpenShift, gatekeeperAuth, ingressDomain),
+		r.serviceForCodewindGatekeeper(codewind, deploymentOptions),
+	)
+	if options.OpenShift {
+		routeTLS, err := routeTLSSettings(codewind, deploymentOptions)
+		if err != nil {
+			return nil, err
+		}
+		if codewind.Spec.Route != nil && codewind.Spec.Route.CertificateSecret != "" {
+			routeTLS.Certificate = RedactedValue
+			routeTLS.Key = RedactedValue
+		}
+		if routeTLS.Termination == routev1.TLSTerminationReencrypt {
+			routeTLS.DestinationCACertificate = RedactedValue
+		}
+		objects = append(objects, r.routeForCodewindGatekeeper(codewind, deploymentOptions, ingressDomain, routeTLS))
+	} else {
+		objects = append(objects, r.ingressForCodewindGatekeeper(codewind, deploymentOptions, ingressDomain))
+	}
+
+	for _, object := range objects {
+		if err := renderedObject(scheme, object); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// renderGatekeeperAuth : Identity provider of the gatekeeper, taken from the CR and the render options rather than
+// looked up from the Keycloak CRs and pods of the cluster
+func renderGatekeeperAuth(codewind *codewindv1alpha1.Codewind, codewindConfigMap OperatorConfigMapCodewind, deploymentOptions DeploymentOptionsCodewind, options RenderOptions) (security.GatekeeperAuth, error) {
+	if codewind.Spec.Auth != nil && codewind.Spec.Auth.ExternalOIDC != nil {
+		provider := &security.ExternalOIDCAuthProvider{
+			IssuerURL: codewind.Spec.Auth.ExternalOIDC.IssuerURL,
+			ClientID:  codewind.Spec.Auth.ExternalOIDC.ClientID,
+		}
+		return provider.GatekeeperAuth(), nil
+	}
+	if options.KeycloakURL == "" {
+		return security.GatekeeperAuth{}, fmt.Errorf("Codewind %s authenticates against Keycloak, the URL of Keycloak is needed to render it", codewind.Name)
+	}
+	realmName := options.Realm
+	if realmName == "" {
+		realmName = codewindConfigMap.DefaultRealm
+	}
+	provider := security.NewKeycloakAuthProvider(security.KeycloakConfiguration{
+		RealmName:  realmName,
+		AuthURL:    strings.TrimSuffix(options.KeycloakURL, "/"),
+		ClientName: "codewind-" + deploymentOptions.WorkspaceID,
+	})
+	return provider.GatekeeperAuth(), nil
+}
+
+// renderedObject : Sets the kind of a rendered resource when its builder left it out, removes the owner references
+// and redacts the values of secrets
+func renderedObject(scheme *runtime.Scheme, object runtime.Object) error {
+	if object.GetObjectKind().GroupVersionKind().Empty() {
+		gvk, err := apiutil.GVKForObject(object, scheme)
+		if err != nil {
+			return err
+		}
+		object.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return err
+	}
+	accessor.SetOwnerReferences(nil)
+	if secret, ok := object.(*corev1.Secret); ok {
+		for key := range secret.StringData {
+			secret.StringData[key] = RedactedValue
+		}
+		for key := range secret.Data {
+			secret.Data[key] = []byte(RedactedValue)
+		}
+	}
+	return nil
+}
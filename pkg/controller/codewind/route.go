@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// externalTLSTermination : Reports whether TLS is terminated in front of the gatekeeper, which then serves plain HTTP
+func externalTLSTermination(codewind *codewindv1alpha1.Codewind) bool {
+	return codewind.Spec.TLS != nil && codewind.Spec.TLS.ExternalTermination
+}
+
+// routeTermination : TLS termination of the gatekeeper route, passthrough unless the CR selects another. External
+// termination defaults to edge
+func routeTermination(codewind *codewindv1alpha1.Codewind) routev1.TLSTerminationType {
+	if codewind.Spec.Route == nil || codewind.Spec.Route.Termination == "" {
+		if externalTLSTermination(codewind) {
+			return routev1.TLSTerminationEdge
+		}
+		return routev1.TLSTerminationPassthrough
+	}
+	return routev1.TLSTerminationType(codewind.Spec.Route.Termination)
+}
+
+// gatekeeperPlainHTTP : Reports whether the gatekeeper serves HTTP, behind external TLS termination or an edge route
+func gatekeeperPlainHTTP(codewind *codewindv1alpha1.Codewind, isOnOpenshift bool) bool {
+	return externalTLSTermination(codewind) || (isOnOpenshift && routeTermination(codewind) == routev1.TLSTerminationEdge)
+}
+
+// gatekeeperURL : Public URL of the gatekeeper, including the base path of path routing
+func gatekeeperURL(deploymentOptions DeploymentOptionsCodewind) string {
+	return "https://" + deploymentOptions.CodewindGatekeeperIngressHost + deploymentOptions.CodewindGatekeeperBasePath
+}
+
+// gatekeeperTLSSecretName : secret of the gatekeeper certificate, the existing secret of the CR when set
+func gatekeeperTLSSecretName(codewind *codewindv1alpha1.Codewind, workspaceID string) string {
+	if secretName := util.TLSSecretName(codewind.Spec.TLS); secretName != "" {
+		return secretName
+	}
+	return "secret-codewind-tls-" + workspaceID
+}
+
+// gatekeeperServiceDNSNames : Extra names of the gatekeeper certificate. The router of a reencrypt route verifies the
+// certificate against the name of the service
+func gatekeeperServiceDNSNames(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) []string {
+	if routeTermination(codewind) != routev1.TLSTerminationReencrypt {
+		return nil
+	}
+	return []string{deploymentOptions.CodewindGatekeeperServiceName + "." + codewind.Namespace + ".svc"}
+}
+
+// routeTLSForCodewind : TLS settings of the gatekeeper route. Edge and reencrypt routes serve the certificate of the
+// certificateSecret of the CR when set, reencrypt routes trust the CA of the gatekeeper TLS secret
+func (r *ReconcileCodewind) routeTLSForCodewind(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) (*routev1.TLSConfig, error) {
+	tls, err := routeTLSSettings(codewind, deploymentOptions)
+	if err != nil {
+		return nil, err
+	}
+	if codewind.Spec.Route != nil && codewind.Spec.Route.CertificateSecret != "" {
+		secret, err := r.routeSecret(codewind.Namespace, codewind.Spec.Route.CertificateSecret, "tls.crt", "tls.key")
+		if err != nil {
+			return nil, err
+		}
+		tls.Certificate = string(secret.Data["tls.crt"])
+		tls.Key = string(secret.Data["tls.key"])
+		tls.CACertificate = string(secret.Data["ca.crt"])
+	}
+	if tls.Termination == routev1.TLSTerminationReencrypt {
+		// The gatekeeper certificate is self-signed unless cert-manager issued it with a CA
+		secret, err := r.routeSecret(codewind.Namespace, deploymentOptions.CodewindGatekeeperSecretTLSName, "tls.crt")
+		if err != nil {
+			return nil, err
+		}
+		tls.DestinationCACertificate = string(secret.Data["ca.crt"])
+		if tls.DestinationCACertificate == "" {
+			tls.DestinationCACertificate = string(secret.Data["tls.crt"])
+		}
+	}
+	return tls, nil
+}
+
+// routeTLSSettings : Termination of the gatekeeper route, without the certificates read from secrets. Fails when the
+// termination cannot serve the routing or the certificateSecret of the CR
+func routeTLSSettings(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) (*routev1.TLSConfig, error) {
+	termination := routeTermination(codewind)
+	tls := &routev1.TLSConfig{
+		InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+		Termination:                   termination,
+	}
+	if externalTLSTermination(codewind) && termination != routev1.TLSTerminationEdge {
+		return nil, fmt.Errorf("external TLS termination forwards plain HTTP to the gatekeeper, %s routes require edge termination", termination)
+	}
+	if deploymentOptions.CodewindGatekeeperBasePath != "" && termination == routev1.TLSTerminationPassthrough {
+		return nil, fmt.Errorf("path routing requires edge or reencrypt termination, the router cannot read the path of passthrough connections")
+	}
+	if codewind.Spec.Route != nil && codewind.Spec.Route.CertificateSecret != "" && termination == routev1.TLSTerminationPassthrough {
+		return nil, fmt.Errorf("route certificateSecret %s requires edge or reencrypt termination, passthrough routes serve the gatekeeper certificate", codewind.Spec.Route.CertificateSecret)
+	}
+	return tls, nil
+}
+
+// routeSecret : Reads a secret of the route, failing when one of the keys is missing
+func (r *ReconcileCodewind) routeSecret(namespace string, name string, keys ...string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read route TLS secret %s: %v", name, err)
+	}
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			return nil, fmt.Errorf("route TLS secret %s has no %s key", name, key)
+		}
+	}
+	return secret, nil
+}
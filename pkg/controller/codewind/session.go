@@ -0,0 +1,145 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// gatekeeperSessionEnvNames : gatekeeper environment variables holding the session settings in seconds
+var gatekeeperSessionEnvNames = []string{"SESSION_TIMEOUT", "SESSION_IDLE_TIMEOUT", "ACCESS_TOKEN_LIFESPAN"}
+
+// sessionSecretEnvName : gatekeeper environment variable holding the key its session cookies are encrypted with
+const sessionSecretEnvName = "SESSION_SECRET"
+
+// sessionSecretKey : key of the session secret generated by the operator, and the default key of a referenced secret
+const sessionSecretKey = "session_secret"
+
+// gatekeeperSessionSecretRef : the session secret referenced by the CR, nil when the operator generates it
+func gatekeeperSessionSecretRef(codewind *codewindv1alpha1.Codewind) *codewindv1alpha1.SessionSecretReference {
+	if codewind.Spec.Auth == nil || codewind.Spec.Auth.SessionSecretRef == nil || codewind.Spec.Auth.SessionSecretRef.Name == "" {
+		return nil
+	}
+	return codewind.Spec.Auth.SessionSecretRef
+}
+
+// gatekeeperSessionSecret : the secret key the gatekeeper reads its session secret from, the one referenced by the CR
+// or else the one generated by the operator
+func gatekeeperSessionSecret(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *corev1.SecretKeySelector {
+	sessionSecretRef := gatekeeperSessionSecretRef(codewind)
+	if sessionSecretRef == nil {
+		return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: deploymentOptions.CodewindGatekeeperSecretSessionName}, Key: sessionSecretKey}
+	}
+	key := sessionSecretRef.Key
+	if key == "" {
+		key = sessionSecretKey
+	}
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: sessionSecretRef.Name}, Key: key}
+}
+
+// checkSessionSecret : Checks that the session secret referenced by a CR exists and holds its key. The secret belongs
+// to the admin and is never written by the operator
+func (r *ReconcileCodewind) checkSessionSecret(namespace string, sessionSecretRef *codewindv1alpha1.SessionSecretReference) error {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sessionSecretRef.Name, Namespace: namespace}, secret)
+	if err != nil {
+		return fmt.Errorf("session secret %s cannot be read: %v", sessionSecretRef.Name, err)
+	}
+	key := sessionSecretRef.Key
+	if key == "" {
+		key = sessionSecretKey
+	}
+	if len(secret.Data[key]) == 0 {
+		return fmt.Errorf("session secret %s has no %s key", sessionSecretRef.Name, key)
+	}
+	return nil
+}
+
+// clientSessionSettings : the token and session lifetimes of the CR in seconds, zero for the ones left to the realm.
+// The durations are checked by the webhook, one that does not parse is left to the realm
+func clientSessionSettings(codewind *codewindv1alpha1.Codewind) security.ClientSessionSettings {
+	settings := security.ClientSessionSettings{}
+	if codewind.Spec.Auth == nil {
+		return settings
+	}
+	settings.SessionMaxLifespan = durationSeconds(codewind.Spec.Auth.SessionTimeout)
+	settings.SessionIdleTimeout = durationSeconds(codewind.Spec.Auth.SessionIdleTimeout)
+	settings.AccessTokenLifespan = durationSeconds(codewind.Spec.Auth.AccessTokenLifespan)
+	return settings
+}
+
+// durationSeconds : a duration such as 1h30m in seconds, zero when empty or invalid
+func durationSeconds(value string) int {
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0
+	}
+	return int(duration / time.Second)
+}
+
+// sessionSettingsHash : identifies the session settings applied to the client, empty when every lifetime is left to the realm
+func sessionSettingsHash(settings security.ClientSessionSettings) string {
+	if settings == (security.ClientSessionSettings{}) {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d/%d", settings.SessionMaxLifespan, settings.SessionIdleTimeout, settings.AccessTokenLifespan)
+}
+
+// gatekeeperSessionEnv : environment of the gatekeeper for the session settings that are set
+func gatekeeperSessionEnv(settings security.ClientSessionSettings) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for i, seconds := range []int{settings.SessionMaxLifespan, settings.SessionIdleTimeout, settings.AccessTokenLifespan} {
+		if seconds > 0 {
+			env = append(env, corev1.EnvVar{Name: gatekeeperSessionEnvNames[i], Value: strconv.Itoa(seconds)})
+		}
+	}
+	return env
+}
+
+// sessionEnv : the session settings and the session secret within an environment
+func sessionEnv(env []corev1.EnvVar) (session []corev1.EnvVar, other []corev1.EnvVar) {
+	for _, envVar := range env {
+		if contains(gatekeeperSessionEnvNames, envVar.Name) || envVar.Name == sessionSecretEnvName {
+			session = append(session, envVar)
+		} else {
+			other = append(other, envVar)
+		}
+	}
+	return session, other
+}
+
+// syncGatekeeperSessionEnv : replaces the session settings and the session secret in the environment of the existing
+// gatekeeper container with the ones of the desired environment. Returns true when the container changed
+func syncGatekeeperSessionEnv(existing *corev1.Container, desiredEnv []corev1.EnvVar) bool {
+	current, env := sessionEnv(existing.Env)
+	desired, _ := sessionEnv(desiredEnv)
+	changed := len(current) != len(desired)
+	for i := 0; !changed && i < len(current); i++ {
+		changed = current[i].Name != desired[i].Name || current[i].Value != desired[i].Value || !reflect.DeepEqual(current[i].ValueFrom, desired[i].ValueFrom)
+	}
+	if changed {
+		existing.Env = append(env, desired...)
+	}
+	return changed
+}
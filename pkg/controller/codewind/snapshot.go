@@ -0,0 +1,140 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/cron"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// defaultSnapshotRetain : number of workspace snapshots kept when the backup spec does not say
+const defaultSnapshotRetain = 7
+
+// snapshotSchedule : the snapshot schedule of the CR, nil when no snapshots are scheduled. The schedule is checked
+// by the webhook
+func snapshotSchedule(codewind *codewindv1alpha1.Codewind) *cron.Schedule {
+	if codewind.Spec.Backup == nil || codewind.Spec.Backup.Schedule == "" {
+		return nil
+	}
+	schedule, err := cron.Parse(codewind.Spec.Backup.Schedule)
+	if err != nil {
+		return nil
+	}
+	return schedule
+}
+
+// reconcileSnapshots : Takes a VolumeSnapshot of the workspace volume when the schedule of the CR is due, then deletes
+// the oldest snapshots beyond the retained number. A run missed while the operator was down is taken once. Returns the
+// result requeueing for the next run
+func (r *ReconcileCodewind) reconcileSnapshots(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) (reconcile.Result, error) {
+	schedule := snapshotSchedule(codewind)
+	if schedule == nil {
+		return reconcile.Result{}, nil
+	}
+	lastRun := codewind.CreationTimestamp.Time
+	if codewind.Status.LastSnapshotTime != nil {
+		lastRun = codewind.Status.LastSnapshotTime.Time
+	}
+	now := time.Now()
+	due := schedule.Next(lastRun)
+	if due.IsZero() {
+		return reconcile.Result{}, nil
+	}
+	if now.Before(due) {
+		return reconcile.Result{RequeueAfter: due.Sub(now)}, nil
+	}
+
+	available, err := util.DetectVolumeSnapshots()
+	if err != nil {
+		reqLogger.Error(err, "Unable to detect the VolumeSnapshot resource")
+		return reconcile.Result{}, err
+	}
+	if !available {
+		reqLogger.Info("Workspace snapshots are scheduled but the cluster does not serve VolumeSnapshots, skipping them")
+		r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonSnapshotFailed, "Workspace snapshots are scheduled but the cluster does not serve VolumeSnapshots")
+		return reconcile.Result{}, nil
+	}
+
+	// The snapshots are not owned by the CR so that a new instance can be restored from them once it is deleted
+	labels := labelsForCodewindPFE(deploymentOptions)
+	snapshot := util.NewVolumeSnapshot(deploymentOptions.CodewindPFEPVCName+"-"+now.UTC().Format("20060102150405"), codewind.Namespace, labels, deploymentOptions.CodewindPFEPVCName, codewind.Spec.Backup.VolumeSnapshotClassName)
+	reqLogger.Info("Creating a snapshot of the workspace volume", "Namespace", snapshot.GetNamespace(), "Name", snapshot.GetName())
+	err = r.client.Create(context.TODO(), snapshot)
+	if err != nil && !k8serr.IsAlreadyExists(err) {
+		reqLogger.Error(err, "Failed to create the workspace snapshot", "Namespace", snapshot.GetNamespace(), "Name", snapshot.GetName())
+		r.recorder.Event(codewind, corev1.EventTypeWarning, defaults.EventReasonSnapshotFailed, "Failed to create snapshot "+snapshot.GetName()+": "+err.Error())
+		return reconcile.Result{}, err
+	}
+	r.recorder.Event(codewind, corev1.EventTypeNormal, defaults.EventReasonSnapshotCreated, "Snapshot "+snapshot.GetName()+" of the workspace volume requested")
+	codewind.Status.LastSnapshotTime = &metav1.Time{Time: now}
+	codewind.Status.LastSnapshotName = snapshot.GetName()
+	err = r.client.Status().Update(context.TODO(), codewind)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	err = r.pruneSnapshots(reqLogger, codewind, labels)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{RequeueAfter: next.Sub(now)}, nil
+}
+
+// pruneSnapshots : Deletes the oldest snapshots of the workspace volume beyond the retained number
+func (r *ReconcileCodewind) pruneSnapshots(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, labels map[string]string) error {
+	retain := defaultSnapshotRetain
+	if codewind.Spec.Backup.Retain > 0 {
+		retain = int(codewind.Spec.Backup.Retain)
+	}
+	snapshots, err := util.ListVolumeSnapshots(r.client, codewind.Namespace, labels)
+	if err != nil {
+		reqLogger.Error(err, "Failed to list the workspace snapshots", "Namespace", codewind.Namespace)
+		return err
+	}
+	for i := 0; i < len(snapshots)-retain; i++ {
+		snapshot := &snapshots[i]
+		reqLogger.Info("Deleting an expired snapshot of the workspace volume", "Namespace", snapshot.GetNamespace(), "Name", snapshot.GetName())
+		err = r.client.Delete(context.TODO(), snapshot)
+		if err != nil && !k8serr.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to delete the workspace snapshot", "Namespace", snapshot.GetNamespace(), "Name", snapshot.GetName())
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreVolumeFromSnapshot : provisions a new workspace volume from the snapshot named by the CR
+func restoreVolumeFromSnapshot(codewind *codewindv1alpha1.Codewind, pvc *corev1.PersistentVolumeClaim) {
+	if codewind.Spec.Backup == nil || codewind.Spec.Backup.RestoreFrom == nil {
+		return
+	}
+	apiGroup := util.VolumeSnapshotGVK.Group
+	pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     util.VolumeSnapshotGVK.Kind,
+		Name:     codewind.Spec.Backup.RestoreFrom.VolumeSnapshotName,
+	}
+}
@@ -0,0 +1,218 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package codewind
+
+import (
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/notification"
+	"github.com/eclipse/codewind-operator/pkg/security"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// codewindConditionTypes : conditions that must all be true for the deployment to be running
+var codewindConditionTypes = []codewindv1alpha1.CodewindConditionType{
+	codewindv1alpha1.CodewindKeycloakConfigured,
+	codewindv1alpha1.CodewindCertificatesReady,
+	codewindv1alpha1.CodewindPFEReady,
+	codewindv1alpha1.CodewindGatekeeperReady,
+	codewindv1alpha1.CodewindPerformanceReady,
+}
+
+// deploymentConditionTypes : conditions reporting the deployments of the instance
+var deploymentConditionTypes = []codewindv1alpha1.CodewindConditionType{
+	codewindv1alpha1.CodewindPFEReady,
+	codewindv1alpha1.CodewindGatekeeperReady,
+	codewindv1alpha1.CodewindPerformanceReady,
+}
+
+// getCodewindCondition : Returns the condition of the given type, or nil when it has not been reported yet
+func getCodewindCondition(codewind *codewindv1alpha1.Codewind, conditionType codewindv1alpha1.CodewindConditionType) *codewindv1alpha1.CodewindCondition {
+	for i := range codewind.Status.Conditions {
+		if codewind.Status.Conditions[i].Type == conditionType {
+			return &codewind.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCodewindCondition : Records the state of a provisioning step. The transition time only moves when the status changes
+func setCodewindCondition(codewind *codewindv1alpha1.Codewind, conditionType codewindv1alpha1.CodewindConditionType, status corev1.ConditionStatus, reason string, message string) {
+	condition := getCodewindCondition(codewind, conditionType)
+	if condition == nil {
+		codewind.Status.Conditions = append(codewind.Status.Conditions, codewindv1alpha1.CodewindCondition{Type: conditionType})
+		condition = &codewind.Status.Conditions[len(codewind.Status.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.Status = status
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// removeCodewindCondition : Drops the condition of the given type, such as the one of a component that was disabled
+func removeCodewindCondition(codewind *codewindv1alpha1.Codewind, conditionType codewindv1alpha1.CodewindConditionType) {
+	conditions := codewind.Status.Conditions[:0]
+	for _, condition := range codewind.Status.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	codewind.Status.Conditions = conditions
+}
+
+// conditionReported : Whether the condition is reported for the instance, a disabled component has none
+func conditionReported(codewind *codewindv1alpha1.Codewind, conditionType codewindv1alpha1.CodewindConditionType) bool {
+	return conditionType != codewindv1alpha1.CodewindPerformanceReady || performanceEnabled(codewind)
+}
+
+// setDeploymentCondition : Records whether a deployment has at least one available replica, or while the instance is
+// suspended whether the deployment has been scaled to zero
+func setDeploymentCondition(codewind *codewindv1alpha1.Codewind, conditionType codewindv1alpha1.CodewindConditionType, deployment *appsv1.Deployment) {
+	if codewind.Spec.Suspended {
+		if deployment.Status.Replicas == 0 {
+			setCodewindCondition(codewind, conditionType, corev1.ConditionFalse, "Hibernated", fmt.Sprintf("Deployment %s is scaled to zero", deployment.Name))
+			return
+		}
+		setCodewindCondition(codewind, conditionType, corev1.ConditionFalse, "ScalingDown",
+			fmt.Sprintf("Deployment %s has %d replicas left", deployment.Name, deployment.Status.Replicas))
+		return
+	}
+	if deployment.Status.AvailableReplicas > 0 {
+		setCodewindCondition(codewind, conditionType, corev1.ConditionTrue, "DeploymentAvailable", fmt.Sprintf("Deployment %s is available", deployment.Name))
+		return
+	}
+	setCodewindCondition(codewind, conditionType, corev1.ConditionFalse, "DeploymentUnavailable",
+		fmt.Sprintf("Deployment %s has %d of %d replicas available", deployment.Name, deployment.Status.AvailableReplicas, deployment.Status.Replicas))
+}
+
+// setCodewindEndpoints : Publishes the URLs and the client of the deployment and the generation they were reconciled from
+func setCodewindEndpoints(codewind *codewindv1alpha1.Codewind, gatekeeperPublicURL string, gatekeeperAuth security.GatekeeperAuth) {
+	codewind.Status.AccessURL = gatekeeperPublicURL
+	codewind.Status.PerformanceURL = ""
+	if performanceEnabled(codewind) {
+		codewind.Status.PerformanceURL = gatekeeperPublicURL + defaults.PerformanceDashboardPath
+	}
+	codewind.Status.AuthURL = gatekeeperAuth.AuthURL
+	codewind.Status.KeycloakURL = gatekeeperAuth.AuthURL
+	codewind.Status.Realm = gatekeeperAuth.Realm
+	codewind.Status.ClientID = gatekeeperAuth.ClientID
+	codewind.Status.ObservedGeneration = codewind.Generation
+}
+
+// updateCodewindPhase : Derives the overall phase of the deployment from its conditions. Returns the notification for
+// the webhook of the operator config map when the deployment became Running or Failed, nil otherwise. Callers send it
+// with notifyCodewindPhase once the status is saved, a status update that fails is retried and would notify the same
+// transition again
+func updateCodewindPhase(codewind *codewindv1alpha1.Codewind) *notification.Notification {
+	if !setCodewindPhase(codewind, codewindPhase(codewind)) {
+		return nil
+	}
+	switch codewind.Status.Phase {
+	case codewindv1alpha1.CodewindPhaseRunning:
+		ready := codewindNotification(codewind, notification.EventReady)
+		return &ready
+	case codewindv1alpha1.CodewindPhaseFailed:
+		failed := codewindNotification(codewind, notification.EventFailed)
+		if condition := failedCondition(codewind); condition != nil {
+			failed.Reason, failed.Message = condition.Reason, condition.Message
+		}
+		return &failed
+	}
+	return nil
+}
+
+// setCodewindPhase : Sets the phase of the deployment, recording when it entered a different phase. Returns true
+// when the phase changed
+func setCodewindPhase(codewind *codewindv1alpha1.Codewind, phase codewindv1alpha1.CodewindPhase) bool {
+	changed := codewind.Status.Phase != phase
+	if changed || codewind.Status.PhaseTransitionTime == nil {
+		now := metav1.Now()
+		codewind.Status.PhaseTransitionTime = &now
+	}
+	codewind.Status.Phase = phase
+	return changed
+}
+
+// notifyCodewindPhase : Sends the notification of a phase change returned by updateCodewindPhase, nil is ignored
+func notifyCodewindPhase(phaseChange *notification.Notification) {
+	if phaseChange != nil {
+		notification.Notify(*phaseChange)
+	}
+}
+
+// codewindNotification : The notification of an event of the deployment
+func codewindNotification(codewind *codewindv1alpha1.Codewind, event string) notification.Notification {
+	return notification.Notification{
+		Event:       event,
+		Kind:        "Codewind",
+		Namespace:   codewind.Namespace,
+		Name:        codewind.Name,
+		WorkspaceID: codewind.GetAnnotations()[codewindv1alpha1.WorkspaceIDAnnotation],
+		Username:    codewind.Spec.Username,
+		Phase:       string(codewind.Status.Phase),
+		AccessURL:   codewind.Status.AccessURL,
+	}
+}
+
+// failedCondition : The condition failing the deployment, nil when none does
+func failedCondition(codewind *codewindv1alpha1.Codewind) *codewindv1alpha1.CodewindCondition {
+	for _, conditionType := range []codewindv1alpha1.CodewindConditionType{codewindv1alpha1.CodewindQuotaExceeded, codewindv1alpha1.CodewindUnsupportedArchitecture} {
+		blocking := getCodewindCondition(codewind, conditionType)
+		if blocking != nil && blocking.Status == corev1.ConditionTrue {
+			return blocking
+		}
+	}
+	// Waiting for Keycloak to start is part of provisioning rather than a failure
+	keycloak := getCodewindCondition(codewind, codewindv1alpha1.CodewindKeycloakConfigured)
+	if keycloak != nil && keycloak.Status == corev1.ConditionFalse && keycloak.Reason != security.ReasonWaitingForKeycloak {
+		return keycloak
+	}
+	return nil
+}
+
+// codewindPhase : Overall phase of the deployment for its conditions
+func codewindPhase(codewind *codewindv1alpha1.Codewind) codewindv1alpha1.CodewindPhase {
+	if len(codewind.Status.Conditions) == 0 {
+		return codewindv1alpha1.CodewindPhasePending
+	}
+	if failedCondition(codewind) != nil {
+		return codewindv1alpha1.CodewindPhaseFailed
+	}
+	if codewind.Spec.Suspended {
+		for _, conditionType := range deploymentConditionTypes {
+			if !conditionReported(codewind, conditionType) {
+				continue
+			}
+			condition := getCodewindCondition(codewind, conditionType)
+			if condition == nil || condition.Reason != "Hibernated" {
+				return codewindv1alpha1.CodewindPhaseProvisioning
+			}
+		}
+		return codewindv1alpha1.CodewindPhaseHibernated
+	}
+	for _, conditionType := range codewindConditionTypes {
+		if !conditionReported(codewind, conditionType) {
+			continue
+		}
+		condition := getCodewindCondition(codewind, conditionType)
+		if condition == nil || condition.Status != corev1.ConditionTrue {
+			return codewindv1alpha1.CodewindPhaseProvisioning
+		}
+	}
+	return codewindv1alpha1.CodewindPhaseRunning
+}
@@ -0,0 +1,224 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package codewind
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/util"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// defaultUpgradeStepTimeout : how long a step of an upgrade may take before the upgrade is rolled back
+const defaultUpgradeStepTimeout = 10 * time.Minute
+
+// upgradeSteps : steps of an upgrade in the order they are rolled out
+var upgradeSteps = []codewindv1alpha1.CodewindUpgradeStep{
+	codewindv1alpha1.CodewindUpgradeStepKeycloak,
+	codewindv1alpha1.CodewindUpgradeStepPFE,
+	codewindv1alpha1.CodewindUpgradeStepPerformance,
+	codewindv1alpha1.CodewindUpgradeStepGatekeeper,
+}
+
+// upgradeStepTimeoutFromOperatorConfig : Step timeout of the upgradeStepTimeout key of the operator config map, on
+// error the default is returned with the error
+func upgradeStepTimeoutFromOperatorConfig(data map[string]string) (time.Duration, error) {
+	value := data["upgradeStepTimeout"]
+	if value == "" {
+		return defaultUpgradeStepTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return defaultUpgradeStepTimeout, fmt.Errorf("operator config map key upgradeStepTimeout must be a positive duration such as 10m, got %q", value)
+	}
+	return timeout, nil
+}
+
+// instanceVersion : Version of the catalog set on the CR, else the tag or digest of the PFE image
+func instanceVersion(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) string {
+	if codewind.Spec.Version != "" {
+		return codewind.Spec.Version
+	}
+	if deploymentOptions.PFEImage.Digest != "" {
+		return deploymentOptions.PFEImage.Digest
+	}
+	return codewindVersion(deploymentOptions)
+}
+
+// upgradeStepIndex : Position of a step in the upgrade order
+func upgradeStepIndex(step codewindv1alpha1.CodewindUpgradeStep) int {
+	for i, upgradeStep := range upgradeSteps {
+		if upgradeStep == step {
+			return i
+		}
+	}
+	return 0
+}
+
+// planUpgrade : Starts an upgrade when the instance version differs from the version last rolled out, and rolls it
+// back when the current step takes longer than stepTimeout. Components the upgrade has not reached yet, and all
+// components of a rolled back upgrade, keep the images of the previous version. Returns true when the reconcile
+// must stop after a change of the upgrade state was recorded
+func (r *ReconcileCodewind) planUpgrade(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, deploymentOptions *DeploymentOptionsCodewind, stepTimeout time.Duration) (reconcile.Result, bool) {
+	version := instanceVersion(codewind, *deploymentOptions)
+	upgrade := codewind.Status.Upgrade
+	if codewind.Status.Version == "" {
+		// A new instance, or one deployed before upgrades were tracked, has nothing to upgrade from
+		codewind.Status.Version = version
+		return reconcile.Result{}, false
+	}
+	if codewind.Status.Version == version {
+		if upgrade != nil {
+			// Changed back to the version that was running, the images are updated directly
+			codewind.Status.Upgrade = nil
+			setCodewindCondition(codewind, codewindv1alpha1.CodewindUpgraded, corev1.ConditionTrue, "UpToDate", "Running version "+version)
+		}
+		return reconcile.Result{}, false
+	}
+
+	if upgrade != nil && upgrade.RolledBack && upgrade.ToVersion != version {
+		// A different version is attempted after a rollback
+		upgrade = nil
+	}
+	if upgrade == nil {
+		reqLogger.Info("Upgrading the deployment", "Namespace", codewind.Namespace, "Name", codewind.Name, "FromVersion", codewind.Status.Version, "ToVersion", version)
+		r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonUpgradeStarted, "Upgrading from version %s to %s", codewind.Status.Version, version)
+		codewind.Status.Upgrade = &codewindv1alpha1.CodewindUpgradeStatus{
+			FromVersion:    codewind.Status.Version,
+			ToVersion:      version,
+			Step:           codewindv1alpha1.CodewindUpgradeStepKeycloak,
+			StepStartTime:  metav1.Now(),
+			PreviousImages: r.runningImages(codewind, *deploymentOptions),
+		}
+		// Configure the client again before any component rolls
+		codewind.Status.KeycloakStatus = defaults.ConstKeycloakConfigStarted
+		return r.upgradeProgressed(reqLogger, codewind, reconcile.Result{Requeue: true}), true
+	}
+	if upgrade.ToVersion != version {
+		// The version changed during the upgrade, start over from the first step with the new version
+		reqLogger.Info("Restarting the upgrade with a new version", "Namespace", codewind.Namespace, "Name", codewind.Name, "FromVersion", upgrade.FromVersion, "ToVersion", version)
+		upgrade.ToVersion = version
+		upgrade.Step = codewindv1alpha1.CodewindUpgradeStepKeycloak
+		upgrade.StepStartTime = metav1.Now()
+		codewind.Status.KeycloakStatus = defaults.ConstKeycloakConfigStarted
+		return r.upgradeProgressed(reqLogger, codewind, reconcile.Result{Requeue: true}), true
+	}
+	if !upgrade.RolledBack && time.Since(upgrade.StepStartTime.Time) > stepTimeout {
+		reqLogger.Info("Rolling back the upgrade", "Namespace", codewind.Namespace, "Name", codewind.Name, "Step", upgrade.Step, "FromVersion", upgrade.FromVersion, "ToVersion", upgrade.ToVersion)
+		r.recorder.Eventf(codewind, corev1.EventTypeWarning, defaults.EventReasonUpgradeRolledBack, "Step %s of the upgrade to version %s did not complete within %s, restoring version %s", upgrade.Step, upgrade.ToVersion, stepTimeout, upgrade.FromVersion)
+		upgrade.RolledBack = true
+		return r.upgradeProgressed(reqLogger, codewind, reconcile.Result{Requeue: true}), true
+	}
+
+	if previous := upgrade.PreviousImages; previous != nil {
+		current := upgradeStepIndex(upgrade.Step)
+		keepPrevious := func(step codewindv1alpha1.CodewindUpgradeStep) bool {
+			return upgrade.RolledBack || upgradeStepIndex(step) > current
+		}
+		if previous.PFE != nil && keepPrevious(codewindv1alpha1.CodewindUpgradeStepPFE) {
+			deploymentOptions.PFEImage = *previous.PFE
+		}
+		if previous.Performance != nil && keepPrevious(codewindv1alpha1.CodewindUpgradeStepPerformance) {
+			deploymentOptions.PerformanceImage = *previous.Performance
+		}
+		if previous.Gatekeeper != nil && keepPrevious(codewindv1alpha1.CodewindUpgradeStepGatekeeper) {
+			deploymentOptions.GatekeeperImage = *previous.Gatekeeper
+		}
+	}
+	return reconcile.Result{}, false
+}
+
+// waitForUpgradeStep : Moves the upgrade to the next step once the component of step has rolled out, a nil deployment
+// has nothing to wait for. Returns true when the reconcile must stop, to wait for the rollout or to select the images
+// of the next step
+func (r *ReconcileCodewind) waitForUpgradeStep(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, step codewindv1alpha1.CodewindUpgradeStep, deployment *appsv1.Deployment) (reconcile.Result, bool) {
+	upgrade := codewind.Status.Upgrade
+	if upgrade == nil || upgrade.RolledBack || upgrade.Step != step {
+		return reconcile.Result{}, false
+	}
+	if deployment != nil && !deploymentRolledOut(deployment) {
+		// The owned deployments are watched, the requeue only bounds the wait for the step timeout
+		return r.upgradeProgressed(reqLogger, codewind, reconcile.Result{RequeueAfter: time.Second * 10}), true
+	}
+	next := upgradeStepIndex(step) + 1
+	if next < len(upgradeSteps) {
+		upgrade.Step = upgradeSteps[next]
+		upgrade.StepStartTime = metav1.Now()
+		return r.upgradeProgressed(reqLogger, codewind, reconcile.Result{Requeue: true}), true
+	}
+	reqLogger.Info("Upgraded the deployment", "Namespace", codewind.Namespace, "Name", codewind.Name, "FromVersion", upgrade.FromVersion, "ToVersion", upgrade.ToVersion)
+	r.recorder.Eventf(codewind, corev1.EventTypeNormal, defaults.EventReasonUpgraded, "Upgraded from version %s to %s", upgrade.FromVersion, upgrade.ToVersion)
+	codewind.Status.Version = upgrade.ToVersion
+	codewind.Status.Upgrade = nil
+	setCodewindCondition(codewind, codewindv1alpha1.CodewindUpgraded, corev1.ConditionTrue, "Upgraded", fmt.Sprintf("Upgraded from version %s to %s", upgrade.FromVersion, upgrade.ToVersion))
+	return r.upgradeProgressed(reqLogger, codewind, reconcile.Result{Requeue: true}), true
+}
+
+// upgradeProgressed : Records the state of the upgrade in the Upgraded condition and the status
+func (r *ReconcileCodewind) upgradeProgressed(reqLogger logr.Logger, codewind *codewindv1alpha1.Codewind, result reconcile.Result) reconcile.Result {
+	if upgrade := codewind.Status.Upgrade; upgrade != nil {
+		if upgrade.RolledBack {
+			setCodewindCondition(codewind, codewindv1alpha1.CodewindUpgraded, corev1.ConditionFalse, "RolledBack",
+				fmt.Sprintf("Step %s of the upgrade from version %s to %s did not complete, version %s was restored", upgrade.Step, upgrade.FromVersion, upgrade.ToVersion, upgrade.FromVersion))
+		} else {
+			setCodewindCondition(codewind, codewindv1alpha1.CodewindUpgraded, corev1.ConditionFalse, "Upgrading",
+				fmt.Sprintf("Upgrading from version %s to %s, rolling out %s", upgrade.FromVersion, upgrade.ToVersion, upgrade.Step))
+		}
+	}
+	phaseChange := updateCodewindPhase(codewind)
+	if err := r.client.Status().Update(context.TODO(), codewind); err != nil {
+		reqLogger.Error(err, "Failed to update Codewind status", "Namespace", codewind.Namespace, "Name", codewind.Name)
+	} else {
+		notifyCodewindPhase(phaseChange)
+	}
+	return result
+}
+
+// runningImages : Images of the existing PFE, performance and gatekeeper deployments, missing deployments are left out
+func (r *ReconcileCodewind) runningImages(codewind *codewindv1alpha1.Codewind, deploymentOptions DeploymentOptionsCodewind) *codewindv1alpha1.CodewindImagesSpec {
+	runningImage := func(name string) *codewindv1alpha1.ImageSpec {
+		deployment := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: codewind.Namespace}, deployment)
+		if err != nil || len(deployment.Spec.Template.Spec.Containers) == 0 {
+			return nil
+		}
+		image := util.ParseImageReference(deployment.Spec.Template.Spec.Containers[0].Image)
+		return &image
+	}
+	return &codewindv1alpha1.CodewindImagesSpec{
+		PFE:         runningImage(deploymentOptions.CodewindPFEDeploymentName),
+		Performance: runningImage(deploymentOptions.CodewindPerformanceDeploymentName),
+		Gatekeeper:  runningImage(deploymentOptions.CodewindGatekeeperDeploymentName),
+	}
+}
+
+// deploymentRolledOut : Every replica of the deployment runs the current pod template and is available
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas &&
+		deployment.Status.Replicas == replicas
+}
@@ -56,18 +56,57 @@ const (
 	// CodewindAuthRealm : Codewind security realm within Keycloak
 	CodewindAuthRealm = "codewind"
 
+	// CodewindLogLevel : Log level of the Codewind pods when the CR does not set one
+	CodewindLogLevel = "info"
+
 	// PFEContainerPort is the port at which Codewind PFE is exposed
 	PFEContainerPort = 9191
 
 	// PerformanceContainerPort is the port at which the Performance dashboard is exposed
 	PerformanceContainerPort = 9095
 
+	// PerformanceDashboardPath is the path of the Performance dashboard behind the gatekeeper
+	PerformanceDashboardPath = "/performance/charts"
+
 	// KeycloakContainerPort is the port at which Keycloak is exposed
 	KeycloakContainerPort = 8080
 
+	// KeycloakJGroupsPort is the port at which Keycloak replicas form a cluster
+	KeycloakJGroupsPort = 7600
+
+	// KeycloakDatabasePort is the port of an external Keycloak database when the CR does not set one
+	KeycloakDatabasePort = 5432
+
+	// KeycloakDatabaseName is the name of an external Keycloak database when the CR does not set one
+	KeycloakDatabaseName = "keycloak"
+
 	// GatekeeperContainerPort is the port at which the Gatekeeper is exposed
 	GatekeeperContainerPort = 9096
 
+	// TrustedCABundlePath : directory the trusted CA bundle of a Codewind CR is mounted at
+	TrustedCABundlePath = "/etc/codewind/trusted-ca"
+
+	// TrustedCABundleFile : file name of the trusted CA bundle in its directory
+	TrustedCABundleFile = "ca-bundle.crt"
+
+	// GitCredentialsPath : directory the git credentials of a Codewind CR are mounted at in the PFE container
+	GitCredentialsPath = "/etc/codewind/git"
+
+	// GitSystemConfigPath : system config file of git, replaced by the config of the git credentials
+	GitSystemConfigPath = "/etc/gitconfig"
+
+	// BuildRegistryConfigPath : directory the docker config of the build registry is mounted at in the PFE container
+	BuildRegistryConfigPath = "/etc/codewind/registry"
+
+	// CodewindSharedHostPrefix : first label of the host shared by the instances published under a path
+	CodewindSharedHostPrefix = "codewind"
+
+	// CodewindPathPrefix : path of the shared host the instances are published under, followed by the workspaceID
+	CodewindPathPrefix = "/codewind"
+
+	// CodewindInstanceRoleNamePrefix : role of an instance, will include the workspaceID when deployed
+	CodewindInstanceRoleNamePrefix = "codewind-role"
+
 	// CodewindRoleBindingNamePrefix will include the workspaceID when deployed
 	CodewindRoleBindingNamePrefix = "codewind-rolebinding"
 
@@ -94,6 +133,99 @@ const (
 	// ConstKeycloakConfigReady : Keycloak config completed
 	ConstKeycloakConfigReady = "Complete"
 
+	// ConstKeycloakConfigFailed : Keycloak config failed and will be retried
+	ConstKeycloakConfigFailed = "Failed"
+
+	// ConstKeycloakCleanupFailed : Removing the deployment from Keycloak failed and will be retried
+	ConstKeycloakCleanupFailed = "CleanupFailed"
+
+	// EventReasonCreated : Event reason, a resource of the CR was created
+	EventReasonCreated = "Created"
+
+	// EventReasonDeleted : Event reason, a resource of the CR was deleted
+	EventReasonDeleted = "Deleted"
+
+	// EventReasonCreateFailed : Event reason, a resource of the CR could not be created
+	EventReasonCreateFailed = "CreateFailed"
+
+	// EventReasonCertificateGenerated : Event reason, a self-signed certificate was generated
+	EventReasonCertificateGenerated = "CertificateGenerated"
+
+	// EventReasonRealmConfigured : Event reason, the Keycloak realm was configured
+	EventReasonRealmConfigured = "RealmConfigured"
+
+	// EventReasonKeycloakConfigured : Event reason, the client of a Codewind instance was configured in Keycloak
+	EventReasonKeycloakConfigured = "KeycloakConfigured"
+
+	// EventReasonClientSecretFetched : Event reason, the gatekeeper client secret was read from Keycloak
+	EventReasonClientSecretFetched = "ClientSecretFetched"
+
+	// EventReasonRemoteAccessTokenIssued : Event reason, an offline token of the machine user was published for IDE remote connections
+	EventReasonRemoteAccessTokenIssued = "RemoteAccessTokenIssued"
+
+	// EventReasonUnknownVersion : Event reason, the version of the CR is not in the version catalog
+	EventReasonUnknownVersion = "UnknownVersion"
+
+	// EventReasonUnsupportedArchitecture : Event reason, the version of the CR has no images for its architecture
+	EventReasonUnsupportedArchitecture = "UnsupportedArchitecture"
+
+	// EventReasonUpgradeStarted : Event reason, a change of the instance version started rolling out
+	EventReasonUpgradeStarted = "UpgradeStarted"
+
+	// EventReasonUpgraded : Event reason, every component rolled out the new instance version
+	EventReasonUpgraded = "Upgraded"
+
+	// EventReasonUpgradeRolledBack : Event reason, an upgrade step timed out and the previous images were restored
+	EventReasonUpgradeRolledBack = "UpgradeRolledBack"
+
+	// EventReasonRouteTLSInvalid : Event reason, the route certificate or termination of the CR cannot be used
+	EventReasonRouteTLSInvalid = "RouteTLSInvalid"
+
+	// EventReasonTLSSecretInvalid : Event reason, the TLS secret named by the CR is missing or incomplete
+	EventReasonTLSSecretInvalid = "TLSSecretInvalid"
+
+	// EventReasonGitCredentialsInvalid : Event reason, the git credentials secret named by the CR is missing or incomplete
+	EventReasonGitCredentialsInvalid = "GitCredentialsInvalid"
+
+	// EventReasonSessionSecretInvalid : Event reason, the session secret referenced by the CR is missing or lacks its key
+	EventReasonSessionSecretInvalid = "SessionSecretInvalid"
+
+	// EventReasonBuildRegistryInvalid : Event reason, the push secret of the build registry is missing or not a docker config
+	EventReasonBuildRegistryInvalid = "BuildRegistryInvalid"
+
+	// EventReasonIdleWarning : Event reason, the idle instance will soon be hibernated or deleted
+	EventReasonIdleWarning = "IdleWarning"
+
+	// EventReasonIdleTimeout : Event reason, the instance was idle for longer than its TTL and is hibernated or deleted
+	EventReasonIdleTimeout = "IdleTimeout"
+
+	// EventReasonQuotaExceeded : Event reason, the instance is not provisioned because of the instance quota
+	EventReasonQuotaExceeded = "QuotaExceeded"
+
+	// EventReasonAdopted : Event reason, a resource of an existing deployment was adopted by the Codewind CR
+	EventReasonAdopted = "Adopted"
+
+	// EventReasonAdoptionFailed : Event reason, a resource of an existing deployment is controlled by another owner
+	EventReasonAdoptionFailed = "AdoptionFailed"
+
+	// EventReasonKeycloakDriftRepaired : Event reason, Keycloak configuration changed outside the operator was restored
+	EventReasonKeycloakDriftRepaired = "KeycloakDriftRepaired"
+
+	// EventReasonRealmBackedUp : Event reason, the Keycloak realm was exported
+	EventReasonRealmBackedUp = "RealmBackedUp"
+
+	// EventReasonRealmRestored : Event reason, the Keycloak realm was created from an export
+	EventReasonRealmRestored = "RealmRestored"
+
+	// EventReasonRealmRestoreFailed : Event reason, the export the Keycloak realm is restored from cannot be read
+	EventReasonRealmRestoreFailed = "RealmRestoreFailed"
+
+	// EventReasonSnapshotCreated : Event reason, a VolumeSnapshot of the workspace volume was requested
+	EventReasonSnapshotCreated = "SnapshotCreated"
+
+	// EventReasonSnapshotFailed : Event reason, a scheduled snapshot of the workspace volume could not be taken
+	EventReasonSnapshotFailed = "SnapshotFailed"
+
 	// ROKSStorageClass references the storage class to use on ROKS
 	ROKSStorageClass = "ibmc-file-bronze"
 
@@ -108,4 +240,20 @@ const (
 
 	// CodewindFinalizerName : Codewind Cluster role binding finalizer
 	CodewindFinalizerName = "crb.finalizer.codewind.eclipse"
+
+	// CodewindKeycloakFinalizerName : Codewind Keycloak client and access role finalizer
+	CodewindKeycloakFinalizerName = "keycloak.finalizer.codewind.eclipse"
+
+	// KeycloakBackupAnnotation : Set to "true" on a Keycloak CR to export its realm now
+	KeycloakBackupAnnotation = "codewind.eclipse.org/backup"
+
+	// RotateClientSecretAnnotation : Set to "true" on a Codewind CR to replace the client secret of its gatekeeper
+	RotateClientSecretAnnotation = "codewind.eclipse.org/rotate-client-secret"
+
+	// GatekeeperClientSecretHashAnnotation : Gatekeeper pod template annotation holding a digest of the client secret
+	// its pods were started with, changing it rolls the pods
+	GatekeeperClientSecretHashAnnotation = "codewind.eclipse.org/client-secret-hash"
+
+	// LastActivityAnnotation : RFC 3339 time of the last use of a Codewind instance, set by IDEs or scripts
+	LastActivityAnnotation = "codewind.eclipse.org/last-activity"
 )
@@ -0,0 +1,269 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package keycloak
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// realmExportKey : key of the latest export in the realm export config map or secret
+const realmExportKey = "realm.json"
+
+// backupRequested : true when the Keycloak CR carries the backup annotation
+func backupRequested(keycloak *codewindv1alpha1.Keycloak) bool {
+	return keycloak.GetAnnotations()[defaults.KeycloakBackupAnnotation] == "true"
+}
+
+// backupInterval : time between two scheduled exports of the realm, zero when the realm is only exported on request.
+// The interval is checked by the webhook
+func backupInterval(keycloak *codewindv1alpha1.Keycloak) time.Duration {
+	if keycloak.Spec.Backup == nil || keycloak.Spec.Backup.Interval == "" {
+		return 0
+	}
+	interval, err := time.ParseDuration(keycloak.Spec.Backup.Interval)
+	if err != nil {
+		return 0
+	}
+	return interval
+}
+
+// nextBackup : time left until the next scheduled export, zero when it is due. Returns false when no export is
+// scheduled
+func nextBackup(keycloak *codewindv1alpha1.Keycloak, now time.Time) (time.Duration, bool) {
+	interval := backupInterval(keycloak)
+	if interval == 0 {
+		return 0, false
+	}
+	if keycloak.Status.LastBackupTime == nil {
+		return 0, true
+	}
+	remaining := keycloak.Status.LastBackupTime.Add(interval).Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// backupKeycloakRealm : Exports the default realm into the realm export config map, or the secret of the backup
+// spec, in the Keycloak namespace. The latest export is kept under realm.json and the previous ones under the time
+// they were taken, up to the retained number. Clears the backup annotation so another backup can be requested.
+func (r *ReconcileKeycloak) backupKeycloakRealm(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	secretUser := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when exporting realm", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return err
+	}
+
+	realmExport, err := security.ExportCodewindRealm(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, retryPolicy)
+	if err != nil {
+		reqLogger.Error(err, "Failed exporting Keycloak realm", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm)
+		r.recorder.Event(keycloak, corev1.EventTypeWarning, security.ConfigFailureReason(err), "Failed exporting realm "+keycloak.Status.DefaultRealm+": "+err.Error())
+		return err
+	}
+
+	retain := 1
+	if keycloak.Spec.Backup != nil && keycloak.Spec.Backup.Retain > 1 {
+		retain = int(keycloak.Spec.Backup.Retain)
+	}
+	exportTime := time.Now().UTC()
+	var exportName string
+	if keycloak.Spec.Backup != nil && keycloak.Spec.Backup.SecretName != "" {
+		exportName = keycloak.Spec.Backup.SecretName
+		err = r.saveRealmExportSecret(reqLogger, keycloak, exportName, realmExport, exportTime, retain)
+	} else {
+		exportName = deploymentOptions.KeycloakRealmExportName
+		err = r.saveRealmExportConfigMap(reqLogger, keycloak, exportName, realmExport, exportTime, retain)
+	}
+	if err != nil {
+		return err
+	}
+	r.recorder.Event(keycloak, corev1.EventTypeNormal, defaults.EventReasonRealmBackedUp, "Realm "+keycloak.Status.DefaultRealm+" exported to "+exportName)
+
+	keycloak.Status.LastBackupTime = &metav1.Time{Time: exportTime}
+	err = r.client.Status().Update(context.TODO(), keycloak)
+	if err != nil {
+		return err
+	}
+	if !backupRequested(keycloak) {
+		return nil
+	}
+
+	// Clear the request so that setting the annotation again triggers a new export
+	annotations := keycloak.GetAnnotations()
+	delete(annotations, defaults.KeycloakBackupAnnotation)
+	keycloak.SetAnnotations(annotations)
+	return r.client.Update(context.TODO(), keycloak)
+}
+
+// realmExportMeta : labels and annotations of a realm export. The export is not owned by the Keycloak CR so that it
+// survives the deletion of the Keycloak instance
+func realmExportMeta(keycloak *codewindv1alpha1.Keycloak, name string, exportTime time.Time) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: keycloak.Namespace,
+		Labels:    labelsForKeycloak(keycloak),
+		Annotations: map[string]string{
+			"realm":      keycloak.Status.DefaultRealm,
+			"exportTime": exportTime.Format(time.RFC3339),
+		},
+	}
+}
+
+// saveRealmExportConfigMap : Creates or updates the config map holding the realm exports
+func (r *ReconcileKeycloak) saveRealmExportConfigMap(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, name string, realmExport []byte, exportTime time.Time, retain int) error {
+	exportConfigMap := &corev1.ConfigMap{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: keycloak.Namespace}, exportConfigMap)
+	if err != nil && !k8serr.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to get realm export", "Namespace", keycloak.Namespace, "Name", name)
+		return err
+	}
+	found := err == nil
+	exports := map[string][]byte{}
+	for key, value := range exportConfigMap.Data {
+		exports[key] = []byte(value)
+	}
+	exports = rotateRealmExports(exports, exportConfigMap.Annotations["exportTime"], realmExport, retain)
+	exportConfigMap.ObjectMeta = mergeRealmExportMeta(exportConfigMap.ObjectMeta, realmExportMeta(keycloak, name, exportTime))
+	exportConfigMap.Data = map[string]string{}
+	for key, value := range exports {
+		exportConfigMap.Data[key] = string(value)
+	}
+	if !found {
+		reqLogger.Info("Creating realm export", "Namespace", exportConfigMap.Namespace, "Name", exportConfigMap.Name)
+		err = r.client.Create(context.TODO(), exportConfigMap)
+	} else {
+		reqLogger.Info("Updating realm export", "Namespace", exportConfigMap.Namespace, "Name", exportConfigMap.Name)
+		err = r.client.Update(context.TODO(), exportConfigMap)
+	}
+	if err != nil {
+		reqLogger.Error(err, "Failed to save realm export", "Namespace", exportConfigMap.Namespace, "Name", exportConfigMap.Name)
+		return err
+	}
+	return nil
+}
+
+// saveRealmExportSecret : Creates or updates the secret holding the realm exports
+func (r *ReconcileKeycloak) saveRealmExportSecret(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, name string, realmExport []byte, exportTime time.Time, retain int) error {
+	exportSecret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: keycloak.Namespace}, exportSecret)
+	if err != nil && !k8serr.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to get realm export", "Namespace", keycloak.Namespace, "Name", name)
+		return err
+	}
+	found := err == nil
+	exportSecret.Data = rotateRealmExports(exportSecret.Data, exportSecret.Annotations["exportTime"], realmExport, retain)
+	exportSecret.ObjectMeta = mergeRealmExportMeta(exportSecret.ObjectMeta, realmExportMeta(keycloak, name, exportTime))
+	if !found {
+		exportSecret.Type = corev1.SecretTypeOpaque
+		reqLogger.Info("Creating realm export", "Namespace", exportSecret.Namespace, "Name", exportSecret.Name)
+		err = r.client.Create(context.TODO(), exportSecret)
+	} else {
+		reqLogger.Info("Updating realm export", "Namespace", exportSecret.Namespace, "Name", exportSecret.Name)
+		err = r.client.Update(context.TODO(), exportSecret)
+	}
+	if err != nil {
+		reqLogger.Error(err, "Failed to save realm export", "Namespace", exportSecret.Namespace, "Name", exportSecret.Name)
+		return err
+	}
+	return nil
+}
+
+// mergeRealmExportMeta : sets the name, labels and annotations of a realm export on the metadata of the existing
+// object, keeping its resource version
+func mergeRealmExportMeta(existing metav1.ObjectMeta, desired metav1.ObjectMeta) metav1.ObjectMeta {
+	existing.Name = desired.Name
+	existing.Namespace = desired.Namespace
+	existing.Labels = desired.Labels
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	for key, value := range desired.Annotations {
+		existing.Annotations[key] = value
+	}
+	return existing
+}
+
+// rotateRealmExports : stores the new export under realm.json, moves the previous one under the time it was taken,
+// eg realm-20200601T120000Z.json, and drops the oldest exports beyond the retained number
+func rotateRealmExports(exports map[string][]byte, previousExportTime string, realmExport []byte, retain int) map[string][]byte {
+	if exports == nil {
+		exports = map[string][]byte{}
+	}
+	if previous, ok := exports[realmExportKey]; ok && retain > 1 {
+		taken, err := time.Parse(time.RFC3339, previousExportTime)
+		if err != nil {
+			taken = time.Now().UTC()
+		}
+		exports[fmt.Sprintf("realm-%s.json", taken.UTC().Format("20060102T150405Z"))] = previous
+	}
+	exports[realmExportKey] = realmExport
+
+	// The time stamps sort in the order the exports were taken
+	previousKeys := []string{}
+	for key := range exports {
+		if key != realmExportKey && strings.HasPrefix(key, "realm-") && strings.HasSuffix(key, ".json") {
+			previousKeys = append(previousKeys, key)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(previousKeys)))
+	for i, key := range previousKeys {
+		if i >= retain-1 {
+			delete(exports, key)
+		}
+	}
+	return exports
+}
+
+// realmRestoreExport : Reads the realm export named by the restoreFrom of the backup spec
+func (r *ReconcileKeycloak) realmRestoreExport(keycloak *codewindv1alpha1.Keycloak) ([]byte, error) {
+	restore := keycloak.Spec.Backup.RestoreFrom
+	key := restore.Key
+	if key == "" {
+		key = realmExportKey
+	}
+	var realmExport []byte
+	if restore.SecretName != "" {
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: restore.SecretName, Namespace: keycloak.Namespace}, secret)
+		if err != nil {
+			return nil, fmt.Errorf("realm export secret %s cannot be read: %v", restore.SecretName, err)
+		}
+		realmExport = secret.Data[key]
+	} else {
+		configMap := &corev1.ConfigMap{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: restore.ConfigMapName, Namespace: keycloak.Namespace}, configMap)
+		if err != nil {
+			return nil, fmt.Errorf("realm export config map %s cannot be read: %v", restore.ConfigMapName, err)
+		}
+		realmExport = []byte(configMap.Data[key])
+	}
+	if len(realmExport) == 0 {
+		return nil, fmt.Errorf("realm export has no key %s", key)
+	}
+	return realmExport, nil
+}
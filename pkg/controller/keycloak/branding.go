@@ -0,0 +1,68 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package keycloak
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"html"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reconcileBranding : Applies the login theme and branding of the spec to the realm, setting them back when they were
+// changed in the admin console. The result is recorded in the BrandingReady condition. Returns ErrKeycloakNotReady
+// while Keycloak starts
+func (r *ReconcileKeycloak) reconcileBranding(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	if keycloak.Spec.Branding == nil {
+		removeKeycloakCondition(keycloak, codewindv1alpha1.KeycloakBrandingReady)
+		return nil
+	}
+
+	secretUser := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when applying the branding", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return err
+	}
+	err = security.ConfigureRealmSettings(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, retryPolicy, realmBranding(keycloak.Spec.Branding))
+	if err != nil {
+		if !errors.Is(err, security.ErrKeycloakNotReady) {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakBrandingReady, corev1.ConditionFalse, security.ConfigFailureReason(err), err.Error())
+		}
+		return err
+	}
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakBrandingReady, corev1.ConditionTrue, "Applied", "The branding of the spec is applied to the realm")
+	return nil
+}
+
+// realmBranding : branding of the spec, with the logo placed in front of the display name HTML
+func realmBranding(branding *codewindv1alpha1.KeycloakBrandingSpec) security.RealmBranding {
+	displayNameHTML := branding.DisplayNameHTML
+	if branding.LogoURL != "" {
+		alt := branding.DisplayName
+		if alt == "" {
+			alt = "logo"
+		}
+		displayNameHTML = "<img src=\"" + html.EscapeString(branding.LogoURL) + "\" alt=\"" + html.EscapeString(alt) + "\"/>" + displayNameHTML
+	}
+	return security.RealmBranding{
+		LoginTheme:      branding.LoginTheme,
+		DisplayName:     branding.DisplayName,
+		DisplayNameHTML: displayNameHTML,
+	}
+}
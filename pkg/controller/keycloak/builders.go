@@ -12,6 +12,8 @@
 package keycloak
 
 import (
+	"strconv"
+
 	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
 	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
 	"github.com/eclipse/codewind-operator/pkg/util"
@@ -19,8 +21,10 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -48,7 +52,7 @@ func (r *ReconcileKeycloak) serviceAccountForKeycloak(keycloak *codewindv1alpha1
 }
 
 // pvcForKeycloak function takes in a Keycloak object and returns a PVC for that object.
-func (r *ReconcileKeycloak) pvcForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, storageClassName string, storageKeycloakSize string) *corev1.PersistentVolumeClaim {
+func (r *ReconcileKeycloak) pvcForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, storageClassName string, storageKeycloakSize resource.Quantity) *corev1.PersistentVolumeClaim {
 	ls := labelsForKeycloak(keycloak)
 
 	pvc := &corev1.PersistentVolumeClaim{
@@ -67,7 +71,7 @@ func (r *ReconcileKeycloak) pvcForKeycloak(keycloak *codewindv1alpha1.Keycloak,
 			},
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(storageKeycloakSize),
+					corev1.ResourceStorage: storageKeycloakSize,
 				},
 			},
 		},
@@ -131,6 +135,15 @@ func (r *ReconcileKeycloak) secretsTLSForKeycloak(keycloak *codewindv1alpha1.Key
 	return secret
 }
 
+// certificateForKeycloak : builds a cert-manager Certificate for the Keycloak ingress host, stored in the Keycloak TLS secret
+func (r *ReconcileKeycloak) certificateForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) *unstructured.Unstructured {
+	certificate := util.NewCertManagerCertificate(deploymentOptions.KeycloakCertificateName, keycloak.Namespace, labelsForKeycloak(keycloak),
+		deploymentOptions.KeycloakTLSSecretsName, []string{deploymentOptions.KeycloakIngressHost}, keycloak.Spec.TLS.CertManager.IssuerRef)
+	// Set Keycloak instance as the owner of the certificate.
+	controllerutil.SetControllerReference(keycloak, certificate, r.scheme)
+	return certificate
+}
+
 // serviceForKeycloak function takes in a Keycloak object and returns a Service for that object.
 func (r *ReconcileKeycloak) serviceForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) *corev1.Service {
 	ls := labelsForKeycloak(keycloak)
@@ -155,10 +168,37 @@ func (r *ReconcileKeycloak) serviceForKeycloak(keycloak *codewindv1alpha1.Keyclo
 	return service
 }
 
+// headlessServiceForKeycloak returns the Service through which Keycloak replicas discover each other.
+// Pods are published before they are ready so that a starting replica can join the cluster
+func (r *ReconcileKeycloak) headlessServiceForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) *corev1.Service {
+	ls := labelsForKeycloak(keycloak)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentOptions.KeycloakHeadlessName,
+			Namespace: keycloak.Namespace,
+			Labels:    ls,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector:                 ls,
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{
+					Port: int32(defaults.KeycloakJGroupsPort),
+					Name: defaults.PrefixCodewindKeycloak + "-jgroups",
+				},
+			},
+		},
+	}
+	// Set Keycloak instance as the owner of the service.
+	controllerutil.SetControllerReference(keycloak, service, r.scheme)
+	return service
+}
+
 // deploymentForKeycloak returns a Keycloak object
 func (r *ReconcileKeycloak) deploymentForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) *appsv1.Deployment {
 	ls := labelsForKeycloak(keycloak)
-	replicas := int32(1)
+	replicas := keycloakReplicas(keycloak)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -173,31 +213,36 @@ func (r *ReconcileKeycloak) deploymentForKeycloak(keycloak *codewindv1alpha1.Key
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
+					Labels:      ls,
+					Annotations: util.PodSecurityAnnotations(deploymentOptions.PodSecurity),
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: deploymentOptions.KeycloakServiceAccountName,
+					NodeSelector:       keycloak.Spec.NodeSelector,
+					Tolerations:        keycloak.Spec.Tolerations,
+					Affinity:           util.ArchitectureAffinity(keycloak.Spec.Affinity, deploymentOptions.KeycloakArchitectures),
+					PriorityClassName:  keycloak.Spec.PriorityClassName,
+					ImagePullSecrets:   deploymentOptions.ImagePullSecrets,
+					SecurityContext:    util.PodSecurityContext(deploymentOptions.PodSecurity),
 					Volumes: []corev1.Volume{
 						{
-							Name: "keycloak-data",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: deploymentOptions.KeycloakPVCName,
-								},
-							},
+							Name:         "keycloak-data",
+							VolumeSource: keycloakDataVolumeSource(keycloak, deploymentOptions),
 						},
 					},
 					Containers: []corev1.Container{{
 						Name:            defaults.PrefixCodewindKeycloak,
-						Image:           defaults.KeycloakImage + ":" + defaults.KeycloakImageTag,
+						Image:           util.ImageReference(deploymentOptions.KeycloakImage),
 						ImagePullPolicy: corev1.PullAlways,
+						Resources:       deploymentOptions.KeycloakResources,
+						SecurityContext: util.ContainerSecurityContext(deploymentOptions.PodSecurity),
 						VolumeMounts: []corev1.VolumeMount{
 							{
 								Name:      "keycloak-data",
 								MountPath: "/opt/jboss/keycloak/standalone/data",
 							},
 						},
-						Env: []corev1.EnvVar{
+						Env: append([]corev1.EnvVar{
 							{
 								Name: "KEYCLOAK_USER",
 								ValueFrom: &corev1.EnvVarSource{
@@ -212,19 +257,15 @@ func (r *ReconcileKeycloak) deploymentForKeycloak(keycloak *codewindv1alpha1.Key
 								Name:  "PROXY_ADDRESS_FORWARDING",
 								Value: "true",
 							},
-							{
-								Name:  "DB_VENDOR",
-								Value: "h2",
-							},
-						},
-						Ports: []corev1.ContainerPort{
-							{ContainerPort: int32(defaults.KeycloakContainerPort)},
-						},
+						}, append(keycloakDatabaseEnv(keycloak), keycloakClusterEnv(keycloak, deploymentOptions)...)...),
+						Ports: keycloakContainerPorts(keycloak),
 					}},
 				},
 			},
 		},
 	}
+	util.SetContainerProbes(&dep.Spec.Template.Spec.Containers[0], defaults.KeycloakContainerPort, keycloakProbeTimings, keycloakProbes(keycloak))
+	util.SetDeploymentProbesHash(dep)
 	// Set Keycloak instance as the owner of the deployment.
 	controllerutil.SetControllerReference(keycloak, dep, r.scheme)
 	return dep
@@ -282,6 +323,7 @@ func (r *ReconcileKeycloak) ingressForKeycloak(keycloak *codewindv1alpha1.Keyclo
 		"nginx.ingress.kubernetes.io/force-ssl-redirect": "true",
 		"kubernetes.io/ingress.class":                    "nginx",
 	}
+	annotations = util.IngressAnnotations(annotations, deploymentOptions.Ingress)
 	ingress := &extv1beta1.Ingress{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "extensions/v1beta1",
@@ -326,6 +368,137 @@ func (r *ReconcileKeycloak) ingressForKeycloak(keycloak *codewindv1alpha1.Keyclo
 	return ingress
 }
 
+// keycloakDataVolumeSource returns the PVC of the embedded database, an external database only needs scratch space
+func keycloakDataVolumeSource(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) corev1.VolumeSource {
+	if keycloak.Spec.Database != nil {
+		return corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	}
+	return corev1.VolumeSource{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: deploymentOptions.KeycloakPVCName,
+		},
+	}
+}
+
+// keycloakDatabaseEnv returns the environment selecting the embedded H2 database, or the external PostgreSQL
+// database of the Keycloak CR with its credentials read from a secret
+func keycloakDatabaseEnv(keycloak *codewindv1alpha1.Keycloak) []corev1.EnvVar {
+	database := keycloak.Spec.Database
+	if database == nil {
+		return []corev1.EnvVar{{Name: "DB_VENDOR", Value: "h2"}}
+	}
+	port := database.Port
+	if port == 0 {
+		port = defaults.KeycloakDatabasePort
+	}
+	name := database.Database
+	if name == "" {
+		name = defaults.KeycloakDatabaseName
+	}
+	credentials := corev1.LocalObjectReference{Name: database.CredentialsSecret}
+	return []corev1.EnvVar{
+		{Name: "DB_VENDOR", Value: "postgres"},
+		{Name: "DB_ADDR", Value: database.Host},
+		{Name: "DB_PORT", Value: strconv.Itoa(int(port))},
+		{Name: "DB_DATABASE", Value: name},
+		{
+			Name: "DB_USER",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: credentials, Key: "username"}},
+		},
+		{
+			Name: "DB_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: credentials, Key: "password"}},
+		},
+	}
+}
+
+// keycloakReplicas returns the number of Keycloak pods requested by the CR, 1 by default
+func keycloakReplicas(keycloak *codewindv1alpha1.Keycloak) int32 {
+	if keycloak.Spec.Replicas != nil && *keycloak.Spec.Replicas > 0 {
+		return *keycloak.Spec.Replicas
+	}
+	return 1
+}
+
+// keycloakClusterEnv returns the environment that forms a cluster of the Keycloak replicas, discovered with
+// DNS queries on the headless service. Sessions are kept on two replicas so that one can restart
+func keycloakClusterEnv(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) []corev1.EnvVar {
+	if keycloakReplicas(keycloak) < 2 {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{Name: "JGROUPS_DISCOVERY_PROTOCOL", Value: "dns.DNS_PING"},
+		{Name: "JGROUPS_DISCOVERY_PROPERTIES", Value: "dns_query=" + deploymentOptions.KeycloakHeadlessName + "." + keycloak.Namespace + ".svc.cluster.local"},
+		{Name: "CACHE_OWNERS_COUNT", Value: "2"},
+		{Name: "CACHE_OWNERS_AUTH_SESSIONS_COUNT", Value: "2"},
+	}
+}
+
+// keycloakProbeTimings : Keycloak imports its realms and migrates its database before it listens, which takes minutes
+// on a first start. The liveness probe waits long enough on clusters that drop startup probes
+var keycloakProbeTimings = util.ProbeTimings{
+	Startup:   corev1.Probe{PeriodSeconds: 10, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 60},
+	Liveness:  corev1.Probe{InitialDelaySeconds: 120, PeriodSeconds: 30, TimeoutSeconds: 10, SuccessThreshold: 1, FailureThreshold: 5},
+	Readiness: corev1.Probe{InitialDelaySeconds: 20, PeriodSeconds: 10, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3},
+}
+
+// keycloakProbes : probe timings of the Keycloak container set on the CR
+func keycloakProbes(keycloak *codewindv1alpha1.Keycloak) *codewindv1alpha1.ProbesSpec {
+	if keycloak.Spec.Probes == nil {
+		return nil
+	}
+	return keycloak.Spec.Probes.Keycloak
+}
+
+// keycloakContainerPorts returns the HTTP port of Keycloak, and the JGroups port when replicas form a cluster
+func keycloakContainerPorts(keycloak *codewindv1alpha1.Keycloak) []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{
+		{ContainerPort: int32(defaults.KeycloakContainerPort)},
+	}
+	if keycloakReplicas(keycloak) > 1 {
+		ports = append(ports, corev1.ContainerPort{Name: "jgroups", ContainerPort: int32(defaults.KeycloakJGroupsPort)})
+	}
+	return ports
+}
+
+// networkPolicyForKeycloak returns the NetworkPolicy admitting any source to the HTTP port, which the Codewind
+// components, the operator and browsers reach through the ingress, and the other replicas to the JGroups port
+func (r *ReconcileKeycloak) networkPolicyForKeycloak(keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak) *networkingv1.NetworkPolicy {
+	ls := labelsForKeycloak(keycloak)
+	rules := []networkingv1.NetworkPolicyIngressRule{{
+		Ports: util.NetworkPolicyPorts(defaults.KeycloakContainerPort),
+	}}
+	if keycloakReplicas(keycloak) > 1 {
+		rules = append(rules, networkingv1.NetworkPolicyIngressRule{
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: ls}}},
+			Ports: util.NetworkPolicyPorts(defaults.KeycloakJGroupsPort),
+		})
+	}
+	networkPolicy := util.NewIngressNetworkPolicy(deploymentOptions.KeycloakDeploymentName, keycloak.Namespace, ls, ls, rules)
+	// Set Keycloak instance as the owner of the NetworkPolicy.
+	controllerutil.SetControllerReference(keycloak, networkPolicy, r.scheme)
+	return networkPolicy
+}
+
+// imageForKeycloak returns the image of the Keycloak container, the images, catalog version and image tag set
+// on the Keycloak CR override the operator default
+func imageForKeycloak(keycloak *codewindv1alpha1.Keycloak, image codewindv1alpha1.ImageSpec, versionTag string) codewindv1alpha1.ImageSpec {
+	switch {
+	case versionTag != "":
+		image.Tag = versionTag
+		image.Digest = ""
+	case keycloak.Spec.ImageTag != "":
+		image.Tag = keycloak.Spec.ImageTag
+		image.Digest = ""
+	}
+	if keycloak.Spec.Images == nil {
+		return image
+	}
+	return util.SelectImage(keycloak.Spec.Images.Keycloak, image)
+}
+
 // labelsForKeycloak returns the labels for selecting the resources
 // belonging to the given keycloak CR name.
 func labelsForKeycloak(keycloak *codewindv1alpha1.Keycloak) map[string]string {
@@ -0,0 +1,90 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package keycloak
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// adminNewPasswordKey : admin secret key of a password the operator sets in Keycloak, then moves to keycloak-admin-password
+	adminNewPasswordKey = "keycloak-admin-new-password"
+
+	// reasonAdminCredentialsInvalid : condition reason when Keycloak rejects the credentials of the admin secret
+	reasonAdminCredentialsInvalid = "AdminCredentialsInvalid"
+)
+
+// reconcileAdminCredentials : Checks that Keycloak accepts the credentials of the admin secret and records the result
+// in the AdminCredentialsValid condition. A password stored under keycloak-admin-new-password is first set in Keycloak
+// and then replaces keycloak-admin-password. Returns false when the credentials cannot be used, which is not an
+// error since the operator waits for the secret to be corrected. Returns ErrKeycloakNotReady while Keycloak starts
+func (r *ReconcileKeycloak) reconcileAdminCredentials(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (bool, error) {
+	secretUser := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when checking the admin credentials", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return false, err
+	}
+	adminUser := string(secretUser.Data["keycloak-admin-user"])
+	adminPassword := string(secretUser.Data["keycloak-admin-password"])
+
+	if newPassword := string(secretUser.Data[adminNewPasswordKey]); newPassword != "" {
+		err = security.ChangeKeycloakAdminPassword(deploymentOptions.KeycloakAccessURL, adminUser, adminPassword, newPassword, rootCAs, retryPolicy)
+		if errors.Is(err, security.ErrAuthFailed) && security.CheckKeycloakAdminCredentials(deploymentOptions.KeycloakAccessURL, adminUser, newPassword, rootCAs, retryPolicy) == nil {
+			// An earlier reconcile changed the password but could not save the secret
+			err = nil
+		}
+		if errors.Is(err, security.ErrKeycloakUnreachable) {
+			return false, err
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed to change the Keycloak admin password", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+			reason := security.ConfigFailureReason(err)
+			if errors.Is(err, security.ErrAuthFailed) {
+				reason = reasonAdminCredentialsInvalid
+			}
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakAdminCredentialsValid, corev1.ConditionFalse, reason, err.Error())
+			return false, nil
+		}
+		secretUser.Data["keycloak-admin-password"] = []byte(newPassword)
+		delete(secretUser.Data, adminNewPasswordKey)
+		reqLogger.Info("Saving the new Keycloak admin password", "Namespace", secretUser.Namespace, "name", secretUser.Name)
+		err = r.client.Update(context.TODO(), secretUser)
+		if err != nil {
+			reqLogger.Error(err, "Failed to save the new Keycloak admin password", "Namespace", secretUser.Namespace, "name", secretUser.Name)
+			return false, err
+		}
+		adminPassword = newPassword
+	}
+
+	err = security.CheckKeycloakAdminCredentials(deploymentOptions.KeycloakAccessURL, adminUser, adminPassword, rootCAs, retryPolicy)
+	if errors.Is(err, security.ErrAuthFailed) {
+		reqLogger.Info("Keycloak rejected the admin credentials, update the admin secret", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakAdminCredentialsValid, corev1.ConditionFalse, reasonAdminCredentialsInvalid,
+			"Keycloak rejected the credentials of secret "+deploymentOptions.KeycloakSecretsName+": "+err.Error())
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakAdminCredentialsValid, corev1.ConditionTrue, "Authenticated", "Logged in as "+adminUser)
+	return true, nil
+}
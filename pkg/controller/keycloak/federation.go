@@ -0,0 +1,136 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package keycloak
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reasonBindSecretInvalid : condition reason when the LDAP bind secret is missing or incomplete
+const reasonBindSecretInvalid = "BindSecretInvalid"
+
+// reconcileUserFederation : Pushes the LDAP user federation of the spec to the realm when it changed since the last
+// push, and removes the provider once the spec no longer has one. The result is recorded in the UserFederationReady
+// condition. Returns ErrKeycloakNotReady while Keycloak starts
+func (r *ReconcileKeycloak) reconcileUserFederation(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	var ldapSpec *codewindv1alpha1.LDAPFederationSpec
+	if keycloak.Spec.UserFederation != nil {
+		ldapSpec = keycloak.Spec.UserFederation.LDAP
+	}
+	if ldapSpec == nil && keycloak.Status.UserFederationHash == "" {
+		return nil
+	}
+
+	secretUser := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when configuring the user federation", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return err
+	}
+	adminUser := string(secretUser.Data["keycloak-admin-user"])
+	adminPassword := string(secretUser.Data["keycloak-admin-password"])
+
+	if ldapSpec == nil {
+		err = security.RemoveLDAPFederation(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, adminUser, adminPassword, rootCAs, retryPolicy)
+		if err != nil {
+			if !errors.Is(err, security.ErrKeycloakNotReady) {
+				setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUserFederationReady, corev1.ConditionFalse, security.ConfigFailureReason(err), err.Error())
+			}
+			return err
+		}
+		reqLogger.Info("Removed the LDAP user federation", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm)
+		keycloak.Status.UserFederationHash = ""
+		removeKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUserFederationReady)
+		return nil
+	}
+
+	ldap, err := r.ldapFederation(keycloak.Namespace, ldapSpec)
+	if err != nil {
+		setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUserFederationReady, corev1.ConditionFalse, reasonBindSecretInvalid, err.Error())
+		return err
+	}
+	hash, err := realmConfigHash(ldap)
+	if err != nil {
+		return err
+	}
+	if hash == keycloak.Status.UserFederationHash {
+		return nil
+	}
+
+	err = security.ConfigureLDAPFederation(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, adminUser, adminPassword, rootCAs, retryPolicy, ldap)
+	if err != nil {
+		if !errors.Is(err, security.ErrKeycloakNotReady) {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUserFederationReady, corev1.ConditionFalse, security.ConfigFailureReason(err), err.Error())
+		}
+		return err
+	}
+	reqLogger.Info("Configured the LDAP user federation", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm, "connectionURL", ldap.ConnectionURL)
+	keycloak.Status.UserFederationHash = hash
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUserFederationReady, corev1.ConditionTrue, "Configured", "Users are read from "+ldap.ConnectionURL)
+	return nil
+}
+
+// ldapFederation : Converts the LDAP spec into the federation pushed to Keycloak, reading the bind credentials from their secret
+func (r *ReconcileKeycloak) ldapFederation(namespace string, ldapSpec *codewindv1alpha1.LDAPFederationSpec) (security.LDAPFederation, error) {
+	ldap := security.LDAPFederation{
+		ConnectionURL:     ldapSpec.ConnectionURL,
+		Vendor:            ldapSpec.Vendor,
+		UsersDN:           ldapSpec.UsersDN,
+		UsernameAttribute: ldapSpec.UsernameAttribute,
+		UserObjectClasses: ldapSpec.UserObjectClasses,
+		ImportUsers:       true,
+	}
+	if sync := ldapSpec.Sync; sync != nil {
+		if sync.ImportUsers != nil {
+			ldap.ImportUsers = *sync.ImportUsers
+		}
+		ldap.FullSyncPeriod = sync.FullSyncPeriod
+		ldap.ChangedSyncPeriod = sync.ChangedSyncPeriod
+	}
+	if ldapSpec.BindCredentialsSecret == "" {
+		return ldap, nil
+	}
+
+	bindSecret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: ldapSpec.BindCredentialsSecret, Namespace: namespace}, bindSecret)
+	if err != nil {
+		return ldap, fmt.Errorf("unable to read the LDAP bind secret %s: %v", ldapSpec.BindCredentialsSecret, err)
+	}
+	ldap.BindDN = string(bindSecret.Data["bindDN"])
+	ldap.BindCredential = string(bindSecret.Data["bindCredential"])
+	if ldap.BindDN == "" || ldap.BindCredential == "" {
+		return ldap, fmt.Errorf("LDAP bind secret %s must hold a bindDN and a bindCredential", ldapSpec.BindCredentialsSecret)
+	}
+	return ldap, nil
+}
+
+// realmConfigHash : sha256 of settings pushed to the realm, so that a changed spec or secret is pushed again
+func realmConfigHash(value interface{}) (string, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(jsonValue)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,135 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package keycloak
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reasonClientCredentialsInvalid : condition reason when the client credentials secret of a provider is missing or incomplete
+const reasonClientCredentialsInvalid = "ClientCredentialsInvalid"
+
+// reconcileIdentityProviders : Pushes the identity providers of the spec to the realm when they changed since the
+// last push, and removes the providers dropped from the spec. The result is recorded in the IdentityProvidersReady
+// condition. Returns ErrKeycloakNotReady while Keycloak starts
+func (r *ReconcileKeycloak) reconcileIdentityProviders(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	if len(keycloak.Spec.IdentityProviders) == 0 && len(keycloak.Status.IdentityProviders) == 0 {
+		return nil
+	}
+
+	var identityProviders []security.IdentityProvider
+	var aliases []string
+	for _, providerSpec := range keycloak.Spec.IdentityProviders {
+		identityProvider, err := r.identityProvider(keycloak.Namespace, providerSpec)
+		if err != nil {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakIdentityProvidersReady, corev1.ConditionFalse, reasonClientCredentialsInvalid, err.Error())
+			return err
+		}
+		identityProviders = append(identityProviders, identityProvider)
+		aliases = append(aliases, providerSpec.Alias)
+	}
+	var removedAliases []string
+	for _, alias := range keycloak.Status.IdentityProviders {
+		if !containsAlias(aliases, alias) {
+			removedAliases = append(removedAliases, alias)
+		}
+	}
+	hash, err := realmConfigHash(identityProviders)
+	if err != nil {
+		return err
+	}
+	if hash == keycloak.Status.IdentityProvidersHash && len(removedAliases) == 0 {
+		return nil
+	}
+
+	secretUser := &corev1.Secret{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when configuring identity providers", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return err
+	}
+	err = security.ConfigureIdentityProviders(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, retryPolicy, identityProviders, removedAliases)
+	if err != nil {
+		if !errors.Is(err, security.ErrKeycloakNotReady) {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakIdentityProvidersReady, corev1.ConditionFalse, security.ConfigFailureReason(err), err.Error())
+		}
+		return err
+	}
+	reqLogger.Info("Configured the identity providers of the realm", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm, "aliases", aliases, "removed", removedAliases)
+	if len(aliases) == 0 {
+		keycloak.Status.IdentityProviders = nil
+		keycloak.Status.IdentityProvidersHash = ""
+		removeKeycloakCondition(keycloak, codewindv1alpha1.KeycloakIdentityProvidersReady)
+		return nil
+	}
+	keycloak.Status.IdentityProviders = aliases
+	keycloak.Status.IdentityProvidersHash = hash
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakIdentityProvidersReady, corev1.ConditionTrue, "Configured", "Users can log in with "+strings.Join(aliases, ", "))
+	return nil
+}
+
+// identityProvider : Converts a provider of the spec into the provider pushed to Keycloak, reading its client credentials from their secret
+func (r *ReconcileKeycloak) identityProvider(namespace string, providerSpec codewindv1alpha1.IdentityProviderSpec) (security.IdentityProvider, error) {
+	identityProvider := security.IdentityProvider{
+		Alias:       providerSpec.Alias,
+		DisplayName: providerSpec.DisplayName,
+		ProviderID:  providerSpec.Type,
+		Enabled:     true,
+		Config:      map[string]string{},
+	}
+	switch providerSpec.Type {
+	case "oidc":
+		identityProvider.ImportFrom = strings.TrimSuffix(providerSpec.IssuerURL, "/") + "/.well-known/openid-configuration"
+		identityProvider.Config["defaultScope"] = "openid profile email"
+	case "saml":
+		identityProvider.ImportFrom = providerSpec.MetadataURL
+	}
+
+	if providerSpec.ClientCredentialsSecret != "" {
+		credentials := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: providerSpec.ClientCredentialsSecret, Namespace: namespace}, credentials)
+		if err != nil {
+			return identityProvider, fmt.Errorf("unable to read the client credentials secret %s of identity provider %s: %v", providerSpec.ClientCredentialsSecret, providerSpec.Alias, err)
+		}
+		clientID := string(credentials.Data["clientID"])
+		clientSecret := string(credentials.Data["clientSecret"])
+		if clientID == "" || clientSecret == "" {
+			return identityProvider, fmt.Errorf("client credentials secret %s of identity provider %s must hold a clientID and a clientSecret", providerSpec.ClientCredentialsSecret, providerSpec.Alias)
+		}
+		identityProvider.Config["clientId"] = clientID
+		identityProvider.Config["clientSecret"] = clientSecret
+	}
+	for key, value := range providerSpec.Config {
+		identityProvider.Config[key] = value
+	}
+	return identityProvider, nil
+}
+
+// containsAlias : true when the list holds the alias
+func containsAlias(aliases []string, alias string) bool {
+	for _, item := range aliases {
+		if item == alias {
+			return true
+		}
+	}
+	return false
+}
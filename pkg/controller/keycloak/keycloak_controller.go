@@ -13,16 +13,23 @@ package keycloak
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
 	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/logging"
+	"github.com/eclipse/codewind-operator/pkg/metrics"
 	"github.com/eclipse/codewind-operator/pkg/security"
 	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
 	routev1 "github.com/openshift/api/route/v1"
 	"gopkg.in/yaml.v2"
 	appsv1 "k8s.io/api/apps/v1"
@@ -32,6 +39,7 @@ import (
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -45,6 +53,9 @@ import (
 
 var log = logf.Log.WithName("controller_keycloak")
 
+// MaxConcurrentReconciles : number of Keycloak resources that may be reconciled in parallel
+var MaxConcurrentReconciles = 1
+
 // DeploymentOptionsKeycloak : Configuration settings of a Keycloak deployment
 type DeploymentOptionsKeycloak struct {
 	KeycloakServiceAccountName string
@@ -54,9 +65,18 @@ type DeploymentOptionsKeycloak struct {
 	KeycloakTLSCertTitle       string
 	KeycloakDeploymentName     string
 	KeycloakServiceName        string
+	KeycloakHeadlessName       string
 	KeycloakIngressName        string
 	KeycloakIngressHost        string
 	KeycloakAccessURL          string
+	KeycloakRealmExportName    string
+	KeycloakCertificateName    string
+	KeycloakResources          corev1.ResourceRequirements
+	KeycloakImage              codewindv1alpha1.ImageSpec
+	KeycloakArchitectures      []string
+	ImagePullSecrets           []corev1.LocalObjectReference
+	PodSecurity                codewindv1alpha1.PodSecuritySpec
+	Ingress                    codewindv1alpha1.IngressSpec
 }
 
 // OperatorConfigMapCodewind : Configuration fields saved in the config map
@@ -64,7 +84,10 @@ type OperatorConfigMapCodewind struct {
 	IngressDomain       string
 	StorageSize         string
 	KeycloakStorageSize string
+	StorageClassName    string
 	DefaultRealm        string
+	RetryPolicy         util.RetryPolicy
+	NetworkPolicies     bool
 }
 
 // Add : creates a new Keycloak Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -78,7 +101,7 @@ func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 	reconciler := &ReconcileKeycloak{client: mgr.GetClient(), scheme: mgr.GetScheme()}
 	operatorNamespace := util.GetOperatorNamespace()
 	createOperatorConfigMap(reconciler, operatorNamespace)
-	return &ReconcileKeycloak{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileKeycloak{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("keycloak-controller")}
 }
 
 func createOperatorConfigMap(reconciler *ReconcileKeycloak, operatorNamespace string) {
@@ -111,7 +134,7 @@ func createOperatorConfigMap(reconciler *ReconcileKeycloak, operatorNamespace st
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 
 	// Create a new controller
-	c, err := controller.New("keycloak-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("keycloak-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: MaxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
@@ -131,6 +154,15 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch the admin secret so that changed credentials are checked straight away
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &codewindv1alpha1.Keycloak{},
+	})
+	if err != nil {
+		return err
+	}
+
 	// Watch for changes to the Keycloak deployment to catch pod changes that require keycloak database updates
 	src := &source.Kind{Type: &appsv1.Deployment{}}
 	h := &handler.EnqueueRequestForOwner{
@@ -156,16 +188,42 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch the operator config map so that changed defaults reach every Keycloak CR without restarting the operator
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: allKeycloaks(mgr.GetClient()),
+	}, util.OperatorConfigMapPredicate(defaults.OperatorConfigMapName))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// allKeycloaks : Requests a reconcile of every Keycloak CR, for example after the operator defaults changed
+func allKeycloaks(c client.Client) handler.ToRequestsFunc {
+	return func(object handler.MapObject) []reconcile.Request {
+		keycloaks := &codewindv1alpha1.KeycloakList{}
+		err := c.List(context.TODO(), keycloaks)
+		if err != nil {
+			log.Error(err, "Unable to list the Keycloak CRs to apply the operator defaults", "Namespace", object.Meta.GetNamespace(), "Name", object.Meta.GetName())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range keycloaks.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: keycloaks.Items[i].Name, Namespace: keycloaks.Items[i].Namespace}})
+		}
+		return requests
+	}
+}
+
 // blank assignment to verify that ReconcileKeycloak implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileKeycloak{}
 
 // ReconcileKeycloak reconciles a Keycloak object
 type ReconcileKeycloak struct {
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 // Reconcile : Reads that state of the cluster for a Keycloak object and makes changes between the current state and required Keycloak.Spec
@@ -174,9 +232,10 @@ type ReconcileKeycloak struct {
 // The Controller will requeue the Request to be processed again if there was an error or Result.Requeue is true,
 // otherwise upon completion it will remove the work from the queue.
 func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	defer metrics.ObserveReconcile("Keycloak", request, time.Now())
 	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
 	reqLogger.Info("Reconciling Keycloak")
-	isOpenshift, _, err := util.DetectOpenShift()
+	isOpenshift, isOpenshift4, err := util.DetectOpenShift()
 	if err != nil {
 		reqLogger.Error(err, "An error occurred when detecting current infrastructure", "")
 	}
@@ -211,13 +270,71 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 		reqLogger.Error(err, "Unable to read config map. Ensure one has been created in the same namespace as the operator", "name", defaults.OperatorConfigMapName)
 		return reconcile.Result{}, err
 	}
+
+	// Apply a log level changed in the operator config map
+	if changed, err := logging.ApplyOperatorConfig(operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid log level in the operator config map", "key", logging.OperatorConfigLogLevelKey)
+	} else if changed {
+		reqLogger.Info("Changed the operator log level", "level", logging.Level())
+	}
+	if util.ApplyProxyConfig(operatorConfigMap.Data) {
+		reqLogger.Info("Changed the outbound proxy of the operator", "httpProxy", operatorConfigMap.Data[util.HTTPProxyKey], "httpsProxy", operatorConfigMap.Data[util.HTTPSProxyKey])
+	}
+	if changed, err := util.ApplyHTTPClientConfig(operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid HTTP client settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the HTTP client settings of the operator")
+	}
+	if changed, err := security.ApplyAuditConfig(r.client, operatorNamespace, operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid audit settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the audit sinks of the operator", "configMap", operatorConfigMap.Data[security.AuditConfigMapKey], "webhook", operatorConfigMap.Data[security.AuditWebhookURLKey] != "")
+	}
+	if changed, err := security.ApplyKeycloakGuardConfig(operatorConfigMap.Data); err != nil {
+		reqLogger.Error(err, "Ignoring invalid Keycloak rate limit settings in the operator config map")
+	} else if changed {
+		reqLogger.Info("Changed the rate limit and circuit breaker of the requests to Keycloak")
+	}
 	// Get fields we need from the configmap
 
+	// The apps domain of an OpenShift 4 cluster replaces the ingressDomain of the cluster, not those of the namespaces
+	clusterIngressDomain, domainErr := util.OperatorIngressDomain(operatorConfigMap.Data, isOpenshift4)
+	if domainErr != nil {
+		reqLogger.Error(domainErr, "Unable to detect the apps domain of the cluster, using the ingressDomain of the operator config map")
+	}
+	if clusterIngressDomain != operatorConfigMap.Data["ingressDomain"] {
+		if operatorConfigMap.Data == nil {
+			operatorConfigMap.Data = map[string]string{}
+		}
+		operatorConfigMap.Data["ingressDomain"] = clusterIngressDomain
+	}
+
+	// Defaults of the namespace of the CR replace those of the cluster
+	namespaceConfig, err := util.OperatorConfigForNamespace(operatorConfigMap.Data, request.Namespace)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid namespace defaults in the operator config map", "key", util.NamespaceDefaultsKey)
+	}
+
 	configMapCodewind := OperatorConfigMapCodewind{
-		IngressDomain:       operatorConfigMap.Data["ingressDomain"],
-		StorageSize:         operatorConfigMap.Data["storageCodewindSize"],
-		KeycloakStorageSize: operatorConfigMap.Data["storageKeycloakSize"],
+		IngressDomain:       namespaceConfig["ingressDomain"],
+		StorageSize:         namespaceConfig["storageCodewindSize"],
+		KeycloakStorageSize: namespaceConfig["storageKeycloakSize"],
+		StorageClassName:    namespaceConfig["storageClassName"],
 		DefaultRealm:        operatorConfigMap.Data["defaultRealm"],
+		NetworkPolicies:     util.NetworkPoliciesEnabled(keycloak.Spec.NetworkPolicies, operatorConfigMap.Data),
+	}
+	// A storage class set in the operator config map wins over the detected class
+	if configMapCodewind.StorageClassName != "" {
+		storageClassName = configMapCodewind.StorageClassName
+	}
+	configMapCodewind.RetryPolicy, err = util.RetryPolicyFromOperatorConfig(operatorConfigMap.Data)
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid Keycloak retry settings in the operator config map")
+	}
+
+	// Settings on the CR, usually filled in by the defaulting webhook, override the operator config map
+	if keycloak.Spec.IngressDomain != "" {
+		configMapCodewind.IngressDomain = keycloak.Spec.IngressDomain
 	}
 
 	// Get the authID from the CR else generate and store a new authID
@@ -230,19 +347,243 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{Requeue: true}, nil
 	}
 
+	// An existing TLS secret of the CR replaces the generated certificate
+	tlsSecretName := util.TLSSecretName(keycloak.Spec.TLS)
+	if tlsSecretName == "" {
+		tlsSecretName = "secret-keycloak-tls-" + authID
+	}
+
 	deploymentOptions := DeploymentOptionsKeycloak{
 		KeycloakServiceAccountName: defaults.PrefixCodewindKeycloak + "-" + authID,
 		KeycloakPVCName:            defaults.PrefixCodewindKeycloak + "-pvc-" + authID,
 		KeycloakSecretsName:        "secret-keycloak-user-" + authID,
-		KeycloakTLSSecretsName:     "secret-keycloak-tls-" + authID,
+		KeycloakTLSSecretsName:     tlsSecretName,
 		KeycloakTLSCertTitle:       "Keycloak" + "-" + authID,
 		KeycloakDeploymentName:     defaults.PrefixCodewindKeycloak + "-" + authID,
 		KeycloakServiceName:        defaults.PrefixCodewindKeycloak + "-" + authID,
+		KeycloakHeadlessName:       defaults.PrefixCodewindKeycloak + "-jgroups-" + authID,
 		KeycloakIngressName:        defaults.PrefixCodewindKeycloak + "-" + authID,
 		KeycloakIngressHost:        defaults.PrefixCodewindKeycloak + "-" + authID + "." + keycloak.Namespace + "." + configMapCodewind.IngressDomain,
 		KeycloakAccessURL:          "https://" + defaults.PrefixCodewindKeycloak + "-" + authID + "." + keycloak.Namespace + "." + configMapCodewind.IngressDomain,
+		KeycloakRealmExportName:    "keycloak-realm-export-" + authID,
+		KeycloakCertificateName:    defaults.PrefixCodewindKeycloak + "-" + authID,
+	}
+
+	// Resources of the CR override the operator config map default, an invalid default is ignored
+	defaultResources, err := util.ResourcesFromOperatorConfig(operatorConfigMap.Data, "resourcesKeycloak")
+	if err != nil {
+		reqLogger.Error(err, "Ignoring invalid resources in the operator config map", "key", "resourcesKeycloak")
+	}
+	var keycloakResources *corev1.ResourceRequirements
+	if keycloak.Spec.Resources != nil {
+		keycloakResources = keycloak.Spec.Resources.Keycloak
+	}
+	deploymentOptions.KeycloakResources = util.SelectResources(keycloakResources, defaultResources)
+
+	// A version of the catalog selects the tested Keycloak tag, the CR is not reconciled again until it or the
+	// operator config map changes
+	versionImages := util.VersionImages{}
+	if keycloak.Spec.Version != "" {
+		versionImages, err = util.LookupVersion(operatorConfigMap.Data, keycloak.Spec.Version)
+		if err != nil {
+			reqLogger.Error(err, "Unable to select the Keycloak image", "Namespace", keycloak.Namespace, "Name", keycloak.Name)
+			r.recorder.Event(keycloak, corev1.EventTypeWarning, defaults.EventReasonUnknownVersion, err.Error())
+			return reconcile.Result{}, nil
+		}
+	}
+
+	// The version must have an image for the architecture of the pod
+	architecture := util.SelectArchitecture(keycloak.Spec.Architecture, operatorConfigMap.Data)
+	if err := util.CheckArchitecture(keycloak.Spec.Version, versionImages, architecture); err != nil {
+		reqLogger.Error(err, "Unable to select the Keycloak image", "Namespace", keycloak.Namespace, "Name", keycloak.Name)
+		r.recorder.Event(keycloak, corev1.EventTypeWarning, defaults.EventReasonUnsupportedArchitecture, err.Error())
+		setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUnsupportedArchitecture, corev1.ConditionTrue, defaults.EventReasonUnsupportedArchitecture, err.Error())
+		return reconcile.Result{}, r.client.Status().Update(context.TODO(), keycloak)
+	}
+	removeKeycloakCondition(keycloak, codewindv1alpha1.KeycloakUnsupportedArchitecture)
+
+	// The operator config map may replace the built in image, whose repository is swapped for the one of the architecture
+	defaultImage := util.ImageFromOperatorConfig(operatorConfigMap.Data, "imageKeycloak", codewindv1alpha1.ImageSpec{Repository: defaults.KeycloakImage, Tag: defaults.KeycloakImageTag})
+	deploymentOptions.KeycloakImage = imageForKeycloak(keycloak, util.ArchitectureImage(defaultImage, architecture), versionImages.Keycloak)
+	deploymentOptions.KeycloakArchitectures = util.ImageArchitectures(deploymentOptions.KeycloakImage, versionImages)
+	deploymentOptions.ImagePullSecrets = util.SelectImagePullSecrets(keycloak.Spec.ImagePullSecrets, operatorConfigMap.Data, "imagePullSecrets")
+
+	// Security settings of the CR override the operator config map default, an invalid default is ignored
+	defaultPodSecurity, podSecurityErr := util.PodSecurityFromOperatorConfig(operatorConfigMap.Data)
+	if podSecurityErr != nil {
+		reqLogger.Error(podSecurityErr, "Ignoring invalid security context in the operator config map", "key", util.PodSecurityContextKey)
+	}
+	deploymentOptions.PodSecurity = util.SelectPodSecurity(keycloak.Spec.SecurityContext, defaultPodSecurity, isOpenshift)
+
+	// Ingress class and annotations of the CR override the operator config map defaults
+	defaultIngress, ingressErr := util.IngressFromOperatorConfig(operatorConfigMap.Data)
+	if ingressErr != nil {
+		reqLogger.Error(ingressErr, "Ignoring invalid ingress annotations in the operator config map", "key", util.IngressAnnotationsKey)
+	}
+	deploymentOptions.Ingress = util.SelectIngress(keycloak.Spec.Ingress, defaultIngress)
+
+	certificateReady := true
+	if keycloak.Spec.Unmanaged {
+		// Keycloak runs elsewhere, only its realm is configured
+		deploymentOptions.KeycloakAccessURL = strings.TrimSuffix(keycloak.Spec.URL, "/")
+		deploymentOptions.KeycloakSecretsName = keycloak.Spec.AdminCredentialsSecret
+		keycloak.Status.AccessURL = deploymentOptions.KeycloakAccessURL
+	} else {
+		var requeue bool
+		requeue, certificateReady, err = r.reconcileKeycloakResources(reqLogger, keycloak, deploymentOptions, configMapCodewind, isOpenshift, storageClassName)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if requeue {
+			return reconcile.Result{Requeue: true}, nil
+		}
+	}
+
+	// Trust the CA bundle of the Keycloak CR, else the bundle of the operator config map
+	rootCAs, err := util.LoadKeycloakCABundle(r.client, keycloak, operatorNamespace, util.CABundleFromOperatorConfig(operatorConfigMap.Data))
+	if err != nil {
+		reqLogger.Error(err, "Unable to load the Keycloak CA bundle", "Namespace", keycloak.Namespace, "name", keycloak.Name)
+		return reconcile.Result{}, err
+	}
+
+	// Update Keycloak default realm, an unmanaged Keycloak is expected to be running
+	keycloakRunning := keycloak.Spec.Unmanaged
+	if !keycloak.Spec.Unmanaged {
+		reqLogger.Info("Checking Keycloak Pod", "instance", authID)
+		keycloakPod, err := fetchKeycloakPod(r.client, keycloak.Name)
+		if err == nil && keycloakPod != nil {
+			reqLogger.Info("Keycloak Pod status", "phase", keycloakPod.Status.Phase)
+			keycloakRunning = keycloakPod.Status.Phase == "Running"
+		}
+	}
+	if keycloakRunning {
+		reqLogger.Info("Configuring Keycloak", "instance", authID, "URL", deploymentOptions.KeycloakAccessURL)
+
+		// Leave Keycloak alone while requests to it are suspended after repeated failures
+		if retryAfter := setAdminAPICondition(keycloak, deploymentOptions.KeycloakAccessURL); retryAfter > 0 {
+			reqLogger.Info("Requests to Keycloak are suspended after repeated failures", "Namespace", keycloak.Namespace, "URL", deploymentOptions.KeycloakAccessURL, "retryAfter", retryAfter.String())
+			r.recorder.Event(keycloak, corev1.EventTypeWarning, string(security.CodeKeycloakCircuitOpen), "Requests to Keycloak are suspended for "+retryAfter.Round(time.Second).String()+" after repeated failures")
+			return reconcile.Result{RequeueAfter: retryAfter}, r.client.Status().Update(context.TODO(), keycloak)
+		}
+
+		// Use the admin API paths of the distribution named in the spec, else detect where Keycloak serves them
+		if keycloak.Spec.Distribution != "" {
+			security.RegisterKeycloakDistribution(deploymentOptions.KeycloakAccessURL, security.KeycloakDistribution(keycloak.Spec.Distribution))
+		}
+		distribution, err := security.DetectKeycloakDistribution(deploymentOptions.KeycloakAccessURL, rootCAs, configMapCodewind.RetryPolicy)
+		if err != nil {
+			reqLogger.Info("Waiting for Keycloak to serve its REST API before detecting its distribution", "Namespace", keycloak.Namespace, "reason", err.Error())
+			r.recorder.Event(keycloak, corev1.EventTypeNormal, security.ReasonWaitingForKeycloak, "Waiting for Keycloak to serve its REST API")
+			return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+		}
+		keycloak.Status.Distribution = string(distribution)
+
+		// Check the admin credentials, applying a password change requested in the admin secret first
+		credentialsValid, err := r.reconcileAdminCredentials(reqLogger, keycloak, deploymentOptions, rootCAs, configMapCodewind.RetryPolicy)
+		if errors.Is(err, security.ErrKeycloakNotReady) {
+			reqLogger.Info("Waiting for Keycloak to start before checking the admin credentials", "Namespace", keycloak.Namespace)
+			r.recorder.Event(keycloak, corev1.EventTypeNormal, security.ReasonWaitingForKeycloak, "Waiting for Keycloak to start before checking the admin credentials")
+			return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed checking the Keycloak admin credentials", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+			r.recorder.Event(keycloak, corev1.EventTypeWarning, security.ConfigFailureReason(err), err.Error())
+			return reconcile.Result{}, err
+		}
+		if !credentialsValid {
+			// Nothing can be configured until the admin secret is corrected, which triggers another reconcile
+			return reconcile.Result{}, r.client.Status().Update(context.TODO(), keycloak)
+		}
+		defaultRealm, sharedRealm := keycloakRealm(keycloak, configMapCodewind.DefaultRealm)
+		if keycloak.Status.DefaultRealm != defaultRealm {
+			keycloak.Status.DefaultRealm = defaultRealm
+			secretUser := &corev1.Secret{}
+			err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+			if err != nil {
+				reqLogger.Error(err, "Unable to find the Keycloak secret when adding realm", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+				return reconcile.Result{}, err
+			}
+			if sharedRealm {
+				err = security.ValidateCodewindRealm(deploymentOptions.KeycloakAccessURL, defaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, configMapCodewind.RetryPolicy)
+			} else if keycloak.Spec.Backup != nil && keycloak.Spec.Backup.RestoreFrom != nil {
+				// Create a realm missing from Keycloak, eg after its volume was lost, from the export of the spec
+				realmExport, restoreErr := r.realmRestoreExport(keycloak)
+				if restoreErr != nil {
+					reqLogger.Error(restoreErr, "Failed reading the realm export to restore", "Namespace", keycloak.Namespace, "realm", defaultRealm)
+					r.recorder.Event(keycloak, corev1.EventTypeWarning, defaults.EventReasonRealmRestoreFailed, restoreErr.Error())
+					return reconcile.Result{RequeueAfter: time.Second * 30}, nil
+				}
+				var restored bool
+				restored, err = security.RestoreCodewindRealmToKeycloak(deploymentOptions.KeycloakAccessURL, defaultRealm, realmExport, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, configMapCodewind.RetryPolicy)
+				if restored {
+					r.recorder.Event(keycloak, corev1.EventTypeNormal, defaults.EventReasonRealmRestored, "Realm "+defaultRealm+" is restored from its export")
+				}
+			} else {
+				err = security.AddCodewindRealmToKeycloak(deploymentOptions.KeycloakAccessURL, defaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, configMapCodewind.RetryPolicy)
+			}
+			if errors.Is(err, security.ErrKeycloakNotReady) {
+				// The pod is running but Keycloak is still starting, check again soon without holding the worker
+				reqLogger.Info("Waiting for Keycloak to start before adding the realm", "Namespace", keycloak.Namespace, "realm", defaultRealm)
+				r.recorder.Event(keycloak, corev1.EventTypeNormal, security.ReasonWaitingForKeycloak, "Waiting for Keycloak to start before adding realm "+defaultRealm)
+				return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+			}
+			if err != nil {
+				reqLogger.Error(err, "Failed configuring keycloak with codewind default realm", "Namespace", keycloak.Namespace, "realm", defaultRealm)
+				r.recorder.Event(keycloak, corev1.EventTypeWarning, security.ConfigFailureReason(err), err.Error())
+				return reconcile.Result{}, err
+			}
+			r.recorder.Event(keycloak, corev1.EventTypeNormal, defaults.EventReasonRealmConfigured, "Realm "+defaultRealm+" is configured")
+		}
+
+		// Push the mail server, security policy, branding, user federation and identity providers of the spec to the
+		// realm, a shared realm is left as its owner configured it
+		for _, setting := range r.realmSettings(sharedRealm) {
+			err = setting.reconcile(reqLogger, keycloak, deploymentOptions, rootCAs, configMapCodewind.RetryPolicy)
+			if errors.Is(err, security.ErrKeycloakNotReady) {
+				reqLogger.Info("Waiting for Keycloak to start before configuring the "+setting.name, "Namespace", keycloak.Namespace)
+				r.recorder.Event(keycloak, corev1.EventTypeNormal, security.ReasonWaitingForKeycloak, "Waiting for Keycloak to start before configuring the "+setting.name)
+				return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+			}
+			if err != nil {
+				reqLogger.Error(err, "Failed configuring the "+setting.name+" of the realm", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm)
+				r.recorder.Event(keycloak, corev1.EventTypeWarning, security.ConfigFailureReason(err), "Failed configuring the "+setting.name+": "+err.Error())
+				if updateErr := r.client.Status().Update(context.TODO(), keycloak); updateErr != nil {
+					return reconcile.Result{}, updateErr
+				}
+				return reconcile.Result{}, err
+			}
+		}
+		setAdminAPICondition(keycloak, deploymentOptions.KeycloakAccessURL)
+	}
+
+	err = r.client.Status().Update(context.TODO(), keycloak)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Export the realm when a backup has been requested or the backup interval has passed
+	untilBackup, backupScheduled := nextBackup(keycloak, time.Now())
+	if keycloak.Status.DefaultRealm != "" && (backupRequested(keycloak) || (backupScheduled && untilBackup == 0)) {
+		err = r.backupKeycloakRealm(reqLogger, keycloak, deploymentOptions, rootCAs, configMapCodewind.RetryPolicy)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		untilBackup, backupScheduled = nextBackup(keycloak, time.Now())
+	}
+
+	// Certificates are not watched, check again until cert-manager has issued it
+	if !certificateReady {
+		return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+	}
+	if backupScheduled && keycloak.Status.DefaultRealm != "" {
+		return reconcile.Result{RequeueAfter: untilBackup}, nil
 	}
+	return reconcile.Result{}, nil
+}
 
+// reconcileKeycloakResources : Creates the service account, secrets, volume, deployment, services and ingress of a
+// managed Keycloak, and updates the deployment when the spec changed. Returns requeue after creating the deployment
+func (r *ReconcileKeycloak) reconcileKeycloakResources(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, configMapCodewind OperatorConfigMapCodewind, isOpenshift bool, storageClassName string) (requeue bool, certificateReady bool, err error) {
 	// Check if the Keycloak Service account already exist, if not create a new one
 	serviceAccount := &corev1.ServiceAccount{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakServiceAccountName, Namespace: keycloak.Namespace}, serviceAccount)
@@ -253,11 +594,11 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 		err = r.client.Create(context.TODO(), newServiceAccount)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
 			reqLogger.Error(err, "Failed to create new Secret.", "Namespace", newServiceAccount.Namespace, "Name", newServiceAccount.Name)
-			return reconcile.Result{}, err
+			return false, false, err
 		}
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get service account.")
-		return reconcile.Result{}, err
+		return false, false, err
 	}
 
 	// Check if the Keycloak Secrets already exist, if not create new ones
@@ -270,51 +611,88 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 		err = r.client.Create(context.TODO(), secretUser)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
 			reqLogger.Error(err, "Failed to create new Keycloak Secret.", "Namespace", secretUser.Namespace, "Name", secretUser.Name)
-			return reconcile.Result{}, err
+			return false, false, err
 		}
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get Keycloak Secret.")
-		return reconcile.Result{}, err
+		return false, false, err
 	}
 
-	// Check if the Keycloak TLS Secrets already exist, if not create new ones
-	secretTLS := &corev1.Secret{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakTLSSecretsName, Namespace: keycloak.Namespace}, secretTLS)
-	if err != nil && k8serr.IsNotFound(err) {
-		// Define a new Secrets object
-		secretTLS = r.secretsTLSForKeycloak(keycloak, deploymentOptions)
-		reqLogger.Info("Creating a new Keycloak TLS Secret", "Namespace", secretTLS.Namespace, "Name", secretTLS.Name)
-		err = r.client.Create(context.TODO(), secretTLS)
-		if err != nil && !k8serr.IsAlreadyExists(err) {
-			reqLogger.Error(err, "Failed to create new Keycloak TLS Secret.", "Namespace", secretTLS.Namespace, "Name", secretTLS.Name)
-			return reconcile.Result{}, err
+	certificateReady = true
+	if util.TLSSecretName(keycloak.Spec.TLS) != "" {
+		// The ingress serves the certificate of the existing secret, no certificate is generated or requested
+		err = util.CheckTLSSecret(r.client, keycloak.Namespace, deploymentOptions.KeycloakTLSSecretsName)
+		if err != nil {
+			reqLogger.Error(err, "Invalid TLS secret of the Keycloak instance", "Namespace", keycloak.Namespace, "Name", deploymentOptions.KeycloakTLSSecretsName)
+			r.recorder.Event(keycloak, corev1.EventTypeWarning, defaults.EventReasonTLSSecretInvalid, err.Error())
+			certificateReady = false
+		}
+	} else if util.CertManagerEnabled(keycloak.Spec.TLS) {
+		// Request the Keycloak certificate from cert-manager, which writes the TLS secret
+		ready, message, err := util.EnsureCertManagerCertificate(r.client, r.certificateForKeycloak(keycloak, deploymentOptions))
+		if err != nil {
+			reqLogger.Error(err, "Failed to request the Keycloak certificate.", "Namespace", keycloak.Namespace, "Name", deploymentOptions.KeycloakCertificateName)
+			return false, false, err
+		}
+		if !ready {
+			reqLogger.Info("Waiting for the Keycloak certificate", "Name", deploymentOptions.KeycloakCertificateName, "message", message)
+		}
+		certificateReady = ready
+	} else {
+		// Check if the Keycloak TLS Secrets already exist, if not create new ones
+		secretTLS := &corev1.Secret{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakTLSSecretsName, Namespace: keycloak.Namespace}, secretTLS)
+		if err != nil && k8serr.IsNotFound(err) {
+			// Define a new Secrets object
+			secretTLS = r.secretsTLSForKeycloak(keycloak, deploymentOptions)
+			reqLogger.Info("Creating a new Keycloak TLS Secret", "Namespace", secretTLS.Namespace, "Name", secretTLS.Name)
+			err = r.client.Create(context.TODO(), secretTLS)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new Keycloak TLS Secret.", "Namespace", secretTLS.Namespace, "Name", secretTLS.Name)
+				r.recorder.Eventf(keycloak, corev1.EventTypeWarning, defaults.EventReasonCreateFailed, "Failed to create TLS secret %s: %v", secretTLS.Name, err)
+				return false, false, err
+			}
+			r.recorder.Eventf(keycloak, corev1.EventTypeNormal, defaults.EventReasonCertificateGenerated, "Generated a self-signed certificate in TLS secret %s", secretTLS.Name)
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get Keycloak TLS Secret.")
+			return false, false, err
 		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Keycloak TLS Secret.")
-		return reconcile.Result{}, err
 	}
 
-	// Check if the Keycloak PVC already exist, if not create a new one
-	keycloakPVC := &corev1.PersistentVolumeClaim{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakPVCName, Namespace: keycloak.Namespace}, keycloakPVC)
-	if err != nil && k8serr.IsNotFound(err) {
-		// Define a new PVC object
-
-		storageSize := configMapCodewind.KeycloakStorageSize
-		if keycloak.Spec.StorageSize != "" {
-			storageSize = keycloak.Spec.StorageSize
+	// Keycloak keeps its data in an embedded database on a PVC unless an external database is configured
+	if keycloak.Spec.Database == nil {
+		// Size and storage class of the Keycloak volume, the CR wins over the operator config map and the detected class
+		storageSize, storageSizeOnCR, err := util.SelectStorageSize(keycloak.Spec.Storage, keycloak.Spec.StorageSize, configMapCodewind.KeycloakStorageSize)
+		if err != nil {
+			reqLogger.Error(err, "Invalid Keycloak storage size", "Namespace", keycloak.Namespace, "Name", keycloak.Name)
+			return false, false, err
 		}
+		storageClassName = util.SelectStorageClassName(keycloak.Spec.Storage, storageClassName)
 
-		newKeycloakPVC := r.pvcForKeycloak(keycloak, deploymentOptions, storageClassName, storageSize)
-		reqLogger.Info("Creating a new PVC", "Namespace", newKeycloakPVC.Namespace, "Name", newKeycloakPVC.Name)
-		err = r.client.Create(context.TODO(), newKeycloakPVC)
-		if err != nil && !k8serr.IsAlreadyExists(err) {
-			reqLogger.Error(err, "Failed to create new PVC.", "Namespace", newKeycloakPVC.Namespace, "Name", newKeycloakPVC.Name)
-			return reconcile.Result{}, err
+		// Check if the Keycloak PVC already exist, if not create a new one
+		keycloakPVC := &corev1.PersistentVolumeClaim{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakPVCName, Namespace: keycloak.Namespace}, keycloakPVC)
+		if err != nil && k8serr.IsNotFound(err) {
+			// Define a new PVC object
+			newKeycloakPVC := r.pvcForKeycloak(keycloak, deploymentOptions, storageClassName, storageSize)
+			reqLogger.Info("Creating a new PVC", "Namespace", newKeycloakPVC.Namespace, "Name", newKeycloakPVC.Name)
+			err = r.client.Create(context.TODO(), newKeycloakPVC)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new PVC.", "Namespace", newKeycloakPVC.Namespace, "Name", newKeycloakPVC.Name)
+				return false, false, err
+			}
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get PVC.")
+			return false, false, err
+		} else if storageSizeOnCR && util.ExpandPVC(keycloakPVC, storageSize) {
+			// The size on the CR grew, the storage class must allow volume expansion
+			reqLogger.Info("Expanding the PVC", "Namespace", keycloakPVC.Namespace, "Name", keycloakPVC.Name, "Size", storageSize.String())
+			err = r.client.Update(context.TODO(), keycloakPVC)
+			if err != nil {
+				reqLogger.Error(err, "Failed to expand PVC.", "Namespace", keycloakPVC.Namespace, "Name", keycloakPVC.Name)
+				return false, false, err
+			}
 		}
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get PVC.")
-		return reconcile.Result{}, err
 	}
 
 	// Check if the Keycloak Deployment already exists, if not create a new one
@@ -327,14 +705,30 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 		err = r.client.Create(context.TODO(), dep)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
 			reqLogger.Error(err, "Failed to create new Deployment.", "Namespace", dep.Namespace, "Name", dep.Name)
-			return reconcile.Result{}, err
+			r.recorder.Eventf(keycloak, corev1.EventTypeWarning, defaults.EventReasonCreateFailed, "Failed to create Keycloak deployment %s: %v", dep.Name, err)
+			return false, false, err
 		}
+		r.recorder.Eventf(keycloak, corev1.EventTypeNormal, defaults.EventReasonCreated, "Created Keycloak deployment %s", dep.Name)
 		// Deployment created successfully - return and requeue
 		// TODO: GET the deployment object again instead of requeuing it see: https://godoc.org/sigs.k8s.io/controller-runtime/pkg/reconcile#Reconciler
-		return reconcile.Result{Requeue: true}, nil
+		return true, certificateReady, nil
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get Deployment.")
-		return reconcile.Result{}, err
+		return false, false, err
+	}
+
+	// Roll the deployment when its image or probes changed, scale it when the replicas of the CR changed
+	desiredDeployment := r.deploymentForKeycloak(keycloak, deploymentOptions)
+	imageChanged := util.SyncDeploymentImages(deployment, desiredDeployment)
+	replicasChanged := syncKeycloakReplicas(deployment, desiredDeployment)
+	probesChanged := util.SyncDeploymentProbes(deployment, desiredDeployment)
+	if imageChanged || replicasChanged || probesChanged {
+		reqLogger.Info("Updating the Deployment.", "Namespace", deployment.Namespace, "Name", deployment.Name)
+		err = r.client.Update(context.TODO(), deployment)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update Deployment.", "Namespace", deployment.Namespace, "Name", deployment.Name)
+			return false, false, err
+		}
 	}
 
 	// Check if the Keycloak Service already exists, if not create a new one
@@ -347,11 +741,51 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 		err = r.client.Create(context.TODO(), ser)
 		if err != nil && !k8serr.IsAlreadyExists(err) {
 			reqLogger.Error(err, "Failed to create new Service.", "Namespace", ser.Namespace, "Name", ser.Name)
-			return reconcile.Result{}, err
+			return false, false, err
 		}
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get Service.")
-		return reconcile.Result{}, err
+		return false, false, err
+	}
+
+	// Replicas discover each other through a headless service
+	if keycloakReplicas(keycloak) > 1 {
+		headless := &corev1.Service{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakHeadlessName, Namespace: keycloak.Namespace}, headless)
+		if err != nil && k8serr.IsNotFound(err) {
+			ser := r.headlessServiceForKeycloak(keycloak, deploymentOptions)
+			reqLogger.Info("Creating a new headless Service", "Namespace", ser.Namespace, "Name", ser.Name)
+			err = r.client.Create(context.TODO(), ser)
+			if err != nil && !k8serr.IsAlreadyExists(err) {
+				reqLogger.Error(err, "Failed to create new headless Service.", "Namespace", ser.Namespace, "Name", ser.Name)
+				return false, false, err
+			}
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get headless Service.")
+			return false, false, err
+		}
+	}
+
+	// Admit only HTTP traffic and the traffic between replicas when NetworkPolicies are enabled
+	networkPolicy := r.networkPolicyForKeycloak(keycloak, deploymentOptions)
+	if configMapCodewind.NetworkPolicies {
+		changed, err := util.EnsureNetworkPolicy(r.client, networkPolicy)
+		if err != nil {
+			reqLogger.Error(err, "Failed to apply the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+			return false, false, err
+		}
+		if changed {
+			reqLogger.Info("Applied the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+		}
+	} else {
+		deleted, err := util.DeleteNetworkPolicy(r.client, networkPolicy.Name, networkPolicy.Namespace)
+		if err != nil {
+			reqLogger.Error(err, "Failed to delete the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+			return false, false, err
+		}
+		if deleted {
+			reqLogger.Info("Deleted the NetworkPolicy", "Namespace", networkPolicy.Namespace, "Name", networkPolicy.Name)
+		}
 	}
 
 	if isOpenshift {
@@ -365,13 +799,13 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 			err = r.client.Create(context.TODO(), openshiftRoute)
 			if err != nil && !k8serr.IsAlreadyExists(err) {
 				reqLogger.Error(err, "Failed to create new route.", "Namespace", openshiftRoute.Namespace, "Name", openshiftRoute.Name)
-				return reconcile.Result{}, err
+				return false, false, err
 			}
 			// Update the accessURL
 			keycloak.Status.AccessURL = deploymentOptions.KeycloakAccessURL
 		} else if err != nil {
 			reqLogger.Error(err, "Failed to get Keycloak route")
-			return reconcile.Result{}, err
+			return false, false, err
 		}
 	} else {
 		// Check if the Keycloak Ingress already exists, if not create a new one
@@ -384,46 +818,76 @@ func (r *ReconcileKeycloak) Reconcile(request reconcile.Request) (reconcile.Resu
 			err = r.client.Create(context.TODO(), ing)
 			if err != nil && !k8serr.IsAlreadyExists(err) {
 				reqLogger.Error(err, "Failed to create new Ingress.", "Namespace", ing.Namespace, "Name", ing.Name)
-				return reconcile.Result{}, err
+				return false, false, err
 			}
 			// Update the accessURL
 			keycloak.Status.AccessURL = deploymentOptions.KeycloakAccessURL
 		} else if err != nil {
 			reqLogger.Error(err, "Failed to get Keycloak Ingress")
-			return reconcile.Result{}, err
+			return false, false, err
+		} else if annotations := r.ingressForKeycloak(keycloak, deploymentOptions).Annotations; !reflect.DeepEqual(ingress.Annotations, annotations) {
+			// The ingress class or annotations changed
+			reqLogger.Info("Updating the annotations of the Ingress", "Namespace", ingress.Namespace, "Name", ingress.Name)
+			ingress.Annotations = annotations
+			err = r.client.Update(context.TODO(), ingress)
+			if err != nil {
+				reqLogger.Error(err, "Failed to update Ingress.", "Namespace", ingress.Namespace, "Name", ingress.Name)
+				return false, false, err
+			}
 		}
 	}
+	return false, certificateReady, nil
+}
 
-	// Update Keycloak default realm
-	reqLogger.Info("Checking Keycloak Pod", "instance", authID)
-	keycloakPod, err := fetchKeycloakPod(r.client, keycloak.Name)
-	if err == nil && keycloakPod != nil {
-		reqLogger.Info("Keycloak Pod status", "phase", keycloakPod.Status.Phase)
-		if keycloakPod.Status.Phase == "Running" {
-			reqLogger.Info("Keycloak Pod", "instance", authID, "Phase", keycloakPod.Status.Phase)
-			defaultRealm := configMapCodewind.DefaultRealm
-			if keycloak.Status.DefaultRealm != defaultRealm {
-				keycloak.Status.DefaultRealm = defaultRealm
-				secretUser := &corev1.Secret{}
-				err = r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
-				if err != nil {
-					reqLogger.Error(err, "Unable to find the Keycloak secret when adding realm", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
-					return reconcile.Result{}, err
-				}
-				err = security.AddCodewindRealmToKeycloak(deploymentOptions.KeycloakAccessURL, defaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]))
-				if err != nil {
-					reqLogger.Error(err, "Failed configuring keycloak with codewind default realm", "Namespace", keycloak.Namespace, "realm", defaultRealm)
-					return reconcile.Result{}, err
-				}
-			}
+// realmSetting : settings of the spec pushed to the realm once it exists. The reconcile function records the result
+// in a condition and returns ErrKeycloakNotReady while Keycloak starts
+type realmSetting struct {
+	name      string
+	reconcile func(logr.Logger, *codewindv1alpha1.Keycloak, DeploymentOptionsKeycloak, *x509.CertPool, util.RetryPolicy) error
+}
+
+// realmSettings : the settings pushed to the realm, in order. None are pushed to a shared realm
+func (r *ReconcileKeycloak) realmSettings(sharedRealm bool) []realmSetting {
+	if sharedRealm {
+		return nil
+	}
+	return []realmSetting{
+		{"mail server", r.reconcileSMTP},
+		{"security policy", r.reconcileSecurityPolicy},
+		{"branding", r.reconcileBranding},
+		{"user federation", r.reconcileUserFederation},
+		{"identity providers", r.reconcileIdentityProviders},
+	}
+}
+
+// keycloakRealm : The realm of the Codewind deployments named in the spec, else the default realm of the operator
+// config map, and whether it is shared with other applications
+func keycloakRealm(keycloak *codewindv1alpha1.Keycloak, defaultRealm string) (string, bool) {
+	if realm := keycloak.Spec.Realm; realm != nil {
+		if realm.Name != "" {
+			return realm.Name, realm.Shared
 		}
+		return defaultRealm, realm.Shared
 	}
+	return defaultRealm, false
+}
 
-	err = r.client.Status().Update(context.TODO(), keycloak)
-	if err != nil {
-		return reconcile.Result{}, err
+// syncKeycloakReplicas : Copies the replicas of the desired deployment to the existing one, along with the
+// clustering environment of the Keycloak container. Returns true when the existing deployment changed
+func syncKeycloakReplicas(existing *appsv1.Deployment, desired *appsv1.Deployment) bool {
+	if existing.Spec.Replicas != nil && *existing.Spec.Replicas == *desired.Spec.Replicas {
+		return false
 	}
-	return reconcile.Result{}, nil
+	existing.Spec.Replicas = desired.Spec.Replicas
+	for _, want := range desired.Spec.Template.Spec.Containers {
+		for i := range existing.Spec.Template.Spec.Containers {
+			if existing.Spec.Template.Spec.Containers[i].Name == want.Name {
+				existing.Spec.Template.Spec.Containers[i].Env = want.Env
+				existing.Spec.Template.Spec.Containers[i].Ports = want.Ports
+			}
+		}
+	}
+	return true
 }
 
 func fetchKeycloakPod(currentClient client.Client, authDeploymentName string) (*corev1.Pod, error) {
@@ -0,0 +1,120 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package keycloak
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fipsPasswordHash : Password policy rule hashing the passwords of the realm with a FIPS approved HMAC
+const fipsPasswordHash = "hashAlgorithm(pbkdf2-sha256)"
+
+// reconcileSecurityPolicy : Applies the password policy and brute force protection of the spec to the realm, setting
+// them back when they were changed in the admin console. In FIPS mode passwords are hashed with PBKDF2 SHA-256 and
+// every request must use HTTPS. The result is recorded in the SecurityPolicyReady condition.
+// Returns ErrKeycloakNotReady while Keycloak starts
+func (r *ReconcileKeycloak) reconcileSecurityPolicy(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	var settings []interface{}
+	if keycloak.Spec.PasswordPolicy != nil || util.FIPSMode {
+		var policy string
+		if keycloak.Spec.PasswordPolicy != nil {
+			policy = passwordPolicy(keycloak.Spec.PasswordPolicy)
+		}
+		if util.FIPSMode {
+			policy = fipsPasswordPolicy(policy)
+		}
+		settings = append(settings, security.RealmPasswordPolicy{PasswordPolicy: policy})
+	}
+	if util.FIPSMode {
+		settings = append(settings, security.RealmSSLRequired{SSLRequired: "all"})
+	}
+	if keycloak.Spec.BruteForceProtection != nil {
+		settings = append(settings, bruteForceProtection(keycloak.Spec.BruteForceProtection))
+	}
+	if len(settings) == 0 {
+		removeKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSecurityPolicyReady)
+		return nil
+	}
+
+	secretUser := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when applying the security policy", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return err
+	}
+	err = security.ConfigureRealmSettings(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, retryPolicy, settings...)
+	if err != nil {
+		if !errors.Is(err, security.ErrKeycloakNotReady) {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSecurityPolicyReady, corev1.ConditionFalse, security.ConfigFailureReason(err), err.Error())
+		}
+		return err
+	}
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSecurityPolicyReady, corev1.ConditionTrue, "Applied", "The security policy of the spec is applied to the realm")
+	return nil
+}
+
+// passwordPolicy : Keycloak policy string of the rules that are set, for example "length(12) and digits(1)"
+func passwordPolicy(policy *codewindv1alpha1.PasswordPolicySpec) string {
+	var rules []string
+	addRule := func(name string, value int32) {
+		if value > 0 {
+			rules = append(rules, fmt.Sprintf("%s(%d)", name, value))
+		}
+	}
+	addRule("length", policy.MinLength)
+	addRule("digits", policy.MinDigits)
+	addRule("lowerCase", policy.MinLowerCase)
+	addRule("upperCase", policy.MinUpperCase)
+	addRule("specialChars", policy.MinSpecialChars)
+	if policy.NotUsername {
+		rules = append(rules, "notUsername(undefined)")
+	}
+	addRule("passwordHistory", policy.PasswordHistory)
+	addRule("forceExpiredPasswordChange", policy.ExpireDays)
+	return strings.Join(rules, " and ")
+}
+
+// fipsPasswordPolicy : Adds the FIPS approved password hash to a Keycloak policy string
+func fipsPasswordPolicy(policy string) string {
+	if policy == "" {
+		return fipsPasswordHash
+	}
+	return policy + " and " + fipsPasswordHash
+}
+
+// bruteForceProtection : brute force detection settings of the spec, filling in the Keycloak defaults
+func bruteForceProtection(protection *codewindv1alpha1.BruteForceProtectionSpec) security.RealmBruteForceProtection {
+	valueOrDefault := func(value int32, defaultValue int32) int32 {
+		if value > 0 {
+			return value
+		}
+		return defaultValue
+	}
+	return security.RealmBruteForceProtection{
+		BruteForceProtected:   true,
+		PermanentLockout:      protection.PermanentLockout,
+		FailureFactor:         valueOrDefault(protection.MaxLoginFailures, 30),
+		WaitIncrementSeconds:  valueOrDefault(protection.WaitIncrementSeconds, 60),
+		MaxFailureWaitSeconds: valueOrDefault(protection.MaxWaitSeconds, 900),
+		MaxDeltaTimeSeconds:   valueOrDefault(protection.FailureResetSeconds, 43200),
+	}
+}
@@ -0,0 +1,105 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package keycloak
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reasonSMTPSecretInvalid : condition reason when the SMTP credentials secret is missing or incomplete
+const reasonSMTPSecretInvalid = "SMTPSecretInvalid"
+
+// reconcileSMTP : Pushes the mail server of the spec to the realm when it changed since the last push, and removes
+// it once the spec no longer has one. The result is recorded in the SMTPReady condition. Returns ErrKeycloakNotReady
+// while Keycloak starts
+func (r *ReconcileKeycloak) reconcileSMTP(reqLogger logr.Logger, keycloak *codewindv1alpha1.Keycloak, deploymentOptions DeploymentOptionsKeycloak, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	if keycloak.Spec.SMTP == nil && keycloak.Status.SMTPHash == "" {
+		return nil
+	}
+
+	var smtpServer *security.SMTPServer
+	hash := ""
+	if keycloak.Spec.SMTP != nil {
+		server, err := r.smtpServer(keycloak.Namespace, keycloak.Spec.SMTP)
+		if err != nil {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSMTPReady, corev1.ConditionFalse, reasonSMTPSecretInvalid, err.Error())
+			return err
+		}
+		hash, err = realmConfigHash(server)
+		if err != nil {
+			return err
+		}
+		if hash == keycloak.Status.SMTPHash {
+			return nil
+		}
+		smtpServer = &server
+	}
+
+	secretUser := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deploymentOptions.KeycloakSecretsName, Namespace: keycloak.Namespace}, secretUser)
+	if err != nil {
+		reqLogger.Error(err, "Unable to find the Keycloak secret when configuring the mail server", "Namespace", keycloak.Namespace, "name", deploymentOptions.KeycloakSecretsName)
+		return err
+	}
+	err = security.ConfigureRealmSMTP(deploymentOptions.KeycloakAccessURL, keycloak.Status.DefaultRealm, string(secretUser.Data["keycloak-admin-user"]), string(secretUser.Data["keycloak-admin-password"]), rootCAs, retryPolicy, smtpServer)
+	if err != nil {
+		if !errors.Is(err, security.ErrKeycloakNotReady) {
+			setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSMTPReady, corev1.ConditionFalse, security.ConfigFailureReason(err), err.Error())
+		}
+		return err
+	}
+	keycloak.Status.SMTPHash = hash
+	if smtpServer == nil {
+		reqLogger.Info("Removed the mail server of the realm", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm)
+		removeKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSMTPReady)
+		return nil
+	}
+	reqLogger.Info("Configured the mail server of the realm", "Namespace", keycloak.Namespace, "realm", keycloak.Status.DefaultRealm, "host", smtpServer.Host)
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakSMTPReady, corev1.ConditionTrue, "Configured", "Emails are sent through "+smtpServer.Host)
+	return nil
+}
+
+// smtpServer : Converts the SMTP spec into the mail server pushed to Keycloak, reading the credentials from their secret
+func (r *ReconcileKeycloak) smtpServer(namespace string, smtpSpec *codewindv1alpha1.KeycloakSMTPSpec) (security.SMTPServer, error) {
+	server := security.SMTPServer{
+		Host:            smtpSpec.Host,
+		Port:            smtpSpec.Port,
+		From:            smtpSpec.From,
+		FromDisplayName: smtpSpec.FromDisplayName,
+		SSL:             smtpSpec.SSL,
+		StartTLS:        smtpSpec.StartTLS,
+	}
+	if smtpSpec.CredentialsSecret == "" {
+		return server, nil
+	}
+
+	credentials := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: smtpSpec.CredentialsSecret, Namespace: namespace}, credentials)
+	if err != nil {
+		return server, fmt.Errorf("unable to read the SMTP credentials secret %s: %v", smtpSpec.CredentialsSecret, err)
+	}
+	server.User = string(credentials.Data["username"])
+	server.Password = string(credentials.Data["password"])
+	if server.User == "" || server.Password == "" {
+		return server, fmt.Errorf("SMTP credentials secret %s must hold a username and a password", smtpSpec.CredentialsSecret)
+	}
+	return server, nil
+}
@@ -0,0 +1,71 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package keycloak
+
+import (
+	"fmt"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/eclipse/codewind-operator/pkg/security"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getKeycloakCondition : Returns the condition of the given type, or nil when it has not been reported yet
+func getKeycloakCondition(keycloak *codewindv1alpha1.Keycloak, conditionType codewindv1alpha1.KeycloakConditionType) *codewindv1alpha1.KeycloakCondition {
+	for i := range keycloak.Status.Conditions {
+		if keycloak.Status.Conditions[i].Type == conditionType {
+			return &keycloak.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setKeycloakCondition : Records the result of a check. The transition time only moves when the status changes
+func setKeycloakCondition(keycloak *codewindv1alpha1.Keycloak, conditionType codewindv1alpha1.KeycloakConditionType, status corev1.ConditionStatus, reason string, message string) {
+	condition := getKeycloakCondition(keycloak, conditionType)
+	if condition == nil {
+		keycloak.Status.Conditions = append(keycloak.Status.Conditions, codewindv1alpha1.KeycloakCondition{Type: conditionType})
+		condition = &keycloak.Status.Conditions[len(keycloak.Status.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.Status = status
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// removeKeycloakCondition : Drops a condition that no longer applies, for example after its feature was removed from the spec
+func removeKeycloakCondition(keycloak *codewindv1alpha1.Keycloak, conditionType codewindv1alpha1.KeycloakConditionType) {
+	conditions := keycloak.Status.Conditions[:0]
+	for _, condition := range keycloak.Status.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	keycloak.Status.Conditions = conditions
+}
+
+// setAdminAPICondition : Records in the AdminAPIAvailable condition whether the operator sends requests to Keycloak or
+// has suspended them after repeated failures. Returns how long the requests stay suspended, zero once they may be sent
+func setAdminAPICondition(keycloak *codewindv1alpha1.Keycloak, authURL string) time.Duration {
+	circuit := security.KeycloakCircuitState(authURL)
+	if !circuit.Open {
+		setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakAdminAPIAvailable, corev1.ConditionTrue, "Available", "Requests are sent to "+authURL)
+		return 0
+	}
+	setKeycloakCondition(keycloak, codewindv1alpha1.KeycloakAdminAPIAvailable, corev1.ConditionFalse, string(security.CodeKeycloakCircuitOpen),
+		fmt.Sprintf("Requests to %s are suspended after %d consecutive failures, the next request probes Keycloak", authURL, circuit.Failures))
+	return circuit.RetryAfter
+}
@@ -0,0 +1,222 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	sdkzap "github.com/operator-framework/operator-sdk/pkg/log/zap"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	crzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// OperatorConfigLogLevelKey : Operator config map key holding the log level of the operator
+const OperatorConfigLogLevelKey = "operatorLogLevel"
+
+// level : Shared by every logger of the operator so that it can be changed while the operator runs
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+// defaultLevel : Level set on the command line, used when the operator config map does not set one
+var defaultLevel = zapcore.InfoLevel
+
+// Options : Settings of a logger built by NewLogger
+type Options struct {
+	// Development : console output at debug level without sampling, with stack traces from warnings on
+	Development bool
+
+	// Encoder : "json" for one JSON object per line or "console" for human readable output. Defaults to json, or
+	// console in development mode
+	Encoder string
+
+	// Level : debug, info, warn, error or a verbosity, a number above 0. Defaults to info, or debug in development mode
+	Level string
+
+	// Sample : "true" or "false", whether repeated messages are sampled. Defaults to true, false in development mode
+	// and for verbosities above 1
+	Sample string
+
+	// TimeEncoding : epoch, millis, nano or iso8601. Defaults to epoch, or iso8601 in development mode
+	TimeEncoding string
+}
+
+// recordedValue : A flag value keeping the text it was set to, the values of the operator-sdk flags are not exported
+type recordedValue struct {
+	pflag.Value
+	text string
+}
+
+// Set : Sets the wrapped value, which validates the text, and keeps the text
+func (v *recordedValue) Set(text string) error {
+	if err := v.Value.Set(text); err != nil {
+		return err
+	}
+	v.text = text
+	return nil
+}
+
+// zapFlags : the values of the flags of FlagSet by name
+var zapFlags = map[string]*recordedValue{}
+
+// FlagSet : Returns the --zap-devel, --zap-encoder, --zap-level, --zap-sample and --zap-time-encoding flags of the
+// operator-sdk, which OptionsFromFlags reads
+func FlagSet() *pflag.FlagSet {
+	flagSet := sdkzap.FlagSet()
+	flagSet.VisitAll(func(flag *pflag.Flag) {
+		if _, recorded := flag.Value.(*recordedValue); !recorded {
+			value := &recordedValue{Value: flag.Value}
+			flag.Value = value
+			zapFlags[flag.Name] = value
+		}
+	})
+	return flagSet
+}
+
+// flagText : the text a flag of FlagSet was set to on the command line, empty when it was not set
+func flagText(name string) string {
+	if value := zapFlags[name]; value != nil {
+		return value.text
+	}
+	return ""
+}
+
+// OptionsFromFlags : Returns the logger options set by the flags of FlagSet, once they are parsed
+func OptionsFromFlags() (Options, error) {
+	options := Options{
+		Encoder:      flagText("zap-encoder"),
+		Level:        flagText("zap-level"),
+		Sample:       flagText("zap-sample"),
+		TimeEncoding: flagText("zap-time-encoding"),
+	}
+	if text := flagText("zap-devel"); text != "" {
+		development, err := strconv.ParseBool(text)
+		if err != nil {
+			return options, fmt.Errorf("invalid --zap-devel %q: %v", text, err)
+		}
+		options.Development = development
+	}
+	return options, nil
+}
+
+// NewLogger : Returns the operator logger writing to stderr, with the defaults of the operator-sdk logger for the
+// options that are not set. The level of every logger follows the operator config map once ApplyOperatorConfig reads it
+func NewLogger(options Options) (logr.Logger, error) {
+	encoderName, initialLevel, sample, stacktraceLevel := "json", zapcore.InfoLevel, true, zapcore.ErrorLevel
+	encoderConfig := zap.NewProductionEncoderConfig()
+	zapOptions := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.AddSync(os.Stderr))}
+	if options.Development {
+		encoderName, initialLevel, sample, stacktraceLevel = "console", zapcore.DebugLevel, false, zapcore.WarnLevel
+		encoderConfig = zap.NewDevelopmentEncoderConfig()
+		zapOptions = append(zapOptions, zap.Development())
+	}
+	zapOptions = append(zapOptions, zap.AddStacktrace(stacktraceLevel))
+	if options.Level != "" {
+		parsed, err := parseLevel(options.Level)
+		if err != nil {
+			return nil, err
+		}
+		initialLevel = parsed
+	}
+	if options.Sample != "" {
+		parsed, err := strconv.ParseBool(options.Sample)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log sampling %q: %v", options.Sample, err)
+		}
+		sample = parsed
+	}
+	if initialLevel < zapcore.DebugLevel {
+		sample = false
+	}
+	switch options.TimeEncoding {
+	case "":
+	case "epoch":
+		encoderConfig.EncodeTime = zapcore.EpochTimeEncoder
+	case "millis":
+		encoderConfig.EncodeTime = zapcore.EpochMillisTimeEncoder
+	case "nano":
+		encoderConfig.EncodeTime = zapcore.EpochNanosTimeEncoder
+	case "iso8601":
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		return nil, fmt.Errorf("unsupported time encoding %q, use epoch, millis, nano or iso8601", options.TimeEncoding)
+	}
+	if options.Encoder != "" {
+		encoderName = options.Encoder
+	}
+	var encoder zapcore.Encoder
+	switch encoderName {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case "console":
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("unsupported log format %q, use json or console", encoderName)
+	}
+
+	defaultLevel = initialLevel
+	level.SetLevel(initialLevel)
+	encoder = &crzap.KubeAwareEncoder{Encoder: encoder}
+	core := zapcore.NewCore(encoder, zapcore.AddSync(os.Stderr), level)
+	if sample {
+		core = zapcore.NewSampler(core, time.Second, 100, 100)
+	}
+	return zapr.NewLogger(zap.New(core, zapOptions...)), nil
+}
+
+// ApplyOperatorConfig : Sets the log level from the operator config map, going back to the command line level when
+// the key is removed. Returns whether the level changed
+func ApplyOperatorConfig(operatorConfig map[string]string) (bool, error) {
+	wanted := defaultLevel
+	if value := operatorConfig[OperatorConfigLogLevelKey]; value != "" {
+		parsed, err := parseLevel(value)
+		if err != nil {
+			return false, err
+		}
+		wanted = parsed
+	}
+	if level.Level() == wanted {
+		return false, nil
+	}
+	level.SetLevel(wanted)
+	return true, nil
+}
+
+// Level : Returns the current log level
+func Level() string {
+	return level.Level().String()
+}
+
+// parseLevel : Parses debug, info, warn, error or a verbosity as the --zap-level flag does. debug and the
+// verbosity 1 enable the V(1) messages of the controllers, higher verbosities the messages of higher V levels
+func parseLevel(value string) (zapcore.Level, error) {
+	if verbosity, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		if verbosity <= 0 || verbosity > 127 {
+			return zapcore.InfoLevel, fmt.Errorf("unsupported log verbosity %q, use a number from 1 to 127", value)
+		}
+		return zapcore.Level(-verbosity), nil
+	}
+	parsed := zapcore.InfoLevel
+	if err := parsed.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return parsed, err
+	}
+	if parsed > zapcore.ErrorLevel {
+		return parsed, fmt.Errorf("unsupported log level %q, use debug, info, warn, error or a verbosity", value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var log = logf.Log.WithName("codewind-operator-metrics")
+
+var (
+	// ReconcileDuration : time taken by each reconcile of a Codewind or Keycloak CR
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "codewind_operator_reconcile_duration_seconds",
+		Help:    "Time taken to reconcile a Codewind or Keycloak custom resource",
+		Buckets: []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"kind", "namespace", "name"})
+
+	// KeycloakConfigFailures : failed Keycloak configuration steps, by step
+	KeycloakConfigFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "codewind_operator_keycloak_config_failures_total",
+		Help: "Keycloak configuration steps that failed, by step",
+	}, []string{"step"})
+
+	// ServiceWaitDuration : time spent waiting for a service such as Keycloak to respond, by result
+	ServiceWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "codewind_operator_service_wait_seconds",
+		Help:    "Time spent waiting for a service to respond",
+		Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120},
+	}, []string{"result"})
+
+	// KeycloakCircuitState : state of the circuit breaker of the requests to each Keycloak, 0 closed, 1 half-open, 2 open
+	KeycloakCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "codewind_operator_keycloak_circuit_state",
+		Help: "State of the circuit breaker of the requests to a Keycloak, 0 closed, 1 half-open and 2 open",
+	}, []string{"url"})
+
+	// KeycloakRequestsDelayed : requests to Keycloak that waited for the rate limit
+	KeycloakRequestsDelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "codewind_operator_keycloak_requests_delayed_total",
+		Help: "Requests to a Keycloak that waited for the rate limit of the operator",
+	}, []string{"url"})
+
+	// KeycloakRequestsShed : requests to Keycloak that were not sent, by reason
+	KeycloakRequestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "codewind_operator_keycloak_requests_shed_total",
+		Help: "Requests to a Keycloak that were not sent because the rate limit was exceeded or the circuit was open",
+	}, []string{"url", "reason"})
+
+	// instancesDesc : managed Codewind instances by phase, counted from the cache when scraped
+	instancesDesc = prometheus.NewDesc("codewind_operator_codewind_instances",
+		"Codewind custom resources managed by the operator, by phase",
+		[]string{"phase"}, nil)
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(ReconcileDuration, KeycloakConfigFailures, ServiceWaitDuration,
+		KeycloakCircuitState, KeycloakRequestsDelayed, KeycloakRequestsShed)
+}
+
+// ObserveReconcile : records the duration of a reconcile started at start, call it deferred from Reconcile
+func ObserveReconcile(kind string, request reconcile.Request, start time.Time) {
+	ReconcileDuration.WithLabelValues(kind, request.Namespace, request.Name).Observe(time.Since(start).Seconds())
+}
+
+// ObserveServiceWait : records the time spent waiting for a service started at start
+func ObserveServiceWait(ready bool, start time.Time) {
+	result := "ready"
+	if !ready {
+		result = "not_ready"
+	}
+	ServiceWaitDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// RegisterInstanceCollector : counts the managed Codewind instances by phase on every scrape, reading the CRs through reader
+func RegisterInstanceCollector(reader client.Reader) error {
+	return ctrlmetrics.Registry.Register(&instanceCollector{reader: reader})
+}
+
+// instanceCollector : collects the number of Codewind CRs in each phase
+type instanceCollector struct {
+	reader client.Reader
+}
+
+// Describe : the collector only reports the instances metric
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instancesDesc
+}
+
+// Collect : lists the CRs, nothing is reported when the list fails
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	codewinds := &codewindv1alpha1.CodewindList{}
+	err := c.reader.List(context.TODO(), codewinds)
+	if err != nil {
+		log.Error(err, "Unable to list the Codewind instances")
+		return
+	}
+	phases := map[codewindv1alpha1.CodewindPhase]int{
+		codewindv1alpha1.CodewindPhasePending:      0,
+		codewindv1alpha1.CodewindPhaseProvisioning: 0,
+		codewindv1alpha1.CodewindPhaseRunning:      0,
+		codewindv1alpha1.CodewindPhaseFailed:       0,
+		codewindv1alpha1.CodewindPhaseHibernated:   0,
+	}
+	for _, codewind := range codewinds.Items {
+		phase := codewind.Status.Phase
+		if phase == "" {
+			phase = codewindv1alpha1.CodewindPhasePending
+		}
+		phases[phase]++
+	}
+	for phase, count := range phases {
+		ch <- prometheus.MustNewConstMetric(instancesDesc, prometheus.GaugeValue, float64(count), string(phase))
+	}
+}
@@ -0,0 +1,293 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// WebhookURLKey : key of the operator config map with the URL notifications are posted to
+	WebhookURLKey = "notificationWebhookURL"
+
+	// AuthSecretKey : key of the operator config map naming the secret holding the Authorization header of the webhook
+	AuthSecretKey = "notificationAuthSecret"
+
+	// EventsKey : key of the operator config map listing the events that are posted, all of them by default
+	EventsKey = "notificationEvents"
+
+	// AuthorizationKey : key of the auth secret holding the value of the Authorization header, such as "Bearer <token>"
+	AuthorizationKey = "authorization"
+
+	// queueSize : notifications waiting to be posted, further notifications are only logged
+	queueSize = 100
+)
+
+// Events of a Codewind instance that are notified
+const (
+	// EventReady : the instance became Running
+	EventReady = "ready"
+
+	// EventFailed : the instance failed provisioning
+	EventFailed = "failed"
+
+	// EventDeleted : the instance was removed and its finalizers cleared
+	EventDeleted = "deleted"
+)
+
+// events : every event, posted when the operator config map does not filter them
+var events = []string{EventReady, EventFailed, EventDeleted}
+
+// Notification : The JSON payload posted for an event of a Codewind instance
+type Notification struct {
+	// Event : ready, failed or deleted
+	Event string `json:"event"`
+
+	// Time : when the operator observed the event
+	Time time.Time `json:"time"`
+
+	// Operator : pod of the operator that observed the event
+	Operator string `json:"operator"`
+
+	// Kind : kind of the CR, Codewind
+	Kind string `json:"kind"`
+
+	// Namespace and Name : the CR of the instance
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// WorkspaceID : workspace ID of the instance
+	WorkspaceID string `json:"workspaceID,omitempty"`
+
+	// Username : developer user of the instance
+	Username string `json:"username,omitempty"`
+
+	// Phase : phase of the instance when the event was observed
+	Phase string `json:"phase,omitempty"`
+
+	// Reason and Message : why the instance failed
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// AccessURL : URL of the gatekeeper of the instance
+	AccessURL string `json:"accessURL,omitempty"`
+
+	// Text : a one line summary of the event, shown by chat tools such as Slack incoming webhooks
+	Text string `json:"text"`
+}
+
+// log : notifications that cannot be posted are logged
+var log = logf.Log.WithName("codewind-operator-notification")
+
+// notifier : webhook of the operator config map and the queue feeding it
+var notifier = struct {
+	sync.Mutex
+	settings string
+	webhook  *Webhook
+	events   map[string]bool
+	queue    chan Notification
+}{}
+
+// operator : name of the operator pod, the hostname of its container
+var operator = func() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}()
+
+// Notify : Queues the notification for the webhook of the operator config map when its event is not filtered out.
+// Nothing is posted without a webhook
+func Notify(notification Notification) {
+	notification.Time = time.Now().UTC()
+	notification.Operator = operator
+	if notification.Text == "" {
+		notification.Text = summary(notification)
+	}
+	notifier.Lock()
+	defer notifier.Unlock()
+	if notifier.webhook == nil || !notifier.events[notification.Event] {
+		return
+	}
+	select {
+	case notifier.queue <- notification:
+	default:
+		log.Info("Notification queue is full, the notification was dropped", "event", notification.Event, "namespace", notification.Namespace, "name", notification.Name)
+	}
+}
+
+// summary : The text of a notification, such as "Codewind instance codewind/jane1 is ready at https://..."
+func summary(notification Notification) string {
+	instance := fmt.Sprintf("%s instance %s/%s", notification.Kind, notification.Namespace, notification.Name)
+	switch notification.Event {
+	case EventReady:
+		if notification.AccessURL != "" {
+			return fmt.Sprintf("%s is ready at %s", instance, notification.AccessURL)
+		}
+		return instance + " is ready"
+	case EventFailed:
+		if notification.Message != "" {
+			return fmt.Sprintf("%s failed: %s", instance, notification.Message)
+		}
+		return instance + " failed"
+	case EventDeleted:
+		return instance + " was deleted"
+	}
+	return fmt.Sprintf("%s: %s", instance, notification.Event)
+}
+
+// deliver : Posts the queued notifications one at a time, in the order they were observed
+func deliver(queue chan Notification) {
+	for notification := range queue {
+		notifier.Lock()
+		webhook := notifier.webhook
+		notifier.Unlock()
+		if webhook == nil {
+			continue
+		}
+		if err := webhook.Post(notification); err != nil {
+			log.Error(err, "Unable to post the notification", "event", notification.Event, "namespace", notification.Namespace, "name", notification.Name)
+		}
+	}
+}
+
+// ApplyConfig : Posts notifications to the webhook of the operator config map, with the Authorization header read
+// from the auth secret in the namespace of the operator, and stops posting them once the URL is removed. An invalid
+// URL, event or auth secret is reported and no notification is posted until it is corrected. Returns whether the
+// webhook changed
+func ApplyConfig(c client.Client, namespace string, data map[string]string) (bool, error) {
+	webhookURL := strings.TrimSpace(data[WebhookURLKey])
+	secretName := strings.TrimSpace(data[AuthSecretKey])
+	selected := map[string]bool{}
+	var err error
+	if webhookURL != "" {
+		parsed, parseErr := url.Parse(webhookURL)
+		if parseErr != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			err = fmt.Errorf("%s must be an http or https URL, not %q", WebhookURLKey, webhookURL)
+			webhookURL = ""
+		}
+	}
+	if value := strings.TrimSpace(data[EventsKey]); value != "" {
+		for _, event := range strings.Split(value, ",") {
+			event = strings.ToLower(strings.TrimSpace(event))
+			if !validEvent(event) {
+				err = fmt.Errorf("%s must be a comma separated list of %s, not %q", EventsKey, strings.Join(events, ", "), value)
+				webhookURL = ""
+				break
+			}
+			selected[event] = true
+		}
+	} else {
+		for _, event := range events {
+			selected[event] = true
+		}
+	}
+	authorization := ""
+	if webhookURL != "" && secretName != "" {
+		secret := &corev1.Secret{}
+		getErr := c.Get(context.TODO(), types.NamespacedName{Name: secretName, Namespace: namespace}, secret)
+		if getErr != nil {
+			err = fmt.Errorf("%s secret %s cannot be read: %v", AuthSecretKey, secretName, getErr)
+			webhookURL = ""
+		} else if authorization = strings.TrimSpace(string(secret.Data[AuthorizationKey])); authorization == "" {
+			err = fmt.Errorf("%s secret %s has no %s key", AuthSecretKey, secretName, AuthorizationKey)
+			webhookURL = ""
+		}
+	}
+
+	settings := fmt.Sprintf("%s/%s/%v", webhookURL, authorization, selected)
+	notifier.Lock()
+	defer notifier.Unlock()
+	if settings == notifier.settings {
+		return false, err
+	}
+	notifier.settings = settings
+	notifier.events = selected
+	notifier.webhook = nil
+	if webhookURL != "" {
+		notifier.webhook = NewWebhook(webhookURL, authorization)
+		if notifier.queue == nil {
+			notifier.queue = make(chan Notification, queueSize)
+			go deliver(notifier.queue)
+		}
+	}
+	return true, err
+}
+
+// validEvent : Reports whether the event can be selected in the operator config map
+func validEvent(event string) bool {
+	for _, known := range events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook : Posts notifications as JSON objects to a URL, for example a Slack incoming webhook or a ServiceNow
+// scripted REST endpoint
+type Webhook struct {
+	URL           string
+	Authorization string
+	Client        util.HTTPClient
+}
+
+// NewWebhook : Returns a webhook posting to the URL through the proxy of the operator, attempting a notification
+// again after timeouts and 5xx responses
+func NewWebhook(webhookURL string, authorization string) *Webhook {
+	return &Webhook{
+		URL:           webhookURL,
+		Authorization: authorization,
+		Client: &util.RetryingHTTPClient{
+			Client: util.NewHTTPClient(util.HTTPClientOptions{Timeout: time.Second * 10}),
+			Policy: util.RetryPolicy{MaxAttempts: 3, Timeout: time.Second * 10},
+		},
+	}
+}
+
+// Post : Posts the notification, failing unless the webhook answers with a 2xx status
+func (w *Webhook) Post(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Authorization != "" {
+		req.Header.Set("Authorization", w.Authorization)
+	}
+	response, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook answered with HTTP status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// AuditConfigMapKey : key of the operator config map naming the config map audit records are appended to
+	AuditConfigMapKey = "auditConfigMap"
+
+	// AuditMaxRecordsKey : key of the operator config map limiting the records kept in the audit config map
+	AuditMaxRecordsKey = "auditMaxRecords"
+
+	// AuditWebhookURLKey : key of the operator config map with the URL audit records are posted to
+	AuditWebhookURLKey = "auditWebhookURL"
+
+	// AuditRecordsKey : key of the audit config map holding the records, one JSON object per line
+	AuditRecordsKey = "audit.jsonl"
+
+	// defaultAuditMaxRecords : records kept in the audit config map when the operator config map sets no limit.
+	// A record takes about 400 bytes, well below the size limit of a config map
+	defaultAuditMaxRecords = 1000
+
+	// auditQueueSize : records waiting for the sinks, further records are only logged
+	auditQueueSize = 500
+)
+
+// Results of an audited change
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditRecord : A change the operator made, or attempted, to the configuration of Keycloak
+type AuditRecord struct {
+	// Time : when Keycloak answered the request
+	Time time.Time `json:"time"`
+
+	// Actor : Keycloak admin user the operator authenticated as
+	Actor string `json:"actor"`
+
+	// Operator : pod of the operator that sent the request
+	Operator string `json:"operator"`
+
+	// WorkspaceID : Codewind instance the change was made for, empty for changes of a realm
+	WorkspaceID string `json:"workspaceID,omitempty"`
+
+	// AuthURL : Keycloak that was changed
+	AuthURL string `json:"authURL"`
+
+	// Realm : realm that was changed, or that holds the changed resource
+	Realm string `json:"realm,omitempty"`
+
+	// Resource : kind of the changed resource, such as realm, client, role or role-mapping
+	Resource string `json:"resource"`
+
+	// Path : path of the resource in the realm, as in the admin REST API
+	Path string `json:"path,omitempty"`
+
+	// Action : create, update or delete
+	Action string `json:"action"`
+
+	// Result : success, or failure when Keycloak rejected the request or did not answer
+	Result string `json:"result"`
+
+	// StatusCode : HTTP status of the response, 0 without a response
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Error : why the request failed without a response
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink : A destination of audit records besides the operator log
+type AuditSink interface {
+	Write(records []AuditRecord) error
+}
+
+// auditLog : every audit record is logged, whether sinks are configured or not
+var auditLog = logf.Log.WithName("codewind-operator-audit")
+
+// auditor : sinks of the operator config map and the queue feeding them
+var auditor = struct {
+	sync.Mutex
+	settings string
+	sinks    []AuditSink
+	queue    chan AuditRecord
+}{}
+
+// auditOperator : name of the operator pod, the hostname of its container
+var auditOperator = func() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}()
+
+// auditActions : actions of the methods of the admin REST API that change the configuration
+var auditActions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodDelete: "delete",
+}
+
+// auditResources : resource kinds of the collections of a realm, role mappings of users and groups are reported as
+// role-mapping wherever they appear in the path
+var auditResources = map[string]string{
+	"clients":           "client",
+	"client-scopes":     "client-scope",
+	"roles":             "role",
+	"users":             "user",
+	"groups":            "group",
+	"components":        "user-federation",
+	"identity-provider": "identity-provider",
+}
+
+// auditingHTTPClient : Records an audit record of each request changing the configuration of Keycloak, after the
+// retries of the wrapped client
+type auditingHTTPClient struct {
+	client         util.HTTPClient
+	keycloakConfig *KeycloakConfiguration
+}
+
+// Do : Sends the request, recording it when it changes the configuration
+func (c *auditingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	record, audited := auditedChange(req.Method, req.URL.EscapedPath())
+	response, err := c.client.Do(req)
+	if !audited {
+		return response, err
+	}
+	record.Time = time.Now().UTC()
+	record.Actor = c.keycloakConfig.KeycloakAdminUsername
+	record.Operator = auditOperator
+	record.WorkspaceID = c.keycloakConfig.WorkspaceID
+	record.AuthURL = c.keycloakConfig.AuthURL
+	if record.Realm == "" {
+		record.Realm = c.keycloakConfig.RealmName
+	}
+	record.Result = AuditResultSuccess
+	if err != nil {
+		record.Result = AuditResultFailure
+		record.Error = err.Error()
+	} else {
+		record.StatusCode = response.StatusCode
+		if response.StatusCode >= 300 {
+			record.Result = AuditResultFailure
+		}
+	}
+	recordAudit(record)
+	return response, err
+}
+
+// auditedChange : Classifies a request of the admin REST API. Reads, token requests and realm exports, which are
+// sent with POST, are not changes and are not audited
+func auditedChange(method string, path string) (AuditRecord, bool) {
+	action, ok := auditActions[method]
+	if !ok {
+		return AuditRecord{}, false
+	}
+	index := strings.Index(path, "/admin/realms")
+	if index < 0 {
+		return AuditRecord{}, false
+	}
+	record := AuditRecord{Action: action, Resource: "realm"}
+	rest := strings.Trim(path[index+len("/admin/realms"):], "/")
+	if rest == "" {
+		// A new realm is posted to the collection of realms
+		return record, true
+	}
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	record.Realm = segments[0]
+	if len(segments) == 1 {
+		return record, true
+	}
+	record.Path = strings.Join(segments[1:], "/")
+	if segments[1] == "partial-export" {
+		return AuditRecord{}, false
+	}
+	record.Resource = segments[1]
+	if resource, ok := auditResources[segments[1]]; ok {
+		record.Resource = resource
+	}
+	for _, segment := range segments[2:] {
+		if segment == "role-mappings" {
+			record.Resource = "role-mapping"
+		}
+	}
+	return record, true
+}
+
+// recordAudit : Logs the record and queues it for the sinks of the operator config map
+func recordAudit(record AuditRecord) {
+	auditLog.Info("Keycloak configuration changed", "actor", record.Actor, "operator", record.Operator, "workspaceID", record.WorkspaceID,
+		"authURL", record.AuthURL, "realm", record.Realm, "resource", record.Resource, "path", record.Path, "action", record.Action,
+		"result", record.Result, "statusCode", record.StatusCode, "error", record.Error)
+	auditor.Lock()
+	defer auditor.Unlock()
+	if len(auditor.sinks) == 0 {
+		return
+	}
+	select {
+	case auditor.queue <- record:
+	default:
+		auditLog.Info("Audit queue is full, the record was only logged", "realm", record.Realm, "resource", record.Resource, "path", record.Path)
+	}
+}
+
+// deliverAuditRecords : Writes the queued records to the sinks, in batches of the records queued while the previous
+// batch was written
+func deliverAuditRecords(queue chan AuditRecord) {
+	for record := range queue {
+		batch := []AuditRecord{record}
+	drain:
+		for len(batch) < auditQueueSize {
+			select {
+			case next := <-queue:
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		auditor.Lock()
+		sinks := auditor.sinks
+		auditor.Unlock()
+		for _, sink := range sinks {
+			if err := sink.Write(batch); err != nil {
+				auditLog.Error(err, "Unable to write audit records", "records", len(batch))
+			}
+		}
+	}
+}
+
+// ApplyAuditConfig : Sends the audit records to the config map and the webhook of the operator config map, and only
+// logs them once the keys are removed. The config map is kept in the namespace of the operator. An invalid limit of
+// records is replaced by the default and reported, an invalid webhook URL is reported and not used. Returns whether the
+// sinks changed
+func ApplyAuditConfig(c client.Client, namespace string, data map[string]string) (bool, error) {
+	configMapName := strings.TrimSpace(data[AuditConfigMapKey])
+	webhookURL := strings.TrimSpace(data[AuditWebhookURLKey])
+	maxRecords := defaultAuditMaxRecords
+	var err error
+	if value := strings.TrimSpace(data[AuditMaxRecordsKey]); value != "" {
+		parsed, parseErr := strconv.Atoi(value)
+		if parseErr != nil || parsed < 1 {
+			err = fmt.Errorf("%s must be a positive number of records, not %q", AuditMaxRecordsKey, value)
+		} else {
+			maxRecords = parsed
+		}
+	}
+	if webhookURL != "" {
+		parsed, parseErr := url.Parse(webhookURL)
+		if parseErr != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			err = fmt.Errorf("%s must be an http or https URL, not %q", AuditWebhookURLKey, webhookURL)
+			webhookURL = ""
+		}
+	}
+
+	settings := fmt.Sprintf("%s/%s/%d/%s", namespace, configMapName, maxRecords, webhookURL)
+	auditor.Lock()
+	defer auditor.Unlock()
+	if settings == auditor.settings {
+		return false, err
+	}
+	auditor.settings = settings
+	auditor.sinks = nil
+	if configMapName != "" {
+		auditor.sinks = append(auditor.sinks, &ConfigMapAuditSink{Client: c, Namespace: namespace, Name: configMapName, MaxRecords: maxRecords})
+	}
+	if webhookURL != "" {
+		auditor.sinks = append(auditor.sinks, NewWebhookAuditSink(webhookURL))
+	}
+	if len(auditor.sinks) > 0 && auditor.queue == nil {
+		auditor.queue = make(chan AuditRecord, auditQueueSize)
+		go deliverAuditRecords(auditor.queue)
+	}
+	return true, err
+}
+
+// ConfigMapAuditSink : Appends audit records to a config map, dropping the oldest records beyond MaxRecords
+type ConfigMapAuditSink struct {
+	Client     client.Client
+	Namespace  string
+	Name       string
+	MaxRecords int
+}
+
+// Write : Appends the records to the config map, creating it when it does not exist
+func (s *ConfigMapAuditSink) Write(records []AuditRecord) error {
+	lines := make([]string, 0, len(records))
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, string(line))
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := &corev1.ConfigMap{}
+		err := s.Client.Get(context.TODO(), types.NamespacedName{Name: s.Name, Namespace: s.Namespace}, configMap)
+		if k8serr.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.Name,
+					Namespace: s.Namespace,
+					Labels:    map[string]string{"app": "codewind-operator", "codewind.eclipse.org/audit": "true"},
+				},
+				Data: map[string]string{AuditRecordsKey: s.keep(lines)},
+			}
+			err = s.Client.Create(context.TODO(), configMap)
+			if k8serr.IsAlreadyExists(err) {
+				// Created by another replica, retried as a conflict
+				return k8serr.NewConflict(corev1.Resource("configmaps"), s.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		existing := strings.Split(strings.TrimSuffix(configMap.Data[AuditRecordsKey], "\n"), "\n")
+		if len(existing) == 1 && existing[0] == "" {
+			existing = nil
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[AuditRecordsKey] = s.keep(append(existing, lines...))
+		return s.Client.Update(context.TODO(), configMap)
+	})
+}
+
+// keep : The newest MaxRecords lines, one record per line
+func (s *ConfigMapAuditSink) keep(lines []string) string {
+	if s.MaxRecords > 0 && len(lines) > s.MaxRecords {
+		lines = lines[len(lines)-s.MaxRecords:]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// WebhookAuditSink : Posts audit records as a JSON array to a URL, for example the HTTP input of a log store or a SIEM
+type WebhookAuditSink struct {
+	URL    string
+	Client util.HTTPClient
+}
+
+// NewWebhookAuditSink : Returns a sink posting to the URL through the proxy of the operator
+func NewWebhookAuditSink(webhookURL string) *WebhookAuditSink {
+	return &WebhookAuditSink{
+		URL:    webhookURL,
+		Client: util.NewHTTPClient(util.HTTPClientOptions{Timeout: time.Second * 10}),
+	}
+}
+
+// Write : Posts the records, failing unless the webhook answers with a 2xx status
+func (s *WebhookAuditSink) Write(records []AuditRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook answered with HTTP status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// ErrOIDCDiscovery : the discovery document of an external OIDC provider could not be read
+var ErrOIDCDiscovery = errors.New("oidc discovery failed")
+
+// ErrRotationUnsupported : the provider cannot generate a new client secret for the operator
+var ErrRotationUnsupported = errors.New("client secret rotation is not supported by the provider")
+
+// ErrRemoteAccessUnsupported : the provider cannot issue offline tokens of a machine user for the operator
+var ErrRemoteAccessUnsupported = errors.New("remote access tokens are not supported by the provider")
+
+// GatekeeperAuth : Authentication settings handed to the Codewind gatekeeper and PFE
+type GatekeeperAuth struct {
+	AuthURL   string
+	AuthHost  string
+	Realm     string
+	ClientID  string
+	IssuerURL string
+}
+
+// AuthProvider : An identity provider that a Codewind deployment authenticates against
+type AuthProvider interface {
+	// ConfigureDeployment : prepares the provider for the deployment and returns the gatekeeper client secret
+	ConfigureDeployment() (string, error)
+
+	// RemoveDeployment : removes anything ConfigureDeployment created for the deployment
+	RemoveDeployment() error
+
+	// UpdateAccess : grants access to the users of a configured deployment and revokes it from removed users
+	UpdateAccess() error
+
+	// UpdateSessionSettings : applies changed token and session lifetimes to a configured deployment
+	UpdateSessionSettings() error
+
+	// UpdateServiceAccount : enables or disables the client credentials access of a configured deployment
+	UpdateServiceAccount() error
+
+	// UpdateTokenClaims : applies changed token claims to a configured deployment
+	UpdateTokenClaims() error
+
+	// IssueRemoteAccessToken : returns a new offline token of the machine user of a configured deployment, for IDE
+	// remote connections. clientSecret is the gatekeeper client secret
+	IssueRemoteAccessToken(clientSecret string) (*RemoteAccessToken, error)
+
+	// RemoveRemoteAccess : removes the machine user of the deployment, revoking the offline tokens issued for it
+	RemoveRemoteAccess() error
+
+	// UpdateRedirectURL : replaces the previous gatekeeper URL of a configured deployment after its hostname changed
+	UpdateRedirectURL(previousURL string) error
+
+	// CurrentClientSecret : the gatekeeper client secret currently held by the provider, without configuring anything
+	CurrentClientSecret() (string, error)
+
+	// RotateClientSecret : replaces the gatekeeper client secret with a new one and returns it
+	RotateClientSecret() (string, error)
+
+	// RepairDrift : restores the configuration of a configured deployment changed outside the operator and returns
+	// a description of each repair
+	RepairDrift() ([]string, error)
+
+	// GatekeeperAuth : settings the gatekeeper needs to reach the provider
+	GatekeeperAuth() GatekeeperAuth
+}
+
+// KeycloakAuthProvider : Keycloak deployment managed by the operator
+type KeycloakAuthProvider struct {
+	Config KeycloakConfiguration
+}
+
+// NewKeycloakAuthProvider : returns an AuthProvider that registers deployments in Keycloak
+func NewKeycloakAuthProvider(keycloakConfig KeycloakConfiguration) *KeycloakAuthProvider {
+	return &KeycloakAuthProvider{Config: keycloakConfig}
+}
+
+// ConfigureDeployment : adds the realm, client, access role and user grant to Keycloak
+func (p *KeycloakAuthProvider) ConfigureDeployment() (string, error) {
+	return AddCodewindToKeycloak(p.Config)
+}
+
+// RemoveDeployment : removes the user role mapping, access role and client from Keycloak
+func (p *KeycloakAuthProvider) RemoveDeployment() error {
+	return RemoveCodewindFromKeycloak(p.Config)
+}
+
+// UpdateAccess : grants the access role of the deployment to its users and removes it from revoked users
+func (p *KeycloakAuthProvider) UpdateAccess() error {
+	return UpdateCodewindAccess(p.Config)
+}
+
+// UpdateSessionSettings : sets the token and session lifetimes of the deployment client
+func (p *KeycloakAuthProvider) UpdateSessionSettings() error {
+	return UpdateCodewindSessionSettings(p.Config)
+}
+
+// UpdateServiceAccount : sets the service account of the deployment client and its access role
+func (p *KeycloakAuthProvider) UpdateServiceAccount() error {
+	return UpdateCodewindServiceAccount(p.Config)
+}
+
+// UpdateTokenClaims : syncs the protocol mappers of the deployment client with the Codewind CR
+func (p *KeycloakAuthProvider) UpdateTokenClaims() error {
+	return UpdateCodewindTokenClaims(p.Config)
+}
+
+// IssueRemoteAccessToken : creates the machine user of the deployment and requests an offline token for it
+func (p *KeycloakAuthProvider) IssueRemoteAccessToken(clientSecret string) (*RemoteAccessToken, error) {
+	return IssueCodewindRemoteAccessToken(p.Config, clientSecret)
+}
+
+// RemoveRemoteAccess : deletes the machine user of the deployment
+func (p *KeycloakAuthProvider) RemoveRemoteAccess() error {
+	return RemoveCodewindRemoteAccess(p.Config)
+}
+
+// UpdateRedirectURL : replaces the previous gatekeeper URL in the redirect URIs and web origins of the deployment client
+func (p *KeycloakAuthProvider) UpdateRedirectURL(previousURL string) error {
+	return UpdateCodewindRedirectURL(p.Config, previousURL)
+}
+
+// CurrentClientSecret : reads the secret of the deployment client from Keycloak, which changes when an administrator
+// regenerates it in the admin console
+func (p *KeycloakAuthProvider) CurrentClientSecret() (string, error) {
+	return FetchCodewindClientSecret(p.Config)
+}
+
+// RotateClientSecret : has Keycloak generate a new secret for the deployment client
+func (p *KeycloakAuthProvider) RotateClientSecret() (string, error) {
+	return RegenerateCodewindClientSecret(p.Config)
+}
+
+// RepairDrift : recreates or re-enables the realm, client and access role of the deployment when an administrator
+// deleted or disabled them, and restores the redirect URI of the client
+func (p *KeycloakAuthProvider) RepairDrift() ([]string, error) {
+	return RepairCodewindConfiguration(p.Config)
+}
+
+// GatekeeperAuth : Keycloak URL, realm and client of the deployment
+func (p *KeycloakAuthProvider) GatekeeperAuth() GatekeeperAuth {
+	return GatekeeperAuth{
+		AuthURL:   p.Config.AuthURL,
+		AuthHost:  strings.TrimPrefix(p.Config.AuthURL, "https://"),
+		Realm:     p.Config.RealmName,
+		ClientID:  p.Config.ClientName,
+		IssuerURL: p.Config.realmURL(p.Config.RealmName, ""),
+	}
+}
+
+// ExternalOIDCAuthProvider : OIDC provider not managed by the operator. The client must already be
+// registered with the provider, nothing is provisioned.
+type ExternalOIDCAuthProvider struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RootCAs      *x509.CertPool
+}
+
+// ConfigureDeployment : checks that the issuer publishes a discovery document and returns the supplied client secret
+func (p *ExternalOIDCAuthProvider) ConfigureDeployment() (string, error) {
+	log.Info("Checking OIDC issuer", "issuer", p.IssuerURL, "client", p.ClientID)
+	httpClient := util.NewHTTPClient(util.HTTPClientOptions{Timeout: time.Second * 10, RootCAs: p.RootCAs, InsecureSkipVerify: true})
+	req, err := http.NewRequest("GET", strings.TrimSuffix(p.IssuerURL, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", &KeycloakConfigError{Step: ErrOIDCDiscovery, Err: err}
+	}
+	req.Header.Add("Accept", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", &KeycloakConfigError{Step: ErrOIDCDiscovery, Err: err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", &KeycloakConfigError{Step: ErrOIDCDiscovery, Err: errors.New("OIDC discovery returned HTTP " + res.Status)}
+	}
+
+	discovery := struct {
+		Issuer string `json:"issuer"`
+	}{}
+	body, err := ioutil.ReadAll(res.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &discovery)
+	}
+	if err != nil {
+		return "", &KeycloakConfigError{Step: ErrOIDCDiscovery, Err: err}
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(p.IssuerURL, "/") {
+		return "", &KeycloakConfigError{Step: ErrOIDCDiscovery, Err: fmt.Errorf("OIDC discovery issuer %s does not match %s", discovery.Issuer, p.IssuerURL)}
+	}
+	return p.ClientSecret, nil
+}
+
+// RemoveDeployment : nothing was provisioned in the external provider
+func (p *ExternalOIDCAuthProvider) RemoveDeployment() error {
+	return nil
+}
+
+// UpdateAccess : access to the client is managed in the external provider
+func (p *ExternalOIDCAuthProvider) UpdateAccess() error {
+	return nil
+}
+
+// UpdateSessionSettings : lifetimes of the external provider are managed with the provider, only the gatekeeper uses them
+func (p *ExternalOIDCAuthProvider) UpdateSessionSettings() error {
+	return nil
+}
+
+// UpdateServiceAccount : service accounts of an external provider are registered with the provider, the webhook rejects them
+func (p *ExternalOIDCAuthProvider) UpdateServiceAccount() error {
+	return nil
+}
+
+// UpdateTokenClaims : claims of an external provider are configured with the provider, the webhook rejects them
+func (p *ExternalOIDCAuthProvider) UpdateTokenClaims() error {
+	return nil
+}
+
+// IssueRemoteAccessToken : machine users of an external provider are registered with the provider, the webhook rejects them
+func (p *ExternalOIDCAuthProvider) IssueRemoteAccessToken(clientSecret string) (*RemoteAccessToken, error) {
+	return nil, ErrRemoteAccessUnsupported
+}
+
+// RemoveRemoteAccess : nothing was provisioned in the external provider
+func (p *ExternalOIDCAuthProvider) RemoveRemoteAccess() error {
+	return nil
+}
+
+// UpdateRedirectURL : redirect URIs of an external provider are registered with the provider
+func (p *ExternalOIDCAuthProvider) UpdateRedirectURL(previousURL string) error {
+	return nil
+}
+
+// CurrentClientSecret : the client secret supplied for the external provider
+func (p *ExternalOIDCAuthProvider) CurrentClientSecret() (string, error) {
+	return p.ClientSecret, nil
+}
+
+// RotateClientSecret : the secret of an external provider is rotated with the provider, then updated in its secret
+func (p *ExternalOIDCAuthProvider) RotateClientSecret() (string, error) {
+	return "", ErrRotationUnsupported
+}
+
+// RepairDrift : the client of an external provider is managed with the provider
+func (p *ExternalOIDCAuthProvider) RepairDrift() ([]string, error) {
+	return nil, nil
+}
+
+// GatekeeperAuth : issuer and client of the deployment, there is no realm
+func (p *ExternalOIDCAuthProvider) GatekeeperAuth() GatekeeperAuth {
+	authHost := p.IssuerURL
+	if issuer, err := url.Parse(p.IssuerURL); err == nil {
+		authHost = issuer.Host
+	}
+	return GatekeeperAuth{
+		AuthURL:   p.IssuerURL,
+		AuthHost:  authHost,
+		ClientID:  p.ClientID,
+		IssuerURL: p.IssuerURL,
+	}
+}
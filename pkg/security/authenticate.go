@@ -12,8 +12,8 @@
 package security
 
 import (
+	"crypto/x509"
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -23,13 +23,14 @@ import (
 
 // AuthToken from the keycloak server after successfully authenticating
 type AuthToken struct {
-	AccessToken     string `json:"access_token"`
-	ExpiresIn       int    `json:"expires_in"`
-	RefreshToken    string `json:"refresh_token"`
-	TokenType       string `json:"token_type"`
-	NotBeforePolicy int    `json:"not-before-policy"`
-	SessionState    string `json:"session_state"`
-	Scope           string `json:"scope"`
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	NotBeforePolicy  int    `json:"not-before-policy"`
+	SessionState     string `json:"session_state"`
+	Scope            string `json:"scope"`
 }
 
 // KeycloakConfiguration : Keycloak configuration for an instance of codewind
@@ -42,16 +43,62 @@ type KeycloakConfiguration struct {
 	DevUsername           string
 	GatekeeperPublicURL   string
 	ClientName            string
+	ProtocolMappers       []ProtocolMapper
+	ClientScopes          []string
+	RootCAs               *x509.CertPool
+
+	// Distribution : decides the context root of the REST API, detected on first use when not set
+	Distribution KeycloakDistribution
+
+	// SharedRealm : the realm is owned by another application, it is checked but never created
+	SharedRealm bool
+
+	// SessionSettings : token and session lifetimes of the deployment client
+	SessionSettings ClientSessionSettings
+
+	// ServiceAccountEnabled : the deployment client has a service account holding the access role, for CI pipelines
+	ServiceAccountEnabled bool
+
+	// TokenClaimMappers : protocol mappers declared on the Codewind CR, kept in sync with the client. Mappers named
+	// with TokenClaimMapperPrefix that are not listed are removed
+	TokenClaimMappers []ProtocolMapper
+
+	// RetryPolicy : retries of Keycloak REST calls failing with timeouts and 5xx responses, defaults when not set
+	RetryPolicy util.RetryPolicy
+
+	// AccessList : further users granted the access role of the deployment along with DevUsername
+	AccessList []string
+	// RevokedUsers : users whose access role is removed, for example after they were dropped from AccessList
+	RevokedUsers []string
+	// AccessGroups : groups granted the access role of the deployment, missing groups are created
+	AccessGroups []string
+	// RevokedGroups : groups whose access role is removed, for example after they were dropped from AccessGroups
+	RevokedGroups []string
+
+	// DevUserInitialPassword : temporary password set only when the dev user is created. Never log this value.
+	DevUserInitialPassword string
+	DevUserRequiredActions []string
 }
 
 // SecAuthenticate - sends credentials to the auth server for a specific realm and returns an AuthToken
 // connectionRealm can be used to override the supplied context arguments
 func SecAuthenticate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration) (*AuthToken, *SecError) {
+	payload := "grant_type=password&client_id=" + KeycloakAdminClientID + "&username=" + keycloakConfig.KeycloakAdminUsername + "&password=" + keycloakConfig.KeycloakAdminPassword
+	return requestAdminToken(httpClient, keycloakConfig, payload)
+}
+
+// SecRefreshToken - exchanges the refresh token of an admin session for a new AuthToken
+func SecRefreshToken(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, refreshToken string) (*AuthToken, *SecError) {
+	payload := "grant_type=refresh_token&client_id=" + KeycloakAdminClientID + "&refresh_token=" + refreshToken
+	return requestAdminToken(httpClient, keycloakConfig, payload)
+}
+
+// requestAdminToken : posts a token request of the admin client to the master realm
+func requestAdminToken(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, payload string) (*AuthToken, *SecError) {
 
 	// build REST request to Keycloak
-	url := keycloakConfig.AuthURL + "/auth/realms/master/protocol/openid-connect/token"
-	payload := strings.NewReader("grant_type=password&client_id=" + KeycloakAdminClientID + "&username=" + keycloakConfig.KeycloakAdminUsername + "&password=" + keycloakConfig.KeycloakAdminPassword)
-	req, err := http.NewRequest("POST", url, payload)
+	url := keycloakConfig.realmURL("master", "/protocol/openid-connect/token")
+	req, err := http.NewRequest("POST", url, strings.NewReader(payload))
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
@@ -73,17 +120,17 @@ func SecAuthenticate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigu
 	switch httpCode := res.StatusCode; {
 	case httpCode == http.StatusBadRequest, httpCode == http.StatusUnauthorized:
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
-		kcError := errors.New(string(keycloakAPIError.ErrorDescription))
+		kcError := newResponseError(res.StatusCode, string(keycloakAPIError.ErrorDescription))
 		return nil, &SecError{keycloakAPIError.Error, kcError, kcError.Error()}
 	case httpCode == http.StatusNotFound:
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
-		kcError := errors.New(string(keycloakAPIError.Error))
+		kcError := newResponseError(res.StatusCode, string(keycloakAPIError.Error))
 		return nil, &SecError{errOpResponse, kcError, kcError.Error()}
 	case httpCode == http.StatusServiceUnavailable:
-		txtError := errors.New(textAuthIsDown)
+		txtError := newResponseError(res.StatusCode, textAuthIsDown)
 		return nil, &SecError{errOpResponse, txtError, txtError.Error()}
 	case httpCode != http.StatusOK:
-		err = errors.New(string(body))
+		err = newResponseError(res.StatusCode, string(body))
 		return nil, &SecError{errOpResponse, err, err.Error()}
 	}
 
@@ -16,6 +16,8 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/eclipse/codewind-operator/pkg/util"
@@ -33,6 +35,29 @@ type RegisteredClient struct {
 	Name         string   `json:"name"`
 	RedirectUris []string `json:"redirectUris"`
 	WebOrigins   []string `json:"webOrigins"`
+	Enabled      *bool    `json:"enabled,omitempty"`
+}
+
+// ClientSessionSettings : Token and session lifetimes of a client in seconds, zero uses the setting of the realm
+type ClientSessionSettings struct {
+	AccessTokenLifespan int
+	SessionIdleTimeout  int
+	SessionMaxLifespan  int
+}
+
+// attributes : client attributes holding the lifetimes, an empty value makes Keycloak use the realm setting
+func (s ClientSessionSettings) attributes() map[string]string {
+	value := func(seconds int) string {
+		if seconds <= 0 {
+			return ""
+		}
+		return strconv.Itoa(seconds)
+	}
+	return map[string]string{
+		"access.token.lifespan":       value(s.AccessTokenLifespan),
+		"client.session.idle.timeout": value(s.SessionIdleTimeout),
+		"client.session.max.lifespan": value(s.SessionMaxLifespan),
+	}
 }
 
 // RegisteredClientSecret : Client secret
@@ -41,11 +66,12 @@ type RegisteredClientSecret struct {
 	Secret string `json:"value"`
 }
 
-// SecClientCreate : Create a new client in Keycloak
-func SecClientCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, redirectURL string) *SecError {
+// SecClientCreate : Create a new client in Keycloak, returns the HTTP status so that callers can detect a client
+// created meanwhile
+func SecClientCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, redirectURL string) (*SecError, int) {
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/clients"
+	url := keycloakConfig.adminRealmURL("/clients")
 
 	// build the payload (JSON)
 	type PayloadClient struct {
@@ -69,7 +95,7 @@ func SecClientCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigu
 	req, err := http.NewRequest("POST", url, payload)
 
 	if err != nil {
-		return &SecError{errOpConnection, err, err.Error()}
+		return &SecError{errOpConnection, err, err.Error()}, 0
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Cache-Control", "no-cache")
@@ -77,26 +103,26 @@ func SecClientCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigu
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 
 	// send request
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
-		return &SecError{errOpConnection, err, err.Error()}
+		return &SecError{errOpConnection, err, err.Error()}, 0
 	}
 	defer res.Body.Close()
 	body, _ := ioutil.ReadAll(res.Body)
 	if string(body) != "" {
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
 		keycloakAPIError.Error = errOpResponseFormat
-		kcError := errors.New(string(keycloakAPIError.ErrorDescription))
-		return &SecError{keycloakAPIError.Error, kcError, kcError.Error()}
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
+		return &SecError{keycloakAPIError.Error, kcError, kcError.Error()}, res.StatusCode
 	}
-	return nil
+	return nil, res.StatusCode
 }
 
 // SecClientGet : Retrieve Client information
 func SecClientGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*RegisteredClient, *SecError) {
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/clients?clientId=" + keycloakConfig.ClientName
+	url := keycloakConfig.adminRealmURL("/clients?clientId=") + keycloakConfig.ClientName
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
@@ -104,7 +130,7 @@ func SecClientGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigurat
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("Cache-Control", "no-cache")
 	req.Header.Add("cache-control", "no-cache")
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
@@ -113,7 +139,7 @@ func SecClientGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigurat
 	// handle HTTP status codes
 	if res.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(res.Body)
-		err = errors.New(string(body))
+		err = newResponseError(res.StatusCode, string(body))
 		return nil, &SecError{errOpResponse, err, err.Error()}
 	}
 
@@ -133,6 +159,39 @@ func SecClientGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigurat
 	return nil, nil
 }
 
+// SecClientDelete : Delete the client of a deployment, a client that does not exist is ignored
+func SecClientDelete(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	registeredClient, secErr := SecClientGet(httpClient, keycloakConfig, accessToken)
+	if secErr != nil {
+		return secErr
+	}
+	if registeredClient == nil {
+		return nil
+	}
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + registeredClient.ID
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusNotFound {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
+
 // SecClientGetSecret : Retrieve the client secret for the supplied clientID
 func SecClientGetSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*RegisteredClientSecret, *SecError) {
 
@@ -146,7 +205,7 @@ func SecClientGetSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConf
 	}
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/clients/" + registeredClient.ID + "/client-secret"
+	url := keycloakConfig.adminRealmURL("/clients/") + registeredClient.ID + "/client-secret"
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
@@ -155,7 +214,7 @@ func SecClientGetSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConf
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("cache-control", "no-cache")
 	req.Header.Add("Cache-Control", "no-cache")
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
@@ -164,7 +223,54 @@ func SecClientGetSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConf
 	// handle HTTP status codes
 	if res.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(res.Body)
-		err = errors.New(string(body))
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	registeredClientSecret := RegisteredClientSecret{}
+	body, err := ioutil.ReadAll(res.Body)
+	err = json.Unmarshal([]byte(body), &registeredClientSecret)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, err.Error()}
+	}
+
+	return &registeredClientSecret, nil
+}
+
+// SecClientRegenerateSecret : Replace the client secret for the supplied clientID with a new generated one.
+// The previous secret stops working immediately
+func SecClientRegenerateSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*RegisteredClientSecret, *SecError) {
+
+	registeredClient, secError := SecClientGet(httpClient, keycloakConfig, accessToken)
+	if secError != nil {
+		return nil, secError
+	}
+
+	if registeredClient == nil {
+		err := errors.New("client " + keycloakConfig.ClientName + " not found")
+		return nil, &SecError{errOpNotFound, err, err.Error()}
+	}
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + registeredClient.ID + "/client-secret"
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		err = newResponseError(res.StatusCode, string(body))
 		return nil, &SecError{errOpResponse, err, err.Error()}
 	}
 
@@ -180,17 +286,47 @@ func SecClientGetSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConf
 
 // SecClientAppendURL : Append an additional url to the whitelist
 func SecClientAppendURL(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	return SecClientReplaceURL(httpClient, keycloakConfig, accessToken, "")
+}
+
+// webOrigin : Origin of a URL for the web origins of a client, which hold no path. A URL that does not parse is
+// returned unchanged
+func webOrigin(publicURL string) string {
+	parsed, err := url.Parse(publicURL)
+	if err != nil || parsed.Host == "" {
+		return publicURL
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// SecClientReplaceURL : Replace previousURL in the whitelist with the gatekeeper public URL, which is only added once.
+// An empty previousURL keeps the other URLs
+func SecClientReplaceURL(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, previousURL string) *SecError {
 
 	registeredClient, secErr := SecClientGet(httpClient, keycloakConfig, accessToken)
 	if secErr != nil {
 		return secErr
 	}
+	if registeredClient == nil {
+		notFound := errors.New("Keycloak client " + keycloakConfig.ClientName + " not found")
+		return &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
 
-	redirectURIs := registeredClient.RedirectUris
-	webOrigins := registeredClient.WebOrigins
-
-	redirectURIs = append(redirectURIs, (keycloakConfig.GatekeeperPublicURL + "/*"))
-	webOrigins = append(webOrigins, keycloakConfig.GatekeeperPublicURL)
+	replace := func(list []string, previous string, current string) []string {
+		updated := []string{}
+		for _, entry := range list {
+			if entry != current && (previous == "" || entry != previous) {
+				updated = append(updated, entry)
+			}
+		}
+		return append(updated, current)
+	}
+	previousRedirectURI := ""
+	if previousURL != "" {
+		previousRedirectURI = previousURL + "/*"
+	}
+	redirectURIs := replace(registeredClient.RedirectUris, previousRedirectURI, keycloakConfig.GatekeeperPublicURL+"/*")
+	webOrigins := replace(registeredClient.WebOrigins, webOrigin(previousURL), webOrigin(keycloakConfig.GatekeeperPublicURL))
 
 	registeredClient.RedirectUris = redirectURIs
 	registeredClient.WebOrigins = webOrigins
@@ -198,7 +334,7 @@ func SecClientAppendURL(httpClient util.HTTPClient, keycloakConfig *KeycloakConf
 	// save the updated client
 	jsonClient, err := json.Marshal(registeredClient)
 	payload := strings.NewReader(string(jsonClient))
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/clients/" + registeredClient.ID
+	url := keycloakConfig.adminRealmURL("/clients/") + registeredClient.ID
 	req, err := http.NewRequest("PUT", url, payload)
 
 	if err != nil {
@@ -217,3 +353,71 @@ func SecClientAppendURL(httpClient util.HTTPClient, keycloakConfig *KeycloakConf
 	defer res.Body.Close()
 	return nil
 }
+
+// SecClientUpdateSessionSettings : Sets the token and session lifetimes of the client, other attributes are kept
+func SecClientUpdateSessionSettings(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, settings ClientSessionSettings) *SecError {
+	type PayloadClient struct {
+		ID         string            `json:"id"`
+		Attributes map[string]string `json:"attributes"`
+	}
+	jsonClient, err := json.Marshal(PayloadClient{ID: clientID, Attributes: settings.attributes()})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest("PUT", keycloakConfig.adminRealmURL("/clients/")+clientID, strings.NewReader(string(jsonClient)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecClientEnable : Enables a client that was disabled, other settings are kept
+func SecClientEnable(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string) *SecError {
+	type PayloadClient struct {
+		ID      string `json:"id"`
+		Enabled bool   `json:"enabled"`
+	}
+	jsonClient, err := json.Marshal(PayloadClient{ID: clientID, Enabled: true})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest("PUT", keycloakConfig.adminRealmURL("/clients/")+clientID, strings.NewReader(string(jsonClient)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
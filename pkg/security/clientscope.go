@@ -0,0 +1,160 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// ClientScope : A Keycloak client scope
+type ClientScope struct {
+	ID              string           `json:"id,omitempty"`
+	Name            string           `json:"name"`
+	Protocol        string           `json:"protocol"`
+	ProtocolMappers []ProtocolMapper `json:"protocolMappers,omitempty"`
+}
+
+// SecClientScopeGet : Finds a client scope in the realm by name, returns nil if it does not exist
+func SecClientScopeGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, scopeName string) (*ClientScope, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/client-scopes")
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	clientScopes := []ClientScope{}
+	err = json.Unmarshal(body, &clientScopes)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	for _, clientScope := range clientScopes {
+		if clientScope.Name == scopeName {
+			return &clientScope, nil
+		}
+	}
+	return nil, nil
+}
+
+// SecClientScopeCreate : Creates a new openid-connect client scope in the realm
+func SecClientScopeCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientScope ClientScope) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/client-scopes")
+	if clientScope.Protocol == "" {
+		clientScope.Protocol = "openid-connect"
+	}
+	jsonScope, err := json.Marshal(clientScope)
+	payload := strings.NewReader(string(jsonScope))
+	req, err := http.NewRequest("POST", url, payload)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (an existing scope returns StatusConflict)
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusConflict {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpCreate, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecClientAddDefaultScope : Adds a client scope to the default scopes of a client
+func SecClientAddDefaultScope(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, scopeID string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/default-client-scopes/" + scopeID
+	req, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		kcError := newResponseError(res.StatusCode, res.Status)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecClientAddOptionalScope : Adds a client scope to the optional scopes of a client, which tokens include when the
+// token request asks for the scope
+func SecClientAddOptionalScope(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, scopeID string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/optional-client-scopes/" + scopeID
+	req, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		kcError := newResponseError(res.StatusCode, res.Status)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
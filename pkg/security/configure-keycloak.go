@@ -12,99 +12,899 @@
 package security
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/eclipse/codewind-operator/pkg/util"
 )
 
 // AddCodewindToKeycloak : sets up Keycloak with a realm, client and user
 // Returns a clientKey or an error
-func AddCodewindToKeycloak(workspaceID string, authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, gatekeeperPublicURL string, devUsername string, clientName string) (string, error) {
+func AddCodewindToKeycloak(keycloakConfig KeycloakConfiguration) (clientKey string, err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return "", err
+	}
+	defer invalidateToken(&err)
+	var secErr *SecError
+
+	// Only one reconcile at a time may configure the same realm
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	// A shared realm belongs to its owner, only the objects of the workspace are added to it
+	if keycloakConfig.SharedRealm {
+		secErr = validateKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
+	} else {
+		secErr = configureKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
+	}
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+
+	secErr = configureKeycloakClient(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+
+	secErr = configureKeycloakAccessRole(httpClient, &keycloakConfig, tokens.AccessToken, "codewind-"+keycloakConfig.WorkspaceID)
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrRoleConfig, secErr)
+	}
+
+	// A new client has no service account, it only needs configuring when requested
+	if keycloakConfig.ServiceAccountEnabled {
+		secErr = configureKeycloakServiceAccount(httpClient, &keycloakConfig, tokens.AccessToken)
+		if secErr != nil {
+			return "", newKeycloakConfigError(ErrClientConfig, secErr)
+		}
+	}
+
+	secErr = configureKeycloakUser(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+
+	secErr = grantUserAccessToDeployment(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrUserConfig, secErr)
+	}
 
+	secErr = syncDeploymentAccessList(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr == nil {
+		secErr = syncDeploymentAccessGroups(httpClient, &keycloakConfig, tokens.AccessToken)
+	}
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+
+	registeredSecret, secErr := fetchClientSecret(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return "", newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+
+	return registeredSecret.Secret, nil
+
+}
+
+// authenticateFailureStep : a failed connection means Keycloak is unreachable, anything else is an auth failure
+func authenticateFailureStep(secErr *SecError) error {
+	if secErr.Op == errOpConnection || secErr.Desc == textAuthIsDown {
+		return ErrKeycloakUnreachable
+	}
+	return ErrAuthFailed
+}
+
+// AddCodewindRealmToKeycloak : Installs a keycloak realm
+func AddCodewindRealmToKeycloak(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (err error) {
 	var keycloakConfig KeycloakConfiguration
 	keycloakConfig.RealmName = realmName
 	keycloakConfig.AuthURL = authURL
-	keycloakConfig.WorkspaceID = workspaceID
 	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
 	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
-	keycloakConfig.DevUsername = devUsername
-	keycloakConfig.GatekeeperPublicURL = gatekeeperPublicURL
-	keycloakConfig.ClientName = clientName
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
 
-	// Wait for the Keycloak service to respond
-	log.Info("Waiting for Keycloak to start", "URL", keycloakConfig.AuthURL)
-	startErr := util.WaitForService(keycloakConfig.AuthURL, 200, 500)
-	if startErr != nil {
-		return "", errors.New("Keycloak did not start in a reasonable about of time")
+	log.Info("AddRealm: Checking Keycloak service is responding", "realm", keycloakConfig.RealmName, "URL", keycloakConfig.AuthURL)
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
 	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
 
-	tokens, secErr := SecAuthenticate(http.DefaultClient, &keycloakConfig)
+	secErr := configureKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
 	if secErr != nil {
-		return "", secErr.Err
+		return newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	return nil
+}
+
+// RemoveCodewindFromKeycloak : Removes the user role mapping, access role and client created for a deployment
+func RemoveCodewindFromKeycloak(keycloakConfig KeycloakConfiguration) (err error) {
+	log.Info("Removing deployment from Keycloak", "realm", keycloakConfig.RealmName, "client", keycloakConfig.ClientName, "URL", keycloakConfig.AuthURL)
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	accessRoleName := "codewind-" + keycloakConfig.WorkspaceID
+	secErr := SecUserRemoveRole(httpClient, &keycloakConfig, tokens.AccessToken, accessRoleName)
+	if secErr != nil {
+		log.Error(secErr.Err, "Removing access role from user failed", "role", accessRoleName, "Username", keycloakConfig.DevUsername)
+		return newKeycloakConfigError(ErrUserConfig, secErr)
 	}
 
-	secErr = configureKeycloakRealm(http.DefaultClient, &keycloakConfig, tokens.AccessToken)
+	secErr = SecRoleDelete(httpClient, &keycloakConfig, tokens.AccessToken, accessRoleName)
 	if secErr != nil {
-		return "", secErr.Err
+		log.Error(secErr.Err, "Deleting access role failed", "role", accessRoleName)
+		return newKeycloakConfigError(ErrRoleConfig, secErr)
 	}
 
-	secErr = configureKeycloakClient(http.DefaultClient, &keycloakConfig, tokens.AccessToken)
+	secErr = removeRemoteAccessUser(httpClient, &keycloakConfig, tokens.AccessToken)
 	if secErr != nil {
-		return "", secErr.Err
+		log.Error(secErr.Err, "Deleting the machine user failed", "Username", RemoteAccessUsername(keycloakConfig.WorkspaceID))
+		return newKeycloakConfigError(ErrUserConfig, secErr)
 	}
 
-	secErr = configureKeycloakAccessRole(http.DefaultClient, &keycloakConfig, tokens.AccessToken, "codewind-"+keycloakConfig.WorkspaceID)
+	secErr = SecClientDelete(httpClient, &keycloakConfig, tokens.AccessToken)
 	if secErr != nil {
-		return "", secErr.Err
+		log.Error(secErr.Err, "Deleting client failed", "client", keycloakConfig.ClientName)
+		return newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+	return nil
+}
+
+// UpdateCodewindAccess : Grants the access role of a configured deployment to the developer user, the users of
+// the access list and the access groups, and removes it from the revoked users and groups. Returns a KeycloakConfigError like AddCodewindToKeycloak
+func UpdateCodewindAccess(keycloakConfig KeycloakConfiguration) (err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	secErr := grantUserAccessToDeployment(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+
+	secErr = syncDeploymentAccessList(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr == nil {
+		secErr = syncDeploymentAccessGroups(httpClient, &keycloakConfig, tokens.AccessToken)
+	}
+	if secErr != nil {
+		return newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+	return nil
+}
+
+// UpdateCodewindSessionSettings : Applies changed token and session lifetimes to the client of a configured
+// deployment. Returns a KeycloakConfigError like AddCodewindToKeycloak
+func UpdateCodewindSessionSettings(keycloakConfig KeycloakConfiguration) (err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	registeredClient, secErr := SecClientGet(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr == nil && registeredClient == nil {
+		notFound := errors.New("Keycloak client " + keycloakConfig.ClientName + " not found")
+		secErr = &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
+	if secErr != nil {
+		return newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+
+	log.Info("Updating the session settings of the client", "client", keycloakConfig.ClientName, "realm", keycloakConfig.RealmName)
+	secErr = SecClientUpdateSessionSettings(httpClient, &keycloakConfig, tokens.AccessToken, registeredClient.ID, keycloakConfig.SessionSettings)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+	return nil
+}
+
+// UpdateCodewindServiceAccount : Enables or disables the service account of the client of a configured deployment,
+// granting it the access role of the deployment while enabled. Returns a KeycloakConfigError like AddCodewindToKeycloak
+func UpdateCodewindServiceAccount(keycloakConfig KeycloakConfiguration) (err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	secErr := configureKeycloakServiceAccount(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+	return nil
+}
+
+// UpdateCodewindTokenClaims : Applies changed token claims to the client of a configured deployment. Returns a
+// KeycloakConfigError like AddCodewindToKeycloak
+func UpdateCodewindTokenClaims(keycloakConfig KeycloakConfiguration) (err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	registeredClient, secErr := SecClientGet(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr == nil && registeredClient == nil {
+		notFound := errors.New("Keycloak client " + keycloakConfig.ClientName + " not found")
+		secErr = &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
+	if secErr == nil {
+		secErr = syncKeycloakTokenClaims(httpClient, &keycloakConfig, tokens.AccessToken, registeredClient.ID)
+	}
+	if secErr != nil {
+		return newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+	return nil
+}
+
+// UpdateCodewindRedirectURL : Replaces previousURL in the redirect URIs and web origins of the client of a deployment
+// with its gatekeeper public URL, after the hostname of the deployment changed. Returns a KeycloakConfigError like
+// AddCodewindToKeycloak
+func UpdateCodewindRedirectURL(keycloakConfig KeycloakConfiguration, previousURL string) (err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	log.Info("Replacing the redirect URL of the Keycloak client", "name", keycloakConfig.ClientName, "previous", previousURL, "url", keycloakConfig.GatekeeperPublicURL)
+	secErr := SecClientReplaceURL(httpClient, &keycloakConfig, tokens.AccessToken, previousURL)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+	return nil
+}
+
+// RepairCodewindConfiguration : Compares the realm, client and access role of a configured deployment with the
+// configuration the operator created, and restores what an administrator deleted, disabled or changed in the admin
+// console. A shared realm is only checked. Returns a description of each repair, and a KeycloakConfigError like
+// AddCodewindToKeycloak
+func RepairCodewindConfiguration(keycloakConfig KeycloakConfiguration) (repaired []string, err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer invalidateToken(&err)
+	var secErr *SecError
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	// A recreated realm has lost the client and the access role, which are recreated below
+	if keycloakConfig.SharedRealm {
+		secErr = validateKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
+		if secErr != nil {
+			return repaired, newKeycloakConfigError(ErrRealmConfig, secErr)
+		}
+	} else {
+		realm, secErr := SecRealmGet(httpClient, &keycloakConfig, tokens.AccessToken)
+		if secErr != nil && secErr.Op == errOpConnection {
+			return repaired, newKeycloakConfigError(ErrRealmConfig, secErr)
+		}
+		if realm == nil || realm.ID == "" {
+			secErr = configureKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
+			if secErr != nil {
+				return repaired, newKeycloakConfigError(ErrRealmConfig, secErr)
+			}
+			repaired = append(repaired, "recreated the deleted realm "+keycloakConfig.RealmName)
+		} else if !realm.Enabled {
+			secErr = SecRealmUpdate(httpClient, &keycloakConfig, tokens.AccessToken, map[string]interface{}{"enabled": true})
+			if secErr != nil {
+				return repaired, newKeycloakConfigError(ErrRealmConfig, secErr)
+			}
+			repaired = append(repaired, "enabled the disabled realm "+keycloakConfig.RealmName)
+		}
 	}
 
-	secErr = configureKeycloakUser(http.DefaultClient, &keycloakConfig, tokens.AccessToken)
+	registeredClient, secErr := SecClientGet(httpClient, &keycloakConfig, tokens.AccessToken)
 	if secErr != nil {
-		return "", secErr.Err
+		return repaired, newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+	clientRecreated := registeredClient == nil
+	if clientRecreated {
+		secErr = configureKeycloakClient(httpClient, &keycloakConfig, tokens.AccessToken)
+		if secErr != nil {
+			return repaired, newKeycloakConfigError(ErrClientConfig, secErr)
+		}
+		repaired = append(repaired, "recreated the deleted client "+keycloakConfig.ClientName)
+	} else {
+		if registeredClient.Enabled != nil && !*registeredClient.Enabled {
+			secErr = SecClientEnable(httpClient, &keycloakConfig, tokens.AccessToken, registeredClient.ID)
+			if secErr != nil {
+				return repaired, newKeycloakConfigError(ErrClientConfig, secErr)
+			}
+			repaired = append(repaired, "enabled the disabled client "+keycloakConfig.ClientName)
+		}
+		redirectURI := keycloakConfig.GatekeeperPublicURL + "/*"
+		if !listContains(registeredClient.RedirectUris, redirectURI) || !listContains(registeredClient.WebOrigins, webOrigin(keycloakConfig.GatekeeperPublicURL)) {
+			secErr = SecClientAppendURL(httpClient, &keycloakConfig, tokens.AccessToken)
+			if secErr != nil {
+				return repaired, newKeycloakConfigError(ErrClientConfig, secErr)
+			}
+			repaired = append(repaired, "restored the redirect URI "+redirectURI+" of client "+keycloakConfig.ClientName)
+		}
 	}
 
-	secErr = grantUserAccessToDeployment(http.DefaultClient, &keycloakConfig, tokens.AccessToken)
+	// Deleting a role also deletes its mappings, the users, groups and service account are granted it again
+	accessRoleName := "codewind-" + keycloakConfig.WorkspaceID
+	_, secErr = getRoleByName(httpClient, &keycloakConfig, tokens.AccessToken, accessRoleName)
+	if secErr != nil && secErr.Op != errOpNotFound {
+		return repaired, newKeycloakConfigError(ErrRoleConfig, secErr)
+	}
+	roleRecreated := secErr != nil
+	if roleRecreated {
+		secErr = configureKeycloakAccessRole(httpClient, &keycloakConfig, tokens.AccessToken, accessRoleName)
+		if secErr != nil {
+			return repaired, newKeycloakConfigError(ErrRoleConfig, secErr)
+		}
+		repaired = append(repaired, "recreated the deleted access role "+accessRoleName)
+	}
+	if (clientRecreated || roleRecreated) && keycloakConfig.ServiceAccountEnabled {
+		secErr = configureKeycloakServiceAccount(httpClient, &keycloakConfig, tokens.AccessToken)
+		if secErr != nil {
+			return repaired, newKeycloakConfigError(ErrClientConfig, secErr)
+		}
+	}
+	if !roleRecreated {
+		return repaired, nil
+	}
+	secErr = grantUserAccessToDeployment(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr == nil {
+		secErr = syncDeploymentAccessList(httpClient, &keycloakConfig, tokens.AccessToken)
+	}
+	if secErr == nil {
+		secErr = syncDeploymentAccessGroups(httpClient, &keycloakConfig, tokens.AccessToken)
+	}
 	if secErr != nil {
-		return "", secErr.Err
+		return repaired, newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+	return repaired, nil
+}
+
+// listContains : true when the list holds the value
+func listContains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchCodewindClientSecret : Reads the current secret of the client created for a deployment. Returns a
+// KeycloakConfigError like AddCodewindToKeycloak
+func FetchCodewindClientSecret(keycloakConfig KeycloakConfiguration) (clientSecret string, err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return "", err
 	}
+	defer invalidateToken(&err)
 
-	registeredSecret, secErr := fetchClientSecret(http.DefaultClient, &keycloakConfig, tokens.AccessToken)
+	registeredSecret, secErr := fetchClientSecret(httpClient, &keycloakConfig, tokens.AccessToken)
 	if secErr != nil {
-		return "", secErr.Err
+		return "", newKeycloakConfigError(ErrClientConfig, secErr)
 	}
+	if registeredSecret == nil {
+		return "", nil
+	}
+	return registeredSecret.Secret, nil
+}
 
+// RegenerateCodewindClientSecret : Has Keycloak generate a new secret for the client created for a deployment and
+// returns it. The previous secret stops working immediately. Returns a KeycloakConfigError like AddCodewindToKeycloak
+func RegenerateCodewindClientSecret(keycloakConfig KeycloakConfiguration) (clientSecret string, err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return "", err
+	}
+	defer invalidateToken(&err)
+
+	log.Info("Regenerating client secret", "realm", keycloakConfig.RealmName, "client", keycloakConfig.ClientName)
+	registeredSecret, secErr := SecClientRegenerateSecret(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		log.Error(secErr.Err, "Error regenerating client secret", "client", keycloakConfig.ClientName)
+		return "", newKeycloakConfigError(ErrClientConfig, secErr)
+	}
 	return registeredSecret.Secret, nil
+}
+
+// CheckKeycloakAdminCredentials : Logs in to the master realm with the admin credentials. Returns a KeycloakConfigError
+// for ErrAuthFailed when Keycloak rejects them, for example after the password was changed in Keycloak but not in
+// the operator secret
+func CheckKeycloakAdminCredentials(authURL string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
 
+	_, _, _, err := adminSession(&keycloakConfig)
+	return err
 }
 
-// AddCodewindRealmToKeycloak : Installs a keycloak realm
-func AddCodewindRealmToKeycloak(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string) error {
+// ChangeKeycloakAdminPassword : Logs in with the current admin password and replaces it with newPass in the
+// master realm. Returns a KeycloakConfigError like CheckKeycloakAdminCredentials
+func ChangeKeycloakAdminPassword(authURL string, keycloakAdminUser string, keycloakAdminPass string, newPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) error {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = "master"
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.DevUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	// The session of the old password is not reused once the password changed
+	defer invalidateAdminToken(&keycloakConfig)
+
+	httpClient, tokens, _, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+
+	adminUser, secErr := SecUserGet(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrAdminPasswordChange, secErr)
+	}
+
+	log.Info("Changing the Keycloak admin password", "user", keycloakAdminUser, "URL", keycloakConfig.AuthURL)
+	secErr = SecUserResetPassword(httpClient, &keycloakConfig, tokens.AccessToken, adminUser.ID, newPass)
+	if secErr != nil {
+		log.Error(secErr.Err, "Error changing the Keycloak admin password", "user", keycloakAdminUser)
+		return newKeycloakConfigError(ErrAdminPasswordChange, secErr)
+	}
+	return nil
+}
+
+// ConfigureRealmSMTP : Sets the mail server of the realm, creating the realm first when it does not exist yet.
+// A nil server removes the mail server from the realm
+func ConfigureRealmSMTP(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy, smtpServer *SMTPServer) (err error) {
 	var keycloakConfig KeycloakConfiguration
 	keycloakConfig.RealmName = realmName
 	keycloakConfig.AuthURL = authURL
 	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
 	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
 
-	// Wait for the Keycloak service to respond
-	log.Info("AddRealm: Checking Keycloak service is responding", "realm", keycloakConfig.RealmName, "URL", keycloakConfig.AuthURL)
-	startErr := util.WaitForService(keycloakConfig.AuthURL, 200, 500)
-	if startErr != nil {
-		return errors.New("Keycloak did not start in a reasonable about of time")
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	secErr := configureKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr == nil {
+		secErr = configureKeycloakRealmSMTP(httpClient, &keycloakConfig, tokens.AccessToken, smtpServer)
+	}
+	if secErr != nil {
+		return newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	return nil
+}
+
+// ValidateCodewindRealm : Checks that an existing realm shared with other applications can be used by Codewind,
+// without creating or changing it
+func ValidateCodewindRealm(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+	keycloakConfig.SharedRealm = true
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	secErr := validateKeycloakRealm(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	return nil
+}
+
+// ConfigureRealmSettings : Updates the realm with each partial representation whose settings differ from those of
+// the realm, so that settings changed in the admin console are set back
+func ConfigureRealmSettings(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy, settings ...interface{}) (err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	realm, secErr := SecRealmGetRepresentation(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	for _, setting := range settings {
+		differ, err := realmSettingsDiffer(realm, setting)
+		if err != nil {
+			return newKeycloakConfigError(ErrRealmConfig, &SecError{errOpResponseFormat, err, err.Error()})
+		}
+		if !differ {
+			continue
+		}
+		if validator, ok := setting.(realmSettingsValidator); ok {
+			secErr = validator.validate(httpClient, &keycloakConfig, tokens.AccessToken)
+			if secErr != nil {
+				return newKeycloakConfigError(ErrRealmConfig, secErr)
+			}
+		}
+		log.Info("Updating realm settings", "realm", realmName, "settings", fmt.Sprintf("%T", setting))
+		secErr = SecRealmUpdate(httpClient, &keycloakConfig, tokens.AccessToken, setting)
+		if secErr != nil {
+			log.Error(secErr.Err, "Error updating realm settings", "realm", realmName)
+			return newKeycloakConfigError(ErrRealmConfig, secErr)
+		}
+	}
+	return nil
+}
+
+// ConfigureLDAPFederation : Adds the LDAP user federation provider to the realm, or replaces the configuration
+// of the provider added by an earlier call
+func ConfigureLDAPFederation(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy, ldap LDAPFederation) (err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	realm, secErr := SecRealmGet(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	if realm == nil || realm.ID == "" {
+		notFound := errors.New("realm " + realmName + " not found")
+		return newKeycloakConfigError(ErrRealmConfig, &SecError{errOpNotFound, notFound, notFound.Error()})
 	}
 
-	tokens, secErr := SecAuthenticate(http.DefaultClient, &keycloakConfig)
+	component := ldap.component(realm.ID)
+	existing, secErr := SecUserFederationGet(httpClient, &keycloakConfig, tokens.AccessToken, component.Name)
 	if secErr != nil {
-		return secErr.Err
+		return newKeycloakConfigError(ErrFederationConfig, secErr)
+	}
+	if existing == nil {
+		log.Info("Adding LDAP user federation", "realm", realmName, "connectionURL", ldap.ConnectionURL)
+		secErr = SecUserFederationCreate(httpClient, &keycloakConfig, tokens.AccessToken, component)
+	} else {
+		log.Info("Updating LDAP user federation", "realm", realmName, "connectionURL", ldap.ConnectionURL)
+		component.ID = existing.ID
+		secErr = SecUserFederationUpdate(httpClient, &keycloakConfig, tokens.AccessToken, component)
+	}
+	if secErr != nil {
+		log.Error(secErr.Err, "Error configuring LDAP user federation", "realm", realmName)
+		return newKeycloakConfigError(ErrFederationConfig, secErr)
+	}
+	return nil
+}
+
+// RemoveLDAPFederation : Removes the LDAP user federation provider added by ConfigureLDAPFederation from the realm
+func RemoveLDAPFederation(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
 	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
 
-	secErr = configureKeycloakRealm(http.DefaultClient, &keycloakConfig, tokens.AccessToken)
+	existing, secErr := SecUserFederationGet(httpClient, &keycloakConfig, tokens.AccessToken, LDAPFederationName)
 	if secErr != nil {
-		return secErr.Err
+		return newKeycloakConfigError(ErrFederationConfig, secErr)
+	}
+	if existing == nil {
+		return nil
+	}
+	log.Info("Removing LDAP user federation", "realm", realmName)
+	secErr = SecUserFederationDelete(httpClient, &keycloakConfig, tokens.AccessToken, existing.ID)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrFederationConfig, secErr)
 	}
 	return nil
 }
 
+// ConfigureIdentityProviders : Adds the identity providers to the realm or replaces the configuration of those
+// already there, then removes the providers with the removed aliases
+func ConfigureIdentityProviders(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy, identityProviders []IdentityProvider, removedAliases []string) (err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+	var secErr *SecError
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	for _, identityProvider := range identityProviders {
+		secErr = configureIdentityProvider(httpClient, &keycloakConfig, tokens.AccessToken, identityProvider)
+		if secErr != nil {
+			log.Error(secErr.Err, "Error configuring identity provider", "realm", realmName, "alias", identityProvider.Alias)
+			return newKeycloakConfigError(ErrIdentityProviderConfig, secErr)
+		}
+	}
+	for _, alias := range removedAliases {
+		log.Info("Removing identity provider", "realm", realmName, "alias", alias)
+		secErr = SecIdentityProviderDelete(httpClient, &keycloakConfig, tokens.AccessToken, alias)
+		if secErr != nil {
+			return newKeycloakConfigError(ErrIdentityProviderConfig, secErr)
+		}
+	}
+	return nil
+}
+
+// ExportCodewindRealm : Exports the realm configuration managed by the operator and the realm users as redacted
+// JSON. Users keep their realm roles and groups but not their credentials, users of a user federation are left
+// to the federation
+func ExportCodewindRealm(authURL string, realmName string, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (realmExport []byte, err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer invalidateToken(&err)
+
+	log.Info("Exporting Keycloak realm", "realm", keycloakConfig.RealmName, "URL", keycloakConfig.AuthURL)
+	realmExport, secErr := SecRealmExport(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return nil, newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	users, secErr := exportRealmUsers(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return nil, newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	realm := map[string]interface{}{}
+	err = json.Unmarshal(realmExport, &realm)
+	if err != nil {
+		return nil, err
+	}
+	realm["users"] = users
+	return json.MarshalIndent(realm, "", "  ")
+}
+
+// exportRealmUsers : Lists the local users of the realm with the names of their realm roles and the paths of
+// their groups, the way a realm import expects them
+func exportRealmUsers(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) ([]interface{}, *SecError) {
+	const pageSize = 100
+	users := []interface{}{}
+	for first := 0; ; first += pageSize {
+		page, secErr := SecUserList(httpClient, keycloakConfig, accessToken, first, pageSize)
+		if secErr != nil {
+			return nil, secErr
+		}
+		for _, user := range page {
+			if federationLink, _ := user["federationLink"].(string); federationLink != "" {
+				continue
+			}
+			userID, _ := user["id"].(string)
+			roles, secErr := SecUserGetRealmRoles(httpClient, keycloakConfig, accessToken, userID)
+			if secErr != nil {
+				return nil, secErr
+			}
+			roleNames := []string{}
+			for _, role := range roles {
+				roleNames = append(roleNames, role.Name)
+			}
+			groups, secErr := SecUserGetGroups(httpClient, keycloakConfig, accessToken, userID)
+			if secErr != nil {
+				return nil, secErr
+			}
+			groupPaths := []string{}
+			for _, group := range groups {
+				groupPaths = append(groupPaths, group.Path)
+			}
+			delete(user, "access")
+			user["realmRoles"] = roleNames
+			user["groups"] = groupPaths
+			redactSecrets(user)
+			users = append(users, user)
+		}
+		if len(page) < pageSize {
+			return users, nil
+		}
+	}
+}
+
+// RestoreCodewindRealmToKeycloak : Creates the realm from a realm export when it does not exist, eg after the
+// Keycloak volume was lost. Returns false when the realm already exists and was left unchanged. Client secrets
+// and keys are not part of the export, Keycloak generates new ones and users have to reset their password
+func RestoreCodewindRealmToKeycloak(authURL string, realmName string, realmExport []byte, keycloakAdminUser string, keycloakAdminPass string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (restored bool, err error) {
+	var keycloakConfig KeycloakConfiguration
+	keycloakConfig.RealmName = realmName
+	keycloakConfig.AuthURL = authURL
+	keycloakConfig.KeycloakAdminPassword = keycloakAdminPass
+	keycloakConfig.KeycloakAdminUsername = keycloakAdminUser
+	keycloakConfig.RootCAs = rootCAs
+	keycloakConfig.RetryPolicy = retryPolicy
+
+	realm, err := realmImport(realmExport, realmName)
+	if err != nil {
+		return false, &KeycloakConfigError{Step: ErrRealmConfig, Err: errors.New("realm export cannot be parsed: " + err.Error())}
+	}
+
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return false, err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	existingRealm, _ := SecRealmGet(httpClient, &keycloakConfig, tokens.AccessToken)
+	if existingRealm != nil && existingRealm.ID != "" {
+		log.Info("Skipping realm restore, the realm already exists", "realm", keycloakConfig.RealmName, "URL", keycloakConfig.AuthURL)
+		return false, nil
+	}
+	log.Info("Restoring Keycloak realm from export", "realm", keycloakConfig.RealmName, "URL", keycloakConfig.AuthURL)
+	secErr, httpStatusCode := SecRealmImport(httpClient, &keycloakConfig, tokens.AccessToken, realm)
+	if httpStatusCode == http.StatusConflict {
+		// Created meanwhile, for example by an operator replica that lost its leader election lock mid-provision
+		log.Info("Keycloak realm already exists", "realm", keycloakConfig.RealmName)
+		return false, nil
+	}
+	if secErr != nil {
+		return false, newKeycloakConfigError(ErrRealmConfig, secErr)
+	}
+	return true, nil
+}
+
+// keycloakHTTPClient : Client for the Keycloak REST API, verifying the Keycloak certificate against the
+// configured CA bundle. Without a bundle the certificate is not verified, except in FIPS mode where it is verified
+// against the system CAs. Each attempt is limited to the timeout of the retry policy, and the connections to
+// Keycloak are pooled across reconciles. Requests are retried with the configured policy, each attempt passing the rate
+// limit and circuit breaker of the Keycloak, and requests changing the configuration are audited.
+func keycloakHTTPClient(keycloakConfig *KeycloakConfiguration) util.HTTPClient {
+	policy := keycloakConfig.RetryPolicy.WithDefaults()
+	httpClient := util.NewHTTPClient(util.HTTPClientOptions{Timeout: policy.Timeout, RootCAs: keycloakConfig.RootCAs, InsecureSkipVerify: true})
+	guardedClient := &guardedHTTPClient{client: httpClient, authURL: keycloakConfig.AuthURL}
+	return &auditingHTTPClient{
+		client:         &util.RetryingHTTPClient{Client: guardedClient, Policy: policy},
+		keycloakConfig: keycloakConfig,
+	}
+}
+
+// adminSession : Checks that Keycloak responds and returns a client for its REST API with an admin token, cached
+// across reconciles. Returns a KeycloakConfigError when Keycloak is starting or the admin credentials are rejected.
+// A failed call may have used a token Keycloak no longer accepts, callers defer the returned function with their
+// error so that the next call authenticates again. The token is only dropped when Keycloak rejected it or could not
+// be reached, other failures keep it so that failing reconciles do not log in to the master realm again each time
+func adminSession(keycloakConfig *KeycloakConfiguration) (util.HTTPClient, *AuthToken, func(*error), error) {
+	invalidateToken := func(err *error) {
+		if adminTokenRejected(failedSecError(*err)) {
+			invalidateAdminToken(keycloakConfig)
+		}
+	}
+
+	// Callers retry later while Keycloak is starting
+	startErr := checkKeycloakReady(keycloakConfig)
+	if startErr != nil {
+		return nil, nil, invalidateToken, startErr
+	}
+
+	httpClient := keycloakHTTPClient(keycloakConfig)
+	tokens, secErr := secAdminToken(httpClient, keycloakConfig)
+	if secErr != nil {
+		return nil, nil, invalidateToken, newKeycloakConfigError(authenticateFailureStep(secErr), secErr)
+	}
+	return httpClient, tokens, invalidateToken, nil
+}
+
+// checkKeycloakReady : Checks once that the Keycloak service responds, trusting the configured CA certificates.
+// Returns a KeycloakConfigError for ErrKeycloakNotReady while Keycloak is starting, so that the caller can retry
+// later instead of blocking, and for ErrKeycloakUnreachable when its certificate is not trusted or its circuit is open.
+// Once Keycloak responds the distribution of the configuration is resolved, so that the admin API paths match the server
+func checkKeycloakReady(keycloakConfig *KeycloakConfiguration) error {
+	if openErr := keycloakGuardFor(keycloakConfig.AuthURL).openError(time.Now()); openErr != nil {
+		return &KeycloakConfigError{Step: ErrKeycloakUnreachable, SecErr: &SecError{errOpConnection, openErr, openErr.Error()}, Err: openErr}
+	}
+	startErr := util.WaitForServiceWithContext(context.TODO(), keycloakConfig.RootCAs, keycloakConfig.AuthURL, 200, 1)
+	if startErr == nil {
+		if secErr := resolveDistribution(keycloakHTTPClient(keycloakConfig), keycloakConfig); secErr != nil {
+			log.Info("Keycloak distribution could not be detected yet", "URL", keycloakConfig.AuthURL, "reason", secErr.Desc)
+			return &KeycloakConfigError{Step: ErrKeycloakNotReady, Err: errors.New("Keycloak REST API is not responding yet: " + secErr.Desc)}
+		}
+		return nil
+	}
+	if notReady, ok := startErr.(*util.ServiceNotReadyError); ok && notReady.TLSError {
+		log.Error(startErr, "Keycloak TLS certificate is not trusted", "URL", keycloakConfig.AuthURL)
+		return &KeycloakConfigError{Step: ErrKeycloakUnreachable, SecErr: &SecError{errOpConnection, notReady, notReady.Error()},
+			Err: errors.New("Keycloak TLS certificate is not trusted: " + notReady.Err.Error())}
+	}
+	log.Info("Keycloak is not ready yet", "URL", keycloakConfig.AuthURL, "reason", startErr.Error())
+	return &KeycloakConfigError{Step: ErrKeycloakNotReady, Err: errors.New("Keycloak is not responding yet: " + startErr.Error())}
+}
+
 func configureKeycloakRealm(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
 	// Check if realm is already registered
 	realm, _ := SecRealmGet(httpClient, keycloakConfig, accessToken)
@@ -113,7 +913,12 @@ func configureKeycloakRealm(httpClient util.HTTPClient, keycloakConfig *Keycloak
 	} else {
 		// Create a new realm
 		log.Info("Creating new Keycloak realm", "name", keycloakConfig.RealmName, "auth", keycloakConfig.AuthURL)
-		secErr := SecRealmCreate(httpClient, keycloakConfig, accessToken)
+		secErr, httpStatusCode := SecRealmCreate(httpClient, keycloakConfig, accessToken)
+		if httpStatusCode == http.StatusConflict {
+			// Created meanwhile, for example by an operator replica that lost its leader election lock mid-provision
+			log.Info("Keycloak realm already exists", "name", keycloakConfig.RealmName)
+			return nil
+		}
 		if secErr != nil {
 			return secErr
 		}
@@ -122,6 +927,38 @@ func configureKeycloakRealm(httpClient util.HTTPClient, keycloakConfig *Keycloak
 	return nil
 }
 
+// validateKeycloakRealm : Checks that a shared realm exists and is enabled
+func validateKeycloakRealm(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	realm, secErr := SecRealmGet(httpClient, keycloakConfig, accessToken)
+	if secErr != nil && secErr.Op == errOpConnection {
+		return secErr
+	}
+	if realm == nil || realm.ID == "" {
+		notFound := errors.New("shared realm " + keycloakConfig.RealmName + " not found, it must be created before Codewind can use it")
+		return &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
+	if !realm.Enabled {
+		disabled := errors.New("shared realm " + keycloakConfig.RealmName + " is disabled")
+		return &SecError{errOpResponse, disabled, disabled.Error()}
+	}
+	log.Info("Using shared realm", "name", keycloakConfig.RealmName, "auth", keycloakConfig.AuthURL)
+	return nil
+}
+
+// configureKeycloakRealmSMTP : Sets or removes the mail server of the realm
+func configureKeycloakRealmSMTP(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, smtpServer *SMTPServer) *SecError {
+	if smtpServer == nil {
+		log.Info("Removing the mail server of the realm", "realm", keycloakConfig.RealmName)
+	} else {
+		log.Info("Setting the mail server of the realm", "realm", keycloakConfig.RealmName, "host", smtpServer.Host, "from", smtpServer.From)
+	}
+	secErr := SecRealmUpdateSMTP(httpClient, keycloakConfig, accessToken, smtpServer)
+	if secErr != nil {
+		log.Error(secErr.Err, "Error configuring the mail server of the realm", "realm", keycloakConfig.RealmName)
+	}
+	return secErr
+}
+
 func configureKeycloakClient(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
 	// Check if the client is already registered
 	log.Info("Checking for Keycloak client", "name", keycloakConfig.ClientName)
@@ -135,7 +972,149 @@ func configureKeycloakClient(httpClient util.HTTPClient, keycloakConfig *Keycloa
 	} else {
 		// Create a new client
 		log.Info("Creating Keycloak client")
-		secErr := SecClientCreate(httpClient, keycloakConfig, accessToken, keycloakConfig.GatekeeperPublicURL+"/*")
+		secErr, httpStatusCode := SecClientCreate(httpClient, keycloakConfig, accessToken, keycloakConfig.GatekeeperPublicURL+"/*")
+		if httpStatusCode == http.StatusConflict {
+			// Created meanwhile, for example by an operator replica that lost its leader election lock mid-provision
+			log.Info("Keycloak client already exists", "name", keycloakConfig.ClientName)
+			secErr = SecClientAppendURL(httpClient, keycloakConfig, accessToken)
+		}
+		if secErr != nil {
+			return secErr
+		}
+		registeredClient, secErr = SecClientGet(httpClient, keycloakConfig, accessToken)
+		if secErr != nil {
+			return secErr
+		}
+	}
+	if registeredClient == nil {
+		kcError := errors.New("Keycloak client " + keycloakConfig.ClientName + " not found after create")
+		return &SecError{errOpNotFound, kcError, kcError.Error()}
+	}
+	secErr := configureKeycloakClientScopes(httpClient, keycloakConfig, accessToken, registeredClient.ID)
+	if secErr != nil {
+		return secErr
+	}
+	secErr = syncKeycloakTokenClaims(httpClient, keycloakConfig, accessToken, registeredClient.ID)
+	if secErr != nil {
+		return secErr
+	}
+	return SecClientUpdateSessionSettings(httpClient, keycloakConfig, accessToken, registeredClient.ID, keycloakConfig.SessionSettings)
+}
+
+// configureKeycloakClientScopes : Adds the workspace claim, any configured protocol mappers and the
+// configured default client scopes to the client. Existing mappers and scopes are left unchanged.
+func configureKeycloakClientScopes(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string) *SecError {
+	protocolMappers := []ProtocolMapper{NewHardcodedClaimMapper("codewind-workspace", "codewind_workspace", keycloakConfig.WorkspaceID)}
+	protocolMappers = append(protocolMappers, keycloakConfig.ProtocolMappers...)
+	for _, protocolMapper := range protocolMappers {
+		log.Info("Checking client protocol mapper", "client", keycloakConfig.ClientName, "mapper", protocolMapper.Name)
+		secErr := SecClientAddProtocolMapper(httpClient, keycloakConfig, accessToken, clientID, protocolMapper)
+		if secErr != nil {
+			log.Error(secErr.Err, "Adding protocol mapper failed", "mapper", protocolMapper.Name)
+			return secErr
+		}
+	}
+
+	for _, scopeName := range keycloakConfig.ClientScopes {
+		clientScope, secErr := SecClientScopeGet(httpClient, keycloakConfig, accessToken, scopeName)
+		if secErr != nil {
+			return secErr
+		}
+		if clientScope == nil {
+			log.Info("Creating client scope", "scope", scopeName, "realm", keycloakConfig.RealmName)
+			secErr = SecClientScopeCreate(httpClient, keycloakConfig, accessToken, ClientScope{Name: scopeName})
+			if secErr != nil {
+				return secErr
+			}
+			clientScope, secErr = SecClientScopeGet(httpClient, keycloakConfig, accessToken, scopeName)
+			if secErr != nil {
+				return secErr
+			}
+			if clientScope == nil {
+				kcError := errors.New("Client scope " + scopeName + " not found after create")
+				return &SecError{errOpNotFound, kcError, kcError.Error()}
+			}
+		}
+		secErr = SecClientAddDefaultScope(httpClient, keycloakConfig, accessToken, clientID, clientScope.ID)
+		if secErr != nil {
+			log.Error(secErr.Err, "Adding default client scope failed", "scope", scopeName)
+			return secErr
+		}
+	}
+	return nil
+}
+
+// configureKeycloakServiceAccount : Sets the service account of the deployment client as configured. The access role
+// is removed from the service account user before the service account is disabled
+func configureKeycloakServiceAccount(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	registeredClient, secErr := SecClientGet(httpClient, keycloakConfig, accessToken)
+	if secErr == nil && registeredClient == nil {
+		notFound := errors.New("Keycloak client " + keycloakConfig.ClientName + " not found")
+		secErr = &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
+	if secErr != nil {
+		return secErr
+	}
+	accessRoleName := "codewind-" + keycloakConfig.WorkspaceID
+
+	if !keycloakConfig.ServiceAccountEnabled {
+		serviceAccountUser, secErr := SecClientGetServiceAccountUser(httpClient, keycloakConfig, accessToken, registeredClient.ID)
+		if secErr == nil {
+			secErr = SecServiceAccountRemoveRole(httpClient, keycloakConfig, accessToken, serviceAccountUser.ID, accessRoleName)
+		}
+		if secErr != nil && secErr.Op != errOpNotFound {
+			return secErr
+		}
+		log.Info("Disabling the service account of the client", "client", keycloakConfig.ClientName)
+		return SecClientSetServiceAccount(httpClient, keycloakConfig, accessToken, registeredClient.ID, false)
+	}
+
+	log.Info("Enabling the service account of the client", "client", keycloakConfig.ClientName)
+	secErr = SecClientSetServiceAccount(httpClient, keycloakConfig, accessToken, registeredClient.ID, true)
+	if secErr != nil {
+		return secErr
+	}
+	serviceAccountUser, secErr := SecClientGetServiceAccountUser(httpClient, keycloakConfig, accessToken, registeredClient.ID)
+	if secErr != nil {
+		return secErr
+	}
+	return SecServiceAccountAddRole(httpClient, keycloakConfig, accessToken, serviceAccountUser.ID, accessRoleName)
+}
+
+// syncKeycloakTokenClaims : Adds, updates and removes the protocol mappers of the client managed for the Codewind CR.
+// Mappers added by an administrator or by the operator config map are left unchanged
+func syncKeycloakTokenClaims(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string) *SecError {
+	existingMappers, secErr := SecClientGetProtocolMappers(httpClient, keycloakConfig, accessToken, clientID)
+	if secErr != nil {
+		return secErr
+	}
+	existing := map[string]ProtocolMapper{}
+	for _, existingMapper := range existingMappers {
+		if strings.HasPrefix(existingMapper.Name, TokenClaimMapperPrefix) {
+			existing[existingMapper.Name] = existingMapper
+		}
+	}
+
+	for _, protocolMapper := range keycloakConfig.TokenClaimMappers {
+		existingMapper, found := existing[protocolMapper.Name]
+		delete(existing, protocolMapper.Name)
+		switch {
+		case !found:
+			log.Info("Adding token claim mapper", "client", keycloakConfig.ClientName, "mapper", protocolMapper.Name)
+			secErr = SecClientAddProtocolMapper(httpClient, keycloakConfig, accessToken, clientID, protocolMapper)
+		case existingMapper.ProtocolMapper != protocolMapper.ProtocolMapper || !reflect.DeepEqual(existingMapper.Config, protocolMapper.Config):
+			log.Info("Updating token claim mapper", "client", keycloakConfig.ClientName, "mapper", protocolMapper.Name)
+			protocolMapper.ID = existingMapper.ID
+			secErr = SecClientUpdateProtocolMapper(httpClient, keycloakConfig, accessToken, clientID, protocolMapper)
+		}
+		if secErr != nil {
+			return secErr
+		}
+	}
+
+	for name, removedMapper := range existing {
+		log.Info("Removing token claim mapper", "client", keycloakConfig.ClientName, "mapper", name)
+		secErr = SecClientDeleteProtocolMapper(httpClient, keycloakConfig, accessToken, clientID, removedMapper.ID)
 		if secErr != nil {
 			return secErr
 		}
@@ -157,12 +1136,24 @@ func configureKeycloakAccessRole(httpClient util.HTTPClient, keycloakConfig *Key
 	return nil
 }
 
-//Check if the user exists and is registered
+// Check if the user exists and is registered. When an initial password is configured a missing user
+// is created with it, an existing user is never modified.
 func configureKeycloakUser(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
 	registeredUser, secErr := SecUserGet(httpClient, keycloakConfig, accessToken)
 	if secErr == nil && registeredUser != nil {
 		return nil
 	}
+	if secErr.Op == errOpNotFound && keycloakConfig.DevUserInitialPassword != "" {
+		log.Info("Creating user", "Username", keycloakConfig.DevUsername, "requiredActions", keycloakConfig.DevUserRequiredActions)
+		secErr, httpStatusCode := SecUserCreate(httpClient, keycloakConfig, accessToken)
+		if httpStatusCode == http.StatusConflict {
+			return nil
+		}
+		if secErr != nil {
+			log.Error(secErr.Err, "Creating user failed", "reason", secErr.Desc)
+		}
+		return secErr
+	}
 	log.Error(secErr.Err, "Configuring user failed", "reason", secErr.Desc)
 	return secErr
 }
@@ -178,7 +1169,101 @@ func grantUserAccessToDeployment(httpClient util.HTTPClient, keycloakConfig *Key
 	return nil
 }
 
-// // fetchClientSecret : Load client secret
+// syncDeploymentAccessList : Grants the access role to each user of the access list and removes it from the
+// revoked users. Listed users must already exist, revoked users that no longer exist are ignored
+func syncDeploymentAccessList(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	accessRoleName := "codewind-" + keycloakConfig.WorkspaceID
+	for _, username := range keycloakConfig.AccessList {
+		if username == keycloakConfig.DevUsername {
+			continue
+		}
+		userConfig := *keycloakConfig
+		userConfig.DevUsername = username
+		secErr := grantUserAccessToDeployment(httpClient, &userConfig, accessToken)
+		if secErr != nil {
+			return &SecError{secErr.Op, secErr.Err, "User " + username + " of the access list: " + secErr.Desc}
+		}
+	}
+	for _, username := range keycloakConfig.RevokedUsers {
+		log.Info("Revoke access to deployment", "Username", username, "Workspace", keycloakConfig.WorkspaceID)
+		userConfig := *keycloakConfig
+		userConfig.DevUsername = username
+		secErr := SecUserRemoveRole(httpClient, &userConfig, accessToken, accessRoleName)
+		if secErr != nil {
+			log.Error(secErr.Err, "Revoking access to deployment", "Username", username)
+			return secErr
+		}
+	}
+	return nil
+}
+
+// syncDeploymentAccessGroups : Maps the access role to each access group, creating missing groups so that
+// members can be added to them later, and removes the mapping from the revoked groups
+func syncDeploymentAccessGroups(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	accessRoleName := "codewind-" + keycloakConfig.WorkspaceID
+	for _, groupName := range keycloakConfig.AccessGroups {
+		group, secErr := SecGroupGet(httpClient, keycloakConfig, accessToken, groupName)
+		if secErr == nil && group == nil {
+			log.Info("Creating group", "group", groupName)
+			secErr = SecGroupCreate(httpClient, keycloakConfig, accessToken, groupName)
+			if secErr == nil {
+				group, secErr = SecGroupGet(httpClient, keycloakConfig, accessToken, groupName)
+			}
+		}
+		if secErr == nil && group == nil {
+			err := errors.New("group " + groupName + " not found after it was created")
+			secErr = &SecError{errOpNotFound, err, err.Error()}
+		}
+		if secErr == nil {
+			log.Info("Grant group access to deployment", "group", groupName, "Workspace", keycloakConfig.WorkspaceID)
+			secErr = SecGroupAddRole(httpClient, keycloakConfig, accessToken, group.ID, accessRoleName)
+		}
+		if secErr != nil {
+			log.Error(secErr.Err, "Granting group access to deployment", "group", groupName)
+			return &SecError{secErr.Op, secErr.Err, "Group " + groupName + " of the access groups: " + secErr.Desc}
+		}
+	}
+	for _, groupName := range keycloakConfig.RevokedGroups {
+		group, secErr := SecGroupGet(httpClient, keycloakConfig, accessToken, groupName)
+		if secErr == nil && group != nil {
+			log.Info("Revoke group access to deployment", "group", groupName, "Workspace", keycloakConfig.WorkspaceID)
+			secErr = SecGroupRemoveRole(httpClient, keycloakConfig, accessToken, group.ID, accessRoleName)
+		}
+		if secErr != nil {
+			log.Error(secErr.Err, "Revoking group access to deployment", "group", groupName)
+			return secErr
+		}
+	}
+	return nil
+}
+
+// configureIdentityProvider : Completes the configuration of the provider from its discovery document or metadata, the
+// settings of the provider taking precedence, then creates the provider or updates the existing one
+func configureIdentityProvider(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, identityProvider IdentityProvider) *SecError {
+	if identityProvider.ImportFrom != "" {
+		config, secErr := SecIdentityProviderImportConfig(httpClient, keycloakConfig, accessToken, identityProvider.ProviderID, identityProvider.ImportFrom)
+		if secErr != nil {
+			return secErr
+		}
+		for key, value := range identityProvider.Config {
+			config[key] = value
+		}
+		identityProvider.Config = config
+	}
+
+	existing, secErr := SecIdentityProviderGet(httpClient, keycloakConfig, accessToken, identityProvider.Alias)
+	if secErr != nil {
+		return secErr
+	}
+	if existing == nil {
+		log.Info("Adding identity provider", "realm", keycloakConfig.RealmName, "alias", identityProvider.Alias, "provider", identityProvider.ProviderID)
+		return SecIdentityProviderCreate(httpClient, keycloakConfig, accessToken, identityProvider)
+	}
+	log.Info("Updating identity provider", "realm", keycloakConfig.RealmName, "alias", identityProvider.Alias, "provider", identityProvider.ProviderID)
+	return SecIdentityProviderUpdate(httpClient, keycloakConfig, accessToken, identityProvider)
+}
+
+// fetchClientSecret : Load client secret
 func fetchClientSecret(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*RegisteredClientSecret, *SecError) {
 	secretName := "codewind-" + keycloakConfig.WorkspaceID
 	log.Info("Fetching client secret", "name", secretName)
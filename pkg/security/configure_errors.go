@@ -0,0 +1,218 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"errors"
+
+	"github.com/eclipse/codewind-operator/pkg/metrics"
+)
+
+// Keycloak configuration steps reported by a KeycloakConfigError, test with errors.Is
+var (
+	// ErrKeycloakUnreachable : Keycloak did not respond or its certificate was not trusted
+	ErrKeycloakUnreachable = errors.New("keycloak unreachable")
+
+	// ErrKeycloakNotReady : Keycloak is not responding yet, it is probably still starting. Wraps ErrKeycloakUnreachable
+	ErrKeycloakNotReady = &notReadyError{}
+
+	// ErrAuthFailed : the Keycloak admin credentials were rejected
+	ErrAuthFailed = errors.New("keycloak authentication failed")
+
+	// ErrRealmConfig : creating or updating the realm or its access roles failed
+	ErrRealmConfig = errors.New("keycloak realm configuration failed")
+
+	// ErrRoleConfig : creating or deleting the access role of a deployment failed. Wraps ErrRealmConfig
+	ErrRoleConfig = &roleConfigError{}
+
+	// ErrClientConfig : creating or updating the client or reading its secret failed
+	ErrClientConfig = errors.New("keycloak client configuration failed")
+
+	// ErrUserConfig : the developer user could not be found or granted access
+	ErrUserConfig = errors.New("keycloak user configuration failed")
+
+	// ErrAdminPasswordChange : the password of the Keycloak admin user could not be changed
+	ErrAdminPasswordChange = errors.New("keycloak admin password change failed")
+
+	// ErrFederationConfig : the user federation provider of the realm could not be configured
+	ErrFederationConfig = errors.New("keycloak user federation configuration failed")
+
+	// ErrIdentityProviderConfig : an identity provider of the realm could not be configured or removed
+	ErrIdentityProviderConfig = errors.New("keycloak identity provider configuration failed")
+)
+
+// notReadyError : a Keycloak that is starting is also unreachable, so callers testing for ErrKeycloakUnreachable keep working
+type notReadyError struct{}
+
+func (e *notReadyError) Error() string {
+	return "keycloak not ready"
+}
+
+func (e *notReadyError) Unwrap() error {
+	return ErrKeycloakUnreachable
+}
+
+// roleConfigError : access roles belong to the realm, so callers testing for ErrRealmConfig keep working
+type roleConfigError struct{}
+
+func (e *roleConfigError) Error() string {
+	return "keycloak access role configuration failed"
+}
+
+func (e *roleConfigError) Unwrap() error {
+	return ErrRealmConfig
+}
+
+// KeycloakConfigError : Error returned when configuring Keycloak for Codewind. Step is one of the
+// Err* sentinels above and SecErr holds the underlying security error when there is one.
+type KeycloakConfigError struct {
+	Step   error
+	SecErr *SecError
+	Err    error
+}
+
+// Error : keeps the message of the underlying error for log compatibility
+func (e *KeycloakConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap : returns the failing step so callers can use errors.Is
+func (e *KeycloakConfigError) Unwrap() error {
+	return e.Step
+}
+
+// Code : Returns the error code of the underlying security error, or of the step when there is none
+func (e *KeycloakConfigError) Code() ErrorCode {
+	if e.SecErr != nil {
+		if code := e.SecErr.Code(); code != CodeUnknown {
+			return code
+		}
+	}
+	switch {
+	case errors.Is(e.Step, ErrKeycloakUnreachable):
+		return CodeKeycloakUnreachable
+	case errors.Is(e.Step, ErrAuthFailed):
+		return CodeInvalidCredentials
+	}
+	return CodeUnknown
+}
+
+// newKeycloakConfigError : wraps a security error with the step that failed and counts the failure
+func newKeycloakConfigError(step error, secErr *SecError) *KeycloakConfigError {
+	metrics.KeycloakConfigFailures.WithLabelValues(configStepName(step)).Inc()
+	return &KeycloakConfigError{Step: step, SecErr: secErr, Err: secErr.Err}
+}
+
+// configStepName : metric label of a failed configuration step
+func configStepName(step error) string {
+	switch {
+	case errors.Is(step, ErrKeycloakUnreachable):
+		return "connection"
+	case errors.Is(step, ErrAuthFailed):
+		return "authentication"
+	case errors.Is(step, ErrRoleConfig):
+		return "role"
+	case errors.Is(step, ErrRealmConfig):
+		return "realm"
+	case errors.Is(step, ErrClientConfig):
+		return "client"
+	case errors.Is(step, ErrUserConfig):
+		return "user"
+	case errors.Is(step, ErrAdminPasswordChange):
+		return "admin_password"
+	case errors.Is(step, ErrFederationConfig):
+		return "user_federation"
+	case errors.Is(step, ErrIdentityProviderConfig):
+		return "identity_provider"
+	}
+	return "other"
+}
+
+// ReasonWaitingForKeycloak : condition reason while Keycloak is starting, not a failure
+const ReasonWaitingForKeycloak = "WaitingForKeycloak"
+
+// ConfigFailureReason : Returns a CamelCase reason for a failed configuration, suitable for a status condition
+func ConfigFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrKeycloakNotReady):
+		return ReasonWaitingForKeycloak
+	case errors.Is(err, ErrKeycloakUnreachable):
+		return "KeycloakUnreachable"
+	case errors.Is(err, ErrAuthFailed):
+		return "AuthenticationFailed"
+	case errors.Is(err, ErrRealmConfig):
+		return "RealmConfigFailed"
+	case errors.Is(err, ErrClientConfig):
+		return "ClientConfigFailed"
+	case errors.Is(err, ErrUserConfig):
+		return "UserConfigFailed"
+	case errors.Is(err, ErrAdminPasswordChange):
+		return "AdminPasswordChangeFailed"
+	case errors.Is(err, ErrFederationConfig):
+		return "UserFederationConfigFailed"
+	case errors.Is(err, ErrIdentityProviderConfig):
+		return "IdentityProviderConfigFailed"
+	case errors.Is(err, ErrOIDCDiscovery):
+		return "OIDCDiscoveryFailed"
+	}
+	return "ConfigurationFailed"
+}
+
+// ConditionReason : Returns a CamelCase reason telling both the failed step and the error code, so that automation
+// can tell bad admin credentials from an unreachable Keycloak or a role of the same name. Failures of the connection,
+// the credentials or the server are reported by their code whatever the step, a resource that was refused, missing
+// or in conflict is reported by the step and the code, such as RoleConflict or ClientNotFound. Without an error code
+// the reason is that of ConfigFailureReason
+func ConditionReason(err error) string {
+	if errors.Is(err, ErrKeycloakNotReady) {
+		return ReasonWaitingForKeycloak
+	}
+	code := ErrorCodeOf(err)
+	switch code {
+	case CodeKeycloakUnreachable, CodeKeycloakTimeout, CodeKeycloakCircuitOpen, CodeKeycloakThrottled, CodeCertificateUntrusted, CodeServerError, CodeInvalidCredentials:
+		return string(code)
+	case CodeUnknown:
+		return ConfigFailureReason(err)
+	}
+	if errors.Is(err, ErrAuthFailed) && code != CodeNotFound {
+		// The token endpoint refuses requests with bad credentials in several ways
+		return string(CodeInvalidCredentials)
+	}
+	if resource := configStepResource(err); resource != "" {
+		return resource + string(code)
+	}
+	return ConfigFailureReason(err)
+}
+
+// configStepResource : CamelCase name of the resource a failed configuration step changes, prefixing the error code
+// in a condition reason
+func configStepResource(step error) string {
+	switch {
+	case errors.Is(step, ErrAuthFailed):
+		return "Keycloak"
+	case errors.Is(step, ErrRoleConfig):
+		return "Role"
+	case errors.Is(step, ErrRealmConfig):
+		return "Realm"
+	case errors.Is(step, ErrClientConfig):
+		return "Client"
+	case errors.Is(step, ErrUserConfig):
+		return "User"
+	case errors.Is(step, ErrAdminPasswordChange):
+		return "AdminPassword"
+	case errors.Is(step, ErrFederationConfig):
+		return "UserFederation"
+	case errors.Is(step, ErrIdentityProviderConfig):
+		return "IdentityProvider"
+	}
+	return ""
+}
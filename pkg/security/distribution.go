@@ -0,0 +1,127 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package security
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// KeycloakDistribution : Distribution of a Keycloak server, deciding where it serves its REST API
+type KeycloakDistribution string
+
+const (
+	// KeycloakLegacy : WildFly based Keycloak before version 17, or a newer server started with the /auth relative path
+	KeycloakLegacy KeycloakDistribution = "legacy"
+
+	// KeycloakQuarkus : Quarkus based Keycloak 17 or later, serving its REST API from the root of the server
+	KeycloakQuarkus KeycloakDistribution = "quarkus"
+)
+
+// contextRoot : path the distribution serves its REST API under
+func (d KeycloakDistribution) contextRoot() string {
+	if d == KeycloakQuarkus {
+		return ""
+	}
+	return "/auth"
+}
+
+// distributions : distribution of each Keycloak server whose distribution is known, keyed by auth URL
+var distributions = struct {
+	sync.Mutex
+	byAuthURL map[string]KeycloakDistribution
+}{byAuthURL: make(map[string]KeycloakDistribution)}
+
+// RegisterKeycloakDistribution : Records the distribution of a Keycloak server, for example from its CR, so that it
+// is not detected
+func RegisterKeycloakDistribution(authURL string, distribution KeycloakDistribution) {
+	distributions.Lock()
+	defer distributions.Unlock()
+	distributions.byAuthURL[authURL] = distribution
+}
+
+// registeredDistribution : the recorded distribution of a Keycloak server, empty when it is not known yet
+func registeredDistribution(authURL string) KeycloakDistribution {
+	distributions.Lock()
+	defer distributions.Unlock()
+	return distributions.byAuthURL[authURL]
+}
+
+// DetectKeycloakDistribution : Finds out where a Keycloak server serves its REST API by reading the master realm
+// under each context root, and records the result. A server that was already detected or registered is not called
+func DetectKeycloakDistribution(authURL string, rootCAs *x509.CertPool, retryPolicy util.RetryPolicy) (KeycloakDistribution, error) {
+	keycloakConfig := KeycloakConfiguration{AuthURL: authURL, RootCAs: rootCAs, RetryPolicy: retryPolicy}
+	secErr := resolveDistribution(keycloakHTTPClient(&keycloakConfig), &keycloakConfig)
+	if secErr != nil {
+		return "", secErr.Err
+	}
+	return keycloakConfig.Distribution, nil
+}
+
+// resolveDistribution : Sets the distribution of the configuration when it is not set, detecting it the first time
+func resolveDistribution(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration) *SecError {
+	if keycloakConfig.Distribution != "" {
+		return nil
+	}
+	if distribution := registeredDistribution(keycloakConfig.AuthURL); distribution != "" {
+		keycloakConfig.Distribution = distribution
+		return nil
+	}
+	for _, distribution := range []KeycloakDistribution{KeycloakLegacy, KeycloakQuarkus} {
+		req, err := http.NewRequest("GET", strings.TrimSuffix(keycloakConfig.AuthURL, "/")+distribution.contextRoot()+"/realms/master", nil)
+		if err != nil {
+			return &SecError{errOpConnection, err, err.Error()}
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return &SecError{errOpConnection, err, err.Error()}
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			log.Info("Detected Keycloak distribution", "URL", keycloakConfig.AuthURL, "distribution", distribution)
+			RegisterKeycloakDistribution(keycloakConfig.AuthURL, distribution)
+			keycloakConfig.Distribution = distribution
+			return nil
+		}
+	}
+	err := errors.New("Keycloak does not serve the master realm under /auth/realms or /realms")
+	return &SecError{errOpNotFound, err, err.Error()}
+}
+
+// baseURL : URL the REST API of the Keycloak server is served under, the legacy context root until the
+// distribution is known
+func (keycloakConfig *KeycloakConfiguration) baseURL() string {
+	distribution := keycloakConfig.Distribution
+	if distribution == "" {
+		distribution = registeredDistribution(keycloakConfig.AuthURL)
+	}
+	return keycloakConfig.AuthURL + distribution.contextRoot()
+}
+
+// adminURL : URL of an endpoint of the admin REST API, for example /serverinfo
+func (keycloakConfig *KeycloakConfiguration) adminURL(path string) string {
+	return keycloakConfig.baseURL() + "/admin" + path
+}
+
+// adminRealmURL : URL of an admin REST API endpoint of the configured realm, for example /users
+func (keycloakConfig *KeycloakConfiguration) adminRealmURL(path string) string {
+	return keycloakConfig.adminURL("/realms/" + keycloakConfig.RealmName + path)
+}
+
+// realmURL : URL of a public endpoint of a realm, for example the token endpoint of the master realm
+func (keycloakConfig *KeycloakConfiguration) realmURL(realmName string, path string) string {
+	return keycloakConfig.baseURL() + "/realms/" + realmName + path
+}
@@ -0,0 +1,173 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// ErrorCode : Why a call to Keycloak failed, independent of the configuration step that made it. The values are
+// CamelCase so that they can be used in status condition reasons
+type ErrorCode string
+
+// Error codes of a SecError
+const (
+	// CodeUnknown : the cause of the failure is not known
+	CodeUnknown ErrorCode = ""
+
+	// CodeKeycloakUnreachable : Keycloak did not respond, or the connection failed
+	CodeKeycloakUnreachable ErrorCode = "KeycloakUnreachable"
+
+	// CodeKeycloakTimeout : Keycloak did not respond in time
+	CodeKeycloakTimeout ErrorCode = "KeycloakTimeout"
+
+	// CodeKeycloakCircuitOpen : the request was not sent, Keycloak failed repeatedly and requests are suspended
+	CodeKeycloakCircuitOpen ErrorCode = "KeycloakCircuitOpen"
+
+	// CodeKeycloakThrottled : the request was not sent, it would have waited too long for the rate limit of the operator
+	CodeKeycloakThrottled ErrorCode = "KeycloakThrottled"
+
+	// CodeCertificateUntrusted : the certificate of Keycloak could not be verified with the CA bundle
+	CodeCertificateUntrusted ErrorCode = "KeycloakCertificateUntrusted"
+
+	// CodeInvalidCredentials : Keycloak rejected the admin credentials, or the token obtained with them
+	CodeInvalidCredentials ErrorCode = "InvalidAdminCredentials"
+
+	// CodeForbidden : the admin user may not make the change, HTTP 403
+	CodeForbidden ErrorCode = "Forbidden"
+
+	// CodeNotFound : the realm, client, role, user or group does not exist, HTTP 404 or an empty search
+	CodeNotFound ErrorCode = "NotFound"
+
+	// CodeConflict : a resource of the same name exists already, HTTP 409
+	CodeConflict ErrorCode = "Conflict"
+
+	// CodeRejected : Keycloak rejected the request as invalid, any other 4xx status
+	CodeRejected ErrorCode = "Rejected"
+
+	// CodeServerError : Keycloak failed handling the request, HTTP 5xx
+	CodeServerError ErrorCode = "KeycloakServerError"
+
+	// CodeInvalidResponse : the response of Keycloak could not be parsed
+	CodeInvalidResponse ErrorCode = "InvalidResponse"
+
+	// CodeInvalidSettings : the request could not be built from the settings, such as a malformed URL or password
+	CodeInvalidSettings ErrorCode = "InvalidSettings"
+)
+
+// tokenErrors : OAuth error codes of the token endpoint meaning the admin credentials were not accepted
+var tokenErrors = map[string]bool{
+	"invalid_grant":       true,
+	"invalid_client":      true,
+	"unauthorized_client": true,
+}
+
+// ResponseError : An unexpected HTTP status of Keycloak. The message is that of the error it replaces, so logs and
+// status messages read as before
+type ResponseError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	return e.Message
+}
+
+// newResponseError : error for an unexpected HTTP status, carrying the status for Code
+func newResponseError(statusCode int, message string) error {
+	return &ResponseError{StatusCode: statusCode, Message: message}
+}
+
+// Code : Classifies the error from the HTTP status of the response, or from the operation that failed without one
+func (se *SecError) Code() ErrorCode {
+	if tokenErrors[se.Op] {
+		return CodeInvalidCredentials
+	}
+	var responseErr *ResponseError
+	if errors.As(se.Err, &responseErr) {
+		return statusErrorCode(responseErr.StatusCode)
+	}
+	switch se.Op {
+	case errOpNotFound:
+		return CodeNotFound
+	case errOpResponseFormat:
+		return CodeInvalidResponse
+	case errOpPassword, errOpHostname, errOpConConfig:
+		return CodeInvalidSettings
+	case errOpConnection:
+		return connectionErrorCode(se.Err)
+	}
+	return CodeUnknown
+}
+
+// statusErrorCode : error code of an unexpected HTTP status
+func statusErrorCode(statusCode int) ErrorCode {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return CodeInvalidCredentials
+	case statusCode == http.StatusForbidden:
+		return CodeForbidden
+	case statusCode == http.StatusNotFound:
+		return CodeNotFound
+	case statusCode == http.StatusConflict:
+		return CodeConflict
+	case statusCode >= 500:
+		return CodeServerError
+	case statusCode >= 400:
+		return CodeRejected
+	}
+	return CodeInvalidResponse
+}
+
+// connectionErrorCode : error code of a request that got no response
+func connectionErrorCode(err error) ErrorCode {
+	var guardErr *GuardError
+	if errors.As(err, &guardErr) {
+		return guardErr.Code
+	}
+	if util.IsTLSError(err) {
+		return CodeCertificateUntrusted
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return CodeKeycloakTimeout
+		}
+		return CodeKeycloakUnreachable
+	}
+	var notReady *util.ServiceNotReadyError
+	if errors.As(err, &notReady) {
+		if notReady.TLSError {
+			return CodeCertificateUntrusted
+		}
+		return CodeKeycloakUnreachable
+	}
+	return CodeUnknown
+}
+
+// ErrorCodeOf : Returns the error code of a KeycloakConfigError or SecError, falling back to the failing step when
+// the underlying error does not tell. Errors of other packages are CodeUnknown
+func ErrorCodeOf(err error) ErrorCode {
+	var configErr *KeycloakConfigError
+	if errors.As(err, &configErr) {
+		return configErr.Code()
+	}
+	var secErr *SecError
+	if errors.As(err, &secErr) {
+		return secErr.Code()
+	}
+	return CodeUnknown
+}
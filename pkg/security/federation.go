@@ -0,0 +1,217 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package security
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// userStorageProviderType : component type of the user federation providers of a realm
+const userStorageProviderType = "org.keycloak.storage.UserStorageProvider"
+
+// LDAPFederationName : name of the LDAP provider the operator manages in the realm
+const LDAPFederationName = "codewind-ldap"
+
+// Component : A Keycloak realm component, user federation providers are components of the realm
+type Component struct {
+	ID           string              `json:"id,omitempty"`
+	Name         string              `json:"name"`
+	ProviderID   string              `json:"providerId"`
+	ProviderType string              `json:"providerType"`
+	ParentID     string              `json:"parentId,omitempty"`
+	Config       map[string][]string `json:"config"`
+}
+
+// LDAPFederation : LDAP user federation provider of a realm. Never log BindCredential.
+type LDAPFederation struct {
+	ConnectionURL     string
+	Vendor            string
+	BindDN            string
+	BindCredential    string
+	UsersDN           string
+	UsernameAttribute string
+	UserObjectClasses []string
+	ImportUsers       bool
+	FullSyncPeriod    int32
+	ChangedSyncPeriod int32
+}
+
+// component : Converts the federation into a read only LDAP component of the realm, filling in the defaults of the vendor
+func (l LDAPFederation) component(realmID string) Component {
+	vendor := l.Vendor
+	if vendor == "" {
+		vendor = "other"
+	}
+	usernameAttribute, rdnAttribute, uuidAttribute := "uid", "uid", "entryUUID"
+	objectClasses := []string{"inetOrgPerson", "organizationalPerson"}
+	if vendor == "ad" {
+		usernameAttribute, rdnAttribute, uuidAttribute = "sAMAccountName", "cn", "objectGUID"
+		objectClasses = []string{"person", "organizationalPerson", "user"}
+	}
+	if l.UsernameAttribute != "" {
+		usernameAttribute = l.UsernameAttribute
+	}
+	if len(l.UserObjectClasses) > 0 {
+		objectClasses = l.UserObjectClasses
+	}
+	authType := "none"
+	if l.BindDN != "" {
+		authType = "simple"
+	}
+	syncPeriod := func(seconds int32) string {
+		if seconds <= 0 {
+			return "-1"
+		}
+		return strconv.Itoa(int(seconds))
+	}
+	return Component{
+		Name:         LDAPFederationName,
+		ProviderID:   "ldap",
+		ProviderType: userStorageProviderType,
+		ParentID:     realmID,
+		Config: map[string][]string{
+			"enabled":               {"true"},
+			"priority":              {"0"},
+			"vendor":                {vendor},
+			"connectionUrl":         {l.ConnectionURL},
+			"authType":              {authType},
+			"bindDn":                {l.BindDN},
+			"bindCredential":        {l.BindCredential},
+			"usersDn":               {l.UsersDN},
+			"usernameLDAPAttribute": {usernameAttribute},
+			"rdnLDAPAttribute":      {rdnAttribute},
+			"uuidLDAPAttribute":     {uuidAttribute},
+			"userObjectClasses":     {strings.Join(objectClasses, ", ")},
+			"searchScope":           {"2"}, // the whole subtree of usersDn
+			"editMode":              {"READ_ONLY"},
+			"syncRegistrations":     {"false"},
+			"useTruststoreSpi":      {"ldapsOnly"},
+			"importEnabled":         {strconv.FormatBool(l.ImportUsers)},
+			"fullSyncPeriod":        {syncPeriod(l.FullSyncPeriod)},
+			"changedSyncPeriod":     {syncPeriod(l.ChangedSyncPeriod)},
+		},
+	}
+}
+
+// SecUserFederationGet : Finds a user federation provider of the realm by name, returns nil if it does not exist
+func SecUserFederationGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, name string) (*Component, *SecError) {
+
+	// build REST request
+	query := url.Values{"type": []string{userStorageProviderType}, "name": []string{name}}
+	componentsURL := keycloakConfig.adminRealmURL("/components?") + query.Encode()
+	req, err := http.NewRequest("GET", componentsURL, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	components := []Component{}
+	err = json.Unmarshal(body, &components)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	for _, component := range components {
+		if component.Name == name {
+			return &component, nil
+		}
+	}
+	return nil, nil
+}
+
+// SecUserFederationCreate : Adds a user federation provider to the realm
+func SecUserFederationCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, component Component) *SecError {
+	url := keycloakConfig.adminRealmURL("/components")
+	return sendComponent(httpClient, accessToken, "POST", url, component, http.StatusCreated)
+}
+
+// SecUserFederationUpdate : Replaces the configuration of an existing user federation provider of the realm
+func SecUserFederationUpdate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, component Component) *SecError {
+	url := keycloakConfig.adminRealmURL("/components/") + component.ID
+	return sendComponent(httpClient, accessToken, "PUT", url, component, http.StatusNoContent)
+}
+
+// SecUserFederationDelete : Removes a user federation provider from the realm, along with the users it imported
+func SecUserFederationDelete(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, componentID string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/components/") + componentID
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (a provider that is already gone returns StatusNotFound)
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusNotFound {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
+
+// sendComponent : Sends a component to Keycloak, success is reported with the expected status code
+func sendComponent(httpClient util.HTTPClient, accessToken string, method string, url string, component Component, expectedStatus int) *SecError {
+	jsonComponent, err := json.Marshal(component)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(string(jsonComponent)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != expectedStatus {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpCreate, kcError, kcError.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// Group : A top level Keycloak group
+type Group struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+}
+
+// SecGroupGet : Finds a top level group in the realm by name, returns nil if it does not exist
+func SecGroupGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, groupName string) (*Group, *SecError) {
+
+	// build REST request, the search also matches subgroups and partial names
+	search := url.Values{"search": []string{groupName}}
+	groupsURL := keycloakConfig.adminRealmURL("/groups?") + search.Encode()
+	req, err := http.NewRequest("GET", groupsURL, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	groups := []Group{}
+	err = json.Unmarshal(body, &groups)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	for _, group := range groups {
+		if group.Name == groupName {
+			return &group, nil
+		}
+	}
+	return nil, nil
+}
+
+// SecGroupCreate : Creates a new top level group in the realm, an existing group is left unchanged
+func SecGroupCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, groupName string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/groups")
+	jsonGroup, err := json.Marshal(Group{Name: groupName})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	payload := strings.NewReader(string(jsonGroup))
+	req, err := http.NewRequest("POST", url, payload)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (an existing group returns StatusConflict)
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusConflict {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpCreate, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecGroupAddRole : Maps a realm role to a group, granting it to every member of the group
+func SecGroupAddRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, groupID string, roleName string) *SecError {
+	existingRole, secErr := getRoleByName(httpClient, keycloakConfig, accessToken, roleName)
+	if secErr != nil {
+		return secErr
+	}
+	log.Info("Adding role to group", "role", existingRole.Name, "groupID", groupID)
+	return groupRoleMappings(httpClient, keycloakConfig, accessToken, groupID, "POST", existingRole)
+}
+
+// SecGroupRemoveRole : Removes a realm role mapping from a group, a role that is not mapped is ignored
+func SecGroupRemoveRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, groupID string, roleName string) *SecError {
+	existingRole, secErr := getRoleByName(httpClient, keycloakConfig, accessToken, roleName)
+	if secErr != nil {
+		return secErr
+	}
+	log.Info("Removing role from group", "role", existingRole.Name, "groupID", groupID)
+	return groupRoleMappings(httpClient, keycloakConfig, accessToken, groupID, "DELETE", existingRole)
+}
+
+// groupRoleMappings : Adds (POST) or removes (DELETE) a realm role mapping of a group
+func groupRoleMappings(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, groupID string, method string, role *Role) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/groups/") + groupID + "/role-mappings/realm"
+	jsonRoles, err := json.Marshal([]Role{*role})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(string(jsonRoles)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
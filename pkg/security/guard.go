@@ -0,0 +1,381 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/metrics"
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+const (
+	// KeycloakRateLimitKey : key of the operator config map limiting the requests per second sent to each Keycloak
+	KeycloakRateLimitKey = "keycloakRateLimit"
+
+	// KeycloakRateBurstKey : key of the operator config map with the requests sent at once before the rate limit applies
+	KeycloakRateBurstKey = "keycloakRateBurst"
+
+	// KeycloakRateMaxWaitKey : key of the operator config map with how long a request waits for the rate limit
+	KeycloakRateMaxWaitKey = "keycloakRateMaxWait"
+
+	// KeycloakCircuitFailuresKey : key of the operator config map with the consecutive failures opening the circuit
+	KeycloakCircuitFailuresKey = "keycloakCircuitFailures"
+
+	// KeycloakCircuitCooldownKey : key of the operator config map with how long the circuit stays open
+	KeycloakCircuitCooldownKey = "keycloakCircuitCooldown"
+
+	// halfOpenRetry : wait suggested to the requests refused while the first request after the cooldown probes Keycloak
+	halfOpenRetry = 5 * time.Second
+)
+
+// KeycloakGuardSettings : How the requests to each Keycloak are rate limited, and after how many consecutive failures
+// they are refused for a cooldown
+type KeycloakGuardSettings struct {
+	// RateLimit : requests per second sent to a Keycloak, no limit when zero
+	RateLimit float64
+
+	// Burst : requests sent at once before the rate limit applies
+	Burst int
+
+	// MaxWait : longest a request waits for the rate limit, requests that would wait longer are refused
+	MaxWait time.Duration
+
+	// CircuitFailures : consecutive timeouts, connection failures or 5xx responses opening the circuit, the
+	// circuit never opens when zero
+	CircuitFailures int
+
+	// CircuitCooldown : how long the circuit stays open before a request probes Keycloak again
+	CircuitCooldown time.Duration
+}
+
+// DefaultKeycloakGuardSettings : Settings of the keys the operator config map does not set
+var DefaultKeycloakGuardSettings = KeycloakGuardSettings{
+	RateLimit:       20,
+	Burst:           40,
+	MaxWait:         5 * time.Second,
+	CircuitFailures: 5,
+	CircuitCooldown: 30 * time.Second,
+}
+
+// circuitState : whether requests are sent to a Keycloak. The values are those of the circuit state metric
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+// GuardError : A request that was not sent to Keycloak, because its circuit is open or the request would have waited
+// too long for the rate limit. Code is CodeKeycloakCircuitOpen or CodeKeycloakThrottled
+type GuardError struct {
+	AuthURL    string
+	Code       ErrorCode
+	RetryAfter time.Duration
+}
+
+func (e *GuardError) Error() string {
+	if e.Code == CodeKeycloakThrottled {
+		return fmt.Sprintf("Request to Keycloak %s not sent, the rate limit of the operator is exceeded, retry in %s", e.AuthURL, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("Request to Keycloak %s not sent, Keycloak failed repeatedly and requests are suspended for %s", e.AuthURL, e.RetryAfter.Round(time.Second))
+}
+
+// RetryAfter : Returns how long to wait before calling Keycloak again when err, a KeycloakConfigError or SecError,
+// is caused by a request the rate limit or the circuit breaker refused. Zero for other errors
+func RetryAfter(err error) time.Duration {
+	var configErr *KeycloakConfigError
+	if errors.As(err, &configErr) && configErr.SecErr != nil {
+		err = configErr.SecErr
+	}
+	var secErr *SecError
+	if errors.As(err, &secErr) {
+		err = secErr.Err
+	}
+	var guardErr *GuardError
+	if errors.As(err, &guardErr) {
+		return guardErr.RetryAfter
+	}
+	return 0
+}
+
+// KeycloakCircuitStatus : State of the circuit breaker of a Keycloak
+type KeycloakCircuitStatus struct {
+	// Open : requests are refused, or only a probe is sent, after consecutive failures
+	Open bool
+
+	// Failures : consecutive failed requests
+	Failures int
+
+	// RetryAfter : time left until a request probes Keycloak again, zero once a probe may be sent
+	RetryAfter time.Duration
+}
+
+// keycloakGuard : Rate limiter and circuit breaker of the requests to one Keycloak, shared by every reconcile
+type keycloakGuard struct {
+	sync.Mutex
+	authURL  string
+	settings KeycloakGuardSettings
+
+	// tokens : requests that can be sent without waiting, negative when requests are waiting for the rate limit
+	tokens   float64
+	refilled time.Time
+
+	state     circuitState
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// guards : the guard of each Keycloak, by auth URL
+var guards = struct {
+	sync.Mutex
+	settings KeycloakGuardSettings
+	byURL    map[string]*keycloakGuard
+}{settings: DefaultKeycloakGuardSettings}
+
+// keycloakGuardFor : Returns the guard of the Keycloak at authURL, creating it with the current settings
+func keycloakGuardFor(authURL string) *keycloakGuard {
+	authURL = strings.TrimSuffix(authURL, "/")
+	guards.Lock()
+	defer guards.Unlock()
+	guard := guards.byURL[authURL]
+	if guard == nil {
+		if guards.byURL == nil {
+			guards.byURL = map[string]*keycloakGuard{}
+		}
+		guard = &keycloakGuard{authURL: authURL, settings: guards.settings, tokens: float64(guards.settings.Burst), refilled: time.Now()}
+		guards.byURL[authURL] = guard
+	}
+	return guard
+}
+
+// admit : Decides whether a request may be sent now. Returns how long it waits for the rate limit, whether it probes
+// a circuit that was open, or the GuardError refusing it
+func (g *keycloakGuard) admit(now time.Time) (time.Duration, bool, error) {
+	g.Lock()
+	defer g.Unlock()
+	probe := false
+	switch g.state {
+	case circuitOpen:
+		if now.Before(g.openUntil) {
+			return 0, false, g.refuse(CodeKeycloakCircuitOpen, g.openUntil.Sub(now), "circuit_open")
+		}
+		g.setState(circuitHalfOpen)
+		fallthrough
+	case circuitHalfOpen:
+		if g.probing {
+			return 0, false, g.refuse(CodeKeycloakCircuitOpen, halfOpenRetry, "circuit_open")
+		}
+		g.probing = true
+		probe = true
+	}
+
+	if g.settings.RateLimit <= 0 {
+		return 0, probe, nil
+	}
+	g.tokens += now.Sub(g.refilled).Seconds() * g.settings.RateLimit
+	if burst := float64(g.settings.Burst); g.tokens > burst {
+		g.tokens = burst
+	}
+	g.refilled = now
+	var wait time.Duration
+	if g.tokens < 1 {
+		wait = time.Duration((1 - g.tokens) / g.settings.RateLimit * float64(time.Second))
+		if wait > g.settings.MaxWait {
+			if probe {
+				g.probing = false
+			}
+			return 0, false, g.refuse(CodeKeycloakThrottled, wait, "rate_limited")
+		}
+		metrics.KeycloakRequestsDelayed.WithLabelValues(g.authURL).Inc()
+	}
+	g.tokens--
+	return wait, probe, nil
+}
+
+// refuse : counts a refused request. The caller holds the lock
+func (g *keycloakGuard) refuse(code ErrorCode, retryAfter time.Duration, reason string) error {
+	metrics.KeycloakRequestsShed.WithLabelValues(g.authURL, reason).Inc()
+	return &GuardError{AuthURL: g.authURL, Code: code, RetryAfter: retryAfter}
+}
+
+// record : Updates the circuit with the result of a request that was admitted. Requests cancelled by the caller say
+// nothing about Keycloak and only end a probe
+func (g *keycloakGuard) record(probe bool, response *http.Response, err error, now time.Time) {
+	g.Lock()
+	defer g.Unlock()
+	if probe {
+		g.probing = false
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil && response.StatusCode < 500 {
+		if g.state != circuitClosed {
+			log.Info("Keycloak responds again, resuming requests", "URL", g.authURL)
+		}
+		g.failures = 0
+		g.setState(circuitClosed)
+		return
+	}
+	g.failures++
+	if g.settings.CircuitFailures <= 0 {
+		return
+	}
+	if g.state == circuitHalfOpen || (g.state == circuitClosed && g.failures >= g.settings.CircuitFailures) {
+		log.Info("Keycloak failed repeatedly, suspending requests", "URL", g.authURL, "failures", g.failures, "cooldown", g.settings.CircuitCooldown.String())
+		g.openUntil = now.Add(g.settings.CircuitCooldown)
+		g.setState(circuitOpen)
+	}
+}
+
+// openError : Returns the GuardError refusing requests while the circuit is open and its cooldown has not passed,
+// without counting a request
+func (g *keycloakGuard) openError(now time.Time) error {
+	g.Lock()
+	defer g.Unlock()
+	if g.state != circuitOpen || !now.Before(g.openUntil) {
+		return nil
+	}
+	return &GuardError{AuthURL: g.authURL, Code: CodeKeycloakCircuitOpen, RetryAfter: g.openUntil.Sub(now)}
+}
+
+// setState : changes the state of the circuit and its metric. The caller holds the lock
+func (g *keycloakGuard) setState(state circuitState) {
+	g.state = state
+	metrics.KeycloakCircuitState.WithLabelValues(g.authURL).Set(float64(state))
+}
+
+// KeycloakCircuitState : Returns the state of the circuit breaker of the Keycloak at authURL
+func KeycloakCircuitState(authURL string) KeycloakCircuitStatus {
+	guard := keycloakGuardFor(authURL)
+	guard.Lock()
+	defer guard.Unlock()
+	status := KeycloakCircuitStatus{Open: guard.state != circuitClosed, Failures: guard.failures}
+	if guard.state == circuitOpen {
+		if wait := time.Until(guard.openUntil); wait > 0 {
+			status.RetryAfter = wait
+		}
+	}
+	return status
+}
+
+// guardedHTTPClient : An HTTPClient sending each attempt of a request through the guard of a Keycloak
+type guardedHTTPClient struct {
+	client  util.HTTPClient
+	authURL string
+}
+
+// Do : Sends the request once the rate limit allows it, unless the circuit of the Keycloak is open
+func (c *guardedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	guard := keycloakGuardFor(c.authURL)
+	wait, probe, err := guard.admit(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		select {
+		case <-req.Context().Done():
+			guard.record(probe, nil, context.Canceled, time.Now())
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+	response, err := c.client.Do(req)
+	guard.record(probe, response, err, time.Now())
+	return response, err
+}
+
+// KeycloakGuardSettingsFromOperatorConfig : Reads the keycloakRateLimit, keycloakRateBurst, keycloakRateMaxWait,
+// keycloakCircuitFailures and keycloakCircuitCooldown settings of the operator config map. Settings that are not set
+// or are invalid keep their default, an error names the first invalid setting
+func KeycloakGuardSettingsFromOperatorConfig(data map[string]string) (KeycloakGuardSettings, error) {
+	settings := DefaultKeycloakGuardSettings
+	var firstErr error
+	if value := strings.TrimSpace(data[KeycloakRateLimitKey]); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 {
+			firstErr = fmt.Errorf("operator config map key %s must be a number of requests per second, 0 for no limit, got %q", KeycloakRateLimitKey, value)
+		} else {
+			settings.RateLimit = rate
+		}
+	}
+	counts := []struct {
+		key   string
+		value *int
+		min   int
+	}{
+		{KeycloakRateBurstKey, &settings.Burst, 1},
+		{KeycloakCircuitFailuresKey, &settings.CircuitFailures, 0},
+	}
+	for _, setting := range counts {
+		value := strings.TrimSpace(data[setting.key])
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < setting.min {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("operator config map key %s must be a number of at least %d, got %q", setting.key, setting.min, value)
+			}
+			continue
+		}
+		*setting.value = parsed
+	}
+	durations := []struct {
+		key   string
+		value *time.Duration
+	}{
+		{KeycloakRateMaxWaitKey, &settings.MaxWait},
+		{KeycloakCircuitCooldownKey, &settings.CircuitCooldown},
+	}
+	for _, setting := range durations {
+		value := strings.TrimSpace(data[setting.key])
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("operator config map key %s must be a positive duration such as 30s, got %q", setting.key, value)
+			}
+			continue
+		}
+		*setting.value = parsed
+	}
+	return settings, firstErr
+}
+
+// ApplyKeycloakGuardConfig : Uses the rate limit and circuit breaker settings of the operator config map for the
+// requests to Keycloak from now on, an invalid setting keeps its default and is reported. Changes reset the guard of
+// every Keycloak, closing their circuits. Returns whether the settings changed
+func ApplyKeycloakGuardConfig(data map[string]string) (bool, error) {
+	settings, err := KeycloakGuardSettingsFromOperatorConfig(data)
+	guards.Lock()
+	defer guards.Unlock()
+	if settings == guards.settings {
+		return false, err
+	}
+	guards.settings = settings
+	guards.byURL = nil
+	metrics.KeycloakCircuitState.Reset()
+	return true, err
+}
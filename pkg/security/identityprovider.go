@@ -0,0 +1,178 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package security
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// IdentityProvider : An identity provider brokered by a realm. Never log the clientSecret of its Config.
+type IdentityProvider struct {
+	Alias       string            `json:"alias"`
+	DisplayName string            `json:"displayName,omitempty"`
+	ProviderID  string            `json:"providerId"`
+	Enabled     bool              `json:"enabled"`
+	TrustEmail  bool              `json:"trustEmail"`
+	Config      map[string]string `json:"config"`
+
+	// ImportFrom : URL of an OIDC discovery document or SAML metadata the Config is completed from, not sent to Keycloak
+	ImportFrom string `json:"-"`
+}
+
+// SecIdentityProviderGet : Reads an identity provider of the realm by alias, returns nil if it does not exist
+func SecIdentityProviderGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, alias string) (*IdentityProvider, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/identity-provider/instances/") + alias
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	identityProvider := IdentityProvider{}
+	err = json.Unmarshal(body, &identityProvider)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return &identityProvider, nil
+}
+
+// SecIdentityProviderCreate : Adds an identity provider to the realm
+func SecIdentityProviderCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, identityProvider IdentityProvider) *SecError {
+	url := keycloakConfig.adminRealmURL("/identity-provider/instances")
+	return sendIdentityProvider(httpClient, accessToken, "POST", url, identityProvider, http.StatusCreated)
+}
+
+// SecIdentityProviderUpdate : Replaces the configuration of an existing identity provider of the realm
+func SecIdentityProviderUpdate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, identityProvider IdentityProvider) *SecError {
+	url := keycloakConfig.adminRealmURL("/identity-provider/instances/") + identityProvider.Alias
+	return sendIdentityProvider(httpClient, accessToken, "PUT", url, identityProvider, http.StatusNoContent)
+}
+
+// SecIdentityProviderDelete : Removes an identity provider from the realm, a provider that does not exist is ignored
+func SecIdentityProviderDelete(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, alias string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/identity-provider/instances/") + alias
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusNotFound {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
+
+// SecIdentityProviderImportConfig : Asks Keycloak to read the configuration of an oidc or saml provider from its
+// discovery document or metadata
+func SecIdentityProviderImportConfig(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, providerID string, fromURL string) (map[string]string, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/identity-provider/import-config")
+	jsonRequest, err := json.Marshal(map[string]string{"providerId": providerID, "fromUrl": fromURL})
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonRequest)))
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" importing "+fromURL+" "+keycloakAPIError.ErrorDescription)
+		return nil, &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+
+	config := map[string]string{}
+	err = json.Unmarshal(body, &config)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return config, nil
+}
+
+// sendIdentityProvider : Sends an identity provider to Keycloak, success is reported with the expected status code
+func sendIdentityProvider(httpClient util.HTTPClient, accessToken string, method string, url string, identityProvider IdentityProvider, expectedStatus int) *SecError {
+	jsonProvider, err := json.Marshal(identityProvider)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(string(jsonProvider)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != expectedStatus {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpCreate, kcError, kcError.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// TokenClaimMapperPrefix : Prefix of the names of the protocol mappers managed for the token claims of a Codewind CR
+const TokenClaimMapperPrefix = "codewind-token-"
+
+// ProtocolMapper : A protocol mapper adding claims to tokens issued for a client
+type ProtocolMapper struct {
+	ID             string            `json:"id,omitempty"`
+	Name           string            `json:"name"`
+	Protocol       string            `json:"protocol"`
+	ProtocolMapper string            `json:"protocolMapper"`
+	Config         map[string]string `json:"config"`
+}
+
+// NewHardcodedClaimMapper : Builds a mapper that adds a fixed claim to access, ID and userinfo tokens
+func NewHardcodedClaimMapper(name string, claimName string, claimValue string) ProtocolMapper {
+	return ProtocolMapper{
+		Name:           name,
+		Protocol:       "openid-connect",
+		ProtocolMapper: "oidc-hardcoded-claim-mapper",
+		Config: map[string]string{
+			"claim.name":           claimName,
+			"claim.value":          claimValue,
+			"jsonType.label":       "String",
+			"access.token.claim":   "true",
+			"id.token.claim":       "true",
+			"userinfo.token.claim": "true",
+		},
+	}
+}
+
+// NewAudienceMapper : Builds a mapper that adds a client ID to the aud claim of access tokens
+func NewAudienceMapper(name string, audience string) ProtocolMapper {
+	return ProtocolMapper{
+		Name:           name,
+		Protocol:       "openid-connect",
+		ProtocolMapper: "oidc-audience-mapper",
+		Config: map[string]string{
+			"included.client.audience": audience,
+			"access.token.claim":       "true",
+			"id.token.claim":           "false",
+		},
+	}
+}
+
+// NewGroupMembershipMapper : Builds a mapper that adds the groups of the user to access, ID and userinfo tokens
+func NewGroupMembershipMapper(name string, claimName string, fullPath bool) ProtocolMapper {
+	return ProtocolMapper{
+		Name:           name,
+		Protocol:       "openid-connect",
+		ProtocolMapper: "oidc-group-membership-mapper",
+		Config: map[string]string{
+			"claim.name":           claimName,
+			"full.path":            strconv.FormatBool(fullPath),
+			"access.token.claim":   "true",
+			"id.token.claim":       "true",
+			"userinfo.token.claim": "true",
+		},
+	}
+}
+
+// SecClientGetProtocolMappers : Retrieve the protocol mappers registered on a client
+func SecClientGetProtocolMappers(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string) ([]ProtocolMapper, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/protocol-mappers/models"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	protocolMappers := []ProtocolMapper{}
+	err = json.Unmarshal(body, &protocolMappers)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return protocolMappers, nil
+}
+
+// SecClientAddProtocolMapper : Adds a protocol mapper to a client. Mappers already registered
+// on the client with the same name are left unchanged.
+func SecClientAddProtocolMapper(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, protocolMapper ProtocolMapper) *SecError {
+
+	existingMappers, secErr := SecClientGetProtocolMappers(httpClient, keycloakConfig, accessToken, clientID)
+	if secErr != nil {
+		return secErr
+	}
+	for _, existingMapper := range existingMappers {
+		if existingMapper.Name == protocolMapper.Name {
+			return nil
+		}
+	}
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/protocol-mappers/models"
+	protocolMapper.ID = ""
+	jsonMapper, err := json.Marshal(protocolMapper)
+	payload := strings.NewReader(string(jsonMapper))
+	req, err := http.NewRequest("POST", url, payload)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusCreated)
+	if res.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpCreate, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecClientUpdateProtocolMapper : Replaces the type and configuration of a protocol mapper registered on a client
+func SecClientUpdateProtocolMapper(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, protocolMapper ProtocolMapper) *SecError {
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/protocol-mappers/models/" + protocolMapper.ID
+	jsonMapper, err := json.Marshal(protocolMapper)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	return sendProtocolMapperRequest(httpClient, accessToken, "PUT", url, strings.NewReader(string(jsonMapper)))
+}
+
+// SecClientDeleteProtocolMapper : Removes a protocol mapper from a client
+func SecClientDeleteProtocolMapper(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, mapperID string) *SecError {
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/protocol-mappers/models/" + mapperID
+	return sendProtocolMapperRequest(httpClient, accessToken, "DELETE", url, nil)
+}
+
+// sendProtocolMapperRequest : Sends a change to a protocol mapper, Keycloak answers StatusNoContent on success
+func sendProtocolMapperRequest(httpClient util.HTTPClient, accessToken string, method string, url string, payload io.Reader) *SecError {
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
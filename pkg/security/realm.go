@@ -16,6 +16,8 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/eclipse/codewind-operator/pkg/util"
@@ -32,7 +34,7 @@ type KeycloakRealm struct {
 
 // SecRealmGet : Reads a realm in Keycloak
 func SecRealmGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*KeycloakRealm, *SecError) {
-	req, err := http.NewRequest("GET", keycloakConfig.AuthURL+"/auth/admin/realms/"+keycloakConfig.RealmName, nil)
+	req, err := http.NewRequest("GET", keycloakConfig.adminRealmURL(""), nil)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
@@ -64,23 +66,24 @@ func SecRealmGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigurati
 	if string(body) != "" {
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
 		keycloakAPIError.Error = errOpResponseFormat
-		kcError := errors.New(keycloakAPIError.ErrorDescription)
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
 		return nil, &SecError{keycloakAPIError.Error, kcError, kcError.Error()}
 	}
 
 	return nil, nil
 }
 
-// SecRealmCreate : Create a new realm in Keycloak
-func SecRealmCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+// SecRealmCreate : Create a new realm in Keycloak, returns the HTTP status so that callers can detect a realm
+// created meanwhile
+func SecRealmCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*SecError, int) {
 
-	themeLoginName, themeAccountName, secErr := GetSuggestedThemes(keycloakConfig.AuthURL, accessToken)
+	themeLoginName, themeAccountName, secErr := GetSuggestedThemes(httpClient, keycloakConfig, accessToken)
 	if secErr != nil {
-		return secErr
+		return secErr, 0
 	}
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms"
+	url := keycloakConfig.adminURL("/realms")
 
 	// build the payload (JSON)
 	type PayloadRealm struct {
@@ -108,7 +111,7 @@ func SecRealmCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigur
 	payload := strings.NewReader(string(jsonRealm))
 	req, err := http.NewRequest("POST", url, payload)
 	if err != nil {
-		return &SecError{errOpConnection, err, err.Error()}
+		return &SecError{errOpConnection, err, err.Error()}, 0
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Cache-Control", "no-cache")
@@ -116,17 +119,349 @@ func SecRealmCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigur
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 
 	// send request
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
-		return &SecError{errOpConnection, err, err.Error()}
+		return &SecError{errOpConnection, err, err.Error()}, 0
 	}
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if string(body) != "" {
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
 		keycloakAPIError.Error = errOpResponseFormat
-		kcError := errors.New(keycloakAPIError.ErrorDescription)
-		return &SecError{keycloakAPIError.Error, kcError, kcError.Error()}
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
+		return &SecError{keycloakAPIError.Error, kcError, kcError.Error()}, res.StatusCode
+	}
+	return nil, res.StatusCode
+}
+
+// SMTPServer : Mail server a realm sends its messages with. Never log Password.
+type SMTPServer struct {
+	Host            string
+	Port            int32
+	From            string
+	FromDisplayName string
+	User            string
+	Password        string
+	SSL             bool
+	StartTLS        bool
+}
+
+// config : the smtpServer entries of the realm representation
+func (s SMTPServer) config() map[string]string {
+	port := s.Port
+	if port == 0 {
+		port = 25
+	}
+	config := map[string]string{
+		"host":     s.Host,
+		"port":     strconv.Itoa(int(port)),
+		"from":     s.From,
+		"ssl":      strconv.FormatBool(s.SSL),
+		"starttls": strconv.FormatBool(s.StartTLS),
+		"auth":     strconv.FormatBool(s.User != ""),
+	}
+	if s.FromDisplayName != "" {
+		config["fromDisplayName"] = s.FromDisplayName
+	}
+	if s.User != "" {
+		config["user"] = s.User
+		config["password"] = s.Password
+	}
+	return config
+}
+
+// SecRealmUpdateSMTP : Sets the mail server of the realm and allows its users to reset forgotten passwords.
+// A nil server removes the mail server and the forgot password link
+func SecRealmUpdateSMTP(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, smtpServer *SMTPServer) *SecError {
+	type PayloadRealm struct {
+		SMTPServer           map[string]string `json:"smtpServer"`
+		ResetPasswordAllowed bool              `json:"resetPasswordAllowed"`
+	}
+	tempRealm := &PayloadRealm{SMTPServer: map[string]string{}}
+	if smtpServer != nil {
+		tempRealm.SMTPServer = smtpServer.config()
+		tempRealm.ResetPasswordAllowed = true
+	}
+	return SecRealmUpdate(httpClient, keycloakConfig, accessToken, tempRealm)
+}
+
+// RealmPasswordPolicy : Password policy of a realm, for example "length(12) and digits(1)"
+type RealmPasswordPolicy struct {
+	PasswordPolicy string `json:"passwordPolicy"`
+}
+
+// RealmSSLRequired : Which requests of a realm must use HTTPS, "external", "all" or "none"
+type RealmSSLRequired struct {
+	SSLRequired string `json:"sslRequired"`
+}
+
+// RealmBruteForceProtection : Brute force detection settings of a realm
+type RealmBruteForceProtection struct {
+	BruteForceProtected   bool  `json:"bruteForceProtected"`
+	PermanentLockout      bool  `json:"permanentLockout"`
+	FailureFactor         int32 `json:"failureFactor"`
+	WaitIncrementSeconds  int32 `json:"waitIncrementSeconds"`
+	MaxFailureWaitSeconds int32 `json:"maxFailureWaitSeconds"`
+	MaxDeltaTimeSeconds   int32 `json:"maxDeltaTimeSeconds"`
+}
+
+// RealmBranding : Login page branding of a realm, settings that are empty are left unchanged
+type RealmBranding struct {
+	LoginTheme      string `json:"loginTheme,omitempty"`
+	DisplayName     string `json:"displayName,omitempty"`
+	DisplayNameHTML string `json:"displayNameHtml,omitempty"`
+}
+
+// realmSettingsValidator : A partial realm representation that checks its settings with Keycloak before they are applied
+type realmSettingsValidator interface {
+	validate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError
+}
+
+// validate : the login theme must be installed in Keycloak, else the login page fails to render
+func (b RealmBranding) validate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	if b.LoginTheme == "" {
+		return nil
+	}
+	serverInfo, secErr := GetServerInfo(httpClient, keycloakConfig, accessToken)
+	if secErr != nil {
+		return secErr
+	}
+	for _, theme := range serverInfo.Themes.Login {
+		if theme.Name == b.LoginTheme {
+			return nil
+		}
+	}
+	err := errors.New("login theme " + b.LoginTheme + " is not installed in Keycloak")
+	return &SecError{errOpNotFound, err, err.Error()}
+}
+
+// SecRealmGetRepresentation : Reads the full representation of the realm, for comparing settings with
+func SecRealmGetRepresentation(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (map[string]interface{}, *SecError) {
+	req, err := http.NewRequest("GET", keycloakConfig.adminRealmURL(""), nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return nil, &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+
+	realm := map[string]interface{}{}
+	err = json.Unmarshal(body, &realm)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return realm, nil
+}
+
+// SecRealmUpdate : Updates the realm with a partial representation, settings missing from it are left unchanged
+func SecRealmUpdate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, settings interface{}) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("")
+	jsonRealm, err := json.Marshal(settings)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest("PUT", url, strings.NewReader(string(jsonRealm)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
 	}
 	return nil
 }
+
+// realmSettingsDiffer : true when a setting of the partial representation has a different value in the realm
+func realmSettingsDiffer(realm map[string]interface{}, settings interface{}) (bool, error) {
+	jsonSettings, err := json.Marshal(settings)
+	if err != nil {
+		return false, err
+	}
+	desired := map[string]interface{}{}
+	err = json.Unmarshal(jsonSettings, &desired)
+	if err != nil {
+		return false, err
+	}
+	for key, value := range desired {
+		current, found := realm[key]
+		if !found && (value == "" || value == false || value == float64(0)) {
+			// Keycloak leaves empty settings out of the representation
+			continue
+		}
+		if !reflect.DeepEqual(current, value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SecRealmExport : Exports the realm, including its clients, groups and roles, as JSON.
+// Client secrets and other credentials in the export are redacted.
+func SecRealmExport(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) ([]byte, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/partial-export?exportClients=true&exportGroupsAndRoles=true")
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, err.Error()}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return nil, &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+
+	realmExport := map[string]interface{}{}
+	err = json.Unmarshal(body, &realmExport)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	redactSecrets(realmExport)
+	redactedExport, err := json.MarshalIndent(realmExport, "", "  ")
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	return redactedExport, nil
+}
+
+// redactedKeys : keys of the realm representation that hold credentials
+var redactedKeys = map[string]bool{
+	"secret":         true,
+	"clientSecret":   true,
+	"password":       true,
+	"bindCredential": true,
+	"privateKey":     true,
+	"hashedSecret":   true,
+}
+
+// redactSecrets : replaces any credential values in a realm representation
+func redactSecrets(value interface{}) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, entry := range typedValue {
+			if redactedKeys[key] {
+				typedValue[key] = "**********"
+				continue
+			}
+			// component configs hold their values in lists, eg "privateKey": ["..."]
+			redactSecrets(entry)
+		}
+	case []interface{}:
+		for _, entry := range typedValue {
+			redactSecrets(entry)
+		}
+	}
+}
+
+// SecRealmImport : Creates a realm from a realm representation, including its clients, roles, groups and users.
+// Returns the HTTP status so that callers can detect a realm created meanwhile
+func SecRealmImport(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, realm map[string]interface{}) (*SecError, int) {
+	jsonRealm, err := json.Marshal(realm)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}, 0
+	}
+	req, err := http.NewRequest("POST", keycloakConfig.adminURL("/realms"), strings.NewReader(string(jsonRealm)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}, 0
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}, 0
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusCreated {
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}, res.StatusCode
+	}
+	return nil, res.StatusCode
+}
+
+// realmImport : turns a redacted realm export into the representation of a new realm named realmName. Redacted
+// credentials are dropped so that Keycloak generates new client secrets, and the key providers are dropped so
+// that the new realm signs its tokens with new keys
+func realmImport(realmExport []byte, realmName string) (map[string]interface{}, error) {
+	realm := map[string]interface{}{}
+	err := json.Unmarshal(realmExport, &realm)
+	if err != nil {
+		return nil, err
+	}
+	delete(realm, "id")
+	realm["realm"] = realmName
+	if components, ok := realm["components"].(map[string]interface{}); ok {
+		delete(components, "org.keycloak.keys.KeyProvider")
+	}
+	dropRedacted(realm)
+	return realm, nil
+}
+
+// dropRedacted : removes the values replaced by redactSecrets from a realm representation
+func dropRedacted(value interface{}) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, entry := range typedValue {
+			if redactedKeys[key] {
+				delete(typedValue, key)
+				continue
+			}
+			dropRedacted(entry)
+		}
+	case []interface{}:
+		for _, entry := range typedValue {
+			dropRedacted(entry)
+		}
+	}
+}
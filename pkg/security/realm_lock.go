@@ -0,0 +1,39 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"strings"
+	"sync"
+)
+
+// realmLocks : one mutex per Keycloak realm, keyed by auth URL and realm name
+var realmLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+// lockRealm : Serialises configuration of a realm across concurrent reconciles of the Codewind and Keycloak
+// controllers. Host names are case insensitive, so the same Keycloak reached through differently written
+// URLs shares a lock. Returns the function that releases the lock.
+func lockRealm(keycloakConfig *KeycloakConfiguration) func() {
+	key := strings.ToLower(strings.TrimSuffix(keycloakConfig.AuthURL, "/")) + "/" + keycloakConfig.RealmName
+	realmLocks.Lock()
+	realmLock, ok := realmLocks.locks[key]
+	if !ok {
+		realmLock = &sync.Mutex{}
+		realmLocks.locks[key] = realmLock
+	}
+	realmLocks.Unlock()
+	realmLock.Lock()
+	return realmLock.Unlock
+}
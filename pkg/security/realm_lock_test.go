@@ -0,0 +1,91 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// fakeKeycloak : Keycloak server that creates the realm slowly, so that a reconcile which is not serialised
+// with the one creating the realm still finds it missing
+type fakeKeycloak struct {
+	realmName string
+	creates   int32
+	mutex     sync.Mutex
+	created   bool
+}
+
+func (k *fakeKeycloak) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/", r.URL.Path == "/auth/realms/master":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "POST" && r.URL.Path == "/auth/realms/master/protocol/openid-connect/token":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"admin-token","expires_in":60,"refresh_token":"refresh-token","refresh_expires_in":1800}`))
+	case r.Method == "GET" && r.URL.Path == "/auth/admin/serverinfo":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	case r.Method == "GET" && r.URL.Path == "/auth/admin/realms/"+k.realmName:
+		k.mutex.Lock()
+		created := k.created
+		k.mutex.Unlock()
+		if !created {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"` + k.realmName + `","realm":"` + k.realmName + `","enabled":true}`))
+	case r.Method == "POST" && r.URL.Path == "/auth/admin/realms":
+		atomic.AddInt32(&k.creates, 1)
+		time.Sleep(100 * time.Millisecond)
+		k.mutex.Lock()
+		k.created = true
+		k.mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConcurrentReconcilesCreateRealmOnce(t *testing.T) {
+	keycloak := &fakeKeycloak{realmName: "codewind-test"}
+	server := httptest.NewServer(keycloak)
+	defer server.Close()
+
+	retryPolicy := util.RetryPolicy{MaxAttempts: 1}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = AddCodewindRealmToKeycloak(server.URL, keycloak.realmName, "admin", "password", nil, retryPolicy)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("reconcile %d: AddCodewindRealmToKeycloak() error = %v", i, err)
+		}
+	}
+	if creates := atomic.LoadInt32(&keycloak.creates); creates != 1 {
+		t.Errorf("POST /admin/realms received %d times, want 1", creates)
+	}
+}
@@ -0,0 +1,225 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// offlineAccessScope : client scope and realm role of Keycloak letting a client request offline tokens, which outlive
+// the login session of the user
+const offlineAccessScope = "offline_access"
+
+// RemoteAccessToken : Long-lived credentials of the machine user IDE plugins connect to a remote deployment as
+type RemoteAccessToken struct {
+	// Username : the machine user of the deployment
+	Username string
+
+	// RefreshToken : offline token of the machine user, exchanged for access tokens at the token endpoint of the realm
+	RefreshToken string
+}
+
+// RemoteAccessUsername : Name of the machine user of a deployment
+func RemoteAccessUsername(workspaceID string) string {
+	return "codewind-remote-" + workspaceID
+}
+
+// IssueCodewindRemoteAccessToken : Lets the deployment client request offline tokens, creates the machine user of the
+// deployment with its access role and returns a new offline token of the machine user. The machine user gets a new
+// random password each time, which is not kept. clientSecret is sent when the client is confidential. Returns a
+// KeycloakConfigError like AddCodewindToKeycloak
+func IssueCodewindRemoteAccessToken(keycloakConfig KeycloakConfiguration, clientSecret string) (token *RemoteAccessToken, err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer invalidateToken(&err)
+
+	unlockRealm := lockRealm(&keycloakConfig)
+	defer unlockRealm()
+
+	secErr := configureClientOfflineAccess(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return nil, newKeycloakConfigError(ErrClientConfig, secErr)
+	}
+
+	userConfig := keycloakConfig
+	userConfig.DevUsername = RemoteAccessUsername(keycloakConfig.WorkspaceID)
+	userConfig.DevUserInitialPassword = ""
+	userConfig.DevUserRequiredActions = nil
+	password, secErr := configureRemoteAccessUser(httpClient, &userConfig, tokens.AccessToken)
+	if secErr != nil {
+		return nil, newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+
+	log.Info("Requesting an offline token for the machine user", "Username", userConfig.DevUsername, "client", keycloakConfig.ClientName)
+	offlineToken, secErr := requestOfflineToken(httpClient, &keycloakConfig, clientSecret, userConfig.DevUsername, password)
+	if secErr != nil {
+		return nil, newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+	return &RemoteAccessToken{Username: userConfig.DevUsername, RefreshToken: offlineToken.RefreshToken}, nil
+}
+
+// RemoveCodewindRemoteAccess : Deletes the machine user of a deployment, which ends its offline sessions and so
+// revokes the offline tokens issued for it. A missing user is ignored. Returns a KeycloakConfigError like
+// AddCodewindToKeycloak
+func RemoveCodewindRemoteAccess(keycloakConfig KeycloakConfiguration) (err error) {
+	httpClient, tokens, invalidateToken, err := adminSession(&keycloakConfig)
+	if err != nil {
+		return err
+	}
+	defer invalidateToken(&err)
+
+	secErr := removeRemoteAccessUser(httpClient, &keycloakConfig, tokens.AccessToken)
+	if secErr != nil {
+		return newKeycloakConfigError(ErrUserConfig, secErr)
+	}
+	return nil
+}
+
+// configureClientOfflineAccess : Adds the offline_access scope to the optional scopes of the deployment client, so
+// that token requests asking for it get an offline token
+func configureClientOfflineAccess(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	registeredClient, secErr := SecClientGet(httpClient, keycloakConfig, accessToken)
+	if secErr == nil && registeredClient == nil {
+		notFound := errors.New("Keycloak client " + keycloakConfig.ClientName + " not found")
+		secErr = &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
+	if secErr != nil {
+		return secErr
+	}
+	clientScope, secErr := SecClientScopeGet(httpClient, keycloakConfig, accessToken, offlineAccessScope)
+	if secErr == nil && clientScope == nil {
+		notFound := errors.New("Client scope " + offlineAccessScope + " not found in realm " + keycloakConfig.RealmName)
+		secErr = &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
+	if secErr != nil {
+		return secErr
+	}
+	return SecClientAddOptionalScope(httpClient, keycloakConfig, accessToken, registeredClient.ID, clientScope.ID)
+}
+
+// configureRemoteAccessUser : Creates the machine user named by userConfig when missing, grants it the access role
+// of the deployment and the offline_access role of the realm, and replaces its password with a new random one,
+// which is returned
+func configureRemoteAccessUser(httpClient util.HTTPClient, userConfig *KeycloakConfiguration, accessToken string) (string, *SecError) {
+	registeredUser, secErr := SecUserGet(httpClient, userConfig, accessToken)
+	if secErr != nil && secErr.Op == errOpNotFound {
+		log.Info("Creating the machine user of the deployment", "Username", userConfig.DevUsername, "realm", userConfig.RealmName)
+		var httpStatusCode int
+		secErr, httpStatusCode = SecUserCreate(httpClient, userConfig, accessToken)
+		if httpStatusCode == http.StatusConflict {
+			secErr = nil
+		}
+		if secErr == nil {
+			registeredUser, secErr = SecUserGet(httpClient, userConfig, accessToken)
+		}
+	}
+	if secErr != nil {
+		return "", secErr
+	}
+	for _, roleName := range []string{"codewind-" + userConfig.WorkspaceID, offlineAccessScope} {
+		secErr = SecUserAddRole(httpClient, userConfig, accessToken, roleName)
+		if secErr != nil {
+			return "", secErr
+		}
+	}
+	password, err := randomPassword()
+	if err != nil {
+		return "", &SecError{errOpPassword, err, err.Error()}
+	}
+	secErr = SecUserResetPassword(httpClient, userConfig, accessToken, registeredUser.ID, password)
+	if secErr != nil {
+		return "", secErr
+	}
+	return password, nil
+}
+
+// removeRemoteAccessUser : deletes the machine user of the deployment when it exists
+func removeRemoteAccessUser(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) *SecError {
+	userConfig := *keycloakConfig
+	userConfig.DevUsername = RemoteAccessUsername(keycloakConfig.WorkspaceID)
+	registeredUser, secErr := SecUserGet(httpClient, &userConfig, accessToken)
+	if secErr != nil {
+		if secErr.Op == errOpNotFound {
+			return nil
+		}
+		return secErr
+	}
+	log.Info("Deleting the machine user of the deployment", "Username", userConfig.DevUsername, "realm", userConfig.RealmName)
+	return SecUserDelete(httpClient, &userConfig, accessToken, registeredUser.ID)
+}
+
+// requestOfflineToken : requests an offline token of a user of the realm with the password grant of the deployment client
+func requestOfflineToken(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, clientSecret string, username string, password string) (*AuthToken, *SecError) {
+	form := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {keycloakConfig.ClientName},
+		"username":   {username},
+		"password":   {password},
+		"scope":      {"openid " + offlineAccessScope},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	// build REST request to Keycloak
+	req, err := http.NewRequest("POST", keycloakConfig.realmURL(keycloakConfig.RealmName, "/protocol/openid-connect/token"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, "HTTP "+res.Status+" "+keycloakAPIError.ErrorDescription)
+		return nil, &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+
+	authToken := AuthToken{}
+	err = json.Unmarshal(body, &authToken)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	if authToken.RefreshToken == "" {
+		err = errors.New("Keycloak issued no offline token for client " + keycloakConfig.ClientName)
+		return nil, &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	return &authToken, nil
+}
+
+// randomPassword : a password of 32 random bytes, never logged
+func randomPassword() (string, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
@@ -13,7 +13,6 @@ package security
 
 import (
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -35,7 +34,7 @@ type Role struct {
 func SecRoleCreate(httpClient utils.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, roleName string) (*SecError, int) {
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/roles"
+	url := keycloakConfig.adminRealmURL("/roles")
 
 	// Role : Access role
 	type NewRole struct {
@@ -64,13 +63,13 @@ func SecRoleCreate(httpClient utils.HTTPClient, keycloakConfig *KeycloakConfigur
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 
 	// send request
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return &SecError{errOpConnection, err, err.Error()}, res.StatusCode
 	}
 
 	if res.StatusCode != http.StatusCreated {
-		secErr := errors.New("HTTP " + res.Status)
+		secErr := newResponseError(res.StatusCode, "HTTP "+res.Status)
 		return &SecError{errOpConnection, secErr, secErr.Error()}, res.StatusCode
 	}
 
@@ -79,18 +78,46 @@ func SecRoleCreate(httpClient utils.HTTPClient, keycloakConfig *KeycloakConfigur
 	if string(body) != "" {
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
 		keycloakAPIError.Error = errOpResponseFormat
-		kcError := errors.New(keycloakAPIError.ErrorDescription)
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
 		return &SecError{keycloakAPIError.Error, kcError, kcError.Error()}, res.StatusCode
 	}
 	return nil, res.StatusCode
 }
 
+// SecRoleDelete : Delete a realm role, a role that does not exist is ignored
+func SecRoleDelete(httpClient utils.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, roleName string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/roles/") + roleName
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusNotFound {
+		secErr := newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, secErr, secErr.Error()}
+	}
+	return nil
+}
+
 func getRoleByName(httpClient utils.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, roleName string) (*Role, *SecError) {
 
 	requestedRole := roleName
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/roles/" + requestedRole
+	url := keycloakConfig.adminRealmURL("/roles/") + requestedRole
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
@@ -102,14 +129,19 @@ func getRoleByName(httpClient utils.HTTPClient, keycloakConfig *KeycloakConfigur
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 
 	// send request
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
 
 	// check we received a valid response
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		notFound := newResponseError(res.StatusCode, "role "+roleName+" not found")
+		return nil, &SecError{errOpNotFound, notFound, notFound.Error()}
+	}
 	if res.StatusCode != http.StatusOK {
-		unableToReadErr := errors.New("Bad response")
+		unableToReadErr := newResponseError(res.StatusCode, "Bad response")
 		return nil, &SecError{errOpConnection, unableToReadErr, unableToReadErr.Error()}
 	}
 
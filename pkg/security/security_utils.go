@@ -69,6 +69,11 @@ func (se *SecError) Error() string {
 	return string(jsonError)
 }
 
+// Unwrap : returns the underlying error so callers can use errors.As
+func (se *SecError) Unwrap() error {
+	return se.Err
+}
+
 // KeycloakAPIError : Error responses from Keycloak
 type KeycloakAPIError struct {
 	HTTPStatus       int
@@ -0,0 +1,155 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"net/http"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// SelfTestCheck : Outcome of a single self test check
+type SelfTestCheck struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+	Desc       string `json:"desc,omitempty"`
+}
+
+// SelfTestResult : Report produced by SelfTest
+type SelfTestResult struct {
+	AuthURL      string               `json:"authURL"`
+	Distribution KeycloakDistribution `json:"distribution,omitempty"`
+	Realm        string               `json:"realm"`
+	Client       string               `json:"client,omitempty"`
+	Username     string               `json:"username,omitempty"`
+	Passed       bool                 `json:"passed"`
+	Checks       []SelfTestCheck      `json:"checks"`
+}
+
+// Names of the self test checks
+const (
+	SelfTestAuthenticate = "authenticate"
+	SelfTestRealm        = "realm"
+	SelfTestClient       = "client"
+	SelfTestUser         = "user"
+	SelfTestAccessRole   = "accessRole"
+	SelfTestRoleBinding  = "userRoleBinding"
+)
+
+// statusRecorder : Remembers the HTTP status of the last response received through the wrapped client
+type statusRecorder struct {
+	httpClient util.HTTPClient
+	lastStatus int
+}
+
+func (s *statusRecorder) Do(req *http.Request) (*http.Response, error) {
+	s.lastStatus = 0
+	res, err := s.httpClient.Do(req)
+	if err == nil {
+		s.lastStatus = res.StatusCode
+	}
+	return res, err
+}
+
+// SelfTest : Checks that Keycloak is configured for a Codewind deployment without changing anything.
+// Each check of the provisioning path is reported with its HTTP status and error description.
+// The client and role checks are skipped when the configuration does not name a client or workspace.
+func SelfTest(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration) *SelfTestResult {
+	recorder := &statusRecorder{httpClient: httpClient}
+	result := &SelfTestResult{
+		AuthURL:  keycloakConfig.AuthURL,
+		Realm:    keycloakConfig.RealmName,
+		Client:   keycloakConfig.ClientName,
+		Username: keycloakConfig.DevUsername,
+		Passed:   true,
+	}
+	record := func(name string, secErr *SecError, desc string) bool {
+		check := SelfTestCheck{Name: name, Passed: secErr == nil && desc == "", HTTPStatus: recorder.lastStatus, Desc: desc}
+		if secErr != nil {
+			check.Desc = secErr.Desc
+		}
+		result.Checks = append(result.Checks, check)
+		if !check.Passed {
+			result.Passed = false
+		}
+		return check.Passed
+	}
+	skip := func(names ...string) {
+		for _, name := range names {
+			result.Checks = append(result.Checks, SelfTestCheck{Name: name, Skipped: true})
+		}
+	}
+
+	secErr := resolveDistribution(recorder, keycloakConfig)
+	if secErr == nil {
+		result.Distribution = keycloakConfig.Distribution
+	}
+	tokens, authErr := SecAuthenticate(recorder, keycloakConfig)
+	if secErr == nil {
+		secErr = authErr
+	}
+	if !record(SelfTestAuthenticate, secErr, "") {
+		skip(SelfTestRealm, SelfTestClient, SelfTestUser, SelfTestAccessRole, SelfTestRoleBinding)
+		return result
+	}
+
+	realm, secErr := SecRealmGet(recorder, keycloakConfig, tokens.AccessToken)
+	desc := ""
+	if secErr == nil && realm == nil {
+		desc = "Realm " + keycloakConfig.RealmName + " not found"
+	}
+	if !record(SelfTestRealm, secErr, desc) {
+		skip(SelfTestClient, SelfTestUser, SelfTestAccessRole, SelfTestRoleBinding)
+		return result
+	}
+
+	if keycloakConfig.ClientName == "" {
+		skip(SelfTestClient)
+	} else {
+		registeredClient, secErr := SecClientGet(recorder, keycloakConfig, tokens.AccessToken)
+		desc = ""
+		if secErr == nil && registeredClient == nil {
+			desc = "Client " + keycloakConfig.ClientName + " not found"
+		}
+		record(SelfTestClient, secErr, desc)
+	}
+
+	registeredUser, secErr := SecUserGet(recorder, keycloakConfig, tokens.AccessToken)
+	userFound := record(SelfTestUser, secErr, "")
+
+	if keycloakConfig.WorkspaceID == "" {
+		skip(SelfTestAccessRole, SelfTestRoleBinding)
+		return result
+	}
+	accessRoleName := "codewind-" + keycloakConfig.WorkspaceID
+	_, secErr = getRoleByName(recorder, keycloakConfig, tokens.AccessToken, accessRoleName)
+	if !record(SelfTestAccessRole, secErr, "") || !userFound {
+		skip(SelfTestRoleBinding)
+		return result
+	}
+
+	userRoles, secErr := SecUserGetRealmRoles(recorder, keycloakConfig, tokens.AccessToken, registeredUser.ID)
+	desc = ""
+	if secErr == nil {
+		desc = "User " + keycloakConfig.DevUsername + " is not granted role " + accessRoleName
+		for _, role := range userRoles {
+			if role.Name == accessRoleName {
+				desc = ""
+				break
+			}
+		}
+	}
+	record(SelfTestRoleBinding, secErr, desc)
+	return result
+}
@@ -13,10 +13,11 @@ package security
 
 import (
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"net/http"
 	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
 )
 
 // RegisteredTheme : A Keycloak theme
@@ -41,10 +42,10 @@ type ServerInfo struct {
 }
 
 // GetServerInfo - fetch Keycloak server info
-func GetServerInfo(keycloakHostname string, accesstoken string) (*ServerInfo, *SecError) {
+func GetServerInfo(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accesstoken string) (*ServerInfo, *SecError) {
 
 	// build REST request
-	url := keycloakHostname + "/auth/admin/serverinfo"
+	url := keycloakConfig.adminURL("/serverinfo")
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
@@ -55,7 +56,7 @@ func GetServerInfo(keycloakHostname string, accesstoken string) (*ServerInfo, *S
 	req.Header.Add("cache-control", "no-cache")
 
 	// send request
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
@@ -69,10 +70,10 @@ func GetServerInfo(keycloakHostname string, accesstoken string) (*ServerInfo, *S
 	switch httpCode := res.StatusCode; {
 	case httpCode == http.StatusBadRequest, httpCode == http.StatusUnauthorized:
 		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
-		kcError := errors.New(string(keycloakAPIError.ErrorDescription))
+		kcError := newResponseError(res.StatusCode, string(keycloakAPIError.ErrorDescription))
 		return nil, &SecError{keycloakAPIError.Error, kcError, kcError.Error()}
 	case httpCode != http.StatusOK:
-		err = errors.New(string(body))
+		err = newResponseError(res.StatusCode, string(body))
 		return nil, &SecError{errOpResponse, err, err.Error()}
 	}
 
@@ -87,8 +88,8 @@ func GetServerInfo(keycloakHostname string, accesstoken string) (*ServerInfo, *S
 
 // GetSuggestedThemes - Recommends the Codewind theme, else Che, else keycloak default
 // Returns the loginTheme, accountTheme, optionalError
-func GetSuggestedThemes(keycloakHostname string, accesstoken string) (string, string, *SecError) {
-	serverInfo, secErr := GetServerInfo(keycloakHostname, accesstoken)
+func GetSuggestedThemes(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accesstoken string) (string, string, *SecError) {
+	serverInfo, secErr := GetServerInfo(httpClient, keycloakConfig, accesstoken)
 	if secErr != nil {
 		return "", "", secErr
 	}
@@ -0,0 +1,148 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// SecClientSetServiceAccount : Enables or disables the service account of a client. Enabling it makes the client
+// confidential, which the client credentials grant requires
+func SecClientSetServiceAccount(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string, enabled bool) *SecError {
+	payloadClient := map[string]interface{}{
+		"id":                     clientID,
+		"serviceAccountsEnabled": enabled,
+	}
+	if enabled {
+		payloadClient["publicClient"] = false
+	}
+	jsonClient, err := json.Marshal(payloadClient)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest("PUT", keycloakConfig.adminRealmURL("/clients/")+clientID, strings.NewReader(string(jsonClient)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecClientGetServiceAccountUser : Retrieve the user Keycloak created for the service account of a client
+func SecClientGetServiceAccountUser(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, clientID string) (*RegisteredUser, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/clients/") + clientID + "/service-account-user"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes, Keycloak answers 400 when the service account is disabled
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusBadRequest {
+		err = newResponseError(res.StatusCode, "Service account of client "+keycloakConfig.ClientName+" not found")
+		return nil, &SecError{errOpNotFound, err, err.Error()}
+	}
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	registeredUser := RegisteredUser{}
+	body, err := ioutil.ReadAll(res.Body)
+	err = json.Unmarshal([]byte(body), &registeredUser)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	return &registeredUser, nil
+}
+
+// SecServiceAccountAddRole : Maps a realm role to the user of a service account
+func SecServiceAccountAddRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string, roleName string) *SecError {
+	existingRole, secErr := getRoleByName(httpClient, keycloakConfig, accessToken, roleName)
+	if secErr != nil {
+		return secErr
+	}
+	log.Info("Adding role to service account", "role", existingRole.Name, "userID", userID)
+	return userRoleMappings(httpClient, keycloakConfig, accessToken, userID, "POST", existingRole)
+}
+
+// SecServiceAccountRemoveRole : Removes a realm role mapping from the user of a service account
+func SecServiceAccountRemoveRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string, roleName string) *SecError {
+	existingRole, secErr := getRoleByName(httpClient, keycloakConfig, accessToken, roleName)
+	if secErr != nil {
+		return secErr
+	}
+	log.Info("Removing role from service account", "role", existingRole.Name, "userID", userID)
+	return userRoleMappings(httpClient, keycloakConfig, accessToken, userID, "DELETE", existingRole)
+}
+
+// userRoleMappings : Adds (POST) or removes (DELETE) a realm role mapping of a user
+func userRoleMappings(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string, method string, role *Role) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users/") + userID + "/role-mappings/realm"
+	jsonRoles, err := json.Marshal([]Role{*role})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(string(jsonRoles)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package security
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/util"
+)
+
+// tokenExpiryMargin : tokens this close to expiring are not reused, leaving time for the calls made with them
+const tokenExpiryMargin = 30 * time.Second
+
+// cachedAdminToken : an admin token with the times its access and refresh tokens expire
+type cachedAdminToken struct {
+	token          *AuthToken
+	credentials    [sha256.Size]byte
+	expires        time.Time
+	refreshExpires time.Time
+}
+
+// adminTokens : admin tokens of each Keycloak instance, keyed by auth URL and admin username
+var adminTokens = struct {
+	sync.Mutex
+	tokens   map[string]*cachedAdminToken
+	fetching map[string]*sync.Mutex
+}{tokens: make(map[string]*cachedAdminToken), fetching: make(map[string]*sync.Mutex)}
+
+// adminTokenKey : one cached token per Keycloak instance and admin user
+func adminTokenKey(keycloakConfig *KeycloakConfiguration) string {
+	return keycloakConfig.AuthURL + "/" + keycloakConfig.KeycloakAdminUsername
+}
+
+// adminCredentials : digest of the admin credentials, a changed password must not reuse the old session
+func adminCredentials(keycloakConfig *KeycloakConfiguration) [sha256.Size]byte {
+	return sha256.Sum256([]byte(keycloakConfig.KeycloakAdminUsername + ":" + keycloakConfig.KeycloakAdminPassword))
+}
+
+// secAdminToken : Returns an admin token for the Keycloak instance, reusing a cached token while it is valid
+// and refreshing it while its refresh token is valid. Authenticates with the admin credentials otherwise
+func secAdminToken(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration) (*AuthToken, *SecError) {
+	key := adminTokenKey(keycloakConfig)
+	credentials := adminCredentials(keycloakConfig)
+
+	// Only one reconcile at a time authenticates against the same Keycloak, concurrent reconciles wait and
+	// reuse the token it obtained instead of each opening an admin session
+	adminTokens.Lock()
+	fetchLock, ok := adminTokens.fetching[key]
+	if !ok {
+		fetchLock = &sync.Mutex{}
+		adminTokens.fetching[key] = fetchLock
+	}
+	adminTokens.Unlock()
+	fetchLock.Lock()
+	defer fetchLock.Unlock()
+
+	now := time.Now()
+	adminTokens.Lock()
+	cached := adminTokens.tokens[key]
+	adminTokens.Unlock()
+
+	if cached != nil && cached.credentials == credentials {
+		if now.Before(cached.expires) {
+			return cached.token, nil
+		}
+		if cached.token.RefreshToken != "" && now.Before(cached.refreshExpires) {
+			token, secErr := SecRefreshToken(httpClient, keycloakConfig, cached.token.RefreshToken)
+			if secErr == nil {
+				storeAdminToken(key, credentials, token, now)
+				return token, nil
+			}
+			log.Info("Refreshing the Keycloak admin token failed, authenticating again", "URL", keycloakConfig.AuthURL, "reason", secErr.Desc)
+		}
+	}
+
+	token, secErr := SecAuthenticate(httpClient, keycloakConfig)
+	if secErr != nil {
+		invalidateAdminToken(keycloakConfig)
+		return nil, secErr
+	}
+	storeAdminToken(key, credentials, token, now)
+	return token, nil
+}
+
+// storeAdminToken : caches a token issued at the given time
+func storeAdminToken(key string, credentials [sha256.Size]byte, token *AuthToken, issued time.Time) {
+	adminTokens.Lock()
+	defer adminTokens.Unlock()
+	adminTokens.tokens[key] = &cachedAdminToken{
+		token:          token,
+		credentials:    credentials,
+		expires:        issued.Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin),
+		refreshExpires: issued.Add(time.Duration(token.RefreshExpiresIn)*time.Second - tokenExpiryMargin),
+	}
+}
+
+// adminTokenRejected : Reports whether a call may have failed because Keycloak no longer accepts the admin token,
+// when it answered 401 or 403 or the connection failed, for example because Keycloak restarted and lost its
+// sessions. A request the circuit breaker or rate limit kept from being sent, and failures such as a missing client
+// or a conflict, leave the token valid
+func adminTokenRejected(secErr *SecError) bool {
+	if secErr == nil {
+		return false
+	}
+	switch secErr.Code() {
+	case CodeInvalidCredentials, CodeForbidden:
+		return true
+	case CodeKeycloakCircuitOpen, CodeKeycloakThrottled:
+		return false
+	}
+	return secErr.Op == errOpConnection
+}
+
+// failedSecError : Security error behind an error returned by a Keycloak operation, nil when there is none
+func failedSecError(err error) *SecError {
+	var configErr *KeycloakConfigError
+	if errors.As(err, &configErr) {
+		return configErr.SecErr
+	}
+	var secErr *SecError
+	if errors.As(err, &secErr) {
+		return secErr
+	}
+	return nil
+}
+
+// invalidateAdminToken : Drops the cached token of a Keycloak instance, for example after a call made with it
+// failed because Keycloak restarted and lost its sessions
+func invalidateAdminToken(keycloakConfig *KeycloakConfiguration) {
+	adminTokens.Lock()
+	defer adminTokens.Unlock()
+	delete(adminTokens.tokens, adminTokenKey(keycloakConfig))
+}
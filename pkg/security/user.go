@@ -16,6 +16,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/eclipse/codewind-operator/pkg/util"
@@ -39,7 +40,7 @@ var log = logf.Log.WithName("codewind-operator-security")
 func SecUserGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*RegisteredUser, *SecError) {
 
 	// build REST request
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/users?username=" + keycloakConfig.DevUsername
+	url := keycloakConfig.adminRealmURL("/users?username=") + keycloakConfig.DevUsername
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
@@ -47,7 +48,7 @@ func SecUserGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguratio
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("cache-control", "no-cache")
 	req.Header.Add("Cache-Control", "no-cache")
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, &SecError{errOpConnection, err, err.Error()}
 	}
@@ -57,7 +58,7 @@ func SecUserGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguratio
 	// handle HTTP status codes
 	if res.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(res.Body)
-		err = errors.New(string(body))
+		err = newResponseError(res.StatusCode, string(body))
 		return nil, &SecError{errOpResponse, err, err.Error()}
 	}
 
@@ -81,6 +82,202 @@ func SecUserGet(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguratio
 
 }
 
+// SecUserCreate : Create the dev user with a temporary initial password and any required actions
+// Can return an error and an HTTP code
+func SecUserCreate(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string) (*SecError, int) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users")
+
+	// NewUserCredential : Initial user credential
+	type NewUserCredential struct {
+		Type      string `json:"type"`
+		Value     string `json:"value"`
+		Temporary bool   `json:"temporary"`
+	}
+
+	// NewUser : User to create
+	type NewUser struct {
+		Username        string              `json:"username"`
+		Enabled         bool                `json:"enabled"`
+		Credentials     []NewUserCredential `json:"credentials,omitempty"`
+		RequiredActions []string            `json:"requiredActions,omitempty"`
+	}
+
+	tempUser := &NewUser{
+		Username:        keycloakConfig.DevUsername,
+		Enabled:         true,
+		RequiredActions: keycloakConfig.DevUserRequiredActions,
+	}
+	if keycloakConfig.DevUserInitialPassword != "" {
+		tempUser.Credentials = []NewUserCredential{{Type: "password", Value: keycloakConfig.DevUserInitialPassword, Temporary: true}}
+	}
+	jsonUser, err := json.Marshal(tempUser)
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}, 0
+	}
+
+	payload := strings.NewReader(string(jsonUser))
+	req, err := http.NewRequest("POST", url, payload)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}, 0
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}, 0
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusCreated)
+	if res.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, "HTTP "+res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpCreate, kcError, kcError.Error()}, res.StatusCode
+	}
+	return nil, res.StatusCode
+}
+
+// SecUserResetPassword : Replaces the password of a user with a permanent one
+func SecUserResetPassword(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string, password string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users/") + userID + "/reset-password"
+
+	// Credential : replacement credential
+	type Credential struct {
+		Type      string `json:"type"`
+		Value     string `json:"value"`
+		Temporary bool   `json:"temporary"`
+	}
+
+	jsonCredential, err := json.Marshal(&Credential{Type: "password", Value: password, Temporary: false})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+
+	payload := strings.NewReader(string(jsonCredential))
+	req, err := http.NewRequest("PUT", url, payload)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// send request
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		keycloakAPIError := parseKeycloakError(string(body), res.StatusCode)
+		kcError := newResponseError(res.StatusCode, "HTTP "+res.Status+" "+keycloakAPIError.ErrorDescription)
+		return &SecError{errOpResponse, kcError, kcError.Error()}
+	}
+	return nil
+}
+
+// SecUserGetRealmRoles : Lists the realm roles granted directly to a user
+func SecUserGetRealmRoles(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string) ([]Role, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users/") + userID + "/role-mappings/realm"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	roles := []Role{}
+	err = json.Unmarshal(body, &roles)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return roles, nil
+}
+
+// SecUserRemoveRole : Removes a realm role from the dev user, a missing user or role is ignored
+func SecUserRemoveRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, roleName string) *SecError {
+
+	// lookup an existing user
+	registeredUser, secErr := SecUserGet(httpClient, keycloakConfig, accessToken)
+	if secErr != nil {
+		if secErr.Op == errOpNotFound {
+			return nil
+		}
+		return secErr
+	}
+
+	userRoles, secErr := SecUserGetRealmRoles(httpClient, keycloakConfig, accessToken, registeredUser.ID)
+	if secErr != nil {
+		return secErr
+	}
+	var mappedRole *Role
+	for i := range userRoles {
+		if userRoles[i].Name == roleName {
+			mappedRole = &userRoles[i]
+			break
+		}
+	}
+	if mappedRole == nil {
+		return nil
+	}
+
+	// build REST request
+	log.Info("Removing role from user", "role", mappedRole.Name, "userID", registeredUser.ID)
+	url := keycloakConfig.adminRealmURL("/users/") + registeredUser.ID + "/role-mappings/realm"
+	jsonRolesToRemove, err := json.Marshal([]Role{*mappedRole})
+	if err != nil {
+		return &SecError{errOpResponseFormat, err, err.Error()}
+	}
+	req, err := http.NewRequest("DELETE", url, strings.NewReader(string(jsonRolesToRemove)))
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
+
 // SecUserAddRole : Adds a role to a specified user
 func SecUserAddRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, roleName string) *SecError {
 
@@ -99,7 +296,7 @@ func SecUserAddRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigur
 
 	// build REST request
 	log.Info("Adding role to user", "role", existingRole.Name, "userID", registeredUser.ID)
-	url := keycloakConfig.AuthURL + "/auth/admin/realms/" + keycloakConfig.RealmName + "/users/" + registeredUser.ID + "/role-mappings/realm"
+	url := keycloakConfig.adminRealmURL("/users/") + registeredUser.ID + "/role-mappings/realm"
 
 	type PayloadRole struct {
 		ID   string `json:"id"`
@@ -119,16 +316,108 @@ func SecUserAddRole(httpClient util.HTTPClient, keycloakConfig *KeycloakConfigur
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("cache-control", "no-cache")
 	req.Header.Add("Cache-Control", "no-cache")
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return &SecError{errOpConnection, err, err.Error()}
 	}
 
 	// handle HTTP status codes (success returns status code StatusNoContent)
 	if res.StatusCode != http.StatusNoContent {
-		errNotFound := errors.New(res.Status)
+		errNotFound := newResponseError(res.StatusCode, res.Status)
 		return &SecError{errOpNotFound, errNotFound, errNotFound.Error()}
 	}
 
 	return nil
 }
+
+// SecUserList : Lists a page of the realm users as their full representations, without credentials
+func SecUserList(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, first int, max int) ([]map[string]interface{}, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users?briefRepresentation=false&first=") + strconv.Itoa(first) + "&max=" + strconv.Itoa(max)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	users := []map[string]interface{}{}
+	err = json.Unmarshal(body, &users)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return users, nil
+}
+
+// SecUserGetGroups : Lists the groups a user is a member of
+func SecUserGetGroups(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string) ([]Group, *SecError) {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users/") + userID + "/groups"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("cache-control", "no-cache")
+	req.Header.Add("Cache-Control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = newResponseError(res.StatusCode, string(body))
+		return nil, &SecError{errOpResponse, err, err.Error()}
+	}
+
+	groups := []Group{}
+	err = json.Unmarshal(body, &groups)
+	if err != nil {
+		return nil, &SecError{errOpResponseFormat, err, textUnableToParse}
+	}
+	return groups, nil
+}
+
+// SecUserDelete : Deletes a user of the realm, which ends its sessions. A user that does not exist is ignored
+func SecUserDelete(httpClient util.HTTPClient, keycloakConfig *KeycloakConfiguration, accessToken string, userID string) *SecError {
+
+	// build REST request
+	url := keycloakConfig.adminRealmURL("/users/") + userID
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Cache-Control", "no-cache")
+	req.Header.Add("cache-control", "no-cache")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return &SecError{errOpConnection, err, err.Error()}
+	}
+	defer res.Body.Close()
+
+	// handle HTTP status codes (success returns status code StatusNoContent)
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusNotFound {
+		err = newResponseError(res.StatusCode, "HTTP "+res.Status)
+		return &SecError{errOpResponse, err, err.Error()}
+	}
+	return nil
+}
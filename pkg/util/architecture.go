@@ -0,0 +1,141 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ArchitectureKey : Operator config map key holding the architecture of the pods when the CR does not set one
+	ArchitectureKey = "architecture"
+
+	// DefaultArchitecture : Architecture of the built in images
+	DefaultArchitecture = "amd64"
+
+	// ArchitectureLabel : Node label holding the architecture of a node
+	ArchitectureLabel = "kubernetes.io/arch"
+)
+
+// KnownArchitectures : Architectures Codewind images are published for. Repositories of one architecture end with
+// the architecture, for example eclipse/codewind-pfe-s390x
+var KnownArchitectures = []string{"amd64", "ppc64le", "s390x"}
+
+// UnsupportedArchitectureError : Returned when the version of the CR has no images for the selected architecture
+type UnsupportedArchitectureError struct {
+	Version      string
+	Architecture string
+	Supported    []string
+}
+
+func (e *UnsupportedArchitectureError) Error() string {
+	return fmt.Sprintf("version %s has no images for architecture %s, supported architectures are %s", e.Version, e.Architecture, strings.Join(e.Supported, ", "))
+}
+
+// SelectArchitecture : Architecture of the pods, the CR setting wins over the operator config map default
+func SelectArchitecture(override string, data map[string]string) string {
+	if override != "" {
+		return override
+	}
+	if data[ArchitectureKey] != "" {
+		return data[ArchitectureKey]
+	}
+	return DefaultArchitecture
+}
+
+// CheckArchitecture : Returns an UnsupportedArchitectureError when the catalog lists the architectures of a version
+// and the selected one is not among them. Versions without a list are not checked
+func CheckArchitecture(version string, images VersionImages, architecture string) error {
+	if len(images.Architectures) == 0 || contains(images.Architectures, architecture) {
+		return nil
+	}
+	return &UnsupportedArchitectureError{Version: version, Architecture: architecture, Supported: images.Architectures}
+}
+
+// ImageArchitecture : Architecture a repository is published for, empty for a multi-architecture manifest list
+func ImageArchitecture(image codewindv1alpha1.ImageSpec) string {
+	name := image.Repository[strings.LastIndex(image.Repository, "/")+1:]
+	for _, architecture := range KnownArchitectures {
+		if strings.HasSuffix(name, "-"+architecture) {
+			return architecture
+		}
+	}
+	return ""
+}
+
+// ArchitectureImage : Swaps the architecture suffix of a repository for the selected architecture. Multi-architecture
+// repositories and images pinned by digest, which name the image of one architecture, are returned unchanged
+func ArchitectureImage(image codewindv1alpha1.ImageSpec, architecture string) codewindv1alpha1.ImageSpec {
+	current := ImageArchitecture(image)
+	if current == "" || current == architecture || image.Digest != "" {
+		return image
+	}
+	image.Repository = strings.TrimSuffix(image.Repository, current) + architecture
+	return image
+}
+
+// ImageArchitectures : Architectures the pods of an image can run on. An image of one architecture runs on that
+// architecture, a multi-architecture manifest list on the architectures of the catalog version, nil when unknown
+func ImageArchitectures(image codewindv1alpha1.ImageSpec, images VersionImages) []string {
+	if architecture := ImageArchitecture(image); architecture != "" {
+		return []string{architecture}
+	}
+	return images.Architectures
+}
+
+// ArchitectureAffinity : Adds a required node affinity on the architecture label to each node selector term of the
+// affinity of the CR, so that pods are only scheduled on nodes with images of their architecture. The affinity of
+// the CR is not modified
+func ArchitectureAffinity(affinity *corev1.Affinity, architectures []string) *corev1.Affinity {
+	if len(architectures) == 0 {
+		return affinity
+	}
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      ArchitectureLabel,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   append([]string(nil), architectures...),
+	}
+	result := &corev1.Affinity{}
+	if affinity != nil {
+		result = affinity.DeepCopy()
+	}
+	if result.NodeAffinity == nil {
+		result.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	if result.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		result.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	selector := result.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	// Terms are ORed, the architecture must hold for each of them
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, requirement)
+	}
+	return result
+}
+
+// contains : Reports whether the list holds the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultCABundleKey : key of the PEM bundle when a CA bundle does not name one
+const DefaultCABundleKey = "ca.crt"
+
+// CABundleFromOperatorConfig : CA bundle referenced by the caBundleConfigMap, caBundleSecret and caBundleKey
+// settings of the operator config map
+func CABundleFromOperatorConfig(data map[string]string) codewindv1alpha1.CABundleSpec {
+	return codewindv1alpha1.CABundleSpec{
+		ConfigMap: data["caBundleConfigMap"],
+		Secret:    data["caBundleSecret"],
+		Key:       data["caBundleKey"],
+	}
+}
+
+// LoadCABundle : Reads the bundle from its config map or secret in namespace. Returns the system roots plus
+// the bundle certificates, or nil when no bundle is referenced
+func LoadCABundle(c client.Client, namespace string, bundle codewindv1alpha1.CABundleSpec) (*x509.CertPool, error) {
+	key := bundle.Key
+	if key == "" {
+		key = DefaultCABundleKey
+	}
+	var pemCerts []byte
+	switch {
+	case bundle.ConfigMap != "":
+		configMap := &corev1.ConfigMap{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: bundle.ConfigMap, Namespace: namespace}, configMap)
+		if err != nil {
+			return nil, err
+		}
+		pemCerts = []byte(configMap.Data[key])
+	case bundle.Secret != "":
+		secret := &corev1.Secret{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: bundle.Secret, Namespace: namespace}, secret)
+		if err != nil {
+			return nil, err
+		}
+		pemCerts = secret.Data[key]
+	default:
+		return nil, nil
+	}
+	rootCAs, err := ParseCABundle(pemCerts)
+	if err != nil {
+		return nil, fmt.Errorf("CA bundle %s%s key %s: %v", bundle.ConfigMap, bundle.Secret, key, err)
+	}
+	return rootCAs, nil
+}
+
+// caPools : pools of the bundles parsed so far by the hash of their PEM, so that a bundle read again on each
+// reconcile keeps its pool and the clients of NewHTTPClient keep their transport. Emptied beyond maxTransports
+var caPools = struct {
+	sync.Mutex
+	byHash map[[sha256.Size]byte]*x509.CertPool
+}{}
+
+// ParseCABundle : Returns the system roots plus the certificates of a PEM bundle. The same bundle returns the same
+// pool, which must not be modified
+func ParseCABundle(pemCerts []byte) (*x509.CertPool, error) {
+	hash := sha256.Sum256(pemCerts)
+	caPools.Lock()
+	defer caPools.Unlock()
+	if rootCAs, ok := caPools.byHash[hash]; ok {
+		return rootCAs, nil
+	}
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if !rootCAs.AppendCertsFromPEM(pemCerts) {
+		return nil, errors.New("no PEM certificates found")
+	}
+	if caPools.byHash == nil || len(caPools.byHash) >= maxTransports {
+		caPools.byHash = map[[sha256.Size]byte]*x509.CertPool{}
+	}
+	caPools.byHash[hash] = rootCAs
+	return rootCAs, nil
+}
+
+// LoadKeycloakCABundle : Loads the CA bundle of a Keycloak CR when it sets one, else the bundle of the operator config map
+func LoadKeycloakCABundle(c client.Client, keycloak *codewindv1alpha1.Keycloak, operatorNamespace string, operatorBundle codewindv1alpha1.CABundleSpec) (*x509.CertPool, error) {
+	if keycloak != nil && keycloak.Spec.CABundle != nil {
+		return LoadCABundle(c, keycloak.Namespace, *keycloak.Spec.CABundle)
+	}
+	return LoadCABundle(c, operatorNamespace, operatorBundle)
+}
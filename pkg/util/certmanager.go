@@ -0,0 +1,128 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CertManagerCertificateGVK : cert-manager Certificate resource, managed as unstructured so cert-manager stays optional
+var CertManagerCertificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1alpha2", Kind: "Certificate"}
+
+// CertManagerEnabled : Reports whether a TLS spec asks for certificates issued by cert-manager
+func CertManagerEnabled(tls *codewindv1alpha1.TLSSpec) bool {
+	return tls != nil && tls.CertManager != nil && tls.CertManager.IssuerRef.Name != ""
+}
+
+// NewCertManagerCertificate : Builds a Certificate asking cert-manager to store a key pair for dnsNames in secretName,
+// with a 3072 bit RSA key in FIPS mode
+func NewCertManagerCertificate(name string, namespace string, labels map[string]string, secretName string, dnsNames []string, issuerRef codewindv1alpha1.CertManagerIssuerRef) *unstructured.Unstructured {
+	issuerKind := issuerRef.Kind
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+	issuerGroup := issuerRef.Group
+	if issuerGroup == "" {
+		issuerGroup = CertManagerCertificateGVK.Group
+	}
+	names := make([]interface{}, 0, len(dnsNames))
+	for _, dnsName := range dnsNames {
+		names = append(names, dnsName)
+	}
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(CertManagerCertificateGVK)
+	certificate.SetName(name)
+	certificate.SetNamespace(namespace)
+	certificate.SetLabels(labels)
+	certificate.Object["spec"] = map[string]interface{}{
+		"secretName": secretName,
+		"commonName": dnsNames[0],
+		"dnsNames":   names,
+		"usages":     []interface{}{"server auth", "digital signature", "key encipherment"},
+		"issuerRef": map[string]interface{}{
+			"name":  issuerRef.Name,
+			"kind":  issuerKind,
+			"group": issuerGroup,
+		},
+	}
+	if FIPSMode {
+		// cert-manager generates the key, ask for the key size of the certificates generated by the operator
+		spec := certificate.Object["spec"].(map[string]interface{})
+		spec["keyAlgorithm"] = "rsa"
+		spec["keySize"] = int64(fipsRSAKeySize)
+	}
+	return certificate
+}
+
+// NewCertManagerCertificateObject : Returns an empty Certificate to read an existing one into
+func NewCertManagerCertificateObject() *unstructured.Unstructured {
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(CertManagerCertificateGVK)
+	return certificate
+}
+
+// CertManagerCertificateReady : Reports whether cert-manager has issued a Certificate, with the message of its Ready condition
+func CertManagerCertificateReady(certificate *unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		message, _ := condition["message"].(string)
+		return condition["status"] == "True", message
+	}
+	return false, "Waiting for cert-manager to issue the certificate"
+}
+
+// EnsureCertManagerCertificate : Creates the Certificate when it does not exist yet and reports whether it has been
+// issued. The names of an existing Certificate are updated when they changed, cert-manager then issues it again
+func EnsureCertManagerCertificate(c client.Client, certificate *unstructured.Unstructured) (bool, string, error) {
+	existing := NewCertManagerCertificateObject()
+	err := c.Get(context.TODO(), types.NamespacedName{Name: certificate.GetName(), Namespace: certificate.GetNamespace()}, existing)
+	if meta.IsNoMatchError(err) {
+		return false, "", fmt.Errorf("cert-manager is not installed, %s is not available: %v", CertManagerCertificateGVK.GroupVersion(), err)
+	}
+	if err != nil && k8serr.IsNotFound(err) {
+		err = c.Create(context.TODO(), certificate)
+		if err != nil && !k8serr.IsAlreadyExists(err) {
+			return false, "", err
+		}
+		return false, "Certificate " + certificate.GetName() + " requested from cert-manager", nil
+	} else if err != nil {
+		return false, "", err
+	}
+	dnsNames, _, _ := unstructured.NestedStringSlice(certificate.Object, "spec", "dnsNames")
+	existingDNSNames, _, _ := unstructured.NestedStringSlice(existing.Object, "spec", "dnsNames")
+	if !reflect.DeepEqual(dnsNames, existingDNSNames) {
+		unstructured.SetNestedStringSlice(existing.Object, dnsNames, "spec", "dnsNames")
+		unstructured.SetNestedField(existing.Object, dnsNames[0], "spec", "commonName")
+		err = c.Update(context.TODO(), existing)
+		if err != nil {
+			return false, "", err
+		}
+		return false, "Certificate " + certificate.GetName() + " updated for " + strings.Join(dnsNames, ", "), nil
+	}
+	ready, message := CertManagerCertificateReady(existing)
+	return ready, message, nil
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FIPSModeKey : Operator config map key turning on FIPS mode when the --fips-mode option is not given
+const FIPSModeKey = "fipsMode"
+
+// FIPSMode : Set when the operator starts in FIPS mode. Generated certificates then use FIPS approved key sizes,
+// TLS connections are limited to FIPS approved versions and cipher suites, and certificates are always verified
+var FIPSMode bool
+
+// fipsRSAKeySize : Size of the RSA keys generated in FIPS mode
+const fipsRSAKeySize = 3072
+
+// fipsCipherSuites : FIPS approved cipher suites of TLS 1.2, TLS 1.3 suites are all approved
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsOpenSSLCiphers : OpenSSL names of the FIPS approved cipher suites, for the Node.js components
+var fipsOpenSSLCiphers = []string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384",
+	"ECDHE-RSA-AES128-GCM-SHA256",
+	"ECDHE-RSA-AES256-GCM-SHA384",
+}
+
+// TLSConfig : TLS settings of the clients of the operator, trusting rootCAs when set and the system roots otherwise.
+// In FIPS mode only TLS 1.2 and above with FIPS approved cipher suites and curves are negotiated
+func TLSConfig(rootCAs *x509.CertPool) *tls.Config {
+	config := &tls.Config{RootCAs: rootCAs}
+	if FIPSMode {
+		config.MinVersion = tls.VersionTLS12
+		config.CipherSuites = fipsCipherSuites
+		config.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	}
+	return config
+}
+
+// FIPSNodeOptions : NODE_OPTIONS limiting the TLS connections of a Node.js container to TLS 1.2 and above with FIPS
+// approved cipher suites
+func FIPSNodeOptions() string {
+	return "--tls-min-v1.2 --tls-cipher-list=" + strings.Join(fipsOpenSSLCiphers, ":")
+}
+
+// CheckFIPSCertificate : Fails when the key of the first certificate of the PEM data is not FIPS approved, an RSA key
+// of at least 2048 bits or an ECDSA key on the P-256, P-384 or P-521 curve
+func CheckFIPSCertificate(pemCert []byte) error {
+	block, _ := pem.Decode(pemCert)
+	if block == nil {
+		return errors.New("no PEM certificate found")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return fmt.Errorf("RSA key of %d bits is shorter than the 2048 bits FIPS requires", key.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("ECDSA curve %s is not FIPS approved", key.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("%s keys are not FIPS approved", certificate.PublicKeyAlgorithm)
+	}
+	switch certificate.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+		return fmt.Errorf("signature algorithm %s is not FIPS approved", certificate.SignatureAlgorithm)
+	}
+	return nil
+}
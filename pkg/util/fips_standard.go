@@ -0,0 +1,21 @@
+//go:build !boringcrypto
+// +build !boringcrypto
+
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+// BoringCrypto : Reports whether the crypto of the binary is provided by the FIPS validated BoringCrypto module,
+// false unless the operator is built with the BoringCrypto Go toolchain and the boringcrypto tag
+func BoringCrypto() bool {
+	return false
+}
@@ -12,10 +12,41 @@
 package util
 
 import (
-	"errors"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/eclipse/codewind-operator/pkg/metrics"
+)
+
+const (
+	// HTTPDialTimeoutKey : Operator config map key holding the time limit of opening a connection
+	HTTPDialTimeoutKey = "httpDialTimeout"
+
+	// HTTPTLSHandshakeTimeoutKey : Operator config map key holding the time limit of the TLS handshake
+	HTTPTLSHandshakeTimeoutKey = "httpTLSHandshakeTimeout"
+
+	// HTTPResponseHeaderTimeoutKey : Operator config map key holding how long to wait for the response headers
+	HTTPResponseHeaderTimeoutKey = "httpResponseHeaderTimeout"
+
+	// HTTPIdleConnTimeoutKey : Operator config map key holding how long an idle connection is kept open
+	HTTPIdleConnTimeoutKey = "httpIdleConnTimeout"
+
+	// HTTPMaxIdleConnsPerHostKey : Operator config map key holding the idle connections kept open to each host
+	HTTPMaxIdleConnsPerHostKey = "httpMaxIdleConnsPerHost"
+
+	// HTTPMaxConnsPerHostKey : Operator config map key limiting the connections to each host, 0 for no limit
+	HTTPMaxConnsPerHostKey = "httpMaxConnsPerHost"
+
+	// maxTransports : transports kept for reuse, one for each set of CAs, the cache is emptied beyond it
+	maxTransports = 32
 )
 
 // HTTPClient : An net HTTP Client to simplify testing
@@ -23,25 +54,257 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// HTTPClientOptions : Settings of a client built by NewHTTPClient
+type HTTPClientOptions struct {
+	// Timeout : time limit of a request including reading the response body, none when zero
+	Timeout time.Duration
+
+	// RootCAs : CAs the server certificates are verified against, the system CAs when nil
+	RootCAs *x509.CertPool
+
+	// InsecureSkipVerify : do not verify the server certificates when no RootCAs are set. Ignored in FIPS mode,
+	// where certificates are always verified
+	InsecureSkipVerify bool
+}
+
+// HTTPTransportSettings : Timeouts and connection pool limits of the transports shared by the clients of NewHTTPClient
+type HTTPTransportSettings struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+}
+
+// DefaultHTTPTransportSettings : Transport settings of the keys the operator config map does not set
+var DefaultHTTPTransportSettings = HTTPTransportSettings{
+	DialTimeout:           10 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	MaxIdleConnsPerHost:   10,
+	MaxConnsPerHost:       0,
+}
+
+// transportKey : the TLS settings a transport is shared for
+type transportKey struct {
+	rootCAs            *x509.CertPool
+	insecureSkipVerify bool
+}
+
+// transports : transports of NewHTTPClient, kept so that the clients of every reconcile reuse the open connections
+var transports = struct {
+	sync.Mutex
+	settings HTTPTransportSettings
+	byKey    map[transportKey]*http.Transport
+}{settings: DefaultHTTPTransportSettings}
+
+// NewHTTPClient : Returns a client with the timeout and TLS settings of the options. Clients with the same TLS
+// settings share a transport, with the timeouts and connection pool limits of the operator config map, and requests
+// go through the proxy of the operator
+func NewHTTPClient(options HTTPClientOptions) *http.Client {
+	key := transportKey{rootCAs: options.RootCAs, insecureSkipVerify: options.InsecureSkipVerify && options.RootCAs == nil && !FIPSMode}
+	transports.Lock()
+	defer transports.Unlock()
+	transport := transports.byKey[key]
+	if transport == nil {
+		if len(transports.byKey) >= maxTransports {
+			closeTransports()
+		}
+		if transports.byKey == nil {
+			transports.byKey = map[transportKey]*http.Transport{}
+		}
+		transport = newTransport(transports.settings, key)
+		transports.byKey[key] = transport
+	}
+	return &http.Client{Timeout: options.Timeout, Transport: transport}
+}
+
+// newTransport : A transport with the settings, verifying server certificates as set by the key
+func newTransport(settings HTTPTransportSettings, key transportKey) *http.Transport {
+	tlsConfig := TLSConfig(key.rootCAs)
+	if key.insecureSkipVerify {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	dialer := &net.Dialer{Timeout: settings.DialTimeout, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 Proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		MaxIdleConns:          maxTransports * settings.MaxIdleConnsPerHost,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// closeTransports : Drops the cached transports, closing their idle connections. Requests in flight complete on the
+// transport they started on. The caller holds the lock of transports
+func closeTransports() {
+	for _, transport := range transports.byKey {
+		transport.CloseIdleConnections()
+	}
+	transports.byKey = nil
+}
+
+// HTTPTransportSettingsFromOperatorConfig : Reads the httpDialTimeout, httpTLSHandshakeTimeout,
+// httpResponseHeaderTimeout, httpIdleConnTimeout, httpMaxIdleConnsPerHost and httpMaxConnsPerHost settings of the
+// operator config map. Settings that are not set or are invalid keep their default, an error names the first
+// invalid setting
+func HTTPTransportSettingsFromOperatorConfig(data map[string]string) (HTTPTransportSettings, error) {
+	settings := DefaultHTTPTransportSettings
+	var firstErr error
+	durations := []struct {
+		key   string
+		value *time.Duration
+	}{
+		{HTTPDialTimeoutKey, &settings.DialTimeout},
+		{HTTPTLSHandshakeTimeoutKey, &settings.TLSHandshakeTimeout},
+		{HTTPResponseHeaderTimeoutKey, &settings.ResponseHeaderTimeout},
+		{HTTPIdleConnTimeoutKey, &settings.IdleConnTimeout},
+	}
+	for _, setting := range durations {
+		value := strings.TrimSpace(data[setting.key])
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("operator config map key %s must be a positive duration such as 10s, got %q", setting.key, value)
+			}
+			continue
+		}
+		*setting.value = parsed
+	}
+	counts := []struct {
+		key   string
+		value *int
+		min   int
+	}{
+		{HTTPMaxIdleConnsPerHostKey, &settings.MaxIdleConnsPerHost, 1},
+		{HTTPMaxConnsPerHostKey, &settings.MaxConnsPerHost, 0},
+	}
+	for _, setting := range counts {
+		value := strings.TrimSpace(data[setting.key])
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < setting.min {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("operator config map key %s must be a number of at least %d, got %q", setting.key, setting.min, value)
+			}
+			continue
+		}
+		*setting.value = parsed
+	}
+	return settings, firstErr
+}
+
+// ApplyHTTPClientConfig : Uses the transport settings of the operator config map for the clients built by
+// NewHTTPClient from now on, an invalid setting keeps its default and is reported. Returns whether the settings changed
+func ApplyHTTPClientConfig(data map[string]string) (bool, error) {
+	settings, err := HTTPTransportSettingsFromOperatorConfig(data)
+	transports.Lock()
+	defer transports.Unlock()
+	if settings == transports.settings {
+		return false, err
+	}
+	transports.settings = settings
+	closeTransports()
+	return true, err
+}
+
+// ServiceNotReadyError : Returned when a service did not become ready. TLSError is set when
+// the last attempt failed verifying the service certificate rather than the service being down.
+type ServiceNotReadyError struct {
+	URL        string
+	TLSError   bool
+	StatusCode int
+	Err        error
+}
+
+func (e *ServiceNotReadyError) Error() string {
+	switch {
+	case e.TLSError:
+		return fmt.Sprintf("Service %s did not respond, TLS certificate could not be verified: %v", e.URL, e.Err)
+	case e.StatusCode != 0:
+		return fmt.Sprintf("Service %s did not respond, last HTTP status %d", e.URL, e.StatusCode)
+	case e.Err != nil:
+		return fmt.Sprintf("Service %s did not respond: %v", e.URL, e.Err)
+	}
+	return fmt.Sprintf("Service %s did not respond", e.URL)
+}
+
 // WaitForService : Wait for service to start
 func WaitForService(url string, successStatusCode int, maxRetries int) error {
-	retries := 0
-	client := http.Client{
-		Timeout: time.Second * 5,
-	}
-	for {
-		response, err := client.Get(url)
-		fmt.Errorf("Error: %v", err)
-		if err == nil && response.StatusCode == successStatusCode {
-			fmt.Println(".")
-			return nil
-		}
-		time.Sleep(1 * time.Second)
-		retries++
-		if retries == maxRetries {
+	return WaitForServiceWithContext(context.Background(), nil, url, successStatusCode, maxRetries)
+}
+
+// WaitForServiceWithContext : Wait for service to start, trusting the certificates in rootCAs
+// when set. Stops waiting when the context is cancelled. The time spent waiting is exported as a metric
+func WaitForServiceWithContext(ctx context.Context, rootCAs *x509.CertPool, url string, successStatusCode int, maxRetries int) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveServiceWait(err == nil, start)
+	}()
+	// Without CAs the service presents a self-signed certificate, which is not verified
+	client := NewHTTPClient(HTTPClientOptions{Timeout: time.Second * 5, RootCAs: rootCAs, InsecureSkipVerify: true})
+	notReady := &ServiceNotReadyError{URL: url}
+	for retries := 0; retries < maxRetries; retries++ {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			notReady.Err = err
+			return notReady
+		}
+		response, err := client.Do(req.WithContext(ctx))
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == successStatusCode {
+				return nil
+			}
+			notReady.StatusCode = response.StatusCode
+			notReady.TLSError = false
+			notReady.Err = nil
+		} else {
+			notReady.StatusCode = 0
+			notReady.TLSError = IsTLSError(err)
+			notReady.Err = err
+		}
+		if retries == maxRetries-1 {
 			break
 		}
+		select {
+		case <-ctx.Done():
+			notReady.Err = ctx.Err()
+			return notReady
+		case <-time.After(1 * time.Second):
+		}
+	}
+	return notReady
+}
+
+// IsTLSError : Reports whether a request failed because the server certificate could not be verified
+func IsTLSError(err error) bool {
+	for err != nil {
+		switch err.(type) {
+		case x509.UnknownAuthorityError, *x509.UnknownAuthorityError,
+			x509.CertificateInvalidError, *x509.CertificateInvalidError,
+			x509.HostnameError, *x509.HostnameError,
+			tls.RecordHeaderError, *tls.RecordHeaderError:
+			return true
+		}
+		unwrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = unwrapper.Unwrap()
 	}
-	fmt.Println(".")
-	return errors.New("Service did not respond")
+	return false
 }
@@ -0,0 +1,124 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package util
+
+import (
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ParseImageReference : Splits an image reference such as eclipse/codewind-pfe-amd64:0.9.0 or
+// eclipse/codewind-pfe-amd64@sha256:... into its repository, tag and digest
+func ParseImageReference(reference string) codewindv1alpha1.ImageSpec {
+	image := codewindv1alpha1.ImageSpec{Repository: reference}
+	if at := strings.Index(reference, "@"); at >= 0 {
+		image.Repository = reference[:at]
+		image.Digest = reference[at+1:]
+		return image
+	}
+	// A colon before the last slash belongs to the registry port
+	if colon := strings.LastIndex(reference, ":"); colon > strings.LastIndex(reference, "/") {
+		image.Repository = reference[:colon]
+		image.Tag = reference[colon+1:]
+	}
+	return image
+}
+
+// ImageFromOperatorConfig : Image reference stored under key in the operator config map, else the given default
+func ImageFromOperatorConfig(data map[string]string, key string, defaultImage codewindv1alpha1.ImageSpec) codewindv1alpha1.ImageSpec {
+	if data[key] == "" {
+		return defaultImage
+	}
+	image := ParseImageReference(data[key])
+	if image.Tag == "" && image.Digest == "" {
+		image.Tag = defaultImage.Tag
+	}
+	return image
+}
+
+// SelectImage : Image of a container, the fields set on the CR win over the operator default
+func SelectImage(override *codewindv1alpha1.ImageSpec, defaultImage codewindv1alpha1.ImageSpec) codewindv1alpha1.ImageSpec {
+	image := defaultImage
+	if override == nil {
+		return image
+	}
+	if override.Repository != "" {
+		image.Repository = override.Repository
+	}
+	if override.Digest != "" {
+		image.Tag = ""
+		image.Digest = override.Digest
+	} else if override.Tag != "" {
+		image.Tag = override.Tag
+		image.Digest = ""
+	}
+	return image
+}
+
+// ImageReference : Reference of an image used in a container spec, the digest wins over the tag
+func ImageReference(image codewindv1alpha1.ImageSpec) string {
+	switch {
+	case image.Digest != "":
+		return image.Repository + "@" + image.Digest
+	case image.Tag != "":
+		return image.Repository + ":" + image.Tag
+	}
+	return image.Repository
+}
+
+// SelectImagePullSecrets : Pull secrets of the pods, the CR setting wins over the comma separated
+// secret names of the operator config map key
+func SelectImagePullSecrets(override []corev1.LocalObjectReference, data map[string]string, key string) []corev1.LocalObjectReference {
+	if len(override) > 0 {
+		return append([]corev1.LocalObjectReference(nil), override...)
+	}
+	var secrets []corev1.LocalObjectReference
+	for _, name := range SplitList(data[key]) {
+		secrets = append(secrets, corev1.LocalObjectReference{Name: name})
+	}
+	return secrets
+}
+
+// SyncDeploymentImages : Copies the image of each container of the desired deployment to the existing one, along
+// with its environment which may carry the image version, the pull secrets of the new images and the affinity to the
+// nodes of their architecture. Returns true when the existing deployment changed and must be updated, which rolls its pods
+func SyncDeploymentImages(existing *appsv1.Deployment, desired *appsv1.Deployment) bool {
+	changed := false
+	for _, want := range desired.Spec.Template.Spec.Containers {
+		for i := range existing.Spec.Template.Spec.Containers {
+			container := &existing.Spec.Template.Spec.Containers[i]
+			if container.Name == want.Name && container.Image != want.Image {
+				container.Image = want.Image
+				container.Env = want.Env
+				changed = true
+			}
+		}
+	}
+	if changed {
+		existing.Spec.Template.Spec.ImagePullSecrets = desired.Spec.Template.Spec.ImagePullSecrets
+		existing.Spec.Template.Spec.Affinity = desired.Spec.Template.Spec.Affinity
+	}
+	return changed
+}
+
+// SyncDeploymentReplicas : Copies the replicas of the desired deployment to the existing one. Returns true when the
+// existing deployment changed and must be updated
+func SyncDeploymentReplicas(existing *appsv1.Deployment, desired *appsv1.Deployment) bool {
+	if desired.Spec.Replicas == nil || (existing.Spec.Replicas != nil && *existing.Spec.Replicas == *desired.Spec.Replicas) {
+		return false
+	}
+	replicas := *desired.Spec.Replicas
+	existing.Spec.Replicas = &replicas
+	return true
+}
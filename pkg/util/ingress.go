@@ -0,0 +1,121 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+)
+
+const (
+	// IngressClassKey : Operator config map key holding the default ingress class
+	IngressClassKey = "ingressClass"
+
+	// IngressAnnotationsKey : Operator config map key holding the JSON object of annotations added to every Ingress
+	IngressAnnotationsKey = "ingressAnnotations"
+
+	// IngressRoutingKey : Operator config map key holding the default routing of the gatekeeper, host or path
+	IngressRoutingKey = "ingressRouting"
+
+	// RoutingHost : each instance is published at a host of its own
+	RoutingHost = "host"
+
+	// RoutingPath : instances are published under a path of a shared host
+	RoutingPath = "path"
+
+	// DefaultIngressClass : ingress class of the Ingress objects when neither the CR nor the operator config map set one
+	DefaultIngressClass = "nginx"
+
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	nginxAnnotationPrefix  = "nginx.ingress.kubernetes.io/"
+)
+
+// IngressFromOperatorConfig : Default ingress settings of the ingressClass and ingressAnnotations keys, on error the
+// annotations are left empty and the error is returned
+func IngressFromOperatorConfig(data map[string]string) (codewindv1alpha1.IngressSpec, error) {
+	ingress := codewindv1alpha1.IngressSpec{ClassName: data[IngressClassKey]}
+	value := data[IngressAnnotationsKey]
+	if value == "" {
+		return ingress, nil
+	}
+	annotations := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &annotations); err != nil {
+		return ingress, fmt.Errorf("operator config map key %s is not a valid JSON object of annotations: %v", IngressAnnotationsKey, err)
+	}
+	ingress.Annotations = annotations
+	return ingress, nil
+}
+
+// SelectIngress : Ingress settings of a CR, the class of the CR wins over the operator default and its annotations
+// replace the default annotations of the same name
+func SelectIngress(override *codewindv1alpha1.IngressSpec, defaultIngress codewindv1alpha1.IngressSpec) codewindv1alpha1.IngressSpec {
+	ingress := codewindv1alpha1.IngressSpec{ClassName: defaultIngress.ClassName}
+	if ingress.ClassName == "" {
+		ingress.ClassName = DefaultIngressClass
+	}
+	annotations := map[string]string{}
+	for key, value := range defaultIngress.Annotations {
+		annotations[key] = value
+	}
+	if override != nil {
+		if override.ClassName != "" {
+			ingress.ClassName = override.ClassName
+		}
+		for key, value := range override.Annotations {
+			annotations[key] = value
+		}
+	}
+	if len(annotations) > 0 {
+		ingress.Annotations = annotations
+	}
+	return ingress
+}
+
+// SelectRouting : Routing of a CR, else the routing of the operator config map. Host unless one of them selects path
+func SelectRouting(override string, data map[string]string) string {
+	routing := override
+	if routing == "" {
+		routing = data[IngressRoutingKey]
+	}
+	if routing == RoutingPath {
+		return RoutingPath
+	}
+	return RoutingHost
+}
+
+// IngressAnnotations : Annotations of an Ingress for the selected controller. The generated nginx annotations are
+// dropped for other classes, then the annotations of the settings are applied, an empty value removing the annotation
+func IngressAnnotations(generated map[string]string, ingress codewindv1alpha1.IngressSpec) map[string]string {
+	className := ingress.ClassName
+	if className == "" {
+		className = DefaultIngressClass
+	}
+	annotations := map[string]string{}
+	for key, value := range generated {
+		if className != DefaultIngressClass && strings.HasPrefix(key, nginxAnnotationPrefix) {
+			continue
+		}
+		annotations[key] = value
+	}
+	annotations[ingressClassAnnotation] = className
+	for key, value := range ingress.Annotations {
+		if value == "" {
+			delete(annotations, key)
+			continue
+		}
+		annotations[key] = value
+	}
+	return annotations
+}
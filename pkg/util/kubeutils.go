@@ -13,14 +13,25 @@ package util
 
 import (
 	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
+// DetectIngressDomainKey : Operator config map key, false keeps the ingressDomain of the config map on OpenShift 4
+const DetectIngressDomainKey = "detectIngressDomain"
+
+// openshiftIngressConfig : cluster scoped ingress config of OpenShift 4, its spec holds the apps domain of the routes
+var openshiftIngressConfig = schema.GroupVersionResource{Group: "config.openshift.io", Version: "v1", Resource: "ingresses"}
+
 // DetectOpenShift determines if we're running on an OpenShift cluster
 func DetectOpenShift() (isOpenshift bool, isOpenshift4 bool, anError error) {
 	apiGroups, err := getAPIList()
@@ -38,6 +49,41 @@ func DetectOpenShift() (isOpenshift bool, isOpenshift4 bool, anError error) {
 	return
 }
 
+// DetectIngressDomain returns the apps domain of an OpenShift 4 cluster, empty when the ingress config sets none
+func DetectIngressDomain() (string, error) {
+	kubeconfig, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	ingressConfig, err := dynamicClient.Resource(openshiftIngressConfig).Get("cluster", v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	domain, _, err := unstructured.NestedString(ingressConfig.Object, "spec", "domain")
+	return domain, err
+}
+
+// OperatorIngressDomain : ingressDomain of the operator config map, replaced on OpenShift 4 by the apps domain of the
+// cluster unless detectIngressDomain is false. The configured domain is returned with the error when detection fails
+func OperatorIngressDomain(data map[string]string, isOpenshift4 bool) (string, error) {
+	configured := data["ingressDomain"]
+	if !isOpenshift4 {
+		return configured, nil
+	}
+	if detect, err := strconv.ParseBool(data[DetectIngressDomainKey]); err == nil && !detect {
+		return configured, nil
+	}
+	domain, err := DetectIngressDomain()
+	if err != nil || domain == "" {
+		return configured, err
+	}
+	return domain, nil
+}
+
 func getAPIList() ([]v1.APIGroup, error) {
 	discoveryClient, err := getDiscoveryClient()
 	if err != nil {
@@ -72,6 +118,28 @@ func GetOperatorNamespace() string {
 	return operatorNamespace
 }
 
+// GetWatchNamespaces : Namespaces the operator should watch, read from the comma separated
+// WATCH_NAMESPACE environment variable. An empty list means all namespaces are watched.
+func GetWatchNamespaces() ([]string, error) {
+	watchNamespace, err := k8sutil.GetWatchNamespace()
+	if err != nil {
+		return nil, err
+	}
+	return SplitList(watchNamespace), nil
+}
+
+// SplitList : Splits a comma separated list, dropping empty entries
+func SplitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // GenerateRandomString : Generates random characters
 func GenerateRandomString(length int) string {
 	var options = []rune("abcdefghijklmnopqrstuvwxyz0123456789")
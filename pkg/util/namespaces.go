@@ -0,0 +1,56 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// NamespaceDefaultsKey : Operator config map key holding the defaults of individual namespaces
+const NamespaceDefaultsKey = "namespaceDefaults"
+
+// NamespaceDefaults : Operator config map defaults that differ in one namespace, empty fields keep the cluster default
+type NamespaceDefaults struct {
+	IngressDomain    string `json:"ingressDomain,omitempty"`
+	StorageClassName string `json:"storageClassName,omitempty"`
+}
+
+// OperatorConfigForNamespace : Returns a copy of the operator config map data with the ingressDomain and
+// storageClassName entries of the namespace, as set in the JSON object of the namespaceDefaults key, for example
+// '{"team-a":{"ingressDomain":"team-a.apps.example.com","storageClassName":"fast"}}'. On error the cluster
+// defaults are returned with the error
+func OperatorConfigForNamespace(data map[string]string, namespace string) (map[string]string, error) {
+	namespaceData := make(map[string]string, len(data))
+	for key, value := range data {
+		namespaceData[key] = value
+	}
+	value := data[NamespaceDefaultsKey]
+	if value == "" {
+		return namespaceData, nil
+	}
+	namespaceDefaults := map[string]NamespaceDefaults{}
+	if err := json.Unmarshal([]byte(value), &namespaceDefaults); err != nil {
+		return namespaceData, fmt.Errorf("operator config map key %s is not a valid JSON object of namespace defaults: %v", NamespaceDefaultsKey, err)
+	}
+	namespaceDefault, ok := namespaceDefaults[namespace]
+	if !ok {
+		return namespaceData, nil
+	}
+	if namespaceDefault.IngressDomain != "" {
+		namespaceData["ingressDomain"] = namespaceDefault.IngressDomain
+	}
+	if namespaceDefault.StorageClassName != "" {
+		namespaceData["storageClassName"] = namespaceDefault.StorageClassName
+	}
+	return namespaceData, nil
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NetworkPoliciesEnabled : Reports whether NetworkPolicies are created for a CR, the CR setting wins over the
+// enableNetworkPolicies key of the operator config map. They are not created by default
+func NetworkPoliciesEnabled(override *bool, operatorConfig map[string]string) bool {
+	if override != nil {
+		return *override
+	}
+	enabled, _ := strconv.ParseBool(operatorConfig["enableNetworkPolicies"])
+	return enabled
+}
+
+// EnsureNetworkPolicy : Creates the NetworkPolicy, or replaces the spec of an existing one that differs.
+// Returns true when the policy was created or updated
+func EnsureNetworkPolicy(c client.Client, networkPolicy *networkingv1.NetworkPolicy) (bool, error) {
+	existing := &networkingv1.NetworkPolicy{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: networkPolicy.Name, Namespace: networkPolicy.Namespace}, existing)
+	if k8serr.IsNotFound(err) {
+		err = c.Create(context.TODO(), networkPolicy)
+		if err != nil && !k8serr.IsAlreadyExists(err) {
+			return false, err
+		}
+		return err == nil, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(existing.Spec, networkPolicy.Spec) {
+		return false, nil
+	}
+	existing.Spec = networkPolicy.Spec
+	return true, c.Update(context.TODO(), existing)
+}
+
+// DeleteNetworkPolicy : Removes a NetworkPolicy, a missing policy is not an error. Returns true when it was deleted
+func DeleteNetworkPolicy(c client.Client, name string, namespace string) (bool, error) {
+	networkPolicy := &networkingv1.NetworkPolicy{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, networkPolicy)
+	if k8serr.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	err = c.Delete(context.TODO(), networkPolicy)
+	if k8serr.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NewIngressNetworkPolicy : Builds a NetworkPolicy of the pods matching selector that admits only the given rules
+func NewIngressNetworkPolicy(name string, namespace string, labels map[string]string, selector map[string]string, rules []networkingv1.NetworkPolicyIngressRule) *networkingv1.NetworkPolicy {
+	networkPolicy := &networkingv1.NetworkPolicy{}
+	networkPolicy.Name = name
+	networkPolicy.Namespace = namespace
+	networkPolicy.Labels = labels
+	networkPolicy.Spec = networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: selector},
+		Ingress:     rules,
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}
+	return networkPolicy
+}
+
+// NetworkPolicyPorts : TCP ports of an ingress rule, the protocol is set so the spec compares equal to the stored one
+func NetworkPolicyPorts(ports ...int) []networkingv1.NetworkPolicyPort {
+	protocol := corev1.ProtocolTCP
+	policyPorts := make([]networkingv1.NetworkPolicyPort, 0, len(ports))
+	for _, port := range ports {
+		portValue := intstr.FromInt(port)
+		policyPorts = append(policyPorts, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &portValue})
+	}
+	return policyPorts
+}
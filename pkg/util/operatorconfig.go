@@ -0,0 +1,48 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// OperatorConfigMapPredicate : Passes the events of the named config map in the operator namespace. Updates only
+// pass when the data changed, so that the periodic resync does not reconcile every CR
+func OperatorConfigMapPredicate(name string) predicate.Funcs {
+	isOperatorConfigMap := func(meta metav1.Object) bool {
+		return meta.GetName() == name && meta.GetNamespace() == GetOperatorNamespace()
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isOperatorConfigMap(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if !isOperatorConfigMap(e.MetaNew) {
+				return false
+			}
+			oldConfigMap, oldOK := e.ObjectOld.(*corev1.ConfigMap)
+			newConfigMap, newOK := e.ObjectNew.(*corev1.ConfigMap)
+			return !oldOK || !newOK || !reflect.DeepEqual(oldConfigMap.Data, newConfigMap.Data)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
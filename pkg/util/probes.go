@@ -0,0 +1,124 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// probesHashAnnotation : deployment annotation holding the hash of the probes the operator last applied. The API
+// server of clusters without startup probes drops them, so the probes of the deployment are not compared directly
+const probesHashAnnotation = "codewind.eclipse.org/probes-hash"
+
+// ProbeTimings : default timings of the startup, liveness and readiness probes of a component. Only the timing
+// fields of each probe are used
+type ProbeTimings struct {
+	Startup   corev1.Probe
+	Liveness  corev1.Probe
+	Readiness corev1.Probe
+}
+
+// SetContainerProbes : Sets probes checking that the container accepts connections on its port, with the default
+// timings overridden field by field by the probes of the CR. A probe disabled on the CR is not set
+func SetContainerProbes(container *corev1.Container, port int, timings ProbeTimings, probes *codewindv1alpha1.ProbesSpec) {
+	if probes == nil {
+		probes = &codewindv1alpha1.ProbesSpec{}
+	}
+	handler := corev1.Handler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(port)}}
+	container.StartupProbe = containerProbe(handler, timings.Startup, probes.Startup)
+	container.LivenessProbe = containerProbe(handler, timings.Liveness, probes.Liveness)
+	container.ReadinessProbe = containerProbe(handler, timings.Readiness, probes.Readiness)
+}
+
+// containerProbe : probe of the handler with the timings of the CR where set
+func containerProbe(handler corev1.Handler, timing corev1.Probe, spec *codewindv1alpha1.ProbeSpec) *corev1.Probe {
+	if spec != nil && spec.Disabled {
+		return nil
+	}
+	probe := timing
+	probe.Handler = handler
+	if spec == nil {
+		return &probe
+	}
+	if spec.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *spec.InitialDelaySeconds
+	}
+	if spec.PeriodSeconds != nil {
+		probe.PeriodSeconds = *spec.PeriodSeconds
+	}
+	if spec.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *spec.TimeoutSeconds
+	}
+	if spec.SuccessThreshold != nil {
+		probe.SuccessThreshold = *spec.SuccessThreshold
+	}
+	if spec.FailureThreshold != nil {
+		probe.FailureThreshold = *spec.FailureThreshold
+	}
+	return &probe
+}
+
+// SetDeploymentProbesHash : Records the probes of a new deployment, so that SyncDeploymentProbes only updates it
+// once they change
+func SetDeploymentProbesHash(deployment *appsv1.Deployment) {
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[probesHashAnnotation] = deploymentProbesHash(deployment)
+}
+
+// SyncDeploymentProbes : Copies the probes of the containers of the desired deployment to the existing one when they
+// changed since the operator last applied them. Returns true when the existing deployment changed and must be updated
+func SyncDeploymentProbes(existing *appsv1.Deployment, desired *appsv1.Deployment) bool {
+	hash := deploymentProbesHash(desired)
+	if existing.Annotations[probesHashAnnotation] == hash {
+		return false
+	}
+	for _, want := range desired.Spec.Template.Spec.Containers {
+		for i := range existing.Spec.Template.Spec.Containers {
+			container := &existing.Spec.Template.Spec.Containers[i]
+			if container.Name == want.Name {
+				container.StartupProbe = want.StartupProbe
+				container.LivenessProbe = want.LivenessProbe
+				container.ReadinessProbe = want.ReadinessProbe
+			}
+		}
+	}
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	existing.Annotations[probesHashAnnotation] = hash
+	return true
+}
+
+// deploymentProbesHash : hash of the probes of the containers of a deployment
+func deploymentProbesHash(deployment *appsv1.Deployment) string {
+	type containerProbes struct {
+		Name      string        `json:"name"`
+		Startup   *corev1.Probe `json:"startup,omitempty"`
+		Liveness  *corev1.Probe `json:"liveness,omitempty"`
+		Readiness *corev1.Probe `json:"readiness,omitempty"`
+	}
+	probes := []containerProbes{}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		probes = append(probes, containerProbes{container.Name, container.StartupProbe, container.LivenessProbe, container.ReadinessProbe})
+	}
+	jsonProbes, _ := json.Marshal(probes)
+	return fmt.Sprintf("%x", sha256.Sum256(jsonProbes))
+}
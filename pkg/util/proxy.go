@@ -0,0 +1,124 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	"golang.org/x/net/http/httpproxy"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// HTTPProxyKey : Operator config map key holding the proxy URL of plain HTTP requests
+	HTTPProxyKey = "httpProxy"
+
+	// HTTPSProxyKey : Operator config map key holding the proxy URL of HTTPS requests
+	HTTPSProxyKey = "httpsProxy"
+
+	// NoProxyKey : Operator config map key holding the hosts reached without the proxy
+	NoProxyKey = "noProxy"
+
+	// clusterNoProxy : hosts of the cluster the components always reach without the proxy
+	clusterNoProxy = ".svc,.cluster.local,localhost,127.0.0.1"
+)
+
+var (
+	operatorProxyLock sync.RWMutex
+	operatorProxy     codewindv1alpha1.ProxySpec
+	operatorProxyFunc func(*url.URL) (*url.URL, error)
+)
+
+// ProxyFromOperatorConfig : Proxy settings of the httpProxy, httpsProxy and noProxy keys of the operator config map
+func ProxyFromOperatorConfig(data map[string]string) codewindv1alpha1.ProxySpec {
+	return codewindv1alpha1.ProxySpec{
+		HTTPProxy:  strings.TrimSpace(data[HTTPProxyKey]),
+		HTTPSProxy: strings.TrimSpace(data[HTTPSProxyKey]),
+		NoProxy:    strings.TrimSpace(data[NoProxyKey]),
+	}
+}
+
+// ApplyProxyConfig : Routes the requests of the operator through the proxy of the operator config map, going back to
+// the proxy environment variables of the operator when the keys are removed. Returns whether the settings changed
+func ApplyProxyConfig(data map[string]string) bool {
+	proxy := ProxyFromOperatorConfig(data)
+	operatorProxyLock.Lock()
+	defer operatorProxyLock.Unlock()
+	if proxy == operatorProxy {
+		return false
+	}
+	operatorProxy = proxy
+	operatorProxyFunc = nil
+	if proxy.HTTPProxy != "" || proxy.HTTPSProxy != "" {
+		config := httpproxy.Config{HTTPProxy: proxy.HTTPProxy, HTTPSProxy: proxy.HTTPSProxy, NoProxy: proxy.NoProxy}
+		operatorProxyFunc = config.ProxyFunc()
+	}
+	return true
+}
+
+// Proxy : Proxy of a request of the operator, for the Proxy field of an http.Transport. Uses the operator config map
+// when it sets a proxy, else the proxy environment variables
+func Proxy(req *http.Request) (*url.URL, error) {
+	operatorProxyLock.RLock()
+	proxyFunc := operatorProxyFunc
+	operatorProxyLock.RUnlock()
+	if proxyFunc == nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	return proxyFunc(req.URL)
+}
+
+// SelectProxy : Proxy settings of a CR, each field set on the CR replaces the operator config map default
+func SelectProxy(override *codewindv1alpha1.ProxySpec, defaultProxy codewindv1alpha1.ProxySpec) codewindv1alpha1.ProxySpec {
+	proxy := defaultProxy
+	if override == nil {
+		return proxy
+	}
+	if override.HTTPProxy != "" {
+		proxy.HTTPProxy = override.HTTPProxy
+	}
+	if override.HTTPSProxy != "" {
+		proxy.HTTPSProxy = override.HTTPSProxy
+	}
+	if override.NoProxy != "" {
+		proxy.NoProxy = override.NoProxy
+	}
+	return proxy
+}
+
+// ProxyEnv : Proxy environment variables of a container in upper and lower case, as tools read either. Empty when no
+// proxy is set, the cluster service domains are always reached without the proxy
+func ProxyEnv(proxy codewindv1alpha1.ProxySpec) []corev1.EnvVar {
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		return nil
+	}
+	noProxy := clusterNoProxy
+	if proxy.NoProxy != "" {
+		noProxy = proxy.NoProxy + "," + clusterNoProxy
+	}
+	var env []corev1.EnvVar
+	for _, variable := range []struct{ name, value string }{
+		{"HTTP_PROXY", proxy.HTTPProxy},
+		{"HTTPS_PROXY", proxy.HTTPSProxy},
+		{"NO_PROXY", noProxy},
+	} {
+		if variable.value == "" {
+			continue
+		}
+		env = append(env, corev1.EnvVar{Name: variable.name, Value: variable.value}, corev1.EnvVar{Name: strings.ToLower(variable.name), Value: variable.value})
+	}
+	return env
+}
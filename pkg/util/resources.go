@@ -0,0 +1,43 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ResourcesFromOperatorConfig : Parses the JSON resource requirements stored under key in the operator config map.
+// Returns nil when the key is not set
+func ResourcesFromOperatorConfig(data map[string]string, key string) (*corev1.ResourceRequirements, error) {
+	value := data[key]
+	if value == "" {
+		return nil, nil
+	}
+	resources := &corev1.ResourceRequirements{}
+	if err := json.Unmarshal([]byte(value), resources); err != nil {
+		return nil, fmt.Errorf("operator config map key %s is not a valid resource requirements object: %v", key, err)
+	}
+	return resources, nil
+}
+
+// SelectResources : Resources of a container, the CR setting wins over the operator config map default
+func SelectResources(override *corev1.ResourceRequirements, defaultResources *corev1.ResourceRequirements) corev1.ResourceRequirements {
+	if override != nil {
+		return *override.DeepCopy()
+	}
+	if defaultResources != nil {
+		return *defaultResources.DeepCopy()
+	}
+	return corev1.ResourceRequirements{}
+}
@@ -0,0 +1,146 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy : How often a request failing with a transient error is attempted and how long to wait between attempts
+type RetryPolicy struct {
+	// MaxAttempts : attempts of each request including the first, 1 disables retries
+	MaxAttempts int
+	// InitialBackoff : wait before the second attempt, doubled after each further attempt
+	InitialBackoff time.Duration
+	// MaxBackoff : longest wait between two attempts
+	MaxBackoff time.Duration
+	// Timeout : time limit of each attempt
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy : Policy of fields not set in a RetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Timeout:        30 * time.Second,
+}
+
+// WithDefaults : Returns the policy with unset fields taken from DefaultRetryPolicy
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultRetryPolicy.Timeout
+	}
+	return p
+}
+
+// RetryPolicyFromOperatorConfig : Reads the keycloakRetryAttempts, keycloakRetryBackoff, keycloakRetryMaxBackoff and
+// keycloakRequestTimeout settings of the operator config map. Settings that are not set or are invalid keep their
+// default, an error names the first invalid setting
+func RetryPolicyFromOperatorConfig(data map[string]string) (RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+	var firstErr error
+	if value := data["keycloakRetryAttempts"]; value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			firstErr = fmt.Errorf("operator config map key keycloakRetryAttempts must be a positive number, got %q", value)
+		} else {
+			policy.MaxAttempts = attempts
+		}
+	}
+	durations := []struct {
+		key   string
+		field *time.Duration
+	}{
+		{"keycloakRetryBackoff", &policy.InitialBackoff},
+		{"keycloakRetryMaxBackoff", &policy.MaxBackoff},
+		{"keycloakRequestTimeout", &policy.Timeout},
+	}
+	for _, setting := range durations {
+		value := data[setting.key]
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("operator config map key %s must be a positive duration such as 2s, got %q", setting.key, value)
+			}
+			continue
+		}
+		*setting.field = duration
+	}
+	return policy, firstErr
+}
+
+// RetryingHTTPClient : An HTTPClient that attempts requests again after timeouts and 5xx responses, waiting
+// longer after each attempt. Requests whose body cannot be replayed are attempted once
+type RetryingHTTPClient struct {
+	Client HTTPClient
+	Policy RetryPolicy
+}
+
+// Do : Sends the request with the retry policy. Returns the last response or error once the attempts are exhausted
+func (c *RetryingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	policy := c.Policy.WithDefaults()
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		response, err := c.Client.Do(req)
+		if attempt >= policy.MaxAttempts || !retryableResult(response, err) || (req.Body != nil && req.GetBody == nil) {
+			return response, err
+		}
+		if response != nil {
+			// Drain the body so that the connection can be reused by the next attempt
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// retryableResult : Reports whether a request ended with a timeout or a server error worth attempting again
+func retryableResult(response *http.Response, err error) bool {
+	if err != nil {
+		netErr, ok := err.(net.Error)
+		return ok && netErr.Timeout()
+	}
+	return response.StatusCode >= 500
+}
@@ -0,0 +1,117 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PodSecurityContextKey : Operator config map key holding the default security settings of the pods
+	PodSecurityContextKey = "podSecurityContext"
+
+	// defaultNonOpenShiftUser : user and volume group of the pods where no security context constraint assigns them
+	defaultNonOpenShiftUser = int64(1001)
+
+	// seccompPodAnnotation : pod template annotation selecting the seccomp profile. The vendored Kubernetes API predates
+	// the seccompProfile field, the API server copies the annotation to the field of the pods it creates
+	seccompPodAnnotation = "seccomp.security.alpha.kubernetes.io/pod"
+)
+
+// PodSecurityFromOperatorConfig : Default security settings of the JSON object of the podSecurityContext key, for example
+// '{"runAsUser":1000,"fsGroup":1000}'. Nil when not set, on error nil is returned with the error
+func PodSecurityFromOperatorConfig(data map[string]string) (*codewindv1alpha1.PodSecuritySpec, error) {
+	value := data[PodSecurityContextKey]
+	if value == "" {
+		return nil, nil
+	}
+	podSecurity := &codewindv1alpha1.PodSecuritySpec{}
+	if err := json.Unmarshal([]byte(value), podSecurity); err != nil {
+		return nil, fmt.Errorf("operator config map key %s is not a valid JSON security context: %v", PodSecurityContextKey, err)
+	}
+	return podSecurity, nil
+}
+
+// SelectPodSecurity : Security settings of the pods of a component, each field set on the CR wins over
+// the operator default and then the restricted defaults. On OpenShift the user and volume group are left to the
+// security context constraint of the service account
+func SelectPodSecurity(override *codewindv1alpha1.PodSecuritySpec, defaultPodSecurity *codewindv1alpha1.PodSecuritySpec, isOpenshift bool) codewindv1alpha1.PodSecuritySpec {
+	runAsNonRoot := true
+	allowPrivilegeEscalation := false
+	podSecurity := codewindv1alpha1.PodSecuritySpec{
+		RunAsNonRoot:             &runAsNonRoot,
+		SeccompProfile:           "runtime/default",
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		DropCapabilities:         []corev1.Capability{"ALL"},
+	}
+	if !isOpenshift {
+		user := defaultNonOpenShiftUser
+		podSecurity.RunAsUser = &user
+		podSecurity.FSGroup = &user
+	}
+	for _, layer := range []*codewindv1alpha1.PodSecuritySpec{defaultPodSecurity, override} {
+		if layer == nil {
+			continue
+		}
+		if layer.RunAsNonRoot != nil {
+			podSecurity.RunAsNonRoot = layer.RunAsNonRoot
+		}
+		if layer.RunAsUser != nil {
+			podSecurity.RunAsUser = layer.RunAsUser
+		}
+		if layer.FSGroup != nil {
+			podSecurity.FSGroup = layer.FSGroup
+		}
+		if layer.SeccompProfile != "" {
+			podSecurity.SeccompProfile = layer.SeccompProfile
+		}
+		if layer.AllowPrivilegeEscalation != nil {
+			podSecurity.AllowPrivilegeEscalation = layer.AllowPrivilegeEscalation
+		}
+		if layer.DropCapabilities != nil {
+			podSecurity.DropCapabilities = layer.DropCapabilities
+		}
+	}
+	return *podSecurity.DeepCopy()
+}
+
+// PodSecurityContext : Pod level security context of the settings
+func PodSecurityContext(podSecurity codewindv1alpha1.PodSecuritySpec) *corev1.PodSecurityContext {
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: podSecurity.RunAsNonRoot,
+		RunAsUser:    podSecurity.RunAsUser,
+		FSGroup:      podSecurity.FSGroup,
+	}
+}
+
+// ContainerSecurityContext : Container level security context of the settings
+func ContainerSecurityContext(podSecurity codewindv1alpha1.PodSecuritySpec) *corev1.SecurityContext {
+	securityContext := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: podSecurity.AllowPrivilegeEscalation,
+	}
+	if len(podSecurity.DropCapabilities) > 0 {
+		securityContext.Capabilities = &corev1.Capabilities{Drop: podSecurity.DropCapabilities}
+	}
+	return securityContext
+}
+
+// PodSecurityAnnotations : Pod template annotations of the settings
+func PodSecurityAnnotations(podSecurity codewindv1alpha1.PodSecuritySpec) map[string]string {
+	if podSecurity.SeccompProfile == "" {
+		return nil
+	}
+	return map[string]string{seccompPodAnnotation: podSecurity.SeccompProfile}
+}
@@ -0,0 +1,91 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"context"
+	"strconv"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ServiceMonitorGVK : Prometheus operator ServiceMonitor resource, managed as unstructured so the Prometheus operator stays optional
+var ServiceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// ServiceMonitorsEnabled : Reports whether the operator config map asks for ServiceMonitors, they are not created by default
+func ServiceMonitorsEnabled(operatorConfig map[string]string) bool {
+	enabled, _ := strconv.ParseBool(operatorConfig["enableServiceMonitors"])
+	return enabled
+}
+
+// DetectPrometheusOperator : Reports whether the ServiceMonitor resource of the Prometheus operator is served by the cluster
+func DetectPrometheusOperator() (bool, error) {
+	apiGroups, err := getAPIList()
+	if err != nil {
+		return false, err
+	}
+	for _, apiGroup := range apiGroups {
+		if apiGroup.Name == ServiceMonitorGVK.Group {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NewServiceMonitor : Builds a ServiceMonitor scraping /metrics from the named port of the services matching selector.
+// Services serving https use self-signed certificates, so their certificate is not verified
+func NewServiceMonitor(name string, namespace string, labels map[string]string, selector map[string]string, port string, scheme string) *unstructured.Unstructured {
+	matchLabels := map[string]interface{}{}
+	for key, value := range selector {
+		matchLabels[key] = value
+	}
+	endpoint := map[string]interface{}{
+		"port":   port,
+		"path":   "/metrics",
+		"scheme": scheme,
+	}
+	if scheme == "https" {
+		endpoint["tlsConfig"] = map[string]interface{}{"insecureSkipVerify": true}
+	}
+	serviceMonitor := &unstructured.Unstructured{}
+	serviceMonitor.SetGroupVersionKind(ServiceMonitorGVK)
+	serviceMonitor.SetName(name)
+	serviceMonitor.SetNamespace(namespace)
+	serviceMonitor.SetLabels(labels)
+	serviceMonitor.Object["spec"] = map[string]interface{}{
+		"selector":  map[string]interface{}{"matchLabels": matchLabels},
+		"endpoints": []interface{}{endpoint},
+	}
+	return serviceMonitor
+}
+
+// EnsureServiceMonitor : Creates the ServiceMonitor when it does not exist yet, an existing one is left unchanged
+func EnsureServiceMonitor(c client.Client, serviceMonitor *unstructured.Unstructured) (created bool, err error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(ServiceMonitorGVK)
+	err = c.Get(context.TODO(), types.NamespacedName{Name: serviceMonitor.GetName(), Namespace: serviceMonitor.GetNamespace()}, existing)
+	if err == nil {
+		return false, nil
+	}
+	if !k8serr.IsNotFound(err) {
+		return false, err
+	}
+	err = c.Create(context.TODO(), serviceMonitor)
+	if err != nil && !k8serr.IsAlreadyExists(err) {
+		return false, err
+	}
+	return err == nil, nil
+}
@@ -0,0 +1,58 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package util
+
+import (
+	"fmt"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// SelectStorageSize : Size of a volume, spec.storage.size wins over the older storageSize field which wins over
+// the operator config map default. fromCR reports whether the size was set on the CR
+func SelectStorageSize(storage *codewindv1alpha1.StorageSpec, storageSize string, defaultSize string) (size resource.Quantity, fromCR bool, err error) {
+	value := defaultSize
+	if storageSize != "" {
+		value, fromCR = storageSize, true
+	}
+	if storage != nil && storage.Size != "" {
+		value, fromCR = storage.Size, true
+	}
+	size, err = resource.ParseQuantity(value)
+	if err != nil {
+		return size, fromCR, fmt.Errorf("storage size %q is not a valid quantity: %v", value, err)
+	}
+	if size.Sign() <= 0 {
+		return size, fromCR, fmt.Errorf("storage size %q must be larger than 0", value)
+	}
+	return size, fromCR, nil
+}
+
+// SelectStorageClassName : Storage class of a volume, the CR setting wins over the class detected by the operator
+func SelectStorageClassName(storage *codewindv1alpha1.StorageSpec, defaultClassName string) string {
+	if storage != nil && storage.StorageClassName != "" {
+		return storage.StorageClassName
+	}
+	return defaultClassName
+}
+
+// ExpandPVC : Raises the storage request of an existing PVC to size. Returns true when the request grew and
+// the PVC must be updated, a smaller size leaves the PVC unchanged
+func ExpandPVC(pvc *corev1.PersistentVolumeClaim, size resource.Quantity) bool {
+	current, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if !ok || size.Cmp(current) <= 0 {
+		return false
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	return true
+}
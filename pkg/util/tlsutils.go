@@ -13,20 +13,74 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"math/big"
 	"time"
 
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
 
-// GenerateCertificate : generates a key and certificate
+// TLSSecretName : Name of the existing TLS secret of a TLS spec, empty when the operator issues the certificate
+func TLSSecretName(tls *codewindv1alpha1.TLSSpec) string {
+	if tls == nil {
+		return ""
+	}
+	return tls.SecretName
+}
+
+// CheckTLSSecret : Fails when the TLS secret does not exist or misses the tls.crt or tls.key key, and in FIPS mode when
+// its certificate does not use a FIPS approved key and signature
+func CheckTLSSecret(c client.Client, namespace string, name string) error {
+	secret := &corev1.Secret{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, secret)
+	if err != nil {
+		return fmt.Errorf("unable to read TLS secret %s: %v", name, err)
+	}
+	for _, key := range []string{"tls.crt", "tls.key"} {
+		if len(secret.Data[key]) == 0 {
+			return fmt.Errorf("TLS secret %s has no %s key", name, key)
+		}
+	}
+	if FIPSMode {
+		if err := CheckFIPSCertificate(secret.Data["tls.crt"]); err != nil {
+			return fmt.Errorf("TLS secret %s cannot be used in FIPS mode: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// CertificateCoversHosts : Reports whether the first certificate of the PEM data is valid for every one of the hosts
+func CertificateCoversHosts(pemCert []byte, hosts []string) bool {
+	block, _ := pem.Decode(pemCert)
+	if block == nil {
+		return false
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if certificate.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateCertificate : generates a key and certificate for dnsName and the optional extra names. In FIPS mode the
+// key is a 3072 bit RSA key, the certificate is signed with SHA-256 and has a random serial number
 // returns ServerKey ServerCert, error
-func GenerateCertificate(dnsName string, certTitle string) (string, string, error) {
+func GenerateCertificate(dnsName string, certTitle string, extraDNSNames ...string) (string, string, error) {
 	var log = logf.Log.WithName("controller_codewind_tlsutils.go")
 
 	template := x509.Certificate{
@@ -39,11 +93,22 @@ func GenerateCertificate(dnsName string, certTitle string) (string, string, erro
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
-		DNSNames:              []string{dnsName},
+		DNSNames:              append([]string{dnsName}, extraDNSNames...),
+	}
+
+	keySize := 2048
+	if FIPSMode {
+		keySize = fipsRSAKeySize
+		template.SignatureAlgorithm = x509.SHA256WithRSA
+		serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+		if err != nil {
+			return "", "", err
+		}
+		template.SerialNumber = serialNumber
 	}
 
 	log.Info("Creating " + dnsName + " server Key")
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
 	if err != nil {
 		return "", "", err
 	}
@@ -0,0 +1,97 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VersionCatalogKey : Operator config map key holding versions added to the built in version catalog
+const VersionCatalogKey = "versionCatalog"
+
+// VersionImages : Image tags of the components tested together as one Codewind version
+type VersionImages struct {
+	PFE         string `json:"pfe"`
+	Performance string `json:"performance"`
+	Gatekeeper  string `json:"gatekeeper"`
+	Keycloak    string `json:"keycloak"`
+
+	// Architectures : architectures the images of the version are published for, not checked when empty
+	Architectures []string `json:"architectures,omitempty"`
+}
+
+// releasedArchitectures : Architectures of the released Codewind images
+var releasedArchitectures = []string{"amd64", "ppc64le", "s390x"}
+
+// versionCatalog : Versions released and tested with this operator
+var versionCatalog = map[string]VersionImages{
+	"0.12.0": {PFE: "0.12.0", Performance: "0.12.0", Gatekeeper: "0.12.0", Keycloak: "0.12.0", Architectures: releasedArchitectures},
+	"0.13.0": {PFE: "0.13.0", Performance: "0.13.0", Gatekeeper: "0.13.0", Keycloak: "0.13.0", Architectures: releasedArchitectures},
+	"0.14.0": {PFE: "0.14.0", Performance: "0.14.0", Gatekeeper: "0.14.0", Keycloak: "0.14.0", Architectures: releasedArchitectures},
+}
+
+// VersionCatalog : Returns the built in version catalog with the versions of the JSON object of the
+// versionCatalog key, for example '{"0.15.0":{"pfe":"0.15.0","performance":"0.15.0","gatekeeper":"0.15.0","keycloak":"0.15.0","architectures":["amd64","s390x"]}}'.
+// A version of the config map replaces the built in version of the same name. On error the built in catalog is returned with the error
+func VersionCatalog(data map[string]string) (map[string]VersionImages, error) {
+	catalog := make(map[string]VersionImages, len(versionCatalog))
+	for version, images := range versionCatalog {
+		catalog[version] = images
+	}
+	value := data[VersionCatalogKey]
+	if value == "" {
+		return catalog, nil
+	}
+	added := map[string]VersionImages{}
+	if err := json.Unmarshal([]byte(value), &added); err != nil {
+		return catalog, fmt.Errorf("operator config map key %s is not a valid JSON object of versions: %v", VersionCatalogKey, err)
+	}
+	for version, images := range added {
+		if images.PFE == "" || images.Performance == "" || images.Gatekeeper == "" || images.Keycloak == "" {
+			return catalog, fmt.Errorf("operator config map key %s: version %s must set the pfe, performance, gatekeeper and keycloak tags", VersionCatalogKey, version)
+		}
+		for _, architecture := range images.Architectures {
+			if !contains(KnownArchitectures, architecture) {
+				return catalog, fmt.Errorf("operator config map key %s: version %s lists unknown architecture %s, known architectures are %s",
+					VersionCatalogKey, version, architecture, strings.Join(KnownArchitectures, ", "))
+			}
+		}
+	}
+	for version, images := range added {
+		catalog[version] = images
+	}
+	return catalog, nil
+}
+
+// LookupVersion : Image tags of a version of the catalog, an error naming the known versions when it is not in the catalog
+func LookupVersion(data map[string]string, version string) (VersionImages, error) {
+	// An invalid config map entry leaves the built in versions usable
+	catalog, _ := VersionCatalog(data)
+	images, ok := catalog[version]
+	if !ok {
+		return VersionImages{}, fmt.Errorf("version %s is not in the version catalog, known versions are %s", version, strings.Join(KnownVersions(catalog), ", "))
+	}
+	return images, nil
+}
+
+// KnownVersions : Sorted versions of a catalog
+func KnownVersions(catalog map[string]VersionImages) []string {
+	versions := make([]string, 0, len(catalog))
+	for version := range catalog {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
@@ -0,0 +1,74 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+
+package util
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// VolumeSnapshotGVK : CSI VolumeSnapshot resource, managed as unstructured so the snapshot CRDs stay optional
+var VolumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1beta1", Kind: "VolumeSnapshot"}
+
+// DetectVolumeSnapshots : Reports whether the VolumeSnapshot resource is served by the cluster
+func DetectVolumeSnapshots() (bool, error) {
+	apiGroups, err := getAPIList()
+	if err != nil {
+		return false, err
+	}
+	for _, apiGroup := range apiGroups {
+		if apiGroup.Name == VolumeSnapshotGVK.Group {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NewVolumeSnapshot : Builds a VolumeSnapshot of a PVC, taken with the default snapshot class of its CSI driver when
+// no class is named
+func NewVolumeSnapshot(name string, namespace string, labels map[string]string, pvcName string, snapshotClassName string) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": pvcName},
+	}
+	if snapshotClassName != "" {
+		spec["volumeSnapshotClassName"] = snapshotClassName
+	}
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	snapshot.SetName(name)
+	snapshot.SetNamespace(namespace)
+	snapshot.SetLabels(labels)
+	snapshot.Object["spec"] = spec
+	return snapshot
+}
+
+// ListVolumeSnapshots : Lists the VolumeSnapshots of a namespace carrying the labels, oldest first
+func ListVolumeSnapshots(c client.Client, namespace string, labels map[string]string) ([]unstructured.Unstructured, error) {
+	snapshots := &unstructured.UnstructuredList{}
+	snapshots.SetGroupVersionKind(VolumeSnapshotGVK.GroupVersion().WithKind(VolumeSnapshotGVK.Kind + "List"))
+	err := c.List(context.TODO(), snapshots, client.InNamespace(namespace), client.MatchingLabels(labels))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots.Items, func(i, j int) bool {
+		created, otherCreated := snapshots.Items[i].GetCreationTimestamp(), snapshots.Items[j].GetCreationTimestamp()
+		if created.Equal(&otherCreated) {
+			return snapshots.Items[i].GetName() < snapshots.Items[j].GetName()
+		}
+		return created.Before(&otherCreated)
+	})
+	return snapshots.Items, nil
+}
@@ -0,0 +1,166 @@
+/*******************************************************************************
+ * Copyright (c) 2020 IBM Corporation and others.
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v2.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v20.html
+ *
+ * Contributors:
+ *     IBM Corporation - initial API and implementation
+ *******************************************************************************/
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	codewindv1alpha1 "github.com/eclipse/codewind-operator/pkg/apis/codewind/v1alpha1"
+	defaults "github.com/eclipse/codewind-operator/pkg/controller/defaults"
+	"github.com/eclipse/codewind-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	crwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// CodewindDefaultingPath : path of the Codewind defaulting webhook
+	CodewindDefaultingPath = "/mutate-codewind-eclipse-org-v1alpha1-codewind"
+
+	// KeycloakDefaultingPath : path of the Keycloak defaulting webhook
+	KeycloakDefaultingPath = "/mutate-codewind-eclipse-org-v1alpha1-keycloak"
+)
+
+// AddDefaultersToManager : registers the defaulting webhooks with the manager webhook server
+func AddDefaultersToManager(mgr manager.Manager) error {
+	server := mgr.GetWebhookServer()
+	server.Register(CodewindDefaultingPath, &crwebhook.Admission{Handler: &codewindDefaulter{reader: mgr.GetAPIReader()}})
+	server.Register(KeycloakDefaultingPath, &crwebhook.Admission{Handler: &keycloakDefaulter{reader: mgr.GetAPIReader()}})
+	return nil
+}
+
+// codewindDefaulter : writes the effective ingress domain, storage size, log level, architecture and image tag onto
+// Codewind CRs, and rejects versions missing from the version catalog or without images for the architecture
+type codewindDefaulter struct {
+	reader  client.Reader
+	decoder *admission.Decoder
+}
+
+// Handle : fills in the fields the CR leaves empty, fields already set are never changed
+func (d *codewindDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	codewind := &codewindv1alpha1.Codewind{}
+	if err := d.decoder.Decode(req, codewind); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	operatorConfig, err := readOperatorConfig(ctx, d.reader, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	setDefault(&codewind.Spec.IngressDomain, operatorConfig["ingressDomain"])
+	setDefault(&codewind.Spec.StorageSize, operatorConfig["storageCodewindSize"])
+	setDefault(&codewind.Spec.LogLevel, defaults.CodewindLogLevel)
+	setDefault(&codewind.Spec.Architecture, util.SelectArchitecture("", operatorConfig))
+	if codewind.Spec.Version != "" {
+		images, err := util.LookupVersion(operatorConfig, codewind.Spec.Version)
+		if err == nil {
+			err = util.CheckArchitecture(codewind.Spec.Version, images, codewind.Spec.Architecture)
+		}
+		if err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	// Images of the operator config map carry their own tag, which imageTag would override. A version selects the tags
+	if codewind.Spec.Version == "" && !hasOperatorImage(operatorConfig, "imagePFE", "imagePerformance", "imageGatekeeper") {
+		setDefault(&codewind.Spec.ImageTag, defaults.CodewindImageTag)
+	}
+	return patchResponse(req, codewind)
+}
+
+// InjectDecoder : called by the webhook server
+func (d *codewindDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// keycloakDefaulter : writes the effective ingress domain, storage size, architecture and image tag onto Keycloak CRs,
+// and rejects versions missing from the version catalog or without images for the architecture
+type keycloakDefaulter struct {
+	reader  client.Reader
+	decoder *admission.Decoder
+}
+
+// Handle : fills in the fields the CR leaves empty, fields already set are never changed
+func (d *keycloakDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	keycloak := &codewindv1alpha1.Keycloak{}
+	if err := d.decoder.Decode(req, keycloak); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	operatorConfig, err := readOperatorConfig(ctx, d.reader, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	setDefault(&keycloak.Spec.IngressDomain, operatorConfig["ingressDomain"])
+	setDefault(&keycloak.Spec.StorageSize, operatorConfig["storageKeycloakSize"])
+	setDefault(&keycloak.Spec.Architecture, util.SelectArchitecture("", operatorConfig))
+	if keycloak.Spec.Version != "" {
+		images, err := util.LookupVersion(operatorConfig, keycloak.Spec.Version)
+		if err == nil {
+			err = util.CheckArchitecture(keycloak.Spec.Version, images, keycloak.Spec.Architecture)
+		}
+		if err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	if keycloak.Spec.Version == "" && !hasOperatorImage(operatorConfig, "imageKeycloak") {
+		setDefault(&keycloak.Spec.ImageTag, defaults.KeycloakImageTag)
+	}
+	return patchResponse(req, keycloak)
+}
+
+// InjectDecoder : called by the webhook server
+func (d *keycloakDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// hasOperatorImage : true when the operator config map sets one of the image keys
+func hasOperatorImage(operatorConfig map[string]string, keys ...string) bool {
+	for _, key := range keys {
+		if operatorConfig[key] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// readOperatorConfig : reads the operator config map directly from the API server, it may be outside the watched namespaces.
+// Returns the defaults of the namespace of the CR
+func readOperatorConfig(ctx context.Context, reader client.Reader, namespace string) (map[string]string, error) {
+	operatorConfigMap := &corev1.ConfigMap{}
+	err := reader.Get(ctx, types.NamespacedName{Name: defaults.OperatorConfigMapName, Namespace: util.GetOperatorNamespace()}, operatorConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	// Invalid namespace defaults are reported by the controllers, the cluster defaults apply meanwhile
+	namespaceConfig, _ := util.OperatorConfigForNamespace(operatorConfigMap.Data, namespace)
+	return namespaceConfig, nil
+}
+
+// setDefault : sets field to value when the field is empty
+func setDefault(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// patchResponse : returns the JSON patch turning the request object into obj
+func patchResponse(req admission.Request, obj interface{}) admission.Response {
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}